@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	awscfg "github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/config"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	userinfra "github.com/buzzryan/zenbu/internal/user/infra"
+)
+
+// admin grants the admin role to a user, so that the first operator can use the admin APIs.
+// e.g. go run cmd/admin/main.go -username alice
+func main() {
+	username := flag.String("username", "", "username of the user to grant the admin role")
+	flag.Parse()
+	if *username == "" {
+		log.Fatal("-username is required")
+	}
+
+	ctx := context.Background()
+	cfg := config.LoadConfigFromEnv()
+	awsCfg, err := awscfg.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Panicf("failed to load AWS config: %v", err)
+	}
+	ddb := nosqlutil.ConnectDDB(awsCfg, cfg.DynamoConfig)
+	userRepo := userinfra.NewDynamoUserRepo(ddb, cfg.TableName)
+
+	u, err := userRepo.GetByName(ctx, *username)
+	if err != nil {
+		log.Panicf("failed to get user: %v", err)
+	}
+
+	prevUpdatedAt := u.UpdatedAt
+	u.GrantRole(domain.RoleAdmin)
+	if err := userRepo.Update(ctx, u, prevUpdatedAt); err != nil {
+		log.Panicf("failed to update user: %v", err)
+	}
+	log.Printf("granted %s role to %s (%s)\n", domain.RoleAdmin, u.Username, u.ID)
+}
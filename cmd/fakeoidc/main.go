@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/oidcutil"
+)
+
+// fakeoidc serves a fake OpenID provider for local development, which signs in anyone without asking.
+// Configure it as a provider of zenbu with the same issuer, client ID and client secret.
+func main() {
+	addr := flag.String("addr", "localhost:9000", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL the provider is reached at")
+	clientID := flag.String("client-id", "zenbu", "client ID of zenbu")
+	clientSecret := flag.String("client-secret", "", "client secret of zenbu")
+	subject := flag.String("subject", "fake-user", "subject of the signed in user")
+	email := flag.String("email", "fake-user@example.com", "verified email address of the signed in user")
+	flag.Parse()
+
+	provider, err := oidcutil.NewFakeProvider(*clientID, *clientSecret)
+	if err != nil {
+		log.Fatalf("failed to create fake provider: %v", err)
+	}
+	provider.Issuer = *issuer
+	provider.SetIdentity(oidcutil.FakeIdentity{Subject: *subject, Email: *email, EmailVerified: true})
+
+	log.Printf("fake OpenID provider %s listening on %s", *issuer, *addr)
+	if err := http.ListenAndServe(*addr, provider); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/jwkutil"
+)
+
+// jwskey generates a private key for signing JWS tokens.
+// The PEM encoded key is written to stdout and its key ID to stderr.
+func main() {
+	alg := flag.String("alg", "ES256", "signing algorithm: ES256, EdDSA or RS256")
+	flag.Parse()
+
+	var (
+		priv crypto.Signer
+		err  error
+	)
+	switch *alg {
+	case "ES256":
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	case "RS256":
+		priv, err = rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		log.Fatalf("unsupported algorithm: %s", *alg)
+	}
+	if err != nil {
+		log.Fatalf("failed to generate key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		log.Fatalf("failed to marshal key: %v", err)
+	}
+	if err := pem.Encode(os.Stdout, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		log.Fatalf("failed to write key: %v", err)
+	}
+
+	jwk, err := jwkutil.FromPublicKey(priv.Public())
+	if err != nil {
+		log.Fatalf("failed to convert key to JWK: %v", err)
+	}
+	kid, err := jwk.Thumbprint()
+	if err != nil {
+		log.Fatalf("failed to compute key ID: %v", err)
+	}
+	log.Printf("kid: %s", kid)
+}
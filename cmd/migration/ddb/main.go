@@ -24,6 +24,11 @@ func main() {
 		log.Panicf("failed to create table: %v", err)
 	}
 
+	err = ddb.Table(cfg.TableName).UpdateTTL(nosqlutil.TTLAttribute, true).Run(ctx)
+	if err != nil {
+		log.Panicf("failed to enable TTL: %v", err)
+	}
+
 	tables, err := ddb.ListTables().All(ctx)
 	if err != nil {
 		log.Panicf("failed to list tables: %v", err)
@@ -3,22 +3,32 @@ package main
 import (
 	"context"
 	"errors"
+	"expvar"
 	"log"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
 	awscfg "github.com/aws/aws-sdk-go-v2/config"
 
+	"github.com/buzzryan/zenbu/internal/commonutil/cryptoutil"
 	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
 	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/mailutil"
 	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/oidcutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/poolutil"
 	"github.com/buzzryan/zenbu/internal/commonutil/storageutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/webauthnutil"
 	"github.com/buzzryan/zenbu/internal/config"
 	userctrl "github.com/buzzryan/zenbu/internal/user/controller"
+	userdomain "github.com/buzzryan/zenbu/internal/user/domain"
 	userinfra "github.com/buzzryan/zenbu/internal/user/infra"
 )
 
@@ -35,19 +45,129 @@ func main() {
 	ddb := nosqlutil.ConnectDDB(awsCfg, cfg.DynamoConfig)
 	slog.Info("dynamoDB connected")
 
+	if cfg.PasswordHashAlgorithm != "" {
+		if err := userdomain.SetPasswordHashAlgorithm(cfg.PasswordHashAlgorithm); err != nil {
+			log.Panicf("failed to set password hash algorithm: %v", err)
+		}
+	}
+
+	if err := httputil.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Panicf("failed to set trusted proxies: %v", err)
+	}
+
+	concurrency := cfg.PasswordHashingConcurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	queueSize := cfg.PasswordHashingQueueSize
+	if queueSize <= 0 {
+		queueSize = 4 * concurrency
+	}
+	passwordHashingPool := poolutil.NewPool(concurrency, queueSize)
+	passwordHashingPool.Publish("password_hashing")
+	userdomain.SetPasswordHashingPool(passwordHashingPool)
+
 	storage := storageutil.NewS3Storage(awsCfg, cfg.S3Config)
+	mailer := mailutil.NewFileMailer(cfg.MailDir, cfg.MailFrom)
+	if cfg.Mailer == "smtp" {
+		mailer = mailutil.NewSMTPMailer(cfg.MailConfig)
+	}
 
 	mux := http.NewServeMux()
 
 	userRepo := userinfra.NewDynamoUserRepo(ddb, cfg.TableName)
-	tokenManager := userinfra.NewJWSTokenManager(cfg.JWSSigningKey)
+	sessionRepo := userinfra.NewDynamoSessionRepo(ddb, cfg.TableName)
+	revocationRepo := userinfra.NewCachedRevocationRepo(userinfra.NewDynamoRevocationRepo(ddb, cfg.TableName))
+	loginAttemptRepo := userinfra.NewDynamoLoginAttemptRepo(ddb, cfg.TableName)
+	if cfg.LoginAttemptStore == "memory" {
+		loginAttemptRepo = userinfra.NewMemoryLoginAttemptRepo()
+	}
+	emailVerificationRepo := userinfra.NewDynamoEmailVerificationRepo(ddb, cfg.TableName)
+	passwordResetRepo := userinfra.NewDynamoPasswordResetRepo(ddb, cfg.TableName)
+	magicLinkRepo := userinfra.NewDynamoMagicLinkRepo(ddb, cfg.TableName)
+	mfaCipher, err := cryptoutil.NewCipherFromBase64(cfg.MFAEncryptionKeys...)
+	if err != nil {
+		log.Panicf("failed to load MFA encryption keys: %v", err)
+	}
+	mfaRepo := userinfra.NewDynamoMFARepo(ddb, cfg.TableName, mfaCipher)
+	mfaChallengeRepo := userinfra.NewDynamoMFAChallengeRepo(ddb, cfg.TableName)
+	mfaIssuer := cfg.MFAIssuer
+	if mfaIssuer == "" {
+		mfaIssuer = "zenbu"
+	}
+	passkeyRepo := userinfra.NewDynamoPasskeyRepo(ddb, cfg.TableName)
+	webAuthnCeremonyRepo := userinfra.NewDynamoWebAuthnCeremonyRepo(ddb, cfg.TableName)
+	relyingParty, rpName, err := loadRelyingParty(cfg)
+	if err != nil {
+		log.Panicf("failed to load WebAuthn relying party: %v", err)
+	}
+	identityRepo := userinfra.NewDynamoIdentityRepo(ddb, cfg.TableName)
+	oidcAuthRequestRepo := userinfra.NewDynamoOIDCAuthRequestRepo(ddb, cfg.TableName)
+	oidcProviders := loadOIDCProviders(cfg)
+	oauthClientRepo := userinfra.NewDynamoOAuthClientRepo(ddb, cfg.TableName)
+	consentRepo := userinfra.NewDynamoConsentRepo(ddb, cfg.TableName)
+	authorizationCodeRepo := userinfra.NewDynamoAuthorizationCodeRepo(ddb, cfg.TableName)
+	apiKeyRepo := userinfra.NewDynamoAPIKeyRepo(ddb, cfg.TableName)
+	dpopReplayRepo := userinfra.NewDynamoDPoPReplayRepo(ddb, cfg.TableName)
+	oauthIssuer := cfg.OAuthIssuer
+	if oauthIssuer == "" {
+		oauthIssuer = "http://localhost:8080"
+	}
+	keyring, err := userinfra.LoadKeyring(cfg.JWSConfig)
+	if err != nil {
+		log.Panicf("failed to load JWS keys: %v", err)
+	}
+	tokenManager := userinfra.NewJWSTokenManager(keyring)
+	auditEventRepo := userinfra.NewDynamoAuditEventRepo(ddb, cfg.TableName)
+	// events are stored in DynamoDB to be queried, and appended to the file as well if any.
+	auditLog := userinfra.NewMultiAuditLog(auditEventRepo)
+	if cfg.AuditLogFile != "" {
+		auditLog = userinfra.NewMultiAuditLog(auditEventRepo, userinfra.NewFileAuditLog(cfg.AuditLogFile))
+	}
 	userctrl.Init(&userctrl.InitOpts{
-		Mux:          mux,
-		UserRepo:     userRepo,
-		TokenManager: tokenManager,
-		Storage:      storage,
+		Mux:                   mux,
+		UserRepo:              userRepo,
+		SessionRepo:           sessionRepo,
+		RevocationRepo:        revocationRepo,
+		LoginAttemptRepo:      loginAttemptRepo,
+		EmailVerificationRepo: emailVerificationRepo,
+		PasswordResetRepo:     passwordResetRepo,
+		MagicLinkRepo:         magicLinkRepo,
+		MFARepo:               mfaRepo,
+		MFAChallengeRepo:      mfaChallengeRepo,
+		PasskeyRepo:           passkeyRepo,
+		WebAuthnCeremonyRepo:  webAuthnCeremonyRepo,
+		IdentityRepo:          identityRepo,
+		OIDCAuthRequestRepo:   oidcAuthRequestRepo,
+		OAuthClientRepo:       oauthClientRepo,
+		ConsentRepo:           consentRepo,
+		AuthorizationCodeRepo: authorizationCodeRepo,
+		APIKeyRepo:            apiKeyRepo,
+		DPoPReplayRepo:        dpopReplayRepo,
+		TokenManager:          tokenManager,
+		AuditLog:              auditLog,
+		AuditEventRepo:        auditEventRepo,
+		Storage:               storage,
+		Mailer:                mailer,
+		AppBaseURL:            cfg.AppBaseURL,
+		MFAIssuer:             mfaIssuer,
+		RelyingParty:          relyingParty,
+		RPName:                rpName,
+		OIDCProviders:         oidcProviders,
+		OAuthIssuer:           oauthIssuer,
 	})
 
+	if cfg.MetricsAddr != "" {
+		go func() {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("GET /debug/vars", expvar.Handler())
+			slog.Info("http: metrics server start", slog.String("addr", cfg.MetricsAddr))
+			if err := http.ListenAndServe(cfg.MetricsAddr, metricsMux); err != nil {
+				slog.Error("http: metrics server error", slog.Any("err", err))
+			}
+		}()
+	}
+
 	server := &http.Server{
 		Addr:    ":8080",
 		Handler: httputil.WithGlobalMiddlewares(mux),
@@ -74,3 +194,53 @@ func main() {
 	}
 	slog.Info("http: server down")
 }
+
+// loadRelyingParty configures WebAuthn for the web app, defaulting to the domain and origin of AppBaseURL.
+func loadRelyingParty(cfg config.Config) (*webauthnutil.RelyingParty, string, error) {
+	rp := &webauthnutil.RelyingParty{
+		ID:                      cfg.WebAuthnRPID,
+		Origins:                 cfg.WebAuthnOrigins,
+		RequireUserVerification: true,
+	}
+	if rp.ID == "" || len(rp.Origins) == 0 {
+		appURL, err := url.Parse(cfg.AppBaseURL)
+		if err != nil || appURL.Host == "" {
+			return nil, "", errors.New("WEBAUTHN_RP_ID and WEBAUTHN_ORIGINS are required if APP_BASE_URL is not a URL")
+		}
+		if rp.ID == "" {
+			rp.ID = appURL.Hostname()
+		}
+		if len(rp.Origins) == 0 {
+			rp.Origins = []string{appURL.Scheme + "://" + appURL.Host}
+		}
+	}
+
+	rpName := cfg.WebAuthnRPName
+	if rpName == "" {
+		rpName = "zenbu"
+	}
+	return rp, rpName, nil
+}
+
+// loadOIDCProviders configures the OpenID providers. They are discovered on first use,
+// so that a provider being down doesn't stop the server from starting.
+func loadOIDCProviders(cfg config.Config) map[string]*oidcutil.Provider {
+	redirectURL := cfg.OIDCRedirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimSuffix(cfg.AppBaseURL, "/") + "/oidc/callback"
+	}
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+
+	providers := make(map[string]*oidcutil.Provider, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		providers[p.Name] = &oidcutil.Provider{
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       p.Scopes,
+			HTTPClient:   httpClient,
+		}
+	}
+	return providers
+}
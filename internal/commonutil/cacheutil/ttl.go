@@ -0,0 +1,87 @@
+package cacheutil
+
+import (
+	"sync"
+	"time"
+)
+
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// TTLCache is an in-memory cache whose entries expire after their own TTL. It is safe for concurrent use.
+// When the cache is full, expired entries are swept first and then arbitrary entries are evicted.
+type TTLCache[K comparable, V any] struct {
+	mu         sync.Mutex
+	entries    map[K]entry[V]
+	maxEntries int
+}
+
+func NewTTLCache[K comparable, V any](maxEntries int) *TTLCache[K, V] {
+	return &TTLCache[K, V]{entries: make(map[K]entry[V]), maxEntries: maxEntries}
+}
+
+// Get returns the value of the key if it exists and is not expired.
+func (c *TTLCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || !time.Now().Before(e.expiresAt) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Set stores the value for the given TTL, replacing the previous value if any.
+func (c *TTLCache[K, V]) Set(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(key, value, ttl)
+}
+
+// SetIfAbsent stores the value only if the key doesn't exist or is expired.
+// It reports whether the value was stored.
+func (c *TTLCache[K, V]) SetIfAbsent(key K, value V, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok && time.Now().Before(e.expiresAt) {
+		return false
+	}
+	c.set(key, value, ttl)
+	return true
+}
+
+func (c *TTLCache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+func (c *TTLCache[K, V]) set(key K, value V, ttl time.Duration) {
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+	c.entries[key] = entry[V]{value: value, expiresAt: time.Now().Add(ttl)}
+}
+
+// evict must be called with the lock held.
+func (c *TTLCache[K, V]) evict() {
+	now := time.Now()
+	for k, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+	for k := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			return
+		}
+		delete(c.entries, k)
+	}
+}
@@ -0,0 +1,87 @@
+package cryptoutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the size of keys in bytes. (AES-256)
+const KeySize = 32
+
+var (
+	ErrInvalidKey        = errors.New("invalid encryption key")
+	ErrDecryptionFailure = errors.New("failed to decrypt")
+)
+
+// Cipher encrypts small secrets at rest with AES-256-GCM.
+// It encrypts with the first key and decrypts with any of the keys, so that keys can be rotated:
+// a new key is put first, and the old one is kept until every secret is encrypted again.
+type Cipher struct {
+	aeads []cipher.AEAD
+}
+
+func NewCipher(keys ...[]byte) (*Cipher, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no key", ErrInvalidKey)
+	}
+
+	c := &Cipher{}
+	for _, key := range keys {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("%w: key must be %d bytes", ErrInvalidKey, KeySize)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.aeads = append(c.aeads, aead)
+	}
+	return c, nil
+}
+
+// NewCipherFromBase64 creates a Cipher from base64 (standard encoding) keys, as given in configurations.
+func NewCipherFromBase64(keys ...string) (*Cipher, error) {
+	decoded := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		b, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+		decoded = append(decoded, b)
+	}
+	return NewCipher(decoded...)
+}
+
+// Encrypt encrypts the plaintext with a random nonce prepended to the ciphertext.
+// additionalData is authenticated but not encrypted. It binds the ciphertext to its context, e.g. the owner,
+// so that it can't be moved to another context.
+func (c *Cipher) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	aead := c.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Decrypt decrypts the ciphertext encrypted by Encrypt with the same additionalData.
+func (c *Cipher) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	for _, aead := range c.aeads {
+		if len(ciphertext) < aead.NonceSize() {
+			return nil, ErrDecryptionFailure
+		}
+		nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+		if plaintext, err := aead.Open(nil, nonce, sealed, additionalData); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, ErrDecryptionFailure
+}
@@ -0,0 +1,153 @@
+package dpoputil
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/jwkutil"
+)
+
+const (
+	// Header carries the proof in requests. (RFC 9449 Section 4.1)
+	Header = "DPoP"
+	// Scheme is the authorization scheme of access tokens bound to a key, and their token_type. (RFC 9449 Section 7.1)
+	Scheme = "DPoP"
+
+	proofType = "dpop+jwt"
+
+	// ProofLifetime is how long a proof is accepted after it is issued. Proofs are made for each request,
+	// so it only needs to cover the latency and the clock skew of clients.
+	ProofLifetime = time.Minute
+	// clockSkew tolerates clocks of clients running ahead of ours.
+	clockSkew = 5 * time.Second
+)
+
+var ErrInvalidProof = errors.New("invalid dpop proof")
+
+// SigningAlgs are the algorithms proofs may be signed with, given in dpop_signing_alg_values_supported.
+var SigningAlgs = []string{"ES256", "EdDSA", "RS256", "PS256"}
+
+var b64 = base64.RawURLEncoding
+
+// Proof is a DPoP proof JWT, which proves that the client holds the private key of the public key in it.
+type Proof struct {
+	// ID is unique to each proof, so that a proof can be used only once.
+	ID       string
+	Method   string
+	URL      string
+	IssuedAt time.Time
+	// AccessTokenHash is given when the proof is sent with an access token.
+	AccessTokenHash string
+	// Thumbprint identifies the public key of the proof. (RFC 7638) Tokens are bound to it as cnf.jkt.
+	Thumbprint string
+}
+
+type proofClaims struct {
+	jwt.RegisteredClaims
+	Method          string `json:"htm"`
+	URL             string `json:"htu"`
+	AccessTokenHash string `json:"ath,omitempty"`
+}
+
+// Parse verifies the signature of the proof by the public key in its header. (RFC 9449 Section 4.3)
+// The proof still has to be verified for the request by Verify.
+func Parse(proof string) (*Proof, error) {
+	var key *jwkutil.JWK
+	var claims proofClaims
+	_, err := jwt.ParseWithClaims(proof, &claims,
+		func(t *jwt.Token) (any, error) {
+			if typ, _ := t.Header["typ"].(string); typ != proofType {
+				return nil, errors.New("typ is not dpop+jwt")
+			}
+			raw, ok := t.Header["jwk"].(map[string]any)
+			if !ok {
+				return nil, errors.New("jwk is missing")
+			}
+			// a private key must never be sent.
+			if _, ok := raw["d"]; ok {
+				return nil, errors.New("jwk is a private key")
+			}
+			b, err := json.Marshal(raw)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(b, &key); err != nil {
+				return nil, fmt.Errorf("malformed jwk: %w", err)
+			}
+			return key.PublicKey()
+		},
+		jwt.WithValidMethods(SigningAlgs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProof, err)
+	}
+
+	if claims.ID == "" || claims.Method == "" || claims.URL == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: jti, htm, htu and iat are required", ErrInvalidProof)
+	}
+	thumbprint, err := key.Thumbprint()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidProof, err)
+	}
+
+	return &Proof{
+		ID:              claims.ID,
+		Method:          claims.Method,
+		URL:             claims.URL,
+		IssuedAt:        claims.IssuedAt.Time,
+		AccessTokenHash: claims.AccessTokenHash,
+		Thumbprint:      thumbprint,
+	}, nil
+}
+
+// Verify checks that the proof was made for the request, and recently.
+// If the proof is sent with an access token, it must be bound to the token by its hash.
+func (p *Proof) Verify(method, requestURL, accessToken string, now time.Time) error {
+	if p.Method != method {
+		return fmt.Errorf("%w: htm does not match the request", ErrInvalidProof)
+	}
+	if normalizeURL(p.URL) != normalizeURL(requestURL) {
+		return fmt.Errorf("%w: htu does not match the request", ErrInvalidProof)
+	}
+	if p.IssuedAt.After(now.Add(clockSkew)) || !now.Before(p.ExpiresAt()) {
+		return fmt.Errorf("%w: iat is out of the acceptable window", ErrInvalidProof)
+	}
+	if accessToken != "" &&
+		subtle.ConstantTimeCompare([]byte(p.AccessTokenHash), []byte(AccessTokenHash(accessToken))) != 1 {
+		return fmt.Errorf("%w: ath does not match the access token", ErrInvalidProof)
+	}
+	return nil
+}
+
+// ExpiresAt is when the proof is no longer accepted. Its ID must be remembered until then to detect replays.
+func (p *Proof) ExpiresAt() time.Time {
+	return p.IssuedAt.Add(ProofLifetime)
+}
+
+// AccessTokenHash returns the ath of proofs sent with the access token.
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return b64.EncodeToString(sum[:])
+}
+
+// normalizeURL drops the query and the fragment, which are not compared. (RFC 9449 Section 4.3)
+func normalizeURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
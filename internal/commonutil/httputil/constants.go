@@ -7,6 +7,10 @@ const (
 	ContentType   = "Content-Type"
 	CorrelationID = "Correlation-Id"
 	Authorization = "Authorization"
+	CacheControl  = "Cache-Control"
+	UserAgent     = "User-Agent"
+	XForwardedFor = "X-Forwarded-For"
+	RetryAfter    = "Retry-After"
 )
 
 const (
@@ -27,6 +31,8 @@ const (
 	CodeInvalidJSONBody      = 1002
 	CodeUnauthenticated      = 1003
 	CodeTokenExpired         = 1004
+	CodePermissionDenied     = 1005 // Authenticated, but not allowed to access the resource
+	CodeServiceUnavailable   = 1006 // Overloaded. Retry after the time in Retry-After header
 )
 
 /* Common Errors */
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 
@@ -68,6 +70,12 @@ func ResponseJSON(w http.ResponseWriter, code int, v interface{}) error {
 	return nil
 }
 
+// ResponseNoContent is a helper function to response 204 No Content.
+func ResponseNoContent(w http.ResponseWriter) error {
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 // errorResponse is unified DTO for handling error
 type errorResponse struct {
 	ErrorMessage string `json:"error_message"`
@@ -85,9 +93,19 @@ func ResponseError(w http.ResponseWriter, statusCode, errCode int, errMsg string
 // In most cases, HandlerFuncWithErr should handle error, response to client and not return error.
 type HandlerFuncWithErr func(w http.ResponseWriter, r *http.Request) error
 
+// Middleware wraps HandlerFuncWithErr of a single route. e.g. authentication
+type Middleware func(next HandlerFuncWithErr) HandlerFuncWithErr
+
 // RegisterHandler is a helper function to register handler with error handling.
 // It covers error such as fail to write response, etc.
-func RegisterHandler(mux *http.ServeMux, method string, pattern string, handler HandlerFuncWithErr) {
+// Middlewares are applied in the given order, so the first one runs first.
+func RegisterHandler(
+	mux *http.ServeMux, method string, pattern string, handler HandlerFuncWithErr, middlewares ...Middleware,
+) {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
 	mux.HandleFunc(method+" "+pattern, func(w http.ResponseWriter, r *http.Request) {
 		if err := handler(w, r); err != nil {
 			logutil.From(r.Context()).Error("failed to handle request", slog.Any("err", err))
@@ -99,15 +117,91 @@ func RegisterHandler(mux *http.ServeMux, method string, pattern string, handler
 // GetBearerToken is a helper function to get bearer token from Authorization header.
 // If Authorization header is not found or invalid, it returns error.
 func GetBearerToken(req *http.Request) (string, error) {
+	scheme, token, err := GetAuthorization(req)
+	if err != nil {
+		return "", err
+	}
+	if scheme != Bearer {
+		return "", errors.New("invalid bearer authorization header")
+	}
+	return token, nil
+}
+
+// GetAuthorization returns the scheme and the credentials of Authorization header, e.g. for schemes other than Bearer.
+// If Authorization header is not found or invalid, it returns error.
+func GetAuthorization(req *http.Request) (scheme, credentials string, err error) {
 	authHeader := req.Header.Get(Authorization)
 	if authHeader == "" {
-		return "", errors.New("authorization header not found")
+		return "", "", errors.New("authorization header not found")
 	}
 
 	authParts := strings.Split(authHeader, " ")
-	if len(authParts) != 2 || authParts[0] != Bearer {
-		return "", errors.New("invalid bearer authorization header")
+	if len(authParts) != 2 || authParts[1] == "" {
+		return "", "", errors.New("invalid authorization header")
+	}
+
+	return authParts[0], authParts[1], nil
+}
+
+// trustedProxies are the networks of proxies whose X-Forwarded-For is trusted. None by default.
+var trustedProxies []netip.Prefix
+
+// SetTrustedProxies sets the proxies, e.g. load balancers, whose X-Forwarded-For is trusted by ClientIP.
+// Each of them is an IP address or a CIDR. It must be called before serving requests.
+func SetTrustedProxies(proxies []string) error {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
 	}
+	trustedProxies = prefixes
+	return nil
+}
 
-	return authParts[1], nil
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client, which is the peer of the connection by default.
+// X-Forwarded-For is honored only if the peer is a trusted proxy, as anyone else can forge it.
+// Then, the addresses are walked from the last one, appended by the nearest proxy, to the first untrusted one,
+// since those before it may have been forged by the client.
+func ClientIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+
+	addrs := strings.Split(strings.Join(req.Header.Values(XForwardedFor), ","), ",")
+	for i := len(addrs) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(addrs[i])
+		if addr == "" {
+			continue
+		}
+		ip = addr
+		if !isTrustedProxy(ip) {
+			break
+		}
+	}
+	return ip
 }
@@ -0,0 +1,75 @@
+package httputil
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   []string
+		want           string
+	}{
+		{
+			name:         "forwarded for is ignored without trusted proxies",
+			remoteAddr:   "203.0.113.7:51234",
+			forwardedFor: []string{"198.51.100.1"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:           "forwarded for is ignored from untrusted peers",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "203.0.113.7:51234",
+			forwardedFor:   []string{"198.51.100.1"},
+			want:           "203.0.113.7",
+		},
+		{
+			name:           "the address appended by the trusted proxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.1.2.3:51234",
+			forwardedFor:   []string{"198.51.100.1, 203.0.113.7"},
+			want:           "203.0.113.7",
+		},
+		{
+			name:           "trusted proxies in the chain are skipped",
+			trustedProxies: []string{"10.0.0.0/8", "192.0.2.10"},
+			remoteAddr:     "10.1.2.3:51234",
+			forwardedFor:   []string{"198.51.100.1", "203.0.113.7, 192.0.2.10"},
+			want:           "203.0.113.7",
+		},
+		{
+			name:           "the peer without forwarded for",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.1.2.3:51234",
+			want:           "10.1.2.3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetTrustedProxies(tt.trustedProxies); err != nil {
+				t.Fatalf("failed to set trusted proxies: %v", err)
+			}
+			t.Cleanup(func() { trustedProxies = nil })
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor {
+				req.Header.Add(XForwardedFor, v)
+			}
+
+			if got := ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTrustedProxies_Invalid(t *testing.T) {
+	t.Cleanup(func() { trustedProxies = nil })
+	if err := SetTrustedProxies([]string{"not-an-address"}); err == nil {
+		t.Error("SetTrustedProxies() succeeded with an invalid proxy")
+	}
+}
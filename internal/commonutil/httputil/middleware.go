@@ -90,7 +90,7 @@ func (t *tracer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	t.Handler.ServeHTTP(w, req.WithContext(
 		logutil.ContextWithLogger(
-			req.Context(),
+			logutil.ContextWithCorrelationID(req.Context(), correlationID),
 			slog.Default().With(
 				slog.String("correlation_id", correlationID),
 				slog.Time("request_time", time.Now()),
@@ -0,0 +1,188 @@
+package jwkutil
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+/* Key Types (kty) */
+const (
+	KeyTypeEC  = "EC"
+	KeyTypeRSA = "RSA"
+	KeyTypeOKP = "OKP"
+)
+
+/* Curves (crv) */
+const (
+	CurveP256    = "P-256"
+	CurveEd25519 = "Ed25519"
+)
+
+var ErrUnsupportedKey = errors.New("unsupported key")
+
+// JWK is a public JSON Web Key. (RFC 7517)
+// Private key members are never included, so a JWK is always safe to publish.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// EC and OKP keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+// Set is a JSON Web Key Set which is served at jwks_uri.
+type Set struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// Find returns the key with the given key ID, or nil if not found.
+func (s *Set) Find(kid string) *JWK {
+	for _, k := range s.Keys {
+		if k.KeyID == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+var b64 = base64.RawURLEncoding
+
+// FromPublicKey converts an ECDSA P-256, Ed25519 or RSA public key to JWK.
+func FromPublicKey(key crypto.PublicKey) (*JWK, error) {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: only P-256 curve is supported", ErrUnsupportedKey)
+		}
+		ecdhKey, err := k.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC public key: %w", err)
+		}
+		// uncompressed point: 0x04 || X || Y
+		point := ecdhKey.Bytes()[1:]
+		return &JWK{
+			KeyType: KeyTypeEC,
+			Curve:   CurveP256,
+			X:       b64.EncodeToString(point[:len(point)/2]),
+			Y:       b64.EncodeToString(point[len(point)/2:]),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{KeyType: KeyTypeOKP, Curve: CurveEd25519, X: b64.EncodeToString(k)}, nil
+	case *rsa.PublicKey:
+		return &JWK{
+			KeyType: KeyTypeRSA,
+			N:       b64.EncodeToString(k.N.Bytes()),
+			E:       b64.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+}
+
+// PublicKey converts the JWK to *ecdsa.PublicKey, ed25519.PublicKey or *rsa.PublicKey.
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case KeyTypeEC:
+		if k.Curve != CurveP256 {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Curve)
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		y, err := b64.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %w", err)
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid P-256 coordinates length")
+		}
+		// ecdh validates that the point is on the curve.
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("invalid EC public key: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case KeyTypeOKP:
+		if k.Curve != CurveEd25519 {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Curve)
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key length")
+		}
+		return ed25519.PublicKey(x), nil
+	case KeyTypeRSA:
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := b64.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid e: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	default:
+		return nil, fmt.Errorf("%w: kty %s", ErrUnsupportedKey, k.KeyType)
+	}
+}
+
+// Thumbprint returns base64url encoded SHA-256 JWK thumbprint. (RFC 7638)
+// Only the required members of the key type are hashed, in lexicographic order.
+func (k *JWK) Thumbprint() (string, error) {
+	var members any
+	switch k.KeyType {
+	case KeyTypeEC:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Curve, k.KeyType, k.X, k.Y}
+	case KeyTypeOKP:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Curve, k.KeyType, k.X}
+	case KeyTypeRSA:
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.KeyType, k.N}
+	default:
+		return "", fmt.Errorf("%w: kty %s", ErrUnsupportedKey, k.KeyType)
+	}
+
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JWK members: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return b64.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,108 @@
+package jwkutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+)
+
+func TestThumbprint(t *testing.T) {
+	tests := []struct {
+		name    string
+		jwk     *JWK
+		want    string
+		wantErr error
+	}{
+		{
+			// RFC 7638 Section 3.1. Members other than the required ones are not hashed.
+			name: "rsa",
+			jwk: &JWK{
+				KeyType: KeyTypeRSA,
+				N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV" +
+					"4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0" +
+					"zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-c" +
+					"sFCur-kEgU8awapJzKnqDKgw",
+				E:         "AQAB",
+				KeyID:     "2011-04-29",
+				Algorithm: "RS256",
+			},
+			want: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+		},
+		{
+			// RFC 8037 Appendix A.3.
+			name: "ed25519",
+			jwk:  &JWK{KeyType: KeyTypeOKP, Curve: CurveEd25519, X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+			want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+		{
+			name:    "unsupported key type",
+			jwk:     &JWK{KeyType: "oct"},
+			wantErr: ErrUnsupportedKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.jwk.Thumbprint()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromPublicKey_RoundTrip(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     crypto.PublicKey
+		wantErr error
+	}{
+		{name: "ec", key: &ecKey.PublicKey},
+		{name: "ed25519", key: edKey},
+		{name: "rsa", key: &rsaKey.PublicKey},
+		{name: "unsupported curve", key: &p384Key.PublicKey, wantErr: ErrUnsupportedKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwk, err := FromPublicKey(tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			got, err := jwk.PublicKey()
+			if err != nil {
+				t.Fatalf("failed to convert JWK to public key: %v", err)
+			}
+			if !got.(interface{ Equal(crypto.PublicKey) bool }).Equal(tt.key) {
+				t.Errorf("got %v, want %v", got, tt.key)
+			}
+		})
+	}
+}
@@ -8,6 +8,8 @@ import (
 
 type loggerKey struct{}
 
+type correlationIDKey struct{}
+
 func InitDefaultLogger() {
 	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
 }
@@ -16,6 +18,17 @@ func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context
 	return context.WithValue(ctx, loggerKey{}, logger)
 }
 
+// ContextWithCorrelationID keeps the correlation ID of the request, for records other than logs to carry it as well.
+func ContextWithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// CorrelationIDFrom returns the correlation ID of the request, or an empty string out of requests.
+func CorrelationIDFrom(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDKey{}).(string)
+	return correlationID
+}
+
 func From(ctx context.Context) *slog.Logger {
 	logger, ok := ctx.Value(loggerKey{}).(*slog.Logger)
 	if !ok || logger == nil {
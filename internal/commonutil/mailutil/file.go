@@ -0,0 +1,45 @@
+package mailutil
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+)
+
+// fileMailer writes mails to files instead of sending them, so that the server runs locally without an SMTP server.
+// If the directory is empty, mails are logged instead.
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) Mailer {
+	return &fileMailer{dir: dir, from: from}
+}
+
+func (f *fileMailer) Send(ctx context.Context, mail *Mail) error {
+	if err := mail.validate(); err != nil {
+		return err
+	}
+
+	if f.dir == "" {
+		logutil.From(ctx).Info("mail",
+			slog.String("to", mail.To), slog.String("subject", mail.Subject), slog.String("body", mail.Body))
+		return nil
+	}
+
+	if err := os.MkdirAll(f.dir, 0o700); err != nil {
+		return fmt.Errorf("fileMailer.Send failed to create directory: %w", err)
+	}
+	name := filepath.Join(f.dir, strconv.FormatInt(time.Now().UnixNano(), 10)+".eml")
+	if err := os.WriteFile(name, buildMessage(f.from, mail), 0o600); err != nil {
+		return fmt.Errorf("fileMailer.Send failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package mailutil
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidHeader = errors.New("mail header must not contain line breaks")
+
+// Mail is a plain text mail.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+func (m *Mail) validate() error {
+	// line breaks in headers would let the value inject other headers.
+	if strings.ContainsAny(m.To, "\r\n") || strings.ContainsAny(m.Subject, "\r\n") {
+		return ErrInvalidHeader
+	}
+	return nil
+}
+
+type Mailer interface {
+	Send(ctx context.Context, mail *Mail) error
+}
@@ -0,0 +1,70 @@
+package mailutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"time"
+
+	"github.com/buzzryan/zenbu/internal/config"
+)
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer sends mails through the SMTP server. The connection is upgraded by STARTTLS if the server supports it,
+// and the credentials are sent only over TLS or to localhost.
+func NewSMTPMailer(cfg config.MailConfig) Mailer {
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	return &smtpMailer{
+		addr: net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		auth: auth,
+		from: cfg.MailFrom,
+	}
+}
+
+func (s *smtpMailer) Send(ctx context.Context, mail *Mail) error {
+	if err := mail.validate(); err != nil {
+		return err
+	}
+
+	// net/smtp doesn't take a context, so the mail is sent in background and the caller stops waiting when done.
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(s.addr, s.auth, s.from, []string{mail.To}, buildMessage(s.from, mail))
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("smtpMailer.Send failed: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func buildMessage(from string, mail *Mail) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(mail.Body)
+	return b.Bytes()
+}
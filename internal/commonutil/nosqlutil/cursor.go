@@ -0,0 +1,60 @@
+package nosqlutil
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/guregu/dynamo/v2"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor encodes the key a paginated query stopped at into an opaque cursor for clients.
+// It returns an empty string when there is no more page. Only string keys are supported.
+func EncodeCursor(key dynamo.PagingKey) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+
+	attrs := make(map[string]string, len(key))
+	for name, v := range key {
+		s, ok := v.(*types.AttributeValueMemberS)
+		if !ok {
+			return "", fmt.Errorf("key attribute %s is not a string", name)
+		}
+		attrs[name] = s.Value
+	}
+
+	b, err := json.Marshal(attrs)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeCursor decodes a cursor made by EncodeCursor for a query in the partition.
+// Cursors come from clients, so cursors of other partitions are rejected.
+// It returns nil for an empty cursor, which is the first page.
+func DecodeCursor(cursor string, partitionKey string) (dynamo.PagingKey, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var attrs map[string]string
+	if err := json.Unmarshal(b, &attrs); err != nil || attrs["pk"] != partitionKey {
+		return nil, ErrInvalidCursor
+	}
+
+	key := make(dynamo.PagingKey, len(attrs))
+	for name, v := range attrs {
+		key[name] = &types.AttributeValueMemberS{Value: v}
+	}
+	return key, nil
+}
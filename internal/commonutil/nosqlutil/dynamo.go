@@ -41,3 +41,7 @@ type CommonSchema struct {
 	PartitionKey string `dynamo:"pk,hash"`
 	SortKey      string `dynamo:"sk,range"`
 }
+
+// TTLAttribute is the attribute DynamoDB uses to expire items. It must be stored as Unix time in seconds.
+// e.g. ExpiresAt time.Time `dynamo:"ttl,unixtime"`
+const TTLAttribute = "ttl"
@@ -18,6 +18,11 @@ const (
 )
 
 func WrapError(err error) error {
+	var condErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condErr) {
+		return errors.Join(ErrConditionalCheckFailed, err)
+	}
+
 	var dynamoErr *types.TransactionCanceledException
 	if errors.As(err, &dynamoErr) {
 		for _, reason := range dynamoErr.CancellationReasons {
@@ -32,3 +37,13 @@ func WrapError(err error) error {
 func IsConditionalCheckFailed(err error) bool {
 	return errors.Is(WrapError(err), ErrConditionalCheckFailed)
 }
+
+// IsConditionalCheckFailedAt reports whether the condition of the i-th item of a write transaction failed.
+func IsConditionalCheckFailedAt(err error, i int) bool {
+	var dynamoErr *types.TransactionCanceledException
+	if !errors.As(err, &dynamoErr) || i >= len(dynamoErr.CancellationReasons) {
+		return false
+	}
+	code := dynamoErr.CancellationReasons[i].Code
+	return code != nil && *code == CodeConditionalCheckFailed
+}
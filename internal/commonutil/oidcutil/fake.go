@@ -0,0 +1,324 @@
+package oidcutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/jwkutil"
+)
+
+// fakeCodeExpiresIn is how long an authorization code of FakeProvider can be redeemed.
+const fakeCodeExpiresIn = time.Minute
+
+// FakeIdentity is the user FakeProvider signs in.
+type FakeIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// FakeProvider is an OpenID provider for local development and tests, so that logins work without network.
+// It signs in the identity set by SetIdentity without asking anything. A "login_hint" parameter in the
+// authorization request signs in another identity instead, whose subject and verified email are the hint.
+//
+// It supports only what Provider uses: discovery, the authorization code flow with S256 PKCE and the JWKS.
+type FakeProvider struct {
+	// Issuer is the URL the provider is served at. If empty, it is derived from requests,
+	// which suits servers listening on a random port.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	key *ecdsa.PrivateKey
+	kid string
+	mux *http.ServeMux
+
+	mu       sync.Mutex
+	identity FakeIdentity
+	codes    map[string]*fakeAuthorization
+}
+
+// fakeAuthorization is an authorization code waiting to be redeemed.
+type fakeAuthorization struct {
+	identity      FakeIdentity
+	issuer        string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	expiresAt     time.Time
+}
+
+func NewFakeProvider(clientID, clientSecret string) (*FakeProvider, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	jwk, err := jwkutil.FromPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	kid, err := jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FakeProvider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		kid:          kid,
+		identity:     FakeIdentity{Subject: "fake-user", Email: "fake-user@example.com", EmailVerified: true},
+		codes:        make(map[string]*fakeAuthorization),
+	}
+	f.mux = http.NewServeMux()
+	f.mux.HandleFunc("GET "+DiscoveryPath, f.handleDiscovery)
+	f.mux.HandleFunc("GET /authorize", f.handleAuthorize)
+	f.mux.HandleFunc("POST /token", f.handleToken)
+	f.mux.HandleFunc("GET /jwks", f.handleJWKS)
+	return f, nil
+}
+
+// SetIdentity changes the identity signed in by following authorization requests.
+func (f *FakeProvider) SetIdentity(identity FakeIdentity) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.identity = identity
+}
+
+func (f *FakeProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mux.ServeHTTP(w, req)
+}
+
+// SignIn follows the authorization URL as a browser would, and returns the URL the user is redirected back to,
+// which has the code and the state.
+func (f *FakeProvider) SignIn(ctx context.Context, authURL string) (*url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, authURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return url.Parse(res.Header.Get("Location"))
+}
+
+func (f *FakeProvider) issuer(req *http.Request) string {
+	if f.Issuer != "" {
+		return f.Issuer
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host
+}
+
+func (f *FakeProvider) handleDiscovery(w http.ResponseWriter, req *http.Request) {
+	issuer := f.issuer(req)
+	writeJSON(w, http.StatusOK, &Metadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		JWKSURI:                           issuer + "/jwks",
+		ScopesSupported:                   []string{"openid", "email", "profile"},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"ES256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+	})
+}
+
+func (f *FakeProvider) handleJWKS(w http.ResponseWriter, _ *http.Request) {
+	jwk, err := jwkutil.FromPublicKey(f.key.Public())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	jwk.KeyID = f.kid
+	jwk.Use = "sig"
+	jwk.Algorithm = "ES256"
+	writeJSON(w, http.StatusOK, &jwkutil.Set{Keys: []*jwkutil.JWK{jwk}})
+}
+
+func (f *FakeProvider) handleAuthorize(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	// errors about the client or the redirect URI must not be redirected. (RFC 6749 Section 4.1.2.1)
+	if q.Get("client_id") != f.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	redirect := func(params url.Values) {
+		query := redirectURI.Query()
+		for k, v := range params {
+			query[k] = v
+		}
+		query.Set("state", q.Get("state"))
+		u := *redirectURI
+		u.RawQuery = query.Encode()
+		http.Redirect(w, req, u.String(), http.StatusFound)
+	}
+	if q.Get("response_type") != "code" {
+		redirect(url.Values{"error": {"unsupported_response_type"}})
+		return
+	}
+	if !strings.Contains(" "+q.Get("scope")+" ", " openid ") {
+		redirect(url.Values{"error": {"invalid_scope"}})
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		redirect(url.Values{"error": {"invalid_request"}, "error_description": {"S256 code challenge required"}})
+		return
+	}
+
+	f.mu.Lock()
+	identity := f.identity
+	if hint := q.Get("login_hint"); hint != "" {
+		identity = FakeIdentity{Subject: hint, Email: hint, EmailVerified: true}
+	}
+	code, err := randomToken()
+	if err != nil {
+		f.mu.Unlock()
+		redirect(url.Values{"error": {"server_error"}})
+		return
+	}
+	f.codes[code] = &fakeAuthorization{
+		identity:      identity,
+		issuer:        f.issuer(req),
+		redirectURI:   redirectURI.String(),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		expiresAt:     time.Now().Add(fakeCodeExpiresIn),
+	}
+	f.mu.Unlock()
+
+	redirect(url.Values{"code": {code}})
+}
+
+func (f *FakeProvider) handleToken(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if !f.authenticateClient(req) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if req.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	// codes are single-use, even if the request fails.
+	f.mu.Lock()
+	code := req.PostForm.Get("code")
+	auth := f.codes[code]
+	delete(f.codes, code)
+	f.mu.Unlock()
+
+	if auth == nil || time.Now().After(auth.expiresAt) ||
+		auth.redirectURI != req.PostForm.Get("redirect_uri") ||
+		PKCEChallenge(req.PostForm.Get("code_verifier")) != auth.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken, err := f.signIDToken(&Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    auth.issuer,
+			Subject:   auth.identity.Subject,
+			Audience:  jwt.ClaimStrings{f.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+		Nonce:         auth.nonce,
+		Email:         auth.identity.Email,
+		EmailVerified: flexBool(auth.identity.EmailVerified),
+		Name:          auth.identity.Name,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken, err := randomToken()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// signIDToken signs the claims with the key published in the JWKS.
+func (f *FakeProvider) signIDToken(claims *Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = f.kid
+	return token.SignedString(f.key)
+}
+
+// authenticateClient accepts both client_secret_basic and client_secret_post.
+func (f *FakeProvider) authenticateClient(req *http.Request) bool {
+	id, secret, ok := req.BasicAuth()
+	if ok {
+		var err1, err2 error
+		id, err1 = url.QueryUnescape(id)
+		secret, err2 = url.QueryUnescape(secret)
+		if errors.Join(err1, err2) != nil {
+			return false
+		}
+	} else {
+		id, secret = req.PostForm.Get("client_id"), req.PostForm.Get("client_secret")
+	}
+	return id == f.ClientID && secret == f.ClientSecret
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,328 @@
+package oidcutil
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/jwkutil"
+)
+
+const (
+	// DiscoveryPath is appended to the issuer to get its metadata. (OpenID Connect Discovery 1.0)
+	DiscoveryPath = "/.well-known/openid-configuration"
+
+	// jwksRefreshInterval bounds how often the JWKS is fetched again for an unknown key ID,
+	// so that tokens with random key IDs can't make us flood the provider.
+	jwksRefreshInterval = time.Minute
+	// maxResponseSize bounds responses of providers read into memory.
+	maxResponseSize = 1 << 20
+)
+
+var (
+	ErrDiscovery = errors.New("failed to discover openid provider")
+	// ErrTokenRejected is returned when the provider rejects the authorization code.
+	ErrTokenRejected  = errors.New("token request rejected")
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// Metadata is the configuration of an OpenID provider served at DiscoveryPath.
+type Metadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint,omitempty"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint,omitempty"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported,omitempty"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+	DPoPSigningAlgValuesSupported     []string `json:"dpop_signing_alg_values_supported,omitempty"`
+}
+
+// Claims are the claims of an ID token identifying the user at the provider.
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce         string   `json:"nonce,omitempty"`
+	AuthorizedBy  string   `json:"azp,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified flexBool `json:"email_verified,omitempty"`
+	Name          string   `json:"name,omitempty"`
+}
+
+// flexBool accepts "true" as well as true, as some providers send booleans as strings.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	case "false", `"false"`, "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean: %s", data)
+	}
+	return nil
+}
+
+// Provider is an OpenID provider which users sign in with. zenbu is the relying party, a confidential client
+// using the authorization code flow with PKCE. Its metadata and keys are discovered from Issuer on first use.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider redirects the user back to with the authorization code.
+	RedirectURL string
+	// Scopes are requested in addition to "openid". If empty, "email" and "profile".
+	Scopes     []string
+	HTTPClient *http.Client
+
+	mu            sync.Mutex
+	metadata      *Metadata
+	jwks          *jwkutil.Set
+	jwksFetchedAt time.Time
+}
+
+func (p *Provider) httpClient() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// NewPKCE generates a code verifier and its S256 code challenge. (RFC 7636)
+func NewPKCE() (verifier, challenge string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	return verifier, PKCEChallenge(verifier), nil
+}
+
+// PKCEChallenge derives the S256 code challenge from the code verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Discover fetches the metadata of the provider. It is cached once fetched successfully.
+func (p *Provider) Discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var m Metadata
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+DiscoveryPath, &m); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+	// the issuer must be the one configured, or tokens of another provider would be accepted. (Section 4.3)
+	if m.Issuer != p.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q doesn't match %q", ErrDiscovery, m.Issuer, p.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: endpoints missing", ErrDiscovery)
+	}
+	p.metadata = &m
+	return p.metadata, nil
+}
+
+// AuthCodeURL returns the URL of the provider the user signs in at.
+// The state and the nonce must be random and kept until the callback, as well as the code verifier of the challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	m, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return m.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// tokenResponse is the response of the token endpoint, either successful or an error. (RFC 6749 Section 5)
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	AccessToken      string `json:"access_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems the authorization code and returns the claims of the verified ID token.
+// The nonce must be the one given to AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	m, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	res, err := p.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer res.Body.Close()
+
+	var body tokenResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode token response (status %d): %w", res.StatusCode, err)
+	}
+	if body.Error != "" {
+		return nil, fmt.Errorf("%w: %s: %s", ErrTokenRejected, body.Error, body.ErrorDescription)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected token response status %d", res.StatusCode)
+	}
+	if body.IDToken == "" {
+		return nil, fmt.Errorf("%w: missing in token response", ErrInvalidIDToken)
+	}
+
+	return p.VerifyIDToken(ctx, body.IDToken, nonce)
+}
+
+// VerifyIDToken verifies the signature and the claims of the ID token. (OpenID Connect Core 1.0 Section 3.1.3.7)
+func (p *Provider) VerifyIDToken(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	m, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	_, err = jwt.ParseWithClaims(idToken, &claims,
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.verificationKey(ctx, m.JWKSURI, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(m.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	// a token issued to several clients must have been issued to us.
+	if len(claims.Audience) > 1 && claims.AuthorizedBy != p.ClientID {
+		return nil, fmt.Errorf("%w: authorized party mismatch", ErrInvalidIDToken)
+	}
+	// the nonce binds the token to the authorization request, so that a token can't be replayed.
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return &claims, nil
+}
+
+// verificationKey returns the public key of the provider with the key ID.
+// Providers rotate keys, so the JWKS is fetched again if the key is not known.
+func (p *Provider) verificationKey(ctx context.Context, jwksURI, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := p.findKey(kid)
+	if key == nil && time.Since(p.jwksFetchedAt) >= jwksRefreshInterval {
+		var set jwkutil.Set
+		if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+			return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+		}
+		p.jwks = &set
+		p.jwksFetchedAt = time.Now()
+		key = p.findKey(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("key %q not found", kid)
+	}
+	return key.PublicKey()
+}
+
+// findKey finds the key by the ID. Tokens without ID are accepted only if the provider has a single key.
+func (p *Provider) findKey(kid string) *jwkutil.JWK {
+	if p.jwks == nil {
+		return nil
+	}
+	if kid == "" {
+		if len(p.jwks.Keys) == 1 {
+			return p.jwks.Keys[0]
+		}
+		return nil
+	}
+	i := slices.IndexFunc(p.jwks.Keys, func(k *jwkutil.JWK) bool { return k.KeyID == kid })
+	if i < 0 {
+		return nil
+	}
+	return p.jwks.Keys[i]
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", res.StatusCode, u)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(v)
+}
@@ -0,0 +1,192 @@
+package oidcutil
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "zenbu"
+	testClientSecret = "secret"
+	testRedirectURL  = "https://zenbu.example.com/oidc/callback"
+)
+
+// newTestProvider serves a FakeProvider and returns it with the Provider of the relying party using it.
+func newTestProvider(t *testing.T) (*FakeProvider, *Provider) {
+	t.Helper()
+	fake, err := NewFakeProvider(testClientID, testClientSecret)
+	if err != nil {
+		t.Fatalf("failed to create fake provider: %v", err)
+	}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	return fake, &Provider{
+		Issuer:       srv.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		HTTPClient:   srv.Client(),
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestProvider(t)
+	fake.SetIdentity(FakeIdentity{Subject: "alice", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("failed to generate pkce: %v", err)
+	}
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", challenge)
+	if err != nil {
+		t.Fatalf("failed to build auth url: %v", err)
+	}
+	callback, err := fake.SignIn(ctx, authURL)
+	if err != nil {
+		t.Fatalf("failed to sign in: %v", err)
+	}
+	if got := callback.Query().Get("state"); got != "state" {
+		t.Errorf("state = %q, want the one sent", got)
+	}
+
+	claims, err := p.Exchange(ctx, callback.Query().Get("code"), verifier, "nonce")
+	if err != nil {
+		t.Fatalf("failed to exchange code: %v", err)
+	}
+	if claims.Subject != "alice" || claims.Email != "alice@example.com" || !bool(claims.EmailVerified) {
+		t.Errorf("claims = %+v, want of the identity signed in", claims)
+	}
+
+	// codes are single-use.
+	_, err = p.Exchange(ctx, callback.Query().Get("code"), verifier, "nonce")
+	if !errors.Is(err, ErrTokenRejected) {
+		t.Errorf("redeeming the code again: got %v, want %v", err, ErrTokenRejected)
+	}
+}
+
+func TestExchange_Rejected(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestProvider(t)
+
+	signIn := func(t *testing.T, nonce string) (code, verifier string) {
+		t.Helper()
+		verifier, challenge, err := NewPKCE()
+		if err != nil {
+			t.Fatalf("failed to generate pkce: %v", err)
+		}
+		authURL, err := p.AuthCodeURL(ctx, "state", nonce, challenge)
+		if err != nil {
+			t.Fatalf("failed to build auth url: %v", err)
+		}
+		callback, err := fake.SignIn(ctx, authURL)
+		if err != nil {
+			t.Fatalf("failed to sign in: %v", err)
+		}
+		return callback.Query().Get("code"), verifier
+	}
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		code, verifier := signIn(t, "nonce")
+		_, err := p.Exchange(ctx, code, verifier, "another nonce")
+		if !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("got %v, want %v", err, ErrInvalidIDToken)
+		}
+	})
+
+	t.Run("wrong code verifier", func(t *testing.T) {
+		code, _ := signIn(t, "nonce")
+		otherVerifier, _, err := NewPKCE()
+		if err != nil {
+			t.Fatalf("failed to generate pkce: %v", err)
+		}
+		_, err = p.Exchange(ctx, code, otherVerifier, "nonce")
+		if !errors.Is(err, ErrTokenRejected) {
+			t.Errorf("got %v, want %v", err, ErrTokenRejected)
+		}
+	})
+}
+
+func TestVerifyIDToken_Rejected(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestProvider(t)
+
+	valid := func() *Claims {
+		now := time.Now()
+		return &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    p.Issuer,
+				Subject:   "alice",
+				Audience:  jwt.ClaimStrings{testClientID},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+			Nonce: "nonce",
+		}
+	}
+	idToken, err := fake.signIDToken(valid())
+	if err != nil {
+		t.Fatalf("failed to sign id token: %v", err)
+	}
+	if _, err := p.VerifyIDToken(ctx, idToken, "nonce"); err != nil {
+		t.Fatalf("valid id token is rejected: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Claims)
+		nonce  string
+	}{
+		{
+			name:   "wrong audience",
+			modify: func(c *Claims) { c.Audience = jwt.ClaimStrings{"another-client"} },
+		},
+		{
+			name: "expired",
+			modify: func(c *Claims) {
+				c.IssuedAt = jwt.NewNumericDate(time.Now().Add(-2 * time.Hour))
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+			},
+		},
+		{
+			name:   "without expiry",
+			modify: func(c *Claims) { c.ExpiresAt = nil },
+		},
+		{
+			name:   "wrong issuer",
+			modify: func(c *Claims) { c.Issuer = "https://evil.example" },
+		},
+		{
+			name:   "nonce mismatch",
+			modify: func(c *Claims) { c.Nonce = "another nonce" },
+		},
+		{
+			name:   "another client authorized",
+			modify: func(c *Claims) { c.Audience = jwt.ClaimStrings{testClientID, "another-client"} },
+		},
+		{
+			name:   "missing subject",
+			modify: func(c *Claims) { c.Subject = "" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.modify(claims)
+			idToken, err := fake.signIDToken(claims)
+			if err != nil {
+				t.Fatalf("failed to sign id token: %v", err)
+			}
+			_, err = p.VerifyIDToken(ctx, idToken, "nonce")
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("got %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package otputil
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SecretSize is the size of generated secrets in bytes, as recommended for HMAC-SHA1 by RFC 4226.
+const SecretSize = 20
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP generates and validates time-based one-time passwords. (RFC 6238)
+// Only HMAC-SHA1 is supported, as most authenticator apps ignore the other algorithms.
+type TOTP struct {
+	Period time.Duration
+	Digits int
+	// Skew is how many time steps before and after the current one are accepted, for clocks out of sync.
+	Skew int
+}
+
+// DefaultTOTP is the configuration supported by every authenticator app.
+var DefaultTOTP = TOTP{Period: 30 * time.Second, Digits: 6, Skew: 1}
+
+// GenerateSecret generates a random secret shared with the authenticator.
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return secret, nil
+}
+
+// EncodeSecret encodes the secret in base32 without padding, to be entered in authenticators manually.
+func EncodeSecret(secret []byte) string {
+	return secretEncoding.EncodeToString(secret)
+}
+
+// Step returns the time step the time falls in.
+func (t TOTP) Step(at time.Time) int64 {
+	return at.Unix() / int64(t.Period/time.Second)
+}
+
+// Code returns the code of the time step. (HOTP, RFC 4226)
+func (t TOTP) Code(secret []byte, step int64) string {
+	mac := hmac.New(sha1.New, secret)
+	_ = binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range t.Digits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", t.Digits, value%mod)
+}
+
+// Validate returns the time step the code was generated for, if it is valid at the time.
+// Callers should reject steps not after the last accepted one, so that a code can't be used twice.
+func (t TOTP) Validate(secret []byte, code string, at time.Time) (step int64, ok bool) {
+	if len(code) != t.Digits {
+		return 0, false
+	}
+
+	current := t.Step(at)
+	for i := -t.Skew; i <= t.Skew; i++ {
+		s := current + int64(i)
+		if subtle.ConstantTimeCompare([]byte(t.Code(secret, s)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// ProvisioningURI returns the otpauth:// URI to enroll the secret in authenticator apps, usually by a QR code.
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func (t TOTP) ProvisioningURI(issuer, account string, secret []byte) string {
+	q := url.Values{}
+	q.Set("secret", EncodeSecret(secret))
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", strconv.Itoa(t.Digits))
+	q.Set("period", strconv.Itoa(int(t.Period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
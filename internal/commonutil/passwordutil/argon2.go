@@ -0,0 +1,87 @@
+package passwordutil
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2idAlgorithm = "argon2id"
+	argon2idKeyLen    = 32
+)
+
+type Argon2idParams struct {
+	// Memory is in KiB.
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// DefaultArgon2idParams follows the OWASP recommendation. (19 MiB, 2 iterations, 1 degree of parallelism)
+var DefaultArgon2idParams = Argon2idParams{Memory: 19 * 1024, Time: 2, Threads: 1}
+
+// argon2idHasher hashes as "argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<base64 salt>$<base64 hash>",
+// which is the PHC string format with "$" in front replaced by the algorithm prefix.
+type argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) Hasher {
+	return &argon2idHasher{params: params}
+}
+
+func (a *argon2idHasher) Algorithm() string {
+	return argon2idAlgorithm
+}
+
+func (a *argon2idHasher) Hash(plain string) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	p := a.params
+	key := argon2.IDKey([]byte(plain), salt, p.Time, p.Memory, p.Threads, argon2idKeyLen)
+	return fmt.Sprintf("%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idAlgorithm, argon2.Version, p.Memory, p.Time, p.Threads, b64.EncodeToString(salt), b64.EncodeToString(key),
+	), nil
+}
+
+func (a *argon2idHasher) parse(hash string) (params Argon2idParams, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[0] != argon2idAlgorithm {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[1], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrMalformedHash
+	}
+	_, err = fmt.Sscanf(parts[2], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil || params.Time == 0 || params.Threads == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if salt, err = b64.DecodeString(parts[3]); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if key, err = b64.DecodeString(parts[4]); err != nil || len(key) == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	return params, salt, key, nil
+}
+
+func (a *argon2idHasher) Verify(hash, plain string) (bool, error) {
+	p, salt, key, err := a.parse(hash)
+	if err != nil {
+		return false, err
+	}
+	computed := argon2.IDKey([]byte(plain), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (a *argon2idHasher) NeedsRehash(hash string) bool {
+	p, _, _, err := a.parse(hash)
+	return err != nil || p.Memory < a.params.Memory || p.Time < a.params.Time || p.Threads < a.params.Threads
+}
@@ -0,0 +1,69 @@
+package passwordutil
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	bcryptAlgorithm   = "bcrypt"
+	DefaultBcryptCost = 12
+)
+
+// bcryptHasher hashes as "bcrypt$<modular crypt format hash>". The cost and the salt are in the hash.
+// bcrypt only takes the first 72 bytes of passwords, so longer passwords are refused.
+type bcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) Hasher {
+	return &bcryptHasher{cost: cost}
+}
+
+func (b *bcryptHasher) Algorithm() string {
+	return bcryptAlgorithm
+}
+
+func (b *bcryptHasher) Hash(plain string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), b.cost)
+	if err != nil {
+		return "", err
+	}
+	return bcryptAlgorithm + "$" + string(hash), nil
+}
+
+func (b *bcryptHasher) parse(hash string) ([]byte, error) {
+	mcf, ok := strings.CutPrefix(hash, bcryptAlgorithm+"$")
+	if !ok {
+		return nil, ErrMalformedHash
+	}
+	return []byte(mcf), nil
+}
+
+func (b *bcryptHasher) Verify(hash, plain string) (bool, error) {
+	mcf, err := b.parse(hash)
+	if err != nil {
+		return false, err
+	}
+
+	// CompareHashAndPassword compares in constant time.
+	err = bcrypt.CompareHashAndPassword(mcf, []byte(plain))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Join(ErrMalformedHash, err)
+	}
+	return true, nil
+}
+
+func (b *bcryptHasher) NeedsRehash(hash string) bool {
+	mcf, err := b.parse(hash)
+	if err != nil {
+		return true
+	}
+	cost, err := bcrypt.Cost(mcf)
+	return err != nil || cost < b.cost
+}
@@ -0,0 +1,109 @@
+package passwordutil
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Hashes are formatted as "<algorithm>$<parameters and salt>$<hash>".
+// The algorithm prefix selects the hasher, and the hasher parses the rest by itself.
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrMalformedHash    = errors.New("malformed password hash")
+)
+
+// Hasher hashes passwords with an algorithm and its parameters.
+type Hasher interface {
+	// Algorithm is the prefix of hashes made by the hasher.
+	Algorithm() string
+	Hash(plain string) (string, error)
+	// Verify compares the password with the hash in constant time, using the parameters stored in the hash.
+	Verify(hash, plain string) (bool, error)
+	// NeedsRehash reports whether the hash was made with weaker parameters than the hasher's.
+	NeedsRehash(hash string) bool
+}
+
+// Registry verifies hashes of every registered algorithm, and hashes new passwords by the preferred one.
+type Registry struct {
+	hashers   map[string]Hasher
+	preferred Hasher
+}
+
+func NewRegistry(preferred Hasher, others ...Hasher) *Registry {
+	r := &Registry{hashers: make(map[string]Hasher), preferred: preferred}
+	for _, h := range append(others, preferred) {
+		r.hashers[h.Algorithm()] = h
+	}
+	return r
+}
+
+// DefaultRegistry supports every algorithm with the default parameters and prefers argon2id.
+func DefaultRegistry() *Registry {
+	return NewRegistry(
+		NewArgon2idHasher(DefaultArgon2idParams),
+		NewPBKDF2Hasher(DefaultPBKDF2Iterations),
+		NewBcryptHasher(DefaultBcryptCost),
+		NewScryptHasher(DefaultScryptParams),
+	)
+}
+
+// Prefer changes the algorithm hashing new passwords. The algorithm must be registered.
+func (r *Registry) Prefer(algorithm string) error {
+	h, ok := r.hashers[algorithm]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAlgorithm, algorithm)
+	}
+	r.preferred = h
+	return nil
+}
+
+func (r *Registry) Hash(plain string) (string, error) {
+	return r.preferred.Hash(plain)
+}
+
+func (r *Registry) Verify(hash, plain string) (bool, error) {
+	h, err := r.hasherOf(hash)
+	if err != nil {
+		return false, err
+	}
+	return h.Verify(hash, plain)
+}
+
+// NeedsRehash reports whether the hash should be replaced by a hash of the preferred algorithm and parameters.
+func (r *Registry) NeedsRehash(hash string) bool {
+	if Algorithm(hash) != r.preferred.Algorithm() {
+		return true
+	}
+	return r.preferred.NeedsRehash(hash)
+}
+
+func (r *Registry) hasherOf(hash string) (Hasher, error) {
+	algorithm := Algorithm(hash)
+	h, ok := r.hashers[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algorithm)
+	}
+	return h, nil
+}
+
+// Algorithm returns the algorithm prefix of the hash.
+func Algorithm(hash string) string {
+	algorithm, _, _ := strings.Cut(hash, "$")
+	return algorithm
+}
+
+const saltLen = 16
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return salt, nil
+}
+
+var b64 = base64.RawStdEncoding
@@ -0,0 +1,74 @@
+package passwordutil
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	pbkdf2Algorithm = "pbkdf2_sha256"
+	pbkdf2KeyLen    = 32
+	// DefaultPBKDF2Iterations follows the OWASP recommendation for PBKDF2-HMAC-SHA256.
+	DefaultPBKDF2Iterations = 600_000
+)
+
+// pbkdf2Hasher hashes as "pbkdf2_sha256$<iterations>$<salt>$<base64 hash>".
+// The salt is used as it is written, as hashes made before salts were random bytes have printable salts.
+type pbkdf2Hasher struct {
+	iterations int
+}
+
+func NewPBKDF2Hasher(iterations int) Hasher {
+	return &pbkdf2Hasher{iterations: iterations}
+}
+
+func (p *pbkdf2Hasher) Algorithm() string {
+	return pbkdf2Algorithm
+}
+
+func (p *pbkdf2Hasher) Hash(plain string) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	encodedSalt := b64.EncodeToString(salt)
+	key := pbkdf2.Key([]byte(plain), []byte(encodedSalt), p.iterations, pbkdf2KeyLen, sha256.New)
+	return fmt.Sprintf("%s$%d$%s$%s",
+		pbkdf2Algorithm, p.iterations, encodedSalt, base64.StdEncoding.EncodeToString(key)), nil
+}
+
+func (p *pbkdf2Hasher) parse(hash string) (iterations int, salt string, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != pbkdf2Algorithm {
+		return 0, "", nil, ErrMalformedHash
+	}
+	iterations, err = strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return 0, "", nil, ErrMalformedHash
+	}
+	key, err = base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return 0, "", nil, ErrMalformedHash
+	}
+	return iterations, parts[2], key, nil
+}
+
+func (p *pbkdf2Hasher) Verify(hash, plain string) (bool, error) {
+	iterations, salt, key, err := p.parse(hash)
+	if err != nil {
+		return false, err
+	}
+	computed := pbkdf2.Key([]byte(plain), []byte(salt), iterations, len(key), sha256.New)
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (p *pbkdf2Hasher) NeedsRehash(hash string) bool {
+	iterations, _, _, err := p.parse(hash)
+	return err != nil || iterations < p.iterations
+}
@@ -0,0 +1,87 @@
+package passwordutil
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	scryptAlgorithm = "scrypt"
+	scryptKeyLen    = 32
+)
+
+type ScryptParams struct {
+	// LogN is the log2 of the CPU/memory cost N.
+	LogN uint8
+	R    int
+	P    int
+}
+
+// DefaultScryptParams follows the OWASP recommendation. (N=2^17, r=8, p=1)
+var DefaultScryptParams = ScryptParams{LogN: 17, R: 8, P: 1}
+
+// scryptHasher hashes as "scrypt$ln=<log2 N>,r=<r>,p=<p>$<base64 salt>$<base64 hash>".
+type scryptHasher struct {
+	params ScryptParams
+}
+
+func NewScryptHasher(params ScryptParams) Hasher {
+	return &scryptHasher{params: params}
+}
+
+func (s *scryptHasher) Algorithm() string {
+	return scryptAlgorithm
+}
+
+func (s *scryptHasher) Hash(plain string) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	p := s.params
+	key, err := scrypt.Key([]byte(plain), salt, 1<<p.LogN, p.R, p.P, scryptKeyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$ln=%d,r=%d,p=%d$%s$%s",
+		scryptAlgorithm, p.LogN, p.R, p.P, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (s *scryptHasher) parse(hash string) (params ScryptParams, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != scryptAlgorithm {
+		return params, nil, nil, ErrMalformedHash
+	}
+	_, err = fmt.Sscanf(parts[1], "ln=%d,r=%d,p=%d", &params.LogN, &params.R, &params.P)
+	// N must fit in int on every platform.
+	if err != nil || params.LogN == 0 || params.LogN > 30 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if salt, err = b64.DecodeString(parts[2]); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if key, err = b64.DecodeString(parts[3]); err != nil || len(key) == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	return params, salt, key, nil
+}
+
+func (s *scryptHasher) Verify(hash, plain string) (bool, error) {
+	p, salt, key, err := s.parse(hash)
+	if err != nil {
+		return false, err
+	}
+	computed, err := scrypt.Key([]byte(plain), salt, 1<<p.LogN, p.R, p.P, len(key))
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrMalformedHash, err)
+	}
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (s *scryptHasher) NeedsRehash(hash string) bool {
+	p, _, _, err := s.parse(hash)
+	return err != nil || p.LogN < s.params.LogN || p.R < s.params.R || p.P < s.params.P
+}
@@ -0,0 +1,77 @@
+package poolutil
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"time"
+)
+
+var ErrQueueFull = errors.New("queue is full")
+
+// Pool bounds how many CPU-heavy tasks run at once. Tasks beyond the concurrency wait in a bounded queue,
+// and tasks beyond the queue are rejected immediately, so that a burst can't starve the rest of the server.
+type Pool struct {
+	// slots admits running and queued tasks. workers admits running tasks only.
+	slots   chan struct{}
+	workers chan struct{}
+	metrics *metrics
+}
+
+type metrics struct {
+	queueDepth  expvar.Int
+	running     expvar.Int
+	completed   expvar.Int
+	rejected    expvar.Int
+	waitSeconds expvar.Float
+}
+
+func NewPool(concurrency, queueSize int) *Pool {
+	return &Pool{
+		slots:   make(chan struct{}, concurrency+queueSize),
+		workers: make(chan struct{}, concurrency),
+		metrics: &metrics{},
+	}
+}
+
+// Publish exposes the metrics of the pool by expvar as the name. The name must be unique.
+func (p *Pool) Publish(name string) {
+	vars := expvar.NewMap(name)
+	vars.Set("queue_depth", &p.metrics.queueDepth)
+	vars.Set("running", &p.metrics.running)
+	vars.Set("completed_total", &p.metrics.completed)
+	vars.Set("rejected_total", &p.metrics.rejected)
+	// the average wait time is wait_seconds_total / completed_total.
+	vars.Set("wait_seconds_total", &p.metrics.waitSeconds)
+}
+
+// Do runs the task on the calling goroutine once a worker is free.
+// It returns ErrQueueFull if the queue is full, or the context error if the context is done while waiting.
+// A task already running is not interrupted.
+func (p *Pool) Do(ctx context.Context, task func()) error {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		p.metrics.rejected.Add(1)
+		return ErrQueueFull
+	}
+	defer func() { <-p.slots }()
+
+	p.metrics.queueDepth.Add(1)
+	start := time.Now()
+	select {
+	case p.workers <- struct{}{}:
+	case <-ctx.Done():
+		p.metrics.queueDepth.Add(-1)
+		return ctx.Err()
+	}
+	p.metrics.queueDepth.Add(-1)
+	p.metrics.waitSeconds.Add(time.Since(start).Seconds())
+	defer func() { <-p.workers }()
+
+	p.metrics.running.Add(1)
+	defer p.metrics.running.Add(-1)
+	task()
+	p.metrics.completed.Add(1)
+	return nil
+}
@@ -0,0 +1,142 @@
+package webauthnutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrNoCredential = errors.New("no credential for the relying party")
+
+// Authenticator is a software authenticator keeping ES256 passkeys in memory.
+// It performs ceremonies as a browser and a platform authenticator would, so that registration and login
+// can be exercised end-to-end without either, e.g. in tests or scripts.
+type Authenticator struct {
+	// Origin is the origin of the page the ceremonies are performed on, as the browser would report it.
+	Origin string
+
+	mu          sync.Mutex
+	credentials []*softCredential
+}
+
+type softCredential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+func NewAuthenticator(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// AttestationResponse is the response of navigator.credentials.create().
+type AttestationResponse struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// AssertionResponse is the response of navigator.credentials.get().
+type AssertionResponse struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+// Register creates a discoverable credential of the user for the relying party, with "none" attestation.
+func (a *Authenticator) Register(rpID string, challenge, userHandle []byte) (*AttestationResponse, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate credential id: %w", err)
+	}
+	cred := &softCredential{id: id, rpID: rpID, userHandle: userHandle, key: key}
+
+	clientDataJSON, err := a.clientData(ceremonyCreate, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	authData := a.authenticatorData(cred, flagAttestedCredsData)
+	authData = append(authData, make([]byte, aaguidLen)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, encodeES256Key(&key.PublicKey)...)
+
+	e := &cborEncoder{}
+	e.mapHeader(3)
+	e.text("fmt")
+	e.text("none")
+	e.text("attStmt")
+	e.mapHeader(0)
+	e.text("authData")
+	e.bytes(authData)
+
+	a.mu.Lock()
+	a.credentials = append(a.credentials, cred)
+	a.mu.Unlock()
+
+	return &AttestationResponse{CredentialID: id, ClientDataJSON: clientDataJSON, AttestationObject: e.buf.Bytes()}, nil
+}
+
+// Assert signs the challenge with the latest credential for the relying party, as a passkey picked by the user.
+func (a *Authenticator) Assert(rpID string, challenge []byte) (*AssertionResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var cred *softCredential
+	for _, c := range a.credentials {
+		if c.rpID == rpID {
+			cred = c
+		}
+	}
+	if cred == nil {
+		return nil, ErrNoCredential
+	}
+
+	clientDataJSON, err := a.clientData(ceremonyGet, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	cred.signCount++
+	authData := a.authenticatorData(cred, 0)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+
+	return &AssertionResponse{
+		CredentialID:      cred.id,
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authData[:len(authData):len(authData)],
+		Signature:         signature,
+		UserHandle:        cred.userHandle,
+	}, nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) ([]byte, error) {
+	return json.Marshal(&clientData{Type: ceremony, Challenge: Encoding.EncodeToString(challenge), Origin: a.Origin})
+}
+
+// authenticatorData returns the authenticator data with the user present and verified.
+func (a *Authenticator) authenticatorData(cred *softCredential, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(cred.rpID))
+	b := append(rpIDHash[:], flagUserPresent|flagUserVerified|flags)
+	return binary.BigEndian.AppendUint32(b, cred.signCount)
+}
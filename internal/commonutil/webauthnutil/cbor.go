@@ -0,0 +1,210 @@
+package webauthnutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CBOR (RFC 8949) is implemented only as far as WebAuthn needs: integers, byte and text strings, arrays, maps,
+// booleans and null, all of definite length. Integers are decoded as int64, and maps as map[any]any.
+
+const maxCBORDepth = 16
+
+var errMalformedCBOR = errors.New("malformed cbor")
+
+const (
+	cborUint   = 0
+	cborNegint = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborSimple = 7
+)
+
+// decodeCBOR decodes the first data item, and returns it with the bytes after it.
+func decodeCBOR(b []byte) (v any, rest []byte, err error) {
+	d := &cborDecoder{b: b}
+	v, err = d.decode(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, d.b, nil
+}
+
+type cborDecoder struct {
+	b []byte
+}
+
+func (d *cborDecoder) decode(depth int) (any, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("%w: too deep", errMalformedCBOR)
+	}
+	if len(d.b) == 0 {
+		return nil, fmt.Errorf("%w: unexpected end", errMalformedCBOR)
+	}
+
+	major, info := d.b[0]>>5, d.b[0]&0x1f
+	d.b = d.b[1:]
+	if major == cborSimple {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("%w: unsupported simple value %d", errMalformedCBOR, info)
+		}
+	}
+
+	arg, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", errMalformedCBOR)
+		}
+		return int64(arg), nil
+	case cborNegint:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", errMalformedCBOR)
+		}
+		return -1 - int64(arg), nil
+	case cborBytes:
+		return d.take(arg)
+	case cborText:
+		s, err := d.take(arg)
+		return string(s), err
+	case cborArray:
+		// every item takes a byte at least, which bounds allocations by malicious lengths.
+		if arg > uint64(len(d.b)) {
+			return nil, fmt.Errorf("%w: unexpected end", errMalformedCBOR)
+		}
+		arr := make([]any, 0, arg)
+		for range arg {
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case cborMap:
+		if arg > uint64(len(d.b)) {
+			return nil, fmt.Errorf("%w: unexpected end", errMalformedCBOR)
+		}
+		m := make(map[any]any, arg)
+		for range arg {
+			k, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: unsupported map key", errMalformedCBOR)
+			}
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported major type %d", errMalformedCBOR, major)
+	}
+}
+
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	var n int
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		n = 1
+	case info == 25:
+		n = 2
+	case info == 26:
+		n = 4
+	case info == 27:
+		n = 8
+	default:
+		// indefinite lengths are not used by authenticators.
+		return 0, fmt.Errorf("%w: unsupported additional info %d", errMalformedCBOR, info)
+	}
+
+	b, err := d.take(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	var arg uint64
+	for _, c := range b {
+		arg = arg<<8 | uint64(c)
+	}
+	return arg, nil
+}
+
+func (d *cborDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.b)) {
+		return nil, fmt.Errorf("%w: unexpected end", errMalformedCBOR)
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b, nil
+}
+
+// cborEncoder encodes data items for the software authenticator.
+type cborEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *cborEncoder) head(major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		e.buf.WriteByte(major<<5 | byte(arg))
+	case arg <= math.MaxUint8:
+		e.buf.WriteByte(major<<5 | 24)
+		e.buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		e.buf.WriteByte(major<<5 | 25)
+		e.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(arg)))
+	case arg <= math.MaxUint32:
+		e.buf.WriteByte(major<<5 | 26)
+		e.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(arg)))
+	default:
+		e.buf.WriteByte(major<<5 | 27)
+		e.buf.Write(binary.BigEndian.AppendUint64(nil, arg))
+	}
+}
+
+func (e *cborEncoder) int(v int64) {
+	if v < 0 {
+		e.head(cborNegint, uint64(-1-v))
+		return
+	}
+	e.head(cborUint, uint64(v))
+}
+
+func (e *cborEncoder) bytes(b []byte) {
+	e.head(cborBytes, uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *cborEncoder) text(s string) {
+	e.head(cborText, uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+// mapHeader starts a map of n pairs. Keys and values are encoded next, alternately.
+func (e *cborEncoder) mapHeader(n int) {
+	e.head(cborMap, uint64(n))
+}
@@ -0,0 +1,133 @@
+package webauthnutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms supported for credentials. (RFC 9053)
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// SupportedAlgorithms are offered to authenticators in order of preference.
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters. (RFC 9052, RFC 9053)
+const (
+	coseKeyKty   = 1
+	coseKeyAlg   = 3
+	coseKeyCrv   = -1
+	coseKeyX     = -2
+	coseKeyY     = -3
+	coseKeyRSAN  = -1
+	coseKeyRSAE  = -2
+	coseKtyOKP   = 1
+	coseKtyEC2   = 2
+	coseKtyRSA   = 3
+	coseCrvP256  = 1
+	coseCrvEd255 = 6
+)
+
+var (
+	ErrUnsupportedKey = errors.New("unsupported credential public key")
+	ErrBadSignature   = errors.New("bad signature")
+)
+
+// publicKey is a credential public key decoded from COSE_Key.
+type publicKey struct {
+	alg int
+	key crypto.PublicKey
+}
+
+func parsePublicKey(coseKey []byte) (*publicKey, error) {
+	v, rest, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing bytes", ErrUnsupportedKey)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a map", ErrUnsupportedKey)
+	}
+
+	kty, _ := m[int64(coseKeyKty)].(int64)
+	alg, _ := m[int64(coseKeyAlg)].(int64)
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseKeyCrv)].(int64)
+		x, _ := m[int64(coseKeyX)].([]byte)
+		y, _ := m[int64(coseKeyY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: invalid EC2 key", ErrUnsupportedKey)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("%w: point not on curve", ErrUnsupportedKey)
+		}
+		return &publicKey{alg: AlgES256, key: key}, nil
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseKeyCrv)].(int64)
+		x, _ := m[int64(coseKeyX)].([]byte)
+		if crv != coseCrvEd255 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid OKP key", ErrUnsupportedKey)
+		}
+		return &publicKey{alg: AlgEdDSA, key: ed25519.PublicKey(x)}, nil
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseKeyRSAN)].([]byte)
+		e, _ := m[int64(coseKeyRSAE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: invalid RSA key", ErrUnsupportedKey)
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return &publicKey{alg: AlgRS256, key: key}, nil
+	default:
+		return nil, fmt.Errorf("%w: kty %d, alg %d", ErrUnsupportedKey, kty, alg)
+	}
+}
+
+func (k *publicKey) verify(message, signature []byte) error {
+	var ok bool
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		ok = ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, message, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	if !ok {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// encodeES256Key encodes the public key of the software authenticator as COSE_Key.
+func encodeES256Key(key *ecdsa.PublicKey) []byte {
+	e := &cborEncoder{}
+	e.mapHeader(5)
+	e.int(coseKeyKty)
+	e.int(coseKtyEC2)
+	e.int(coseKeyAlg)
+	e.int(AlgES256)
+	e.int(coseKeyCrv)
+	e.int(coseCrvP256)
+	e.int(coseKeyX)
+	e.bytes(key.X.FillBytes(make([]byte, 32)))
+	e.int(coseKeyY)
+	e.bytes(key.Y.FillBytes(make([]byte, 32)))
+	return e.buf.Bytes()
+}
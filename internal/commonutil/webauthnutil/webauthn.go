@@ -0,0 +1,226 @@
+// Package webauthnutil verifies WebAuthn registration and authentication ceremonies of a relying party.
+// https://www.w3.org/TR/webauthn-3/
+package webauthnutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	ChallengeSize = 32
+
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+
+	flagUserPresent       = 0x01
+	flagUserVerified      = 0x04
+	flagBackupEligible    = 0x08
+	flagBackedUp          = 0x10
+	flagAttestedCredsData = 0x40
+	flagExtensionData     = 0x80
+
+	// rpIDHashLen, flags and signCount.
+	authDataMinLen = 32 + 1 + 4
+	aaguidLen      = 16
+	// maxCredentialIDLen is the limit of credential IDs by the specification.
+	maxCredentialIDLen = 1023
+)
+
+var (
+	ErrInvalidClientData        = errors.New("invalid client data")
+	ErrInvalidAuthenticatorData = errors.New("invalid authenticator data")
+	ErrInvalidAttestation       = errors.New("invalid attestation object")
+	ErrUserNotVerified          = errors.New("user not verified")
+)
+
+// Encoding is how binary values are encoded in JSON of WebAuthn, e.g. by PublicKeyCredential.toJSON().
+var Encoding = base64.RawURLEncoding
+
+// NewChallenge generates a random challenge for a ceremony. Every challenge must be used only once.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// RelyingParty verifies ceremonies of credentials scoped to ID, performed on pages of Origins.
+type RelyingParty struct {
+	// ID is the domain of the relying party, e.g. example.com.
+	ID      string
+	Origins []string
+	// RequireUserVerification requires the authenticator to verify the user, e.g. by biometrics or a PIN,
+	// which makes a passkey sufficient for login without a password.
+	RequireUserVerification bool
+}
+
+// Credential is a public key credential registered by an authenticator.
+type Credential struct {
+	ID []byte
+	// PublicKey is COSE_Key encoded, to be given back to VerifyAssertion as is.
+	PublicKey []byte
+	SignCount uint32
+	AAGUID    []byte
+	// BackupEligible is true for passkeys synced between devices.
+	BackupEligible bool
+}
+
+// VerifyRegistration verifies the response of navigator.credentials.create() to the challenge.
+// Attestation statements are not verified, as attestation is not requested from authenticators.
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, ceremonyCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	v, rest, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidAttestation, err)
+	}
+	att, ok := v.(map[any]any)
+	if !ok || len(rest) != 0 {
+		return nil, ErrInvalidAttestation
+	}
+	rawAuthData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: no authData", ErrInvalidAttestation)
+	}
+
+	authData, err := rp.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credential == nil {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrInvalidAuthenticatorData)
+	}
+	if _, err := parsePublicKey(authData.credential.PublicKey); err != nil {
+		return nil, err
+	}
+
+	authData.credential.SignCount = authData.signCount
+	return authData.credential, nil
+}
+
+// VerifyAssertion verifies the response of navigator.credentials.get() to the challenge, signed by the credential.
+// It returns the sign count of the authenticator, to be compared with the last one.
+func (rp *RelyingParty) VerifyAssertion(
+	challenge, publicKey, clientDataJSON, rawAuthData, signature []byte,
+) (signCount uint32, err error) {
+	if err := rp.verifyClientData(clientDataJSON, ceremonyGet, challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err := key.verify(append(slices.Clip(rawAuthData), clientDataHash[:]...), signature); err != nil {
+		return 0, err
+	}
+	return authData.signCount, nil
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidClientData, err)
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: unexpected type %q", ErrInvalidClientData, cd.Type)
+	}
+	got, err := Encoding.DecodeString(cd.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidClientData)
+	}
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return fmt.Errorf("%w: unexpected origin %q", ErrInvalidClientData, cd.Origin)
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	flags      byte
+	signCount  uint32
+	credential *Credential
+}
+
+func (rp *RelyingParty) parseAuthenticatorData(b []byte) (*authenticatorData, error) {
+	if len(b) < authDataMinLen {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidAuthenticatorData)
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(b[:32], rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: rp id mismatch", ErrInvalidAuthenticatorData)
+	}
+
+	d := &authenticatorData{flags: b[32], signCount: binary.BigEndian.Uint32(b[33:37])}
+	if d.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user not present", ErrInvalidAuthenticatorData)
+	}
+	if rp.RequireUserVerification && d.flags&flagUserVerified == 0 {
+		return nil, ErrUserNotVerified
+	}
+	if d.flags&flagBackedUp != 0 && d.flags&flagBackupEligible == 0 {
+		return nil, fmt.Errorf("%w: backed up but not backup eligible", ErrInvalidAuthenticatorData)
+	}
+
+	rest := b[authDataMinLen:]
+	if d.flags&flagAttestedCredsData != 0 {
+		if len(rest) < aaguidLen+2 {
+			return nil, fmt.Errorf("%w: too short", ErrInvalidAuthenticatorData)
+		}
+		aaguid := rest[:aaguidLen]
+		idLen := int(binary.BigEndian.Uint16(rest[aaguidLen:]))
+		rest = rest[aaguidLen+2:]
+		if idLen > maxCredentialIDLen || len(rest) < idLen {
+			return nil, fmt.Errorf("%w: invalid credential id", ErrInvalidAuthenticatorData)
+		}
+		id := rest[:idLen]
+		rest = rest[idLen:]
+
+		// the COSE key is followed by extensions, so its length is known only by decoding it.
+		_, afterKey, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidAuthenticatorData, err)
+		}
+		d.credential = &Credential{
+			ID:             bytes.Clone(id),
+			PublicKey:      bytes.Clone(rest[:len(rest)-len(afterKey)]),
+			AAGUID:         bytes.Clone(aaguid),
+			BackupEligible: d.flags&flagBackupEligible != 0,
+		}
+		rest = afterKey
+	}
+	if d.flags&flagExtensionData != 0 {
+		_, afterExtensions, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidAuthenticatorData, err)
+		}
+		rest = afterExtensions
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing bytes", ErrInvalidAuthenticatorData)
+	}
+	return d, nil
+}
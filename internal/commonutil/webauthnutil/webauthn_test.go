@@ -0,0 +1,177 @@
+package webauthnutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func newTestRelyingParty() *RelyingParty {
+	return &RelyingParty{ID: testRPID, Origins: []string{testOrigin}, RequireUserVerification: true}
+}
+
+func mustChallenge(t *testing.T) []byte {
+	t.Helper()
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatalf("failed to generate challenge: %v", err)
+	}
+	return challenge
+}
+
+// register registers a credential of the authenticator to the relying party.
+func register(t *testing.T, rp *RelyingParty, a *Authenticator) *Credential {
+	t.Helper()
+	challenge := mustChallenge(t)
+	att, err := a.Register(rp.ID, challenge, []byte("user handle"))
+	if err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	cred, err := rp.VerifyRegistration(challenge, att.ClientDataJSON, att.AttestationObject)
+	if err != nil {
+		t.Fatalf("failed to verify registration: %v", err)
+	}
+	return cred
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := newTestRelyingParty()
+	a := NewAuthenticator(testOrigin)
+
+	challenge := mustChallenge(t)
+	att, err := a.Register(rp.ID, challenge, []byte("user handle"))
+	if err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	cred, err := rp.VerifyRegistration(challenge, att.ClientDataJSON, att.AttestationObject)
+	if err != nil {
+		t.Fatalf("failed to verify registration: %v", err)
+	}
+	if !bytes.Equal(cred.ID, att.CredentialID) {
+		t.Errorf("credential id = %x, want %x", cred.ID, att.CredentialID)
+	}
+	if cred.SignCount != 0 {
+		t.Errorf("sign count at registration = %d, want 0", cred.SignCount)
+	}
+
+	for want := uint32(1); want <= 2; want++ {
+		challenge := mustChallenge(t)
+		assertion, err := a.Assert(rp.ID, challenge)
+		if err != nil {
+			t.Fatalf("failed to assert: %v", err)
+		}
+		if !bytes.Equal(assertion.UserHandle, []byte("user handle")) {
+			t.Errorf("user handle = %q, want the one registered", assertion.UserHandle)
+		}
+		signCount, err := rp.VerifyAssertion(
+			challenge, cred.PublicKey, assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature,
+		)
+		if err != nil {
+			t.Fatalf("failed to verify assertion: %v", err)
+		}
+		if signCount != want {
+			t.Errorf("sign count = %d, want %d", signCount, want)
+		}
+	}
+}
+
+func TestVerifyRegistration_Rejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		rpID    string
+		wantErr error
+	}{
+		{name: "wrong origin", origin: "https://evil.example", rpID: testRPID, wantErr: ErrInvalidClientData},
+		{name: "wrong rp id", origin: testOrigin, rpID: "evil.example", wantErr: ErrInvalidAuthenticatorData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newTestRelyingParty()
+			challenge := mustChallenge(t)
+			att, err := NewAuthenticator(tt.origin).Register(tt.rpID, challenge, []byte("user handle"))
+			if err != nil {
+				t.Fatalf("failed to register: %v", err)
+			}
+			_, err = rp.VerifyRegistration(challenge, att.ClientDataJSON, att.AttestationObject)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion_Rejected(t *testing.T) {
+	rp := newTestRelyingParty()
+	a := NewAuthenticator(testOrigin)
+	cred := register(t, rp, a)
+
+	t.Run("wrong origin", func(t *testing.T) {
+		a.Origin = "https://evil.example"
+		defer func() { a.Origin = testOrigin }()
+
+		challenge := mustChallenge(t)
+		assertion, err := a.Assert(rp.ID, challenge)
+		if err != nil {
+			t.Fatalf("failed to assert: %v", err)
+		}
+		_, err = rp.VerifyAssertion(
+			challenge, cred.PublicKey, assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature,
+		)
+		if !errors.Is(err, ErrInvalidClientData) {
+			t.Errorf("got %v, want %v", err, ErrInvalidClientData)
+		}
+	})
+
+	t.Run("wrong rp id", func(t *testing.T) {
+		// the same key registered for another relying party, e.g. by a phishing site.
+		other := &RelyingParty{ID: "evil.example", Origins: []string{testOrigin}}
+		otherCred := register(t, other, a)
+
+		challenge := mustChallenge(t)
+		assertion, err := a.Assert(other.ID, challenge)
+		if err != nil {
+			t.Fatalf("failed to assert: %v", err)
+		}
+		_, err = rp.VerifyAssertion(
+			challenge, otherCred.PublicKey, assertion.ClientDataJSON, assertion.AuthenticatorData, assertion.Signature,
+		)
+		if !errors.Is(err, ErrInvalidAuthenticatorData) {
+			t.Errorf("got %v, want %v", err, ErrInvalidAuthenticatorData)
+		}
+	})
+
+	t.Run("another challenge", func(t *testing.T) {
+		assertion, err := a.Assert(rp.ID, mustChallenge(t))
+		if err != nil {
+			t.Fatalf("failed to assert: %v", err)
+		}
+		_, err = rp.VerifyAssertion(
+			mustChallenge(t), cred.PublicKey, assertion.ClientDataJSON, assertion.AuthenticatorData,
+			assertion.Signature,
+		)
+		if !errors.Is(err, ErrInvalidClientData) {
+			t.Errorf("got %v, want %v", err, ErrInvalidClientData)
+		}
+	})
+
+	t.Run("tampered authenticator data", func(t *testing.T) {
+		challenge := mustChallenge(t)
+		assertion, err := a.Assert(rp.ID, challenge)
+		if err != nil {
+			t.Fatalf("failed to assert: %v", err)
+		}
+		// a higher sign count than the one signed.
+		authData := bytes.Clone(assertion.AuthenticatorData)
+		authData[len(authData)-1]++
+		_, err = rp.VerifyAssertion(challenge, cred.PublicKey, assertion.ClientDataJSON, authData, assertion.Signature)
+		if err == nil {
+			t.Error("tampered authenticator data is accepted")
+		}
+	})
+}
@@ -2,12 +2,38 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
-	JWSSigningKey string
+	JWSConfig
 	DynamoConfig
 	S3Config
+	LoginAttemptConfig
+	PasswordConfig
+	MetricsConfig
+	MailConfig
+	AppConfig
+	MFAConfig
+	WebAuthnConfig
+	OIDCConfig
+	OAuthConfig
+	AuditConfig
+	ProxyConfig
+}
+
+type JWSConfig struct {
+	// JWSSigningKey is the HMAC secret for HS256. It signs tokens only if no asymmetric key is configured,
+	// otherwise it is kept to verify tokens issued before the asymmetric keys.
+	JWSSigningKey string
+	// JWSKeyFiles are paths of PEM files containing private or public keys. (ECDSA P-256, Ed25519 or RSA)
+	JWSKeyFiles []string
+	// JWSKeys is PEM encoded keys given directly, e.g. from a secret manager.
+	JWSKeys string
+	// JWSActiveKeyID is the key ID (JWK thumbprint) of the private key signing new tokens.
+	// If empty, the first private key is used.
+	JWSActiveKeyID string
 }
 
 type DynamoConfig struct {
@@ -24,11 +50,110 @@ type S3Config struct {
 	PublicCloudfrontEndpoint string
 }
 
+type LoginAttemptConfig struct {
+	// LoginAttemptStore is where failed login attempts are counted. "dynamo" (default) or "memory".
+	// Counters in memory are not shared between server instances.
+	LoginAttemptStore string
+}
+
+type PasswordConfig struct {
+	// PasswordHashAlgorithm hashes new passwords. "argon2id" (default), "pbkdf2_sha256", "bcrypt" or "scrypt".
+	PasswordHashAlgorithm string
+	// PasswordHashingConcurrency is how many passwords are hashed at once. If zero, the number of CPUs.
+	PasswordHashingConcurrency int
+	// PasswordHashingQueueSize is how many passwords may wait to be hashed. Requests beyond it get 503.
+	// If zero, 4 times the concurrency.
+	PasswordHashingQueueSize int
+}
+
+type MetricsConfig struct {
+	// MetricsAddr is the address serving metrics at /debug/vars. If empty, metrics are not served.
+	// It should not be exposed publicly.
+	MetricsAddr string
+}
+
+type MailConfig struct {
+	// Mailer is how mails are delivered. "file" (default) writes them to MailDir, or logs them if it is empty.
+	// "smtp" sends them through the SMTP server.
+	Mailer       string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+type AppConfig struct {
+	// AppBaseURL is the URL of the web app, which links in mails point to. e.g. https://zenbu.example.com
+	AppBaseURL string
+}
+
+type MFAConfig struct {
+	// MFAIssuer names the service in authenticator apps. If empty, "zenbu".
+	MFAIssuer string
+	// MFAEncryptionKeys are base64 encoded 32 bytes keys encrypting TOTP secrets.
+	// The first key encrypts new secrets, and the others are kept to decrypt secrets encrypted before rotation.
+	MFAEncryptionKeys []string
+}
+
+type WebAuthnConfig struct {
+	// WebAuthnRPID is the domain passkeys are bound to. If empty, the host of AppBaseURL.
+	// It can't be changed without losing the passkeys registered before.
+	WebAuthnRPID string
+	// WebAuthnRPName names the service to users registering passkeys. If empty, "zenbu".
+	WebAuthnRPName string
+	// WebAuthnOrigins are the origins of the web app allowed to use passkeys. If empty, the origin of AppBaseURL.
+	WebAuthnOrigins []string
+}
+
+type OIDCConfig struct {
+	// OIDCRedirectURL is the page of the web app providers redirect back to, which passes the code to zenbu.
+	// If empty, AppBaseURL + "/oidc/callback".
+	OIDCRedirectURL string
+	// OIDCProviders are configured by OIDC_PROVIDERS, a comma separated list of names,
+	// and OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and OIDC_<NAME>_SCOPES for each name.
+	OIDCProviders []OIDCProviderConfig
+}
+
+type OIDCProviderConfig struct {
+	// Name identifies the provider in routes, e.g. "google" for /login/oidc/google.
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Scopes are requested in addition to "openid". If empty, "email" and "profile".
+	Scopes []string
+}
+
+type OAuthConfig struct {
+	// OAuthIssuer is the public URL of zenbu as an OAuth authorization server and OpenID provider,
+	// e.g. https://auth.zenbu.example.com. If empty, http://localhost:8080.
+	OAuthIssuer string
+}
+
+type AuditConfig struct {
+	// AuditLogFile is the file audit events are appended to as JSON lines, besides DynamoDB.
+	// If empty, events are only stored in DynamoDB.
+	AuditLogFile string
+}
+
+type ProxyConfig struct {
+	// TrustedProxies are IP addresses or CIDRs of proxies, e.g. load balancers, in front of zenbu.
+	// X-Forwarded-For is honored only if the request comes from one of them. If empty, it is ignored.
+	TrustedProxies []string
+}
+
 // LoadConfigFromEnv initializes the configuration from environment variables.
 // TODO: use library such as godotenv to load configuration from .env file.
 func LoadConfigFromEnv() Config {
 	return Config{
-		JWSSigningKey: os.Getenv("JWS_SIGNING_KEY"),
+		JWSConfig: JWSConfig{
+			JWSSigningKey:  os.Getenv("JWS_SIGNING_KEY"),
+			JWSKeyFiles:    splitList(os.Getenv("JWS_KEY_FILES")),
+			JWSKeys:        os.Getenv("JWS_KEYS"),
+			JWSActiveKeyID: os.Getenv("JWS_ACTIVE_KEY_ID"),
+		},
 		DynamoConfig: DynamoConfig{
 			Endpoint:  os.Getenv("DYNAMO_ENDPOINT"),
 			TableName: os.Getenv("DYNAMO_TABLE_NAME"),
@@ -39,5 +164,82 @@ func LoadConfigFromEnv() Config {
 			PublicDir:                os.Getenv("S3_PUBLIC_DIR"),
 			PublicCloudfrontEndpoint: os.Getenv("S3_PUBLIC_CLOUDFRONT_ENDPOINT"),
 		},
+		LoginAttemptConfig: LoginAttemptConfig{
+			LoginAttemptStore: os.Getenv("LOGIN_ATTEMPT_STORE"),
+		},
+		PasswordConfig: PasswordConfig{
+			PasswordHashAlgorithm:      os.Getenv("PASSWORD_HASH_ALGORITHM"),
+			PasswordHashingConcurrency: atoi(os.Getenv("PASSWORD_HASHING_CONCURRENCY")),
+			PasswordHashingQueueSize:   atoi(os.Getenv("PASSWORD_HASHING_QUEUE_SIZE")),
+		},
+		MetricsConfig: MetricsConfig{
+			MetricsAddr: os.Getenv("METRICS_ADDR"),
+		},
+		MailConfig: MailConfig{
+			Mailer:       os.Getenv("MAILER"),
+			MailFrom:     os.Getenv("MAIL_FROM"),
+			MailDir:      os.Getenv("MAIL_DIR"),
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     os.Getenv("SMTP_PORT"),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		},
+		AppConfig: AppConfig{
+			AppBaseURL: os.Getenv("APP_BASE_URL"),
+		},
+		MFAConfig: MFAConfig{
+			MFAIssuer:         os.Getenv("MFA_ISSUER"),
+			MFAEncryptionKeys: splitList(os.Getenv("MFA_ENCRYPTION_KEYS")),
+		},
+		WebAuthnConfig: WebAuthnConfig{
+			WebAuthnRPID:    os.Getenv("WEBAUTHN_RP_ID"),
+			WebAuthnRPName:  os.Getenv("WEBAUTHN_RP_NAME"),
+			WebAuthnOrigins: splitList(os.Getenv("WEBAUTHN_ORIGINS")),
+		},
+		OIDCConfig: OIDCConfig{
+			OIDCRedirectURL: os.Getenv("OIDC_REDIRECT_URL"),
+			OIDCProviders:   loadOIDCProviders(),
+		},
+		OAuthConfig: OAuthConfig{
+			OAuthIssuer: os.Getenv("OAUTH_ISSUER"),
+		},
+		AuditConfig: AuditConfig{
+			AuditLogFile: os.Getenv("AUDIT_LOG_FILE"),
+		},
+		ProxyConfig: ProxyConfig{
+			TrustedProxies: splitList(os.Getenv("TRUSTED_PROXIES")),
+		},
+	}
+}
+
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range splitList(os.Getenv("OIDC_PROVIDERS")) {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		})
+	}
+	return providers
+}
+
+// splitList splits comma separated values, ignoring empty ones.
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
 	}
+	return values
+}
+
+// atoi parses an integer, returning zero if it is empty or invalid.
+func atoi(s string) int {
+	i, _ := strconv.Atoi(strings.TrimSpace(s))
+	return i
 }
@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/validutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+// AdminUserRes is a user as seen by operators.
+type AdminUserRes struct {
+	ID                    string     `json:"id"`
+	Username              string     `json:"username"`
+	Roles                 []string   `json:"roles"`
+	Email                 string     `json:"email,omitempty"`
+	EmailVerified         bool       `json:"email_verified"`
+	Disabled              bool       `json:"disabled"`
+	DisabledAt            *time.Time `json:"disabled_at,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+func newAdminUserRes(u *domain.User) *AdminUserRes {
+	roles := make([]string, 0, len(u.Roles))
+	for _, r := range u.Roles {
+		roles = append(roles, string(r))
+	}
+
+	res := &AdminUserRes{
+		ID:                    u.ID.String(),
+		Username:              u.Username,
+		Roles:                 roles,
+		Email:                 u.Email,
+		EmailVerified:         u.IsEmailVerified(),
+		Disabled:              u.IsDisabled(),
+		PasswordResetRequired: u.PasswordResetRequired,
+		CreatedAt:             u.CreatedAt,
+		UpdatedAt:             u.UpdatedAt,
+	}
+	if u.IsDisabled() {
+		res.DisabledAt = &u.DisabledAt
+	}
+	return res
+}
+
+type ListUsersCtrl struct {
+	uc usecase.ListUsersUC
+}
+
+func NewListUsersCtrl(uc usecase.ListUsersUC) *ListUsersCtrl {
+	return &ListUsersCtrl{uc: uc}
+}
+
+type ListUsersRes struct {
+	Users      []*AdminUserRes `json:"users"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+func (l *ListUsersCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var limit int
+	if v := req.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid limit")
+		}
+	}
+
+	res, err := l.uc.Execute(req.Context(), limit, req.URL.Query().Get("cursor"))
+	if errors.Is(err, usecase.ErrInvalidCursor) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidCursor, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ListUsers", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	users := make([]*AdminUserRes, 0, len(res.Users))
+	for _, u := range res.Users {
+		users = append(users, newAdminUserRes(u))
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, &ListUsersRes{Users: users, NextCursor: res.NextCursor})
+}
+
+type GetUserCtrl struct {
+	uc usecase.GetUserUC
+}
+
+func NewGetUserCtrl(uc usecase.GetUserUC) *GetUserCtrl {
+	return &GetUserCtrl{uc: uc}
+}
+
+func (g *GetUserCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid user id")
+	}
+
+	u, err := g.uc.Execute(req.Context(), userID)
+	if errors.Is(err, usecase.ErrUserNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute GetUser", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, newAdminUserRes(u))
+}
+
+// SetUserDisabledCtrl serves both disabling and enabling a user.
+type SetUserDisabledCtrl struct {
+	uc       usecase.SetUserDisabledUC
+	disabled bool
+}
+
+func NewSetUserDisabledCtrl(uc usecase.SetUserDisabledUC, disabled bool) *SetUserDisabledCtrl {
+	return &SetUserDisabledCtrl{uc: uc, disabled: disabled}
+}
+
+func (s *SetUserDisabledCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid user id")
+	}
+
+	u, err := s.uc.Execute(req.Context(), principalFrom(req.Context()), userID, s.disabled)
+	if errors.Is(err, usecase.ErrUserNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUserUpdated) {
+		return responseUserUpdated(w)
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute SetUserDisabled", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, newAdminUserRes(u))
+}
+
+type ForcePasswordResetCtrl struct {
+	uc usecase.ForcePasswordResetUC
+}
+
+func NewForcePasswordResetCtrl(uc usecase.ForcePasswordResetUC) *ForcePasswordResetCtrl {
+	return &ForcePasswordResetCtrl{uc: uc}
+}
+
+func (f *ForcePasswordResetCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid user id")
+	}
+
+	err = f.uc.Execute(req.Context(), principalFrom(req.Context()), userID)
+	if errors.Is(err, usecase.ErrUserNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUserUpdated) {
+		return responseUserUpdated(w)
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ForcePasswordReset", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
+
+type RevokeUserTokensCtrl struct {
+	uc usecase.RevokeUserTokensUC
+}
+
+func NewRevokeUserTokensCtrl(uc usecase.RevokeUserTokensUC) *RevokeUserTokensCtrl {
+	return &RevokeUserTokensCtrl{uc: uc}
+}
+
+func (r *RevokeUserTokensCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid user id")
+	}
+
+	err = r.uc.Execute(req.Context(), principalFrom(req.Context()), userID)
+	if errors.Is(err, usecase.ErrUserNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute RevokeUserTokens", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
+
+type ChangeUsernameCtrl struct {
+	uc usecase.ChangeUsernameUC
+}
+
+func NewChangeUsernameCtrl(uc usecase.ChangeUsernameUC) *ChangeUsernameCtrl {
+	return &ChangeUsernameCtrl{uc: uc}
+}
+
+type ChangeUsernameReq struct {
+	Username string `json:"username" validate:"required,max=32,min=1"`
+}
+
+func (c *ChangeUsernameCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid user id")
+	}
+
+	var reqBody ChangeUsernameReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	u, err := c.uc.Execute(req.Context(), principalFrom(req.Context()), userID, reqBody.Username)
+	if errors.Is(err, usecase.ErrUserNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUsernameAlreadyExists) {
+		return httputil.ResponseError(w, http.StatusConflict, CodeUsernameAlreadyExists, "username already exists")
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ChangeUsername", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, newAdminUserRes(u))
+}
+
+type DeleteUserCtrl struct {
+	uc usecase.DeleteUserUC
+}
+
+func NewDeleteUserCtrl(uc usecase.DeleteUserUC) *DeleteUserCtrl {
+	return &DeleteUserCtrl{uc: uc}
+}
+
+func (d *DeleteUserCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid user id")
+	}
+
+	err = d.uc.Execute(req.Context(), principalFrom(req.Context()), userID)
+	if errors.Is(err, usecase.ErrUserNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute DeleteUser", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
+
+// UnlockUserCtrl lifts the login lockout of a user.
+type UnlockUserCtrl struct {
+	uc usecase.UnlockUserUC
+}
+
+func NewUnlockUserCtrl(uc usecase.UnlockUserUC) *UnlockUserCtrl {
+	return &UnlockUserCtrl{uc: uc}
+}
+
+func (u *UnlockUserCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid user id")
+	}
+
+	err = u.uc.Execute(req.Context(), principalFrom(req.Context()), userID)
+	if errors.Is(err, usecase.ErrUserNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute UnlockUser", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
+
+// ResetMFACtrl disables MFA of a user who lost every second factor.
+type ResetMFACtrl struct {
+	uc usecase.ResetMFAUC
+}
+
+func NewResetMFACtrl(uc usecase.ResetMFAUC) *ResetMFACtrl {
+	return &ResetMFACtrl{uc: uc}
+}
+
+func (r *ResetMFACtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid user id")
+	}
+
+	err = r.uc.Execute(req.Context(), principalFrom(req.Context()), userID)
+	if errors.Is(err, usecase.ErrUserNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ResetMFA", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/validutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+// APIKeyRes never has the key itself, which is shown only once when it is created.
+type APIKeyRes struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Prefix tells the keys apart from other secrets, e.g. in secret scanners.
+	Prefix     string    `json:"prefix"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func newAPIKeyRes(k *domain.APIKey) *APIKeyRes {
+	scopes := make([]string, 0, len(k.Scopes))
+	for _, s := range k.Scopes {
+		scopes = append(scopes, string(s))
+	}
+	return &APIKeyRes{
+		ID:         k.ID.String(),
+		Name:       k.Name,
+		Scopes:     scopes,
+		Prefix:     domain.APIKeyPrefix,
+		CreatedAt:  k.CreatedAt,
+		LastUsedAt: k.LastUsedAt,
+		ExpiresAt:  k.ExpiresAt,
+	}
+}
+
+type CreateAPIKeyCtrl struct {
+	uc usecase.CreateAPIKeyUC
+}
+
+func NewCreateAPIKeyCtrl(uc usecase.CreateAPIKeyUC) *CreateAPIKeyCtrl {
+	return &CreateAPIKeyCtrl{uc: uc}
+}
+
+type CreateAPIKeyReq struct {
+	Name   string   `json:"name" validate:"required,max=64"`
+	Scopes []string `json:"scopes" validate:"required,min=1,max=20,dive,max=64"`
+	// ExpiresInDays is 30 days if omitted.
+	ExpiresInDays int `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+}
+
+// CreateAPIKeyRes has the key, which is never shown again.
+type CreateAPIKeyRes struct {
+	*APIKeyRes
+	Token string `json:"token"`
+}
+
+func (c *CreateAPIKeyCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody CreateAPIKeyReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	scopes := make([]domain.Scope, 0, len(reqBody.Scopes))
+	for _, s := range reqBody.Scopes {
+		scopes = append(scopes, domain.Scope(s))
+	}
+
+	res, err := c.uc.Execute(req.Context(), principalFrom(req.Context()), &usecase.CreateAPIKeyReq{
+		Name:      reqBody.Name,
+		Scopes:    scopes,
+		ExpiresIn: time.Duration(reqBody.ExpiresInDays) * 24 * time.Hour,
+	})
+	if errors.Is(err, usecase.ErrReauthenticationRequired) {
+		return responseReauthenticationRequired(w)
+	}
+	if errors.Is(err, usecase.ErrImpersonationForbidden) {
+		return responseImpersonationForbidden(w)
+	}
+	if errors.Is(err, usecase.ErrPermissionDenied) {
+		return httputil.ResponseError(w, http.StatusForbidden, httputil.CodePermissionDenied, err.Error())
+	}
+	if errors.Is(err, usecase.ErrTooManyAPIKeys) {
+		return httputil.ResponseError(w, http.StatusConflict, CodeTooManyAPIKeys, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute CreateAPIKey", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	w.Header().Set(httputil.CacheControl, "no-store")
+	return httputil.ResponseJSON(w, http.StatusCreated, &CreateAPIKeyRes{
+		APIKeyRes: newAPIKeyRes(res.APIKey),
+		Token:     res.Key,
+	})
+}
+
+type ListAPIKeysCtrl struct {
+	uc usecase.ListAPIKeysUC
+}
+
+func NewListAPIKeysCtrl(uc usecase.ListAPIKeysUC) *ListAPIKeysCtrl {
+	return &ListAPIKeysCtrl{uc: uc}
+}
+
+type ListAPIKeysRes struct {
+	Tokens []*APIKeyRes `json:"tokens"`
+}
+
+func (l *ListAPIKeysCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	keys, err := l.uc.Execute(req.Context(), principalFrom(req.Context()))
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ListAPIKeys", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	res := make([]*APIKeyRes, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, newAPIKeyRes(k))
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &ListAPIKeysRes{Tokens: res})
+}
+
+type RevokeAPIKeyCtrl struct {
+	uc usecase.RevokeAPIKeyUC
+}
+
+func NewRevokeAPIKeyCtrl(uc usecase.RevokeAPIKeyUC) *RevokeAPIKeyCtrl {
+	return &RevokeAPIKeyCtrl{uc: uc}
+}
+
+func (r *RevokeAPIKeyCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	id, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid token id")
+	}
+
+	err = r.uc.Execute(req.Context(), principalFrom(req.Context()), id)
+	if errors.Is(err, usecase.ErrAPIKeyNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeAPIKeyNotFound, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute RevokeAPIKey", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+type AuditEventRes struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	UserID string `json:"user_id"`
+	// ActorID is the admin who acted, if not the user.
+	ActorID string            `json:"actor_id,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+	// CorrelationID is of the request the event occurred in, to be quoted to support.
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func newAuditEventRes(e *domain.AuditEvent) *AuditEventRes {
+	res := &AuditEventRes{
+		ID:            e.ID.String(),
+		Type:          string(e.Type),
+		UserID:        e.UserID.String(),
+		Details:       e.Details,
+		CorrelationID: e.CorrelationID,
+		CreatedAt:     e.CreatedAt,
+	}
+	if e.ActorID != uuid.Nil {
+		res.ActorID = e.ActorID.String()
+	}
+	return res
+}
+
+type ListAuditEventsRes struct {
+	Events     []*AuditEventRes `json:"events"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+func newListAuditEventsRes(res *usecase.ListAuditEventsRes) *ListAuditEventsRes {
+	events := make([]*AuditEventRes, 0, len(res.Events))
+	for _, e := range res.Events {
+		events = append(events, newAuditEventRes(e))
+	}
+	return &ListAuditEventsRes{Events: events, NextCursor: res.NextCursor}
+}
+
+// parseLimit parses the limit of a page from the query. Zero means the default limit.
+func parseLimit(query url.Values) (int, bool) {
+	v := query.Get("limit")
+	if v == "" {
+		return 0, true
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit <= 0 {
+		return 0, false
+	}
+	return limit, true
+}
+
+// ListActivityCtrl lists the audit events of the user, e.g. logins and password changes.
+type ListActivityCtrl struct {
+	uc usecase.ListActivityUC
+}
+
+func NewListActivityCtrl(uc usecase.ListActivityUC) *ListActivityCtrl {
+	return &ListActivityCtrl{uc: uc}
+}
+
+func (l *ListActivityCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	limit, ok := parseLimit(req.URL.Query())
+	if !ok {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid limit")
+	}
+
+	res, err := l.uc.Execute(req.Context(), principalFrom(req.Context()), limit, req.URL.Query().Get("cursor"))
+	if errors.Is(err, usecase.ErrInvalidCursor) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidCursor, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ListActivity", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, newListAuditEventsRes(res))
+}
+
+// ListAuditEventsCtrl lists audit events for operators, filtered by the query:
+// user_id, actor_id, type, and from and to in RFC 3339.
+// Without user_id, events of all users are listed for the day of to, which is today by default.
+type ListAuditEventsCtrl struct {
+	uc usecase.ListAuditEventsUC
+}
+
+func NewListAuditEventsCtrl(uc usecase.ListAuditEventsUC) *ListAuditEventsCtrl {
+	return &ListAuditEventsCtrl{uc: uc}
+}
+
+func (l *ListAuditEventsCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	query := req.URL.Query()
+	q := &usecase.AuditEventQuery{
+		Type:   domain.AuditEventType(query.Get("type")),
+		Cursor: query.Get("cursor"),
+	}
+
+	var ok bool
+	if q.Limit, ok = parseLimit(query); !ok {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid limit")
+	}
+	for name, id := range map[string]*uuid.UUID{"user_id": &q.UserID, "actor_id": &q.ActorID} {
+		if v := query.Get(name); v != "" {
+			var err error
+			if *id, err = uuid.Parse(v); err != nil {
+				return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams,
+					"invalid "+name)
+			}
+		}
+	}
+	for name, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if v := query.Get(name); v != "" {
+			var err error
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams,
+					"invalid "+name)
+			}
+		}
+	}
+	to := q.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if q.From.After(to) {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams,
+			"from must not be after to")
+	}
+
+	res, err := l.uc.Execute(req.Context(), q)
+	if errors.Is(err, usecase.ErrInvalidCursor) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidCursor, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ListAuditEvents", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, newListAuditEventsRes(res))
+}
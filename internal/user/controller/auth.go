@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/dpoputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+type principalKey struct{}
+
+func contextWithPrincipal(ctx context.Context, p *usecase.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// principalFrom returns the principal resolved by authenticator.
+// If the route is not authenticated, it returns anonymous principal.
+func principalFrom(ctx context.Context) *usecase.Principal {
+	p, ok := ctx.Value(principalKey{}).(*usecase.Principal)
+	if !ok || p == nil {
+		return usecase.AnonymousPrincipal()
+	}
+	return p
+}
+
+// dpopProofOf returns the DPoP proof of the request, or nil if it is not sent. (RFC 9449 Section 4.1)
+// baseURL is the URL zenbu is served at, as the request may be forwarded by a proxy under another URL.
+func dpopProofOf(req *http.Request, baseURL string) (*usecase.DPoPProofReq, error) {
+	proofs := req.Header.Values(dpoputil.Header)
+	if len(proofs) == 0 {
+		return nil, nil
+	}
+	if len(proofs) > 1 {
+		return nil, errors.New("only one dpop proof can be sent")
+	}
+	return &usecase.DPoPProofReq{Proof: proofs[0], Method: req.Method, URL: baseURL + req.URL.Path}, nil
+}
+
+// authenticator is the authentication middleware. It resolves the principal of the access token once per request,
+// and responds 401 uniformly when the token is missing, invalid or expired.
+// Tokens are sent by the Bearer scheme, or by the DPoP scheme with a proof of the key they are bound to.
+// Browsers send them in cookies instead, with a csrf token for unsafe methods.
+// Requests of admins impersonating users are recorded before they are served.
+type authenticator struct {
+	uc                  usecase.ResolvePrincipalUC
+	recordImpersonation usecase.RecordImpersonatedRequestUC
+	// baseURL is the URL zenbu is served at, which DPoP proofs are made for.
+	baseURL string
+}
+
+func newAuthenticator(
+	uc usecase.ResolvePrincipalUC, recordImpersonation usecase.RecordImpersonatedRequestUC, baseURL string,
+) *authenticator {
+	return &authenticator{uc: uc, recordImpersonation: recordImpersonation, baseURL: baseURL}
+}
+
+// required rejects requests without a valid access token.
+func (a *authenticator) required(next httputil.HandlerFuncWithErr) httputil.HandlerFuncWithErr {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		return a.authenticate(w, req, next)
+	}
+}
+
+// optional lets requests without credentials through as anonymous principal.
+// Credentials are still verified if given, so that clients notice an invalid token.
+func (a *authenticator) optional(next httputil.HandlerFuncWithErr) httputil.HandlerFuncWithErr {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		if req.Header.Get(httputil.Authorization) == "" && !isCookieAuthenticated(req) {
+			return next(w, req.WithContext(contextWithPrincipal(req.Context(), usecase.AnonymousPrincipal())))
+		}
+		return a.authenticate(w, req, next)
+	}
+}
+
+func (a *authenticator) authenticate(w http.ResponseWriter, req *http.Request, next httputil.HandlerFuncWithErr) error {
+	if isCookieAuthenticated(req) {
+		if err := verifyCSRFToken(req); err != nil {
+			return httputil.ResponseError(w, http.StatusForbidden, CodeInvalidCSRFToken, err.Error())
+		}
+		c, _ := req.Cookie(accessTokenCookie)
+		return a.resolve(w, req, next, &usecase.ResolvePrincipalReq{Token: c.Value})
+	}
+
+	scheme, token, err := httputil.GetAuthorization(req)
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated, err.Error())
+	}
+
+	resolveReq := &usecase.ResolvePrincipalReq{Token: token}
+	switch scheme {
+	case httputil.Bearer:
+	case dpoputil.Scheme:
+		resolveReq.DPoP, err = dpopProofOf(req, a.baseURL)
+		if err == nil && resolveReq.DPoP == nil {
+			err = errors.New("dpop proof is required")
+		}
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `DPoP error="invalid_dpop_proof"`)
+			return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated, err.Error())
+		}
+	default:
+		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated,
+			"unsupported authorization scheme")
+	}
+	return a.resolve(w, req, next, resolveReq)
+}
+
+func (a *authenticator) resolve(
+	w http.ResponseWriter, req *http.Request, next httputil.HandlerFuncWithErr, resolveReq *usecase.ResolvePrincipalReq,
+) error {
+	p, err := a.uc.Execute(req.Context(), resolveReq)
+	if errors.Is(err, usecase.ErrInvalidDPoPProof) {
+		w.Header().Set("WWW-Authenticate", `DPoP error="invalid_dpop_proof"`)
+		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated, "invalid dpop proof")
+	}
+	if errors.Is(err, usecase.ErrTokenExpired) {
+		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeTokenExpired, err.Error())
+	}
+	if errors.Is(err, usecase.ErrInvalidToken) {
+		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated, "invalid token")
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ResolvePrincipal", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	logger := logutil.From(req.Context()).With(slog.String("user_id", p.UserID.String()))
+	if p.IsImpersonated() {
+		logger = logger.With(slog.String("actor_id", p.ActorID.String()))
+	}
+	ctx := logutil.ContextWithLogger(contextWithPrincipal(req.Context(), p), logger)
+
+	if p.IsImpersonated() {
+		err := a.recordImpersonation.Execute(ctx, p, &usecase.ImpersonatedRequest{Method: req.Method, Path: req.URL.Path})
+		if err != nil {
+			logger.Error("failed to execute RecordImpersonatedRequest", slog.Any("err", err))
+			return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+		}
+	}
+	return next(w, req.WithContext(ctx))
+}
+
+// authorize returns a middleware rejecting principals not granted every scope.
+// It must be applied after required or optional, which resolve the principal.
+func authorize(scopes ...domain.Scope) httputil.Middleware {
+	return func(next httputil.HandlerFuncWithErr) httputil.HandlerFuncWithErr {
+		return func(w http.ResponseWriter, req *http.Request) error {
+			p := principalFrom(req.Context())
+			if p.IsAnonymous() {
+				return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated, "authentication required")
+			}
+			if err := p.Authorize(scopes...); err != nil {
+				return httputil.ResponseError(w, http.StatusForbidden, httputil.CodePermissionDenied, err.Error())
+			}
+			return next(w, req)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+// Browsers keep the tokens in cookies, out of the reach of scripts, instead of in storage.
+// A client asks for cookies by the Session-Mode header when it logs in, and the tokens are then issued in cookies
+// and left out of the response. Requests with an Authorization header are never authenticated by cookies.
+const (
+	sessionModeHeader = "Session-Mode"
+	sessionModeCookie = "cookie"
+
+	// __Host- cookies are sent only to the host which set them, over HTTPS. (RFC 6265bis Section 4.1.3)
+	accessTokenCookie = "__Host-zenbu_at"
+	// the refresh token is sent only to the endpoint using it, so it can't have the __Host- prefix requiring "/".
+	refreshTokenCookie     = "__Secure-zenbu_rt"
+	refreshTokenCookiePath = "/token/refresh"
+
+	// csrfTokenCookie is readable by scripts of the web app, which send it back in csrfTokenHeader.
+	// Other sites can neither read the cookie nor set the header, which proves that a request is made by the app.
+	csrfTokenCookie = "__Host-zenbu_csrf"
+	csrfTokenHeader = "Csrf-Token"
+)
+
+// sessionCookieMaxAge keeps the cookies as long as the session.
+var sessionCookieMaxAge = int(usecase.SessionExpiresIn.Seconds())
+
+var errInvalidCSRFToken = errors.New("csrf token does not match")
+
+// wantsCookies reports whether the tokens of the response are issued in cookies,
+// which is asked by the Session-Mode header, or implied by a request authenticated by cookies.
+func wantsCookies(req *http.Request) bool {
+	return req.Header.Get(sessionModeHeader) == sessionModeCookie || isCookieAuthenticated(req)
+}
+
+// isCookieAuthenticated reports whether the request is authenticated by the access token cookie.
+func isCookieAuthenticated(req *http.Request) bool {
+	if req.Header.Get(httputil.Authorization) != "" {
+		return false
+	}
+	_, err := req.Cookie(accessTokenCookie)
+	return err == nil
+}
+
+// issueTokens sets the tokens of a new session in cookies if they are asked for,
+// and returns the tokens left for the response body. refreshToken is empty when only the access token is renewed.
+func issueTokens(w http.ResponseWriter, req *http.Request, accessToken, refreshToken string) (string, string, error) {
+	if accessToken == "" || !wantsCookies(req) {
+		return accessToken, refreshToken, nil
+	}
+	if err := setSessionCookies(w, req, accessToken, refreshToken, refreshToken != ""); err != nil {
+		return "", "", err
+	}
+	return "", "", nil
+}
+
+// setSessionCookies sets the tokens in cookies. A new session gets a new csrf token by renewCSRFToken,
+// but it is kept while the session is refreshed, so that requests already made by other tabs are not rejected.
+func setSessionCookies(w http.ResponseWriter, req *http.Request, accessToken, refreshToken string, renewCSRFToken bool) error {
+	// the access token cookie lives as long as the session, so that an expired token is still sent
+	// and rejected with CodeTokenExpired, which tells the app to refresh it.
+	http.SetCookie(w, sessionCookie(accessTokenCookie, accessToken, "/", sessionCookieMaxAge, true))
+	if refreshToken != "" {
+		c := sessionCookie(refreshTokenCookie, refreshToken, refreshTokenCookiePath, sessionCookieMaxAge, true)
+		c.SameSite = http.SameSiteStrictMode
+		http.SetCookie(w, c)
+	}
+	if _, err := req.Cookie(csrfTokenCookie); err != nil || renewCSRFToken {
+		csrfToken, err := newCSRFToken()
+		if err != nil {
+			return err
+		}
+		http.SetCookie(w, sessionCookie(csrfTokenCookie, csrfToken, "/", sessionCookieMaxAge, false))
+	}
+	w.Header().Set(httputil.CacheControl, "no-store")
+	return nil
+}
+
+// clearSessionCookies removes the cookies of a session which is over.
+func clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, sessionCookie(accessTokenCookie, "", "/", -1, true))
+	http.SetCookie(w, sessionCookie(refreshTokenCookie, "", refreshTokenCookiePath, -1, true))
+	http.SetCookie(w, sessionCookie(csrfTokenCookie, "", "/", -1, false))
+}
+
+func sessionCookie(name, value, path string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// verifyCSRFToken checks the csrf token of requests authenticated by cookies, which browsers send with requests
+// made by any site. Safe methods are not checked, as they must not change anything. (double-submit cookie)
+func verifyCSRFToken(req *http.Request) error {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	c, err := req.Cookie(csrfTokenCookie)
+	if err != nil {
+		return errInvalidCSRFToken
+	}
+	token := req.Header.Get(csrfTokenHeader)
+	if c.Value == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(token)) != 1 {
+		return errInvalidCSRFToken
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/validutil"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+type ChangeEmailCtrl struct {
+	uc usecase.ChangeEmailUC
+}
+
+func NewChangeEmailCtrl(uc usecase.ChangeEmailUC) *ChangeEmailCtrl {
+	return &ChangeEmailCtrl{uc: uc}
+}
+
+type ChangeEmailReq struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+type ChangeEmailRes struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+func (c *ChangeEmailCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody ChangeEmailReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	u, err := c.uc.Execute(req.Context(), principalFrom(req.Context()), reqBody.Email)
+	if errors.Is(err, usecase.ErrEmailAlreadyExists) {
+		return httputil.ResponseError(w, http.StatusConflict, CodeEmailAlreadyExists, "email already exists")
+	}
+	if errors.Is(err, usecase.ErrPermissionDenied) {
+		return httputil.ResponseError(w, http.StatusForbidden, httputil.CodePermissionDenied, err.Error())
+	}
+	if errors.Is(err, usecase.ErrTooManyVerificationMails) {
+		return httputil.ResponseError(w, http.StatusTooManyRequests, CodeTooManyAttempts, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ChangeEmail", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &ChangeEmailRes{Email: u.Email, EmailVerified: u.IsEmailVerified()})
+}
+
+type SendEmailVerificationCtrl struct {
+	uc usecase.SendEmailVerificationUC
+}
+
+func NewSendEmailVerificationCtrl(uc usecase.SendEmailVerificationUC) *SendEmailVerificationCtrl {
+	return &SendEmailVerificationCtrl{uc: uc}
+}
+
+func (s *SendEmailVerificationCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	err := s.uc.Execute(req.Context(), principalFrom(req.Context()))
+	if errors.Is(err, usecase.ErrEmailNotSet) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeEmailNotSet, err.Error())
+	}
+	if errors.Is(err, usecase.ErrEmailAlreadyVerified) {
+		return httputil.ResponseError(w, http.StatusConflict, CodeEmailAlreadyVerified, err.Error())
+	}
+	if errors.Is(err, usecase.ErrTooManyVerificationMails) {
+		return httputil.ResponseError(w, http.StatusTooManyRequests, CodeTooManyAttempts, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute SendEmailVerification", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
+
+type VerifyEmailCtrl struct {
+	uc usecase.VerifyEmailUC
+}
+
+func NewVerifyEmailCtrl(uc usecase.VerifyEmailUC) *VerifyEmailCtrl {
+	return &VerifyEmailCtrl{uc: uc}
+}
+
+type VerifyEmailReq struct {
+	Token string `json:"token" validate:"required,max=256"`
+}
+
+func (v *VerifyEmailCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody VerifyEmailReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	err := v.uc.Execute(req.Context(), reqBody.Token)
+	if errors.Is(err, usecase.ErrInvalidEmailVerification) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidVerification, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute VerifyEmail", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
+
+type VerifyEmailCodeCtrl struct {
+	uc usecase.VerifyEmailCodeUC
+}
+
+func NewVerifyEmailCodeCtrl(uc usecase.VerifyEmailCodeUC) *VerifyEmailCodeCtrl {
+	return &VerifyEmailCodeCtrl{uc: uc}
+}
+
+type VerifyEmailCodeReq struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+func (v *VerifyEmailCodeCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody VerifyEmailCodeReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	err := v.uc.Execute(req.Context(), principalFrom(req.Context()), reqBody.Code)
+	if errors.Is(err, usecase.ErrInvalidEmailVerification) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidVerification, err.Error())
+	}
+	if errors.Is(err, usecase.ErrTooManyVerificationAttempts) {
+		return httputil.ResponseError(w, http.StatusTooManyRequests, CodeTooManyAttempts, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute VerifyEmailCode", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+type CreateGuestCtrl struct {
+	uc usecase.CreateGuestUC
+}
+
+func NewCreateGuestCtrl(uc usecase.CreateGuestUC) *CreateGuestCtrl {
+	return &CreateGuestCtrl{uc: uc}
+}
+
+// CreateGuestRes has the tokens of the guest, which are its only credentials until it signs up.
+type CreateGuestRes struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+func (c *CreateGuestCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	res, err := c.uc.Execute(req.Context(), deviceOf(req))
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute CreateGuest", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	token, refreshToken, err := issueTokens(w, req, res.AccessToken, res.RefreshToken)
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to issue session cookies", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+	return httputil.ResponseJSON(w, http.StatusCreated, &CreateGuestRes{Token: token, RefreshToken: refreshToken})
+}
@@ -3,21 +3,88 @@ package controller
 import (
 	"errors"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/google/uuid"
 
+	"github.com/buzzryan/zenbu/internal/commonutil/dpoputil"
 	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
 	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
 	"github.com/buzzryan/zenbu/internal/commonutil/validutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
 	"github.com/buzzryan/zenbu/internal/user/usecase"
 )
 
 const (
-	CodeUsernameAlreadyExists = 2000
-	CodeUserNotFound          = 2001
+	CodeUsernameAlreadyExists   = 2000
+	CodeUserNotFound            = 2001
+	CodeInvalidRefreshToken     = 2002
+	CodeRefreshTokenReused      = 2003
+	CodeSessionNotFound         = 2004
+	CodeUserDisabled            = 2005
+	CodePasswordResetRequired   = 2006
+	CodeInvalidCursor           = 2007
+	CodeLoginLocked             = 2008
+	CodeEmailAlreadyExists      = 2009
+	CodeEmailNotSet             = 2010
+	CodeEmailAlreadyVerified    = 2011
+	CodeInvalidVerification     = 2012
+	CodeTooManyAttempts         = 2013
+	CodeInvalidPasswordReset    = 2014
+	CodeInvalidPassword         = 2015
+	CodeMFANotEnrolled          = 2016
+	CodeMFAAlreadyEnabled       = 2017
+	CodeMFANotEnabled           = 2018
+	CodeInvalidMFACode          = 2019
+	CodeInvalidMFAChallenge     = 2020
+	CodeInvalidWebAuthnResponse = 2021
+	CodePasskeyNotFound         = 2022
+	CodePasskeyCloned           = 2023
+	CodeTooManyPasskeys         = 2024
+	CodePasskeyAlreadyExists    = 2025
+	CodeUnknownIdentityProvider = 2026
+	CodeInvalidOIDCCallback     = 2027
+	CodeIdentityAlreadyLinked   = 2028
+	CodeIdentityNotLinked       = 2029
+	CodeIdentityNotFound        = 2030
+	CodeLastLoginMethod         = 2031
+	CodeInvalidAuthorization    = 2032
+	CodeOAuthClientNotFound     = 2033
+	CodeConsentNotFound         = 2034
+	CodeInvalidClientMetadata   = 2035
+	CodeAPIKeyNotFound          = 2036
+	CodeTooManyAPIKeys          = 2037
+	CodeInvalidDPoPProof        = 2038
+	CodeInvalidCSRFToken        = 2039
+	CodeInvalidMagicLink        = 2040
+	// CodeReauthenticationRequired asks the user to re-authenticate at /reauthenticate and retry the request.
+	CodeReauthenticationRequired = 2041
+	// CodeImpersonationForbidden rejects sensitive operations requested by an admin impersonating the user.
+	CodeImpersonationForbidden = 2042
+	// CodeUserUpdated rejects a request which raced another updating the same user. It can be retried as is.
+	CodeUserUpdated = 2043
 )
 
+// deviceOf returns the device the request was sent from.
+func deviceOf(req *http.Request) *domain.Device {
+	return domain.NewDevice(req.Header.Get(httputil.UserAgent), httputil.ClientIP(req))
+}
+
+// hasherBusyRetryAfter is in seconds. Hashing a password takes much less, but the queue may be long.
+const hasherBusyRetryAfter = "1"
+
+// responseHasherBusy sheds load when too many passwords are being hashed.
+func responseHasherBusy(w http.ResponseWriter) error {
+	w.Header().Set(httputil.RetryAfter, hasherBusyRetryAfter)
+	return httputil.ResponseError(w, http.StatusServiceUnavailable, httputil.CodeServiceUnavailable, "server busy")
+}
+
+func responseUserUpdated(w http.ResponseWriter) error {
+	return httputil.ResponseError(w, http.StatusConflict, CodeUserUpdated, "user updated concurrently, retry the request")
+}
+
 // BasicSignupCtrl is a controller for basic signup.
 type BasicSignupCtrl struct {
 	uc usecase.BasicSignupUC
@@ -26,10 +93,12 @@ type BasicSignupCtrl struct {
 type BasicSignupReq struct {
 	Username string `json:"username" validate:"required,max=32,min=1"`
 	Password string `json:"password" validate:"required,password"`
+	Email    string `json:"email" validate:"omitempty,email,max=254"`
 }
 
 type BasicSignupRes struct {
-	Token string `json:"token"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
 func NewBasicSignupCtrl(uc usecase.BasicSignupUC) *BasicSignupCtrl {
@@ -47,18 +116,32 @@ func (b *BasicSignupCtrl) Handle(w http.ResponseWriter, req *http.Request) error
 	}
 
 	res, err := b.uc.Execute(req.Context(), &usecase.SignupReq{
-		Username: reqBody.Username,
-		Password: reqBody.Password,
+		Username:  reqBody.Username,
+		Password:  reqBody.Password,
+		Email:     reqBody.Email,
+		Device:    deviceOf(req),
+		Principal: principalFrom(req.Context()),
 	})
 	if errors.Is(err, usecase.ErrUsernameAlreadyExists) {
 		return httputil.ResponseError(w, http.StatusConflict, CodeUsernameAlreadyExists, "username already exists")
 	}
+	if errors.Is(err, usecase.ErrEmailAlreadyExists) {
+		return httputil.ResponseError(w, http.StatusConflict, CodeEmailAlreadyExists, "email already exists")
+	}
+	if errors.Is(err, domain.ErrPasswordHasherBusy) {
+		return responseHasherBusy(w)
+	}
 	if err != nil {
 		logutil.From(req.Context()).Error("failed to execute Basic Signup", slog.Any("err", err))
 		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
 	}
 
-	return httputil.ResponseJSON(w, http.StatusOK, &BasicSignupRes{Token: res.Token})
+	token, refreshToken, err := issueTokens(w, req, res.Token, res.RefreshToken)
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to issue session cookies", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, &BasicSignupRes{Token: token, RefreshToken: refreshToken})
 }
 
 type AuthenticateCtrl struct {
@@ -70,34 +153,34 @@ func NewAuthenticateCtrl(uc usecase.AuthenticateUC) *AuthenticateCtrl {
 }
 
 type AuthenticateRes struct {
-	Token    string `json:"token"`
+	Token    string `json:"token,omitempty"`
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
 }
 
 func (a *AuthenticateCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
-	token, err := httputil.GetBearerToken(req)
-	if err != nil {
-		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated, err.Error())
-	}
-
-	res, err := a.uc.Execute(req.Context(), token)
+	res, err := a.uc.Execute(req.Context(), principalFrom(req.Context()))
 	if errors.Is(err, usecase.ErrInvalidToken) {
 		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated, err.Error())
 	}
-	if errors.Is(err, usecase.ErrTokenExpired) {
-		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeTokenExpired, err.Error())
-	}
 	if errors.Is(err, usecase.ErrUserNotFound) {
 		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
 	}
+	if errors.Is(err, usecase.ErrUserDisabled) {
+		return httputil.ResponseError(w, http.StatusForbidden, CodeUserDisabled, err.Error())
+	}
 	if err != nil {
 		logutil.From(req.Context()).Error("failed to execute Authenticate", slog.Any("err", err))
 		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
 	}
 
+	token, _, err := issueTokens(w, req, res.RefreshedToken, "")
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to issue session cookies", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
 	return httputil.ResponseJSON(w, http.StatusOK, &AuthenticateRes{
-		Token:    res.RefreshedToken,
+		Token:    token,
 		UserID:   res.User.ID.String(),
 		Username: res.User.Username,
 	})
@@ -111,13 +194,19 @@ func NewBasicLoginCtrl(uc usecase.BasicLoginUC) *BasicLoginCtrl {
 	return &BasicLoginCtrl{uc: uc}
 }
 
+// BasicLoginReq identifies the user by either the username or the email address.
 type BasicLoginReq struct {
-	Username string `json:"username" validate:"required,max=32,min=1"`
+	Username string `json:"username" validate:"required_without=Email,omitempty,max=32,min=1"`
+	Email    string `json:"email" validate:"required_without=Username,omitempty,email,max=254"`
 	Password string `json:"password" validate:"required,password"`
 }
 
+// BasicLoginRes has no tokens if MFA is required. The login is completed at /login/mfa with MFAToken.
 type BasicLoginRes struct {
-	Token string `json:"token"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	MFARequired  bool   `json:"mfa_required"`
+	MFAToken     string `json:"mfa_token,omitempty"`
 }
 
 func (b *BasicLoginCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
@@ -130,16 +219,177 @@ func (b *BasicLoginCtrl) Handle(w http.ResponseWriter, req *http.Request) error
 		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
 	}
 
-	res, err := b.uc.Execute(req.Context(), reqBody.Username, reqBody.Password)
+	res, err := b.uc.Execute(req.Context(), &usecase.BasicLoginReq{
+		Username: reqBody.Username,
+		Email:    reqBody.Email,
+		Password: reqBody.Password,
+		Device:   deviceOf(req),
+	})
 	if errors.Is(err, usecase.ErrUserNotFound) || errors.Is(err, usecase.ErrInvalidPassword) {
 		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated, "invalid credentials")
 	}
+	if errors.Is(err, domain.ErrPasswordHasherBusy) {
+		return responseHasherBusy(w)
+	}
+	var lockedErr *usecase.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		w.Header().Set(httputil.RetryAfter, strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+		return httputil.ResponseError(w, http.StatusTooManyRequests, CodeLoginLocked, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUserDisabled) {
+		return httputil.ResponseError(w, http.StatusForbidden, CodeUserDisabled, err.Error())
+	}
+	if errors.Is(err, usecase.ErrPasswordResetRequired) {
+		return httputil.ResponseError(w, http.StatusForbidden, CodePasswordResetRequired, err.Error())
+	}
 	if err != nil {
 		logutil.From(req.Context()).Error("failed to execute Basic Signup", slog.Any("err", err))
 		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
 	}
 
-	return httputil.ResponseJSON(w, http.StatusOK, &BasicLoginRes{Token: res.Token})
+	token, refreshToken, err := issueTokens(w, req, res.Token, res.RefreshToken)
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to issue session cookies", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, &BasicLoginRes{
+		Token:        token,
+		RefreshToken: refreshToken,
+		MFARequired:  res.MFAToken != "",
+		MFAToken:     res.MFAToken,
+	})
+}
+
+type RefreshTokenCtrl struct {
+	uc usecase.RefreshTokenUC
+	// baseURL is the URL zenbu is served at, which DPoP proofs are made for.
+	baseURL string
+}
+
+func NewRefreshTokenCtrl(uc usecase.RefreshTokenUC, baseURL string) *RefreshTokenCtrl {
+	return &RefreshTokenCtrl{uc: uc, baseURL: baseURL}
+}
+
+// RefreshTokenReq has no refresh token if it is sent in the cookie.
+type RefreshTokenReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RefreshTokenRes struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// TokenType is DPoP if the session is bound to a DPoP key, so that the token must be sent with proofs.
+	TokenType string `json:"token_type"`
+}
+
+func (r *RefreshTokenCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody RefreshTokenReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	fromCookie := false
+	if reqBody.RefreshToken == "" {
+		c, err := req.Cookie(refreshTokenCookie)
+		if err != nil {
+			return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "refresh_token is required")
+		}
+		if err := verifyCSRFToken(req); err != nil {
+			return httputil.ResponseError(w, http.StatusForbidden, CodeInvalidCSRFToken, err.Error())
+		}
+		reqBody.RefreshToken = c.Value
+		fromCookie = true
+	}
+
+	proof, err := dpopProofOf(req, r.baseURL)
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidDPoPProof, err.Error())
+	}
+
+	res, err := r.uc.Execute(req.Context(), &usecase.RefreshTokenReq{RefreshToken: reqBody.RefreshToken, DPoP: proof})
+	if errors.Is(err, usecase.ErrInvalidDPoPProof) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidDPoPProof, err.Error())
+	}
+	if errors.Is(err, usecase.ErrRefreshTokenReused) {
+		logutil.From(req.Context()).Warn("refresh token reused, session revoked", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusUnauthorized, CodeRefreshTokenReused, "refresh token reused")
+	}
+	if errors.Is(err, usecase.ErrInvalidRefreshToken) {
+		return httputil.ResponseError(w, http.StatusUnauthorized, CodeInvalidRefreshToken, "invalid refresh token")
+	}
+	if errors.Is(err, usecase.ErrUserNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUserDisabled) {
+		return httputil.ResponseError(w, http.StatusForbidden, CodeUserDisabled, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute RefreshToken", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	tokenType := httputil.Bearer
+	if res.DPoPBound {
+		tokenType = dpoputil.Scheme
+	}
+	if fromCookie {
+		if err := setSessionCookies(w, req, res.AccessToken, res.RefreshToken, false); err != nil {
+			logutil.From(req.Context()).Error("failed to issue session cookies", slog.Any("err", err))
+			return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+		}
+		return httputil.ResponseJSON(w, http.StatusOK, &RefreshTokenRes{TokenType: tokenType})
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, &RefreshTokenRes{
+		Token:        res.AccessToken,
+		RefreshToken: res.RefreshToken,
+		TokenType:    tokenType,
+	})
+}
+
+type LogoutCtrl struct {
+	uc usecase.LogoutUC
+}
+
+func NewLogoutCtrl(uc usecase.LogoutUC) *LogoutCtrl {
+	return &LogoutCtrl{uc: uc}
+}
+
+func (l *LogoutCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	err := l.uc.Execute(req.Context(), principalFrom(req.Context()))
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute Logout", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	if isCookieAuthenticated(req) {
+		clearSessionCookies(w)
+	}
+	return httputil.ResponseNoContent(w)
+}
+
+type LogoutAllCtrl struct {
+	uc usecase.LogoutAllUC
+}
+
+func NewLogoutAllCtrl(uc usecase.LogoutAllUC) *LogoutAllCtrl {
+	return &LogoutAllCtrl{uc: uc}
+}
+
+func (l *LogoutAllCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	err := l.uc.Execute(req.Context(), principalFrom(req.Context()))
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute LogoutAll", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	if isCookieAuthenticated(req) {
+		clearSessionCookies(w)
+	}
+	return httputil.ResponseNoContent(w)
 }
 
 type CreateProfileImageUploadURLCtrl struct {
@@ -155,12 +405,7 @@ func NewCreateProfileImageUploadURLCtrl(uc usecase.CreateProfileImagUploadURLUC)
 }
 
 func (c *CreateProfileImageUploadURLCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
-	token, err := httputil.GetBearerToken(req)
-	if err != nil {
-		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated, err.Error())
-	}
-
-	url, err := c.uc.Execute(req.Context(), token)
+	url, err := c.uc.Execute(req.Context(), principalFrom(req.Context()))
 	if err != nil {
 		logutil.From(req.Context()).Error("failed to execute CreateProfileImagUploadURL", slog.Any("err", err))
 		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
@@ -205,24 +450,62 @@ func NewGetMeCtrl(uc usecase.GetMeUC) *GetMeCtrl {
 }
 
 type GetMeRes struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
+	ID            string   `json:"id"`
+	Username      string   `json:"username"`
+	Roles         []string `json:"roles"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified bool     `json:"email_verified"`
+	// Guest tells that the user has not signed up yet.
+	Guest bool `json:"guest"`
+	// Impersonated tells that an admin is acting as the user, who is ImpersonatorID.
+	Impersonated   bool   `json:"impersonated"`
+	ImpersonatorID string `json:"impersonator_id,omitempty"`
 }
 
 func (g *GetMeCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
-	token, err := httputil.GetBearerToken(req)
+	p := principalFrom(req.Context())
+	u, err := g.uc.Execute(req.Context(), p)
 	if err != nil {
-		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated, err.Error())
+		logutil.From(req.Context()).Error("failed to execute CreateProfileImagUploadURL", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	roles := make([]string, 0, len(u.Roles))
+	for _, r := range u.Roles {
+		roles = append(roles, string(r))
+	}
+
+	res := &GetMeRes{
+		ID:            u.ID.String(),
+		Username:      u.Username,
+		Roles:         roles,
+		Email:         u.Email,
+		EmailVerified: u.IsEmailVerified(),
+		Guest:         u.IsGuest(),
+		Impersonated:  p.IsImpersonated(),
+	}
+	if p.IsImpersonated() {
+		res.ImpersonatorID = p.ActorID.String()
 	}
+	return httputil.ResponseJSON(w, http.StatusOK, res)
+}
+
+type GetJWKSCtrl struct {
+	uc usecase.GetJWKSUC
+}
 
-	u, err := g.uc.Execute(req.Context(), token)
+func NewGetJWKSCtrl(uc usecase.GetJWKSUC) *GetJWKSCtrl {
+	return &GetJWKSCtrl{uc: uc}
+}
+
+func (g *GetJWKSCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	jwks, err := g.uc.Execute(req.Context())
 	if err != nil {
-		logutil.From(req.Context()).Error("failed to execute CreateProfileImagUploadURL", slog.Any("err", err))
+		logutil.From(req.Context()).Error("failed to execute GetJWKS", slog.Any("err", err))
 		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
 	}
 
-	return httputil.ResponseJSON(w, http.StatusOK, &GetMeRes{
-		ID:       u.ID.String(),
-		Username: u.Username,
-	})
+	// verifiers may cache keys for a while. A new key should be published before it becomes active.
+	w.Header().Set(httputil.CacheControl, "public, max-age=300")
+	return httputil.ResponseJSON(w, http.StatusOK, jwks)
 }
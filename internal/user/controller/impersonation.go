@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/validutil"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+func responseImpersonationForbidden(w http.ResponseWriter) error {
+	return httputil.ResponseError(w, http.StatusForbidden, CodeImpersonationForbidden,
+		"this operation is forbidden while impersonating the user")
+}
+
+// notImpersonated forbids the route to admins impersonating users, e.g. for changing credentials of the user.
+// It must be applied after required or optional, which resolve the principal.
+func notImpersonated(next httputil.HandlerFuncWithErr) httputil.HandlerFuncWithErr {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		if principalFrom(req.Context()).IsImpersonated() {
+			return responseImpersonationForbidden(w)
+		}
+		return next(w, req)
+	}
+}
+
+type ImpersonateCtrl struct {
+	uc usecase.ImpersonateUC
+}
+
+func NewImpersonateCtrl(uc usecase.ImpersonateUC) *ImpersonateCtrl {
+	return &ImpersonateCtrl{uc: uc}
+}
+
+type ImpersonateReq struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+type ImpersonateRes struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (i *ImpersonateCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	userID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid user id")
+	}
+
+	var reqBody ImpersonateReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	res, err := i.uc.Execute(req.Context(), principalFrom(req.Context()), &usecase.ImpersonateReq{
+		UserID: userID,
+		Reason: reqBody.Reason,
+	})
+	if errors.Is(err, usecase.ErrUserNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUserDisabled) {
+		return httputil.ResponseError(w, http.StatusForbidden, CodeUserDisabled, err.Error())
+	}
+	if errors.Is(err, usecase.ErrPermissionDenied) {
+		return httputil.ResponseError(w, http.StatusForbidden, httputil.CodePermissionDenied, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute Impersonate", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	// the token is given only in the body, never in cookies, so that the browser of the admin stays logged in as the admin.
+	w.Header().Set(httputil.CacheControl, "no-store")
+	return httputil.ResponseJSON(w, http.StatusOK, &ImpersonateRes{
+		Token:     res.AccessToken,
+		TokenType: httputil.Bearer,
+		ExpiresAt: res.ExpiresAt,
+	})
+}
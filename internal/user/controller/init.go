@@ -4,41 +4,420 @@ import (
 	"net/http"
 
 	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/mailutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/oidcutil"
 	"github.com/buzzryan/zenbu/internal/commonutil/storageutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/webauthnutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
 	"github.com/buzzryan/zenbu/internal/user/usecase"
 )
 
 type InitOpts struct {
-	Mux          *http.ServeMux
-	UserRepo     usecase.UserRepo
-	TokenManager usecase.TokenManager
-	Storage      storageutil.Storage
+	Mux                   *http.ServeMux
+	UserRepo              usecase.UserRepo
+	SessionRepo           usecase.SessionRepo
+	RevocationRepo        usecase.RevocationRepo
+	LoginAttemptRepo      usecase.LoginAttemptRepo
+	EmailVerificationRepo usecase.EmailVerificationRepo
+	PasswordResetRepo     usecase.PasswordResetRepo
+	MagicLinkRepo         usecase.MagicLinkRepo
+	MFARepo               usecase.MFARepo
+	MFAChallengeRepo      usecase.MFAChallengeRepo
+	PasskeyRepo           usecase.PasskeyRepo
+	WebAuthnCeremonyRepo  usecase.WebAuthnCeremonyRepo
+	IdentityRepo          usecase.IdentityRepo
+	OIDCAuthRequestRepo   usecase.OIDCAuthRequestRepo
+	OAuthClientRepo       usecase.OAuthClientRepo
+	ConsentRepo           usecase.ConsentRepo
+	AuthorizationCodeRepo usecase.AuthorizationCodeRepo
+	APIKeyRepo            usecase.APIKeyRepo
+	DPoPReplayRepo        usecase.DPoPReplayRepo
+	TokenManager          usecase.TokenManager
+	AuditLog              usecase.AuditLog
+	AuditEventRepo        usecase.AuditEventRepo
+	Storage               storageutil.Storage
+	Mailer                mailutil.Mailer
+	// AppBaseURL is the URL of the web app, used for links in mails.
+	AppBaseURL string
+	// MFAIssuer names the service in authenticator apps.
+	MFAIssuer string
+	// RelyingParty is the WebAuthn relying party passkeys are registered for, and RPName names it to users.
+	RelyingParty *webauthnutil.RelyingParty
+	RPName       string
+	// OIDCProviders are the OpenID providers users log in with, by their names in routes.
+	OIDCProviders map[string]*oidcutil.Provider
+	// OAuthIssuer is the URL zenbu is served at as an OAuth authorization server and OpenID provider.
+	// DPoP proofs are made for URLs under it as well.
+	OAuthIssuer string
 }
 
 func Init(opts *InitOpts) {
-	basicSignupUC := usecase.NewBasicSignupUC(opts.UserRepo, opts.TokenManager)
+	resolvePrincipalUC := usecase.NewResolvePrincipalUC(
+		opts.UserRepo, opts.APIKeyRepo, opts.RevocationRepo, opts.DPoPReplayRepo, opts.TokenManager,
+	)
+	recordImpersonatedRequestUC := usecase.NewRecordImpersonatedRequestUC(opts.AuditLog)
+	auth := newAuthenticator(resolvePrincipalUC, recordImpersonatedRequestUC, opts.OAuthIssuer)
+
+	basicSignupUC := usecase.NewBasicSignupUC(
+		opts.UserRepo, opts.SessionRepo, opts.TokenManager, opts.EmailVerificationRepo, opts.Mailer, opts.AppBaseURL,
+	)
 	basicSignupCtrl := NewBasicSignupCtrl(basicSignupUC)
 
-	authenticateUC := usecase.NewAuthenticateUC(opts.UserRepo, opts.TokenManager)
+	createGuestUC := usecase.NewCreateGuestUC(opts.UserRepo, opts.SessionRepo, opts.TokenManager)
+	createGuestCtrl := NewCreateGuestCtrl(createGuestUC)
+
+	authenticateUC := usecase.NewAuthenticateUC(opts.UserRepo, opts.SessionRepo, opts.TokenManager)
 	authenticateCtrl := NewAuthenticateCtrl(authenticateUC)
 
-	basicLoginUC := usecase.NewBasicLoginUC(opts.UserRepo, opts.TokenManager)
+	basicLoginUC := usecase.NewBasicLoginUC(
+		opts.UserRepo, opts.SessionRepo, opts.LoginAttemptRepo, opts.MFARepo, opts.MFAChallengeRepo, opts.TokenManager,
+		opts.AuditLog, usecase.DefaultLockoutPolicy,
+	)
 	basicLoginCtrl := NewBasicLoginCtrl(basicLoginUC)
 
-	createProfileImageUploadUC := usecase.NewCreateProfileImagUploadURLUC(opts.UserRepo, opts.TokenManager, opts.Storage)
+	sendMagicLinkUC := usecase.NewSendMagicLinkUC(
+		opts.UserRepo, opts.MagicLinkRepo, opts.LoginAttemptRepo, opts.Mailer, opts.AppBaseURL,
+	)
+	sendMagicLinkCtrl := NewSendMagicLinkCtrl(sendMagicLinkUC)
+
+	verifyMagicLinkUC := usecase.NewVerifyMagicLinkUC(
+		opts.UserRepo, opts.MagicLinkRepo, opts.SessionRepo, opts.MFARepo, opts.MFAChallengeRepo, opts.TokenManager,
+		opts.AuditLog,
+	)
+	verifyMagicLinkCtrl := NewVerifyMagicLinkCtrl(verifyMagicLinkUC)
+
+	completeMFALoginUC := usecase.NewCompleteMFALoginUC(
+		opts.UserRepo, opts.SessionRepo, opts.LoginAttemptRepo, opts.MFARepo, opts.MFAChallengeRepo, opts.TokenManager,
+		opts.AuditLog, usecase.DefaultLockoutPolicy,
+	)
+	completeMFALoginCtrl := NewCompleteMFALoginCtrl(completeMFALoginUC)
+
+	refreshTokenUC := usecase.NewRefreshTokenUC(opts.UserRepo, opts.SessionRepo, opts.DPoPReplayRepo, opts.TokenManager)
+	refreshTokenCtrl := NewRefreshTokenCtrl(refreshTokenUC, opts.OAuthIssuer)
+
+	logoutUC := usecase.NewLogoutUC(opts.SessionRepo, opts.RevocationRepo)
+	logoutCtrl := NewLogoutCtrl(logoutUC)
+
+	logoutAllUC := usecase.NewLogoutAllUC(opts.SessionRepo, opts.RevocationRepo, opts.APIKeyRepo)
+	logoutAllCtrl := NewLogoutAllCtrl(logoutAllUC)
+
+	createProfileImageUploadUC := usecase.NewCreateProfileImagUploadURLUC(opts.UserRepo, opts.Storage, opts.AuditLog)
 	createProfileImageUploadURLCtrl := NewCreateProfileImageUploadURLCtrl(createProfileImageUploadUC)
 
 	getProfileImageURLUC := usecase.NewGetProfileImageURLUC(opts.UserRepo, opts.Storage)
 	getProfileImageURLCtrl := NewGetProfileImageURLCtrl(getProfileImageURLUC)
 
-	getMeUC := usecase.NewGetMeUC(opts.UserRepo, opts.TokenManager)
+	getMeUC := usecase.NewGetMeUC(opts.UserRepo)
 	getMeCtrl := NewGetMeCtrl(getMeUC)
 
+	listActivityUC := usecase.NewListActivityUC(opts.AuditEventRepo)
+	listActivityCtrl := NewListActivityCtrl(listActivityUC)
+
+	listSessionsUC := usecase.NewListSessionsUC(opts.SessionRepo)
+	listSessionsCtrl := NewListSessionsCtrl(listSessionsUC)
+
+	revokeSessionUC := usecase.NewRevokeSessionUC(opts.SessionRepo, opts.RevocationRepo)
+	revokeSessionCtrl := NewRevokeSessionCtrl(revokeSessionUC)
+
+	getJWKSUC := usecase.NewGetJWKSUC(opts.TokenManager)
+	getJWKSCtrl := NewGetJWKSCtrl(getJWKSUC)
+
+	changeEmailUC := usecase.NewChangeEmailUC(
+		opts.UserRepo, opts.EmailVerificationRepo, opts.LoginAttemptRepo, opts.Mailer, opts.AppBaseURL,
+	)
+	changeEmailCtrl := NewChangeEmailCtrl(changeEmailUC)
+
+	sendEmailVerificationUC := usecase.NewSendEmailVerificationUC(
+		opts.UserRepo, opts.EmailVerificationRepo, opts.LoginAttemptRepo, opts.Mailer, opts.AppBaseURL,
+	)
+	sendEmailVerificationCtrl := NewSendEmailVerificationCtrl(sendEmailVerificationUC)
+
+	verifyEmailUC := usecase.NewVerifyEmailUC(opts.UserRepo, opts.EmailVerificationRepo)
+	verifyEmailCtrl := NewVerifyEmailCtrl(verifyEmailUC)
+
+	verifyEmailCodeUC := usecase.NewVerifyEmailCodeUC(opts.UserRepo, opts.EmailVerificationRepo)
+	verifyEmailCodeCtrl := NewVerifyEmailCodeCtrl(verifyEmailCodeUC)
+
+	forgotPasswordUC := usecase.NewForgotPasswordUC(opts.UserRepo, opts.PasswordResetRepo, opts.Mailer, opts.AppBaseURL)
+	forgotPasswordCtrl := NewForgotPasswordCtrl(forgotPasswordUC)
+
+	resetPasswordUC := usecase.NewResetPasswordUC(
+		opts.UserRepo, opts.PasswordResetRepo, opts.SessionRepo, opts.RevocationRepo, opts.APIKeyRepo, opts.AuditLog,
+	)
+	resetPasswordCtrl := NewResetPasswordCtrl(resetPasswordUC)
+
+	changePasswordUC := usecase.NewChangePasswordUC(
+		opts.UserRepo, opts.SessionRepo, opts.RevocationRepo, opts.APIKeyRepo, opts.TokenManager, opts.AuditLog,
+	)
+	changePasswordCtrl := NewChangePasswordCtrl(changePasswordUC)
+
+	reauthenticateUC := usecase.NewReauthenticateUC(
+		opts.UserRepo, opts.SessionRepo, opts.LoginAttemptRepo, opts.MFARepo, opts.TokenManager,
+		usecase.DefaultLockoutPolicy,
+	)
+	reauthenticateCtrl := NewReauthenticateCtrl(reauthenticateUC)
+
+	deleteAccountUC := usecase.NewDeleteAccountUC(
+		opts.UserRepo, opts.SessionRepo, opts.RevocationRepo, opts.APIKeyRepo, opts.AuditLog,
+	)
+	deleteAccountCtrl := NewDeleteAccountCtrl(deleteAccountUC)
+
+	enrollTOTPUC := usecase.NewEnrollTOTPUC(opts.UserRepo, opts.MFARepo, opts.MFAIssuer)
+	enrollTOTPCtrl := NewEnrollTOTPCtrl(enrollTOTPUC)
+
+	enableMFAUC := usecase.NewEnableMFAUC(opts.MFARepo)
+	enableMFACtrl := NewEnableMFACtrl(enableMFAUC)
+
+	disableMFAUC := usecase.NewDisableMFAUC(opts.MFARepo, opts.LoginAttemptRepo, usecase.DefaultLockoutPolicy)
+	disableMFACtrl := NewDisableMFACtrl(disableMFAUC)
+
+	beginPasskeyRegistrationUC := usecase.NewBeginPasskeyRegistrationUC(
+		opts.UserRepo, opts.PasskeyRepo, opts.WebAuthnCeremonyRepo, opts.RelyingParty, opts.RPName,
+	)
+	beginPasskeyRegistrationCtrl := NewBeginPasskeyRegistrationCtrl(beginPasskeyRegistrationUC)
+
+	finishPasskeyRegistrationUC := usecase.NewFinishPasskeyRegistrationUC(
+		opts.PasskeyRepo, opts.WebAuthnCeremonyRepo, opts.RelyingParty,
+	)
+	finishPasskeyRegistrationCtrl := NewFinishPasskeyRegistrationCtrl(finishPasskeyRegistrationUC)
+
+	beginPasskeyLoginUC := usecase.NewBeginPasskeyLoginUC(opts.WebAuthnCeremonyRepo, opts.RelyingParty)
+	beginPasskeyLoginCtrl := NewBeginPasskeyLoginCtrl(beginPasskeyLoginUC)
+
+	finishPasskeyLoginUC := usecase.NewFinishPasskeyLoginUC(
+		opts.UserRepo, opts.SessionRepo, opts.PasskeyRepo, opts.WebAuthnCeremonyRepo, opts.TokenManager, opts.AuditLog,
+		opts.RelyingParty,
+	)
+	finishPasskeyLoginCtrl := NewFinishPasskeyLoginCtrl(finishPasskeyLoginUC)
+
+	listPasskeysUC := usecase.NewListPasskeysUC(opts.PasskeyRepo)
+	listPasskeysCtrl := NewListPasskeysCtrl(listPasskeysUC)
+
+	deletePasskeyUC := usecase.NewDeletePasskeyUC(opts.PasskeyRepo)
+	deletePasskeyCtrl := NewDeletePasskeyCtrl(deletePasskeyUC)
+
+	beginOIDCLoginUC := usecase.NewBeginOIDCLoginUC(opts.OIDCProviders, opts.OIDCAuthRequestRepo)
+	beginOIDCLoginCtrl := NewBeginOIDCLoginCtrl(beginOIDCLoginUC)
+
+	finishOIDCLoginUC := usecase.NewFinishOIDCLoginUC(
+		opts.UserRepo, opts.SessionRepo, opts.IdentityRepo, opts.MFARepo, opts.MFAChallengeRepo, opts.TokenManager,
+		opts.AuditLog, opts.OIDCProviders, opts.OIDCAuthRequestRepo,
+	)
+	finishOIDCLoginCtrl := NewFinishOIDCLoginCtrl(finishOIDCLoginUC)
+
+	beginOIDCLinkUC := usecase.NewBeginOIDCLinkUC(opts.OIDCProviders, opts.OIDCAuthRequestRepo)
+	beginOIDCLinkCtrl := NewBeginOIDCLinkCtrl(beginOIDCLinkUC)
+
+	finishOIDCLinkUC := usecase.NewFinishOIDCLinkUC(
+		opts.UserRepo, opts.IdentityRepo, opts.OIDCProviders, opts.OIDCAuthRequestRepo,
+	)
+	finishOIDCLinkCtrl := NewFinishOIDCLinkCtrl(finishOIDCLinkUC)
+
+	listIdentitiesUC := usecase.NewListIdentitiesUC(opts.IdentityRepo)
+	listIdentitiesCtrl := NewListIdentitiesCtrl(listIdentitiesUC)
+
+	unlinkIdentityUC := usecase.NewUnlinkIdentityUC(opts.UserRepo, opts.IdentityRepo, opts.PasskeyRepo)
+	unlinkIdentityCtrl := NewUnlinkIdentityCtrl(unlinkIdentityUC)
+
+	createAPIKeyUC := usecase.NewCreateAPIKeyUC(opts.UserRepo, opts.APIKeyRepo)
+	createAPIKeyCtrl := NewCreateAPIKeyCtrl(createAPIKeyUC)
+
+	listAPIKeysUC := usecase.NewListAPIKeysUC(opts.APIKeyRepo)
+	listAPIKeysCtrl := NewListAPIKeysCtrl(listAPIKeysUC)
+
+	revokeAPIKeyUC := usecase.NewRevokeAPIKeyUC(opts.APIKeyRepo)
+	revokeAPIKeyCtrl := NewRevokeAPIKeyCtrl(revokeAPIKeyUC)
+
+	oauthLoginPageCtrl := NewOAuthLoginPageCtrl()
+
+	authorizeUC := usecase.NewAuthorizeUC(
+		opts.UserRepo, opts.SessionRepo, opts.OAuthClientRepo, opts.ConsentRepo, opts.AuthorizationCodeRepo,
+	)
+	authorizeCtrl := NewAuthorizeCtrl(authorizeUC)
+
+	oauthTokenUC := usecase.NewOAuthTokenUC(
+		opts.UserRepo, opts.SessionRepo, opts.OAuthClientRepo, opts.AuthorizationCodeRepo, opts.DPoPReplayRepo,
+		opts.TokenManager, opts.OAuthIssuer,
+	)
+	oauthTokenCtrl := NewOAuthTokenCtrl(oauthTokenUC, opts.OAuthIssuer)
+
+	introspectUC := usecase.NewIntrospectUC(
+		opts.UserRepo, opts.APIKeyRepo, opts.OAuthClientRepo, opts.RevocationRepo, opts.TokenManager,
+	)
+	introspectCtrl := NewIntrospectCtrl(introspectUC, opts.OAuthIssuer)
+
+	userInfoUC := usecase.NewUserInfoUC(opts.UserRepo)
+	userInfoCtrl := NewUserInfoCtrl(userInfoUC)
+
+	openIDConfigurationCtrl := NewOpenIDConfigurationCtrl(getJWKSUC, opts.OAuthIssuer)
+
+	listConsentsUC := usecase.NewListConsentsUC(opts.OAuthClientRepo, opts.ConsentRepo)
+	listConsentsCtrl := NewListConsentsCtrl(listConsentsUC)
+
+	revokeConsentUC := usecase.NewRevokeConsentUC(opts.ConsentRepo, opts.SessionRepo, opts.RevocationRepo)
+	revokeConsentCtrl := NewRevokeConsentCtrl(revokeConsentUC)
+
+	registerOAuthClientUC := usecase.NewRegisterOAuthClientUC(opts.OAuthClientRepo)
+	registerOAuthClientCtrl := NewRegisterOAuthClientCtrl(registerOAuthClientUC)
+
+	listOAuthClientsUC := usecase.NewListOAuthClientsUC(opts.OAuthClientRepo)
+	listOAuthClientsCtrl := NewListOAuthClientsCtrl(listOAuthClientsUC)
+
+	deleteOAuthClientUC := usecase.NewDeleteOAuthClientUC(opts.OAuthClientRepo)
+	deleteOAuthClientCtrl := NewDeleteOAuthClientCtrl(deleteOAuthClientUC)
+
+	listUsersUC := usecase.NewListUsersUC(opts.UserRepo)
+	listUsersCtrl := NewListUsersCtrl(listUsersUC)
+
+	getUserUC := usecase.NewGetUserUC(opts.UserRepo)
+	getUserCtrl := NewGetUserCtrl(getUserUC)
+
+	setUserDisabledUC := usecase.NewSetUserDisabledUC(
+		opts.UserRepo, opts.SessionRepo, opts.RevocationRepo, opts.APIKeyRepo, opts.AuditLog,
+	)
+	disableUserCtrl := NewSetUserDisabledCtrl(setUserDisabledUC, true)
+	enableUserCtrl := NewSetUserDisabledCtrl(setUserDisabledUC, false)
+
+	forcePasswordResetUC := usecase.NewForcePasswordResetUC(
+		opts.UserRepo, opts.SessionRepo, opts.RevocationRepo, opts.APIKeyRepo, opts.AuditLog,
+	)
+	forcePasswordResetCtrl := NewForcePasswordResetCtrl(forcePasswordResetUC)
+
+	revokeUserTokensUC := usecase.NewRevokeUserTokensUC(
+		opts.UserRepo, opts.SessionRepo, opts.RevocationRepo, opts.APIKeyRepo, opts.AuditLog,
+	)
+	revokeUserTokensCtrl := NewRevokeUserTokensCtrl(revokeUserTokensUC)
+
+	changeUsernameUC := usecase.NewChangeUsernameUC(opts.UserRepo, opts.AuditLog)
+	changeUsernameCtrl := NewChangeUsernameCtrl(changeUsernameUC)
+
+	deleteUserUC := usecase.NewDeleteUserUC(
+		opts.UserRepo, opts.SessionRepo, opts.RevocationRepo, opts.APIKeyRepo, opts.AuditLog,
+	)
+	deleteUserCtrl := NewDeleteUserCtrl(deleteUserUC)
+
+	unlockUserUC := usecase.NewUnlockUserUC(opts.UserRepo, opts.LoginAttemptRepo, opts.AuditLog)
+	unlockUserCtrl := NewUnlockUserCtrl(unlockUserUC)
+
+	resetMFAUC := usecase.NewResetMFAUC(opts.UserRepo, opts.MFARepo, opts.AuditLog)
+	resetMFACtrl := NewResetMFACtrl(resetMFAUC)
+
+	impersonateUC := usecase.NewImpersonateUC(opts.UserRepo, opts.TokenManager, opts.AuditLog)
+	impersonateCtrl := NewImpersonateCtrl(impersonateUC)
+
+	listAuditEventsUC := usecase.NewListAuditEventsUC(opts.AuditEventRepo)
+	listAuditEventsCtrl := NewListAuditEventsCtrl(listAuditEventsUC)
+
 	// register routers
-	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/signup", basicSignupCtrl.Handle)
-	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/authenticate", authenticateCtrl.Handle)
+	// Routes changing credentials or sessions of the user are forbidden to admins impersonating the user.
+
+	// guests sign up with their tokens, so that they are upgraded instead of creating new users.
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/signup", basicSignupCtrl.Handle,
+		auth.optional, notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/guest", createGuestCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/authenticate", authenticateCtrl.Handle, auth.required)
 	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/login", basicLoginCtrl.Handle)
-	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/me/profile/image", createProfileImageUploadURLCtrl.Handle)
-	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/users/{id}/profile/image", getProfileImageURLCtrl.Handle)
-	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/me", getMeCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/login/mfa", completeMFALoginCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/login/magic", sendMagicLinkCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/login/magic/verify", verifyMagicLinkCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/login/passkey/options", beginPasskeyLoginCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/login/passkey", finishPasskeyLoginCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/login/oidc/{provider}", beginOIDCLoginCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/login/oidc/callback", finishOIDCLoginCtrl.Handle,
+		auth.optional, notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/token/refresh", refreshTokenCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/reauthenticate", reauthenticateCtrl.Handle,
+		auth.required, notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/logout", logoutCtrl.Handle, auth.required)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/logout/all", logoutAllCtrl.Handle,
+		auth.required, notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/me/profile/image", createProfileImageUploadURLCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite))
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/users/{id}/profile/image", getProfileImageURLCtrl.Handle, auth.optional)
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/me", getMeCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileRead))
+	httputil.RegisterHandler(opts.Mux, http.MethodDelete, "/me", deleteAccountCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/me/activity", listActivityCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileRead))
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/me/sessions", listSessionsCtrl.Handle,
+		auth.required, authorize(domain.ScopeSessionsRead))
+	httputil.RegisterHandler(opts.Mux, http.MethodDelete, "/me/sessions/{id}", revokeSessionCtrl.Handle,
+		auth.required, authorize(domain.ScopeSessionsWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPut, "/me/email", changeEmailCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/me/email/verification", sendEmailVerificationCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/me/email/verify", verifyEmailCodeCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/email/verify", verifyEmailCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/password/forgot", forgotPasswordCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/password/reset", resetPasswordCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPut, "/me/password", changePasswordCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/me/mfa/totp", enrollTOTPCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/me/mfa/totp/enable", enableMFACtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/me/mfa/disable", disableMFACtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/me/passkeys/registration/options",
+		beginPasskeyRegistrationCtrl.Handle, auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/me/passkeys", finishPasskeyRegistrationCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/me/passkeys", listPasskeysCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileRead))
+	httputil.RegisterHandler(opts.Mux, http.MethodDelete, "/me/passkeys/{id}", deletePasskeyCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/me/identities", listIdentitiesCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileRead))
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/me/identities/{provider}", beginOIDCLinkCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/me/identities/callback", finishOIDCLinkCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodDelete, "/me/identities/{provider}/{subject}",
+		unlinkIdentityCtrl.Handle, auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/me/consents", listConsentsCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileRead))
+	httputil.RegisterHandler(opts.Mux, http.MethodDelete, "/me/consents/{client_id}", revokeConsentCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/me/tokens", createAPIKeyCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/me/tokens", listAPIKeysCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileRead))
+	httputil.RegisterHandler(opts.Mux, http.MethodDelete, "/me/tokens/{id}", revokeAPIKeyCtrl.Handle,
+		auth.required, authorize(domain.ScopeProfileWrite), notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/.well-known/jwks.json", getJWKSCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/.well-known/openid-configuration",
+		openIDConfigurationCtrl.Handle)
+
+	// OAuth authorization server routers
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/oauth/authorize", oauthLoginPageCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/oauth/authorize", authorizeCtrl.Handle,
+		auth.required, notImpersonated)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/oauth/token", oauthTokenCtrl.Handle)
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/oauth/userinfo", userInfoCtrl.Handle,
+		auth.required, authorize(domain.ScopeOpenID))
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/introspect", introspectCtrl.Handle)
+
+	// admin routers
+	admin := []httputil.Middleware{auth.required, authorize(domain.ScopeUsersAdmin)}
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/admin/users", listUsersCtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/admin/users/{id}", getUserCtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodDelete, "/admin/users/{id}", deleteUserCtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/admin/users/{id}/disable", disableUserCtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/admin/users/{id}/enable", enableUserCtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/admin/users/{id}/unlock", unlockUserCtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodDelete, "/admin/users/{id}/mfa", resetMFACtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/admin/users/{id}/password/reset",
+		forcePasswordResetCtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/admin/users/{id}/tokens/revoke",
+		revokeUserTokensCtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodPut, "/admin/users/{id}/username", changeUsernameCtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/admin/users/{id}/impersonate", impersonateCtrl.Handle,
+		append(admin, notImpersonated)...)
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/admin/audit-events", listAuditEventsCtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodGet, "/admin/clients", listOAuthClientsCtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodPost, "/admin/clients", registerOAuthClientCtrl.Handle, admin...)
+	httputil.RegisterHandler(opts.Mux, http.MethodDelete, "/admin/clients/{id}", deleteOAuthClientCtrl.Handle, admin...)
 }
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/validutil"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+type SendMagicLinkCtrl struct {
+	uc usecase.SendMagicLinkUC
+}
+
+func NewSendMagicLinkCtrl(uc usecase.SendMagicLinkUC) *SendMagicLinkCtrl {
+	return &SendMagicLinkCtrl{uc: uc}
+}
+
+type SendMagicLinkReq struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+// SendMagicLinkRes has the nonce the link is bound to. The app keeps it on the device, and sends it with the link
+// to /login/magic/verify.
+type SendMagicLinkRes struct {
+	Nonce string `json:"nonce"`
+}
+
+func (s *SendMagicLinkCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody SendMagicLinkReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	nonce, err := s.uc.Execute(req.Context(), &usecase.SendMagicLinkReq{
+		Email:     reqBody.Email,
+		IPAddress: httputil.ClientIP(req),
+	})
+	if errors.Is(err, usecase.ErrTooManyMagicLinkMails) {
+		return httputil.ResponseError(w, http.StatusTooManyRequests, CodeTooManyAttempts, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute SendMagicLink", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	w.Header().Set(httputil.CacheControl, "no-store")
+	return httputil.ResponseJSON(w, http.StatusAccepted, &SendMagicLinkRes{Nonce: nonce})
+}
+
+type VerifyMagicLinkCtrl struct {
+	uc usecase.VerifyMagicLinkUC
+}
+
+func NewVerifyMagicLinkCtrl(uc usecase.VerifyMagicLinkUC) *VerifyMagicLinkCtrl {
+	return &VerifyMagicLinkCtrl{uc: uc}
+}
+
+type VerifyMagicLinkReq struct {
+	Token string `json:"token" validate:"required,max=256"`
+	Nonce string `json:"nonce" validate:"required,max=256"`
+}
+
+// Handle responds as BasicLoginCtrl, so that MFA is completed at /login/mfa likewise.
+func (v *VerifyMagicLinkCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody VerifyMagicLinkReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	res, err := v.uc.Execute(req.Context(), &usecase.VerifyMagicLinkReq{
+		Token:  reqBody.Token,
+		Nonce:  reqBody.Nonce,
+		Device: deviceOf(req),
+	})
+	if errors.Is(err, usecase.ErrInvalidMagicLink) {
+		return httputil.ResponseError(w, http.StatusUnauthorized, CodeInvalidMagicLink, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUserDisabled) {
+		return httputil.ResponseError(w, http.StatusForbidden, CodeUserDisabled, err.Error())
+	}
+	if errors.Is(err, usecase.ErrPasswordResetRequired) {
+		return httputil.ResponseError(w, http.StatusForbidden, CodePasswordResetRequired, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute VerifyMagicLink", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	token, refreshToken, err := issueTokens(w, req, res.Token, res.RefreshToken)
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to issue session cookies", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, &BasicLoginRes{
+		Token:        token,
+		RefreshToken: refreshToken,
+		MFARequired:  res.MFAToken != "",
+		MFAToken:     res.MFAToken,
+	})
+}
@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/validutil"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+type CompleteMFALoginCtrl struct {
+	uc usecase.CompleteMFALoginUC
+}
+
+func NewCompleteMFALoginCtrl(uc usecase.CompleteMFALoginUC) *CompleteMFALoginCtrl {
+	return &CompleteMFALoginCtrl{uc: uc}
+}
+
+type CompleteMFALoginReq struct {
+	MFAToken string `json:"mfa_token" validate:"required,max=256"`
+	// Code is either a code of the authenticator or a recovery code.
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type CompleteMFALoginRes struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+func (c *CompleteMFALoginCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody CompleteMFALoginReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	res, err := c.uc.Execute(req.Context(), &usecase.CompleteMFALoginReq{
+		MFAToken: reqBody.MFAToken,
+		Code:     reqBody.Code,
+		Device:   deviceOf(req),
+	})
+	if errors.Is(err, usecase.ErrInvalidMFAChallenge) {
+		return httputil.ResponseError(w, http.StatusUnauthorized, CodeInvalidMFAChallenge, err.Error())
+	}
+	if errors.Is(err, usecase.ErrInvalidMFACode) {
+		return httputil.ResponseError(w, http.StatusUnauthorized, CodeInvalidMFACode, err.Error())
+	}
+	var lockedErr *usecase.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		w.Header().Set(httputil.RetryAfter, strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+		return httputil.ResponseError(w, http.StatusTooManyRequests, CodeLoginLocked, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUserDisabled) {
+		return httputil.ResponseError(w, http.StatusForbidden, CodeUserDisabled, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute CompleteMFALogin", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	token, refreshToken, err := issueTokens(w, req, res.AccessToken, res.RefreshToken)
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to issue session cookies", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, &CompleteMFALoginRes{Token: token, RefreshToken: refreshToken})
+}
+
+type EnrollTOTPCtrl struct {
+	uc usecase.EnrollTOTPUC
+}
+
+func NewEnrollTOTPCtrl(uc usecase.EnrollTOTPUC) *EnrollTOTPCtrl {
+	return &EnrollTOTPCtrl{uc: uc}
+}
+
+type EnrollTOTPRes struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+func (e *EnrollTOTPCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	res, err := e.uc.Execute(req.Context(), principalFrom(req.Context()))
+	if errors.Is(err, usecase.ErrMFAAlreadyEnabled) {
+		return httputil.ResponseError(w, http.StatusConflict, CodeMFAAlreadyEnabled, err.Error())
+	}
+	if errors.Is(err, usecase.ErrPermissionDenied) {
+		return httputil.ResponseError(w, http.StatusForbidden, httputil.CodePermissionDenied, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute EnrollTOTP", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &EnrollTOTPRes{
+		Secret:          res.Secret,
+		ProvisioningURI: res.ProvisioningURI,
+	})
+}
+
+type EnableMFACtrl struct {
+	uc usecase.EnableMFAUC
+}
+
+func NewEnableMFACtrl(uc usecase.EnableMFAUC) *EnableMFACtrl {
+	return &EnableMFACtrl{uc: uc}
+}
+
+type EnableMFAReq struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+type EnableMFARes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (e *EnableMFACtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody EnableMFAReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	recoveryCodes, err := e.uc.Execute(req.Context(), principalFrom(req.Context()), reqBody.Code)
+	if errors.Is(err, usecase.ErrMFANotFound) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeMFANotEnrolled, "mfa not enrolled")
+	}
+	if errors.Is(err, usecase.ErrMFAAlreadyEnabled) {
+		return httputil.ResponseError(w, http.StatusConflict, CodeMFAAlreadyEnabled, err.Error())
+	}
+	if errors.Is(err, usecase.ErrInvalidMFACode) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidMFACode, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute EnableMFA", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &EnableMFARes{RecoveryCodes: recoveryCodes})
+}
+
+type DisableMFACtrl struct {
+	uc usecase.DisableMFAUC
+}
+
+func NewDisableMFACtrl(uc usecase.DisableMFAUC) *DisableMFACtrl {
+	return &DisableMFACtrl{uc: uc}
+}
+
+type DisableMFAReq struct {
+	// Code is either a code of the authenticator or a recovery code.
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+func (d *DisableMFACtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody DisableMFAReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	err := d.uc.Execute(req.Context(), principalFrom(req.Context()), reqBody.Code)
+	if errors.Is(err, usecase.ErrMFANotEnabled) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeMFANotEnabled, err.Error())
+	}
+	if errors.Is(err, usecase.ErrInvalidMFACode) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidMFACode, err.Error())
+	}
+	var lockedErr *usecase.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		w.Header().Set(httputil.RetryAfter, strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+		return httputil.ResponseError(w, http.StatusTooManyRequests, CodeLoginLocked, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute DisableMFA", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
@@ -0,0 +1,636 @@
+package controller
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/dpoputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/oidcutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/validutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+// oauthLoginPage is the login page hosted for OAuth clients. It logs the user in with the JSON APIs,
+// and authorizes the client with the parameters of its own URL at POST /oauth/authorize.
+//
+//go:embed oauth_login.html
+var oauthLoginPage []byte
+
+// OAuthErrorRes is an error of the OAuth protocol. Clients expect it instead of the unified format.
+// (RFC 6749 Section 5.2)
+type OAuthErrorRes struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func responseOAuthError(w http.ResponseWriter, statusCode int, code, description string) error {
+	w.Header().Set(httputil.CacheControl, "no-store")
+	return httputil.ResponseJSON(w, statusCode, &OAuthErrorRes{Error: code, ErrorDescription: description})
+}
+
+// responseClientOAuthError responds the error to a client calling an endpoint by itself.
+// Failed client authentication is 401, and asks for Basic again if the client used it. (RFC 6749 Section 5.2)
+func responseClientOAuthError(w http.ResponseWriter, req *http.Request, oauthErr *usecase.OAuthError) error {
+	status := http.StatusBadRequest
+	if oauthErr.Code == usecase.OAuthInvalidClient {
+		status = http.StatusUnauthorized
+		if _, _, ok := req.BasicAuth(); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="zenbu"`)
+		}
+	}
+	return responseOAuthError(w, status, oauthErr.Code, oauthErr.Description)
+}
+
+// clientCredentialsOf returns the credentials of the client, sent either by HTTP Basic (client_secret_basic)
+// or in the form (client_secret_post). Public clients send only client_id in the form. (RFC 6749 Section 2.3.1)
+func clientCredentialsOf(req *http.Request) (id, secret string, err error) {
+	id, secret, ok := req.BasicAuth()
+	if !ok {
+		return req.PostForm.Get("client_id"), req.PostForm.Get("client_secret"), nil
+	}
+	if req.PostForm.Has("client_secret") {
+		return "", "", errors.New("only one client authentication method can be used")
+	}
+
+	// credentials are form-encoded before they are joined by Basic.
+	id, err = url.QueryUnescape(id)
+	if err != nil {
+		return "", "", errors.New("malformed client_id")
+	}
+	secret, err = url.QueryUnescape(secret)
+	if err != nil {
+		return "", "", errors.New("malformed client_secret")
+	}
+	return id, secret, nil
+}
+
+// parseForm parses the body of OAuth endpoints, which is form-encoded unlike the other APIs.
+func parseForm(req *http.Request) error {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get(httputil.ContentType))
+	if err != nil || mediaType != httputil.MIMETypeApplicationForm {
+		return httputil.ErrInvalidContentType
+	}
+	return req.ParseForm()
+}
+
+type OAuthLoginPageCtrl struct{}
+
+func NewOAuthLoginPageCtrl() *OAuthLoginPageCtrl {
+	return &OAuthLoginPageCtrl{}
+}
+
+func (o *OAuthLoginPageCtrl) Handle(w http.ResponseWriter, _ *http.Request) error {
+	w.Header().Set(httputil.ContentType, "text/html; charset=utf-8")
+	w.Header().Set(httputil.CacheControl, "no-store")
+	// the page must not be framed, so that users can't be tricked into consenting. (RFC 6749 Section 10.13)
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(oauthLoginPage); err != nil {
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+	return nil
+}
+
+type AuthorizeCtrl struct {
+	uc usecase.AuthorizeUC
+}
+
+func NewAuthorizeCtrl(uc usecase.AuthorizeUC) *AuthorizeCtrl {
+	return &AuthorizeCtrl{uc: uc}
+}
+
+// AuthorizeReq has the parameters of the authorization request of the client, and the answer of the user
+// once asked to consent.
+type AuthorizeReq struct {
+	ClientID            string `json:"client_id" validate:"required,max=64"`
+	RedirectURI         string `json:"redirect_uri" validate:"required,max=2048"`
+	ResponseType        string `json:"response_type" validate:"max=32"`
+	Scope               string `json:"scope" validate:"max=1024"`
+	State               string `json:"state" validate:"max=1024"`
+	CodeChallenge       string `json:"code_challenge" validate:"max=128"`
+	CodeChallengeMethod string `json:"code_challenge_method" validate:"max=16"`
+	Nonce               string `json:"nonce" validate:"max=256"`
+	Approve             *bool  `json:"approve"`
+}
+
+// AuthorizeRes has either the URI to send the user back to the client, or what the user is asked to consent to.
+type AuthorizeRes struct {
+	RedirectTo      string   `json:"redirect_to,omitempty"`
+	ConsentRequired bool     `json:"consent_required"`
+	ClientName      string   `json:"client_name,omitempty"`
+	Scopes          []string `json:"scopes,omitempty"`
+}
+
+func (a *AuthorizeCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody AuthorizeReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	res, err := a.uc.Execute(req.Context(), principalFrom(req.Context()), &usecase.AuthorizeReq{
+		ClientID:            reqBody.ClientID,
+		RedirectURI:         reqBody.RedirectURI,
+		ResponseType:        reqBody.ResponseType,
+		Scope:               reqBody.Scope,
+		State:               reqBody.State,
+		CodeChallenge:       reqBody.CodeChallenge,
+		CodeChallengeMethod: reqBody.CodeChallengeMethod,
+		Nonce:               reqBody.Nonce,
+		Approve:             reqBody.Approve,
+	})
+	if errors.Is(err, usecase.ErrInvalidAuthorization) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidAuthorization, err.Error())
+	}
+	if errors.Is(err, usecase.ErrPermissionDenied) {
+		return httputil.ResponseError(w, http.StatusForbidden, httputil.CodePermissionDenied, err.Error())
+	}
+	if errors.Is(err, usecase.ErrInvalidToken) {
+		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated, "invalid token")
+	}
+	if errors.Is(err, usecase.ErrUserDisabled) {
+		return httputil.ResponseError(w, http.StatusForbidden, CodeUserDisabled, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute Authorize", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	if res.ConsentRequired {
+		scopes := make([]string, 0, len(res.Scopes))
+		for _, s := range res.Scopes {
+			scopes = append(scopes, string(s))
+		}
+		return httputil.ResponseJSON(w, http.StatusOK, &AuthorizeRes{
+			ConsentRequired: true,
+			ClientName:      res.Client.Name,
+			Scopes:          scopes,
+		})
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, &AuthorizeRes{RedirectTo: res.RedirectURI})
+}
+
+type OAuthTokenCtrl struct {
+	uc usecase.OAuthTokenUC
+	// issuer is the URL zenbu is served at, which DPoP proofs are made for.
+	issuer string
+}
+
+func NewOAuthTokenCtrl(uc usecase.OAuthTokenUC, issuer string) *OAuthTokenCtrl {
+	return &OAuthTokenCtrl{uc: uc, issuer: issuer}
+}
+
+// OAuthTokenRes is the access token response. (RFC 6749 Section 5.1)
+type OAuthTokenRes struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+func (o *OAuthTokenCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	if err := parseForm(req); err != nil {
+		return responseOAuthError(w, http.StatusBadRequest, usecase.OAuthInvalidRequest, err.Error())
+	}
+	clientID, clientSecret, err := clientCredentialsOf(req)
+	if err != nil {
+		return responseOAuthError(w, http.StatusBadRequest, usecase.OAuthInvalidRequest, err.Error())
+	}
+	proof, err := dpopProofOf(req, o.issuer)
+	if err != nil {
+		return responseOAuthError(w, http.StatusBadRequest, usecase.OAuthInvalidDPoPProof, err.Error())
+	}
+
+	res, err := o.uc.Execute(req.Context(), &usecase.OAuthTokenReq{
+		GrantType:    req.PostForm.Get("grant_type"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Code:         req.PostForm.Get("code"),
+		RedirectURI:  req.PostForm.Get("redirect_uri"),
+		CodeVerifier: req.PostForm.Get("code_verifier"),
+		RefreshToken: req.PostForm.Get("refresh_token"),
+		Scope:        req.PostForm.Get("scope"),
+		Device:       deviceOf(req),
+		DPoP:         proof,
+	})
+	var oauthErr *usecase.OAuthError
+	if errors.As(err, &oauthErr) {
+		return responseClientOAuthError(w, req, oauthErr)
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute OAuthToken", slog.Any("err", err))
+		return responseOAuthError(w, http.StatusInternalServerError, "server_error", "internal server error")
+	}
+
+	tokenType := httputil.Bearer
+	if res.DPoPBound {
+		tokenType = dpoputil.Scheme
+	}
+
+	w.Header().Set(httputil.CacheControl, "no-store")
+	return httputil.ResponseJSON(w, http.StatusOK, &OAuthTokenRes{
+		AccessToken:  res.AccessToken,
+		TokenType:    tokenType,
+		ExpiresIn:    int(res.ExpiresIn / time.Second),
+		RefreshToken: res.RefreshToken,
+		IDToken:      res.IDToken,
+		Scope:        domain.FormatScopes(res.Scopes),
+	})
+}
+
+type UserInfoCtrl struct {
+	uc usecase.UserInfoUC
+}
+
+func NewUserInfoCtrl(uc usecase.UserInfoUC) *UserInfoCtrl {
+	return &UserInfoCtrl{uc: uc}
+}
+
+// UserInfoRes has the standard claims of the user. (OpenID Connect Core 1.0 Section 5.1)
+type UserInfoRes struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+func (u *UserInfoCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	res, err := u.uc.Execute(req.Context(), principalFrom(req.Context()))
+	if errors.Is(err, usecase.ErrUserNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute UserInfo", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	info := &UserInfoRes{
+		Subject:           res.Subject.String(),
+		Email:             res.Email,
+		PreferredUsername: res.Username,
+	}
+	if res.Email != "" {
+		info.EmailVerified = &res.EmailVerified
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, info)
+}
+
+type OpenIDConfigurationCtrl struct {
+	uc     usecase.GetJWKSUC
+	issuer string
+}
+
+// NewOpenIDConfigurationCtrl serves the metadata of zenbu as an OpenID provider at the issuer URL.
+func NewOpenIDConfigurationCtrl(uc usecase.GetJWKSUC, issuer string) *OpenIDConfigurationCtrl {
+	return &OpenIDConfigurationCtrl{uc: uc, issuer: strings.TrimSuffix(issuer, "/")}
+}
+
+func (o *OpenIDConfigurationCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	jwks, err := o.uc.Execute(req.Context())
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute GetJWKS", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+	// ID tokens are signed by the active key, which is one of the published keys.
+	var algs []string
+	for _, k := range jwks.Keys {
+		if !slices.Contains(algs, k.Algorithm) {
+			algs = append(algs, k.Algorithm)
+		}
+	}
+
+	w.Header().Set(httputil.CacheControl, "public, max-age=300")
+	return httputil.ResponseJSON(w, http.StatusOK, &oidcutil.Metadata{
+		Issuer:                            o.issuer,
+		AuthorizationEndpoint:             o.issuer + "/oauth/authorize",
+		TokenEndpoint:                     o.issuer + "/oauth/token",
+		JWKSURI:                           o.issuer + "/.well-known/jwks.json",
+		UserinfoEndpoint:                  o.issuer + "/oauth/userinfo",
+		IntrospectionEndpoint:             o.issuer + "/introspect",
+		ScopesSupported:                   []string{string(domain.ScopeOpenID), string(domain.ScopeEmail), string(domain.ScopeProfile)},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{string(domain.GrantAuthorizationCode), string(domain.GrantRefreshToken), string(domain.GrantClientCredentials)},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algs,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		DPoPSigningAlgValuesSupported:     dpoputil.SigningAlgs,
+	})
+}
+
+type ListConsentsCtrl struct {
+	uc usecase.ListConsentsUC
+}
+
+func NewListConsentsCtrl(uc usecase.ListConsentsUC) *ListConsentsCtrl {
+	return &ListConsentsCtrl{uc: uc}
+}
+
+type ConsentRes struct {
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name,omitempty"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type ListConsentsRes struct {
+	Consents []*ConsentRes `json:"consents"`
+}
+
+func (l *ListConsentsCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	consents, err := l.uc.Execute(req.Context(), principalFrom(req.Context()))
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ListConsents", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	res := make([]*ConsentRes, 0, len(consents))
+	for _, c := range consents {
+		scopes := make([]string, 0, len(c.Scopes))
+		for _, s := range c.Scopes {
+			scopes = append(scopes, string(s))
+		}
+		res = append(res, &ConsentRes{
+			ClientID:   c.ClientID,
+			ClientName: c.ClientName,
+			Scopes:     scopes,
+			CreatedAt:  c.CreatedAt,
+			UpdatedAt:  c.UpdatedAt,
+		})
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &ListConsentsRes{Consents: res})
+}
+
+type RevokeConsentCtrl struct {
+	uc usecase.RevokeConsentUC
+}
+
+func NewRevokeConsentCtrl(uc usecase.RevokeConsentUC) *RevokeConsentCtrl {
+	return &RevokeConsentCtrl{uc: uc}
+}
+
+func (r *RevokeConsentCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	err := r.uc.Execute(req.Context(), principalFrom(req.Context()), req.PathValue("client_id"))
+	if errors.Is(err, usecase.ErrConsentNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeConsentNotFound, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute RevokeConsent", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
+
+// OAuthClientRes is a client as seen by operators.
+type OAuthClientRes struct {
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	GrantTypes   []string  `json:"grant_types"`
+	Confidential bool      `json:"confidential"`
+	FirstParty   bool      `json:"first_party"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func newOAuthClientRes(c *domain.OAuthClient) *OAuthClientRes {
+	scopes := make([]string, 0, len(c.Scopes))
+	for _, s := range c.Scopes {
+		scopes = append(scopes, string(s))
+	}
+	grantTypes := make([]string, 0, len(c.GrantTypes))
+	for _, g := range c.GrantTypes {
+		grantTypes = append(grantTypes, string(g))
+	}
+	return &OAuthClientRes{
+		ClientID:     c.ID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectURIs,
+		Scopes:       scopes,
+		GrantTypes:   grantTypes,
+		Confidential: c.IsConfidential(),
+		FirstParty:   c.FirstParty,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+type RegisterOAuthClientCtrl struct {
+	uc usecase.RegisterOAuthClientUC
+}
+
+func NewRegisterOAuthClientCtrl(uc usecase.RegisterOAuthClientUC) *RegisterOAuthClientCtrl {
+	return &RegisterOAuthClientCtrl{uc: uc}
+}
+
+type RegisterOAuthClientReq struct {
+	Name         string   `json:"name" validate:"required,max=64"`
+	RedirectURIs []string `json:"redirect_uris" validate:"max=10,dive,max=2048"`
+	Scopes       []string `json:"scopes" validate:"required,max=20,dive,max=64"`
+	GrantTypes   []string `json:"grant_types" validate:"required,max=3,dive,max=32"`
+	Confidential bool     `json:"confidential"`
+	FirstParty   bool     `json:"first_party"`
+}
+
+// RegisterOAuthClientRes has the secret of a confidential client, which is never shown again.
+type RegisterOAuthClientRes struct {
+	*OAuthClientRes
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func (r *RegisterOAuthClientCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody RegisterOAuthClientReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	scopes := make([]domain.Scope, 0, len(reqBody.Scopes))
+	for _, s := range reqBody.Scopes {
+		scopes = append(scopes, domain.Scope(s))
+	}
+	grantTypes := make([]domain.GrantType, 0, len(reqBody.GrantTypes))
+	for _, g := range reqBody.GrantTypes {
+		grantTypes = append(grantTypes, domain.GrantType(g))
+	}
+
+	client, secret, err := r.uc.Execute(req.Context(), &usecase.RegisterOAuthClientReq{
+		Name:         reqBody.Name,
+		RedirectURIs: reqBody.RedirectURIs,
+		Scopes:       scopes,
+		GrantTypes:   grantTypes,
+		Confidential: reqBody.Confidential,
+		FirstParty:   reqBody.FirstParty,
+	})
+	if errors.Is(err, usecase.ErrInvalidClientMetadata) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidClientMetadata, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute RegisterOAuthClient", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	w.Header().Set(httputil.CacheControl, "no-store")
+	return httputil.ResponseJSON(w, http.StatusCreated, &RegisterOAuthClientRes{
+		OAuthClientRes: newOAuthClientRes(client),
+		ClientSecret:   secret,
+	})
+}
+
+type ListOAuthClientsCtrl struct {
+	uc usecase.ListOAuthClientsUC
+}
+
+func NewListOAuthClientsCtrl(uc usecase.ListOAuthClientsUC) *ListOAuthClientsCtrl {
+	return &ListOAuthClientsCtrl{uc: uc}
+}
+
+type ListOAuthClientsRes struct {
+	Clients []*OAuthClientRes `json:"clients"`
+}
+
+func (l *ListOAuthClientsCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	clients, err := l.uc.Execute(req.Context())
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ListOAuthClients", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	res := make([]*OAuthClientRes, 0, len(clients))
+	for _, c := range clients {
+		res = append(res, newOAuthClientRes(c))
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, &ListOAuthClientsRes{Clients: res})
+}
+
+type DeleteOAuthClientCtrl struct {
+	uc usecase.DeleteOAuthClientUC
+}
+
+func NewDeleteOAuthClientCtrl(uc usecase.DeleteOAuthClientUC) *DeleteOAuthClientCtrl {
+	return &DeleteOAuthClientCtrl{uc: uc}
+}
+
+func (d *DeleteOAuthClientCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	err := d.uc.Execute(req.Context(), req.PathValue("id"))
+	if errors.Is(err, usecase.ErrOAuthClientNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeOAuthClientNotFound, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute DeleteOAuthClient", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
+
+type IntrospectCtrl struct {
+	uc     usecase.IntrospectUC
+	issuer string
+}
+
+func NewIntrospectCtrl(uc usecase.IntrospectUC, issuer string) *IntrospectCtrl {
+	return &IntrospectCtrl{uc: uc, issuer: issuer}
+}
+
+// IntrospectionRes has only active for inactive tokens. (RFC 7662 Section 2.2)
+type IntrospectionRes struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	// Cnf is the key a DPoP-bound token is bound to, whose proof the resource server must verify.
+	// (RFC 9449 Section 6.2)
+	Cnf *ConfirmationRes `json:"cnf,omitempty"`
+	// Act is the admin impersonating the user. (RFC 8693 Section 4.1)
+	Act *ActorRes `json:"act,omitempty"`
+}
+
+type ConfirmationRes struct {
+	JKT string `json:"jkt"`
+}
+
+type ActorRes struct {
+	Sub string `json:"sub"`
+}
+
+func (i *IntrospectCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	if err := parseForm(req); err != nil {
+		return responseOAuthError(w, http.StatusBadRequest, usecase.OAuthInvalidRequest, err.Error())
+	}
+	clientID, clientSecret, err := clientCredentialsOf(req)
+	if err != nil {
+		return responseOAuthError(w, http.StatusBadRequest, usecase.OAuthInvalidRequest, err.Error())
+	}
+
+	// token_type_hint is ignored, as the kind of a token is told by itself.
+	res, err := i.uc.Execute(req.Context(), &usecase.IntrospectReq{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Token:        req.PostForm.Get("token"),
+	})
+	var oauthErr *usecase.OAuthError
+	if errors.As(err, &oauthErr) {
+		return responseClientOAuthError(w, req, oauthErr)
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute Introspect", slog.Any("err", err))
+		return responseOAuthError(w, http.StatusInternalServerError, "server_error", "internal server error")
+	}
+
+	w.Header().Set(httputil.CacheControl, "no-store")
+	if !res.Active {
+		return httputil.ResponseJSON(w, http.StatusOK, &IntrospectionRes{Active: false})
+	}
+
+	p := res.Principal
+	introspection := &IntrospectionRes{
+		Active:    true,
+		Scope:     domain.FormatScopes(p.Scopes),
+		ClientID:  p.ClientID,
+		TokenType: httputil.Bearer,
+		Exp:       p.TokenExpiresAt.Unix(),
+		Iss:       i.issuer,
+		Jti:       p.TokenID,
+	}
+	// tokens of the client credentials grant are issued to no user.
+	if p.UserID != uuid.Nil {
+		introspection.Sub = p.UserID.String()
+	}
+	if p.Thumbprint != "" {
+		introspection.TokenType = dpoputil.Scheme
+		introspection.Cnf = &ConfirmationRes{JKT: p.Thumbprint}
+	}
+	if p.IsImpersonated() {
+		introspection.Act = &ActorRes{Sub: p.ActorID.String()}
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, introspection)
+}
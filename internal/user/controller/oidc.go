@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/validutil"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+// AuthorizationURLRes has the URL of the provider the user is sent to.
+type AuthorizationURLRes struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// OIDCCallbackReq has the parameters the provider redirected the user back to the web app with.
+type OIDCCallbackReq struct {
+	State string `json:"state" validate:"required,max=256"`
+	Code  string `json:"code" validate:"required,max=2048"`
+}
+
+type BeginOIDCLoginCtrl struct {
+	uc usecase.BeginOIDCLoginUC
+}
+
+func NewBeginOIDCLoginCtrl(uc usecase.BeginOIDCLoginUC) *BeginOIDCLoginCtrl {
+	return &BeginOIDCLoginCtrl{uc: uc}
+}
+
+func (b *BeginOIDCLoginCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	authURL, err := b.uc.Execute(req.Context(), req.PathValue("provider"))
+	if errors.Is(err, usecase.ErrUnknownIdentityProvider) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUnknownIdentityProvider, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute BeginOIDCLogin", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &AuthorizationURLRes{AuthorizationURL: authURL})
+}
+
+type FinishOIDCLoginCtrl struct {
+	uc usecase.FinishOIDCLoginUC
+}
+
+func NewFinishOIDCLoginCtrl(uc usecase.FinishOIDCLoginUC) *FinishOIDCLoginCtrl {
+	return &FinishOIDCLoginCtrl{uc: uc}
+}
+
+// OIDCLoginRes has no tokens if MFA is required, as BasicLoginRes.
+type OIDCLoginRes struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	MFARequired  bool   `json:"mfa_required"`
+	MFAToken     string `json:"mfa_token,omitempty"`
+	SignedUp     bool   `json:"signed_up"`
+}
+
+func (f *FinishOIDCLoginCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody OIDCCallbackReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	res, err := f.uc.Execute(req.Context(), &usecase.FinishOIDCLoginReq{
+		State:     reqBody.State,
+		Code:      reqBody.Code,
+		Device:    deviceOf(req),
+		Principal: principalFrom(req.Context()),
+	})
+	if errors.Is(err, usecase.ErrInvalidOIDCCallback) {
+		return httputil.ResponseError(w, http.StatusUnauthorized, CodeInvalidOIDCCallback, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUnknownIdentityProvider) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUnknownIdentityProvider, err.Error())
+	}
+	if errors.Is(err, usecase.ErrIdentityNotLinked) {
+		return httputil.ResponseError(w, http.StatusConflict, CodeIdentityNotLinked, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUserDisabled) {
+		return httputil.ResponseError(w, http.StatusForbidden, CodeUserDisabled, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute FinishOIDCLogin", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	token, refreshToken, err := issueTokens(w, req, res.Token, res.RefreshToken)
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to issue session cookies", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, &OIDCLoginRes{
+		Token:        token,
+		RefreshToken: refreshToken,
+		MFARequired:  res.MFAToken != "",
+		MFAToken:     res.MFAToken,
+		SignedUp:     res.SignedUp,
+	})
+}
+
+type BeginOIDCLinkCtrl struct {
+	uc usecase.BeginOIDCLinkUC
+}
+
+func NewBeginOIDCLinkCtrl(uc usecase.BeginOIDCLinkUC) *BeginOIDCLinkCtrl {
+	return &BeginOIDCLinkCtrl{uc: uc}
+}
+
+func (b *BeginOIDCLinkCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	authURL, err := b.uc.Execute(req.Context(), principalFrom(req.Context()), req.PathValue("provider"))
+	if errors.Is(err, usecase.ErrUnknownIdentityProvider) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUnknownIdentityProvider, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute BeginOIDCLink", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &AuthorizationURLRes{AuthorizationURL: authURL})
+}
+
+type FinishOIDCLinkCtrl struct {
+	uc usecase.FinishOIDCLinkUC
+}
+
+func NewFinishOIDCLinkCtrl(uc usecase.FinishOIDCLinkUC) *FinishOIDCLinkCtrl {
+	return &FinishOIDCLinkCtrl{uc: uc}
+}
+
+type IdentityRes struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (f *FinishOIDCLinkCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody OIDCCallbackReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	identity, err := f.uc.Execute(req.Context(), principalFrom(req.Context()), &usecase.FinishOIDCLinkReq{
+		State: reqBody.State,
+		Code:  reqBody.Code,
+	})
+	if errors.Is(err, usecase.ErrInvalidOIDCCallback) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidOIDCCallback, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUnknownIdentityProvider) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUnknownIdentityProvider, err.Error())
+	}
+	if errors.Is(err, usecase.ErrIdentityAlreadyLinked) {
+		return httputil.ResponseError(w, http.StatusConflict, CodeIdentityAlreadyLinked, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute FinishOIDCLink", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &IdentityRes{
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+	})
+}
+
+type ListIdentitiesCtrl struct {
+	uc usecase.ListIdentitiesUC
+}
+
+func NewListIdentitiesCtrl(uc usecase.ListIdentitiesUC) *ListIdentitiesCtrl {
+	return &ListIdentitiesCtrl{uc: uc}
+}
+
+type ListIdentitiesRes struct {
+	Identities []*IdentityRes `json:"identities"`
+}
+
+func (l *ListIdentitiesCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	identities, err := l.uc.Execute(req.Context(), principalFrom(req.Context()))
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ListIdentities", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	res := make([]*IdentityRes, 0, len(identities))
+	for _, i := range identities {
+		res = append(res, &IdentityRes{
+			Provider:  i.Provider,
+			Subject:   i.Subject,
+			Email:     i.Email,
+			CreatedAt: i.CreatedAt,
+		})
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &ListIdentitiesRes{Identities: res})
+}
+
+type UnlinkIdentityCtrl struct {
+	uc usecase.UnlinkIdentityUC
+}
+
+func NewUnlinkIdentityCtrl(uc usecase.UnlinkIdentityUC) *UnlinkIdentityCtrl {
+	return &UnlinkIdentityCtrl{uc: uc}
+}
+
+func (u *UnlinkIdentityCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	err := u.uc.Execute(req.Context(), principalFrom(req.Context()), req.PathValue("provider"), req.PathValue("subject"))
+	if errors.Is(err, usecase.ErrIdentityNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeIdentityNotFound, err.Error())
+	}
+	if errors.Is(err, usecase.ErrLastLoginMethod) {
+		return httputil.ResponseError(w, http.StatusConflict, CodeLastLoginMethod, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute UnlinkIdentity", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
@@ -0,0 +1,357 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/validutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/webauthnutil"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+// webAuthnTimeout is given to browsers in milliseconds.
+var webAuthnTimeout = usecase.WebAuthnCeremonyExpiresIn.Milliseconds()
+
+// webAuthnBytes is binary in WebAuthn JSON, encoded in base64url as by PublicKeyCredential.toJSON().
+type webAuthnBytes []byte
+
+func (b webAuthnBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(webauthnutil.Encoding.EncodeToString(b))
+}
+
+func (b *webAuthnBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := webauthnutil.Encoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+type PublicKeyCredentialDescriptor struct {
+	Type string        `json:"type"`
+	ID   webAuthnBytes `json:"id"`
+}
+
+type BeginPasskeyRegistrationCtrl struct {
+	uc usecase.BeginPasskeyRegistrationUC
+}
+
+func NewBeginPasskeyRegistrationCtrl(uc usecase.BeginPasskeyRegistrationUC) *BeginPasskeyRegistrationCtrl {
+	return &BeginPasskeyRegistrationCtrl{uc: uc}
+}
+
+// PublicKeyCredentialCreationOptions is given to navigator.credentials.create() as publicKey.
+type PublicKeyCredentialCreationOptions struct {
+	Challenge webAuthnBytes `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          webAuthnBytes `json:"id"`
+		Name        string        `json:"name"`
+		DisplayName string        `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []PublicKeyCredentialParameters  `json:"pubKeyCredParams"`
+	Timeout                int64                            `json:"timeout"`
+	ExcludeCredentials     []*PublicKeyCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+type PublicKeyCredentialParameters struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type BeginPasskeyRegistrationRes struct {
+	CeremonyID string                              `json:"ceremony_id"`
+	PublicKey  *PublicKeyCredentialCreationOptions `json:"public_key"`
+}
+
+func (b *BeginPasskeyRegistrationCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	res, err := b.uc.Execute(req.Context(), principalFrom(req.Context()))
+	if errors.Is(err, usecase.ErrTooManyPasskeys) {
+		return httputil.ResponseError(w, http.StatusConflict, CodeTooManyPasskeys, err.Error())
+	}
+	if errors.Is(err, usecase.ErrPermissionDenied) {
+		return httputil.ResponseError(w, http.StatusForbidden, httputil.CodePermissionDenied, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute BeginPasskeyRegistration", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	opts := &PublicKeyCredentialCreationOptions{
+		Challenge:          res.Challenge,
+		Timeout:            webAuthnTimeout,
+		ExcludeCredentials: make([]*PublicKeyCredentialDescriptor, 0, len(res.ExcludeCredentialIDs)),
+		Attestation:        "none",
+	}
+	opts.RP.ID = res.RPID
+	opts.RP.Name = res.RPName
+	opts.User.ID = res.UserID[:]
+	opts.User.Name = res.Username
+	opts.User.DisplayName = res.Username
+	for _, alg := range webauthnutil.SupportedAlgorithms {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, PublicKeyCredentialParameters{Type: "public-key", Alg: alg})
+	}
+	for _, id := range res.ExcludeCredentialIDs {
+		opts.ExcludeCredentials = append(opts.ExcludeCredentials, &PublicKeyCredentialDescriptor{Type: "public-key", ID: id})
+	}
+	opts.AuthenticatorSelection.ResidentKey = "required"
+	opts.AuthenticatorSelection.UserVerification = "required"
+
+	return httputil.ResponseJSON(w, http.StatusOK, &BeginPasskeyRegistrationRes{
+		CeremonyID: res.CeremonyID.String(),
+		PublicKey:  opts,
+	})
+}
+
+type FinishPasskeyRegistrationCtrl struct {
+	uc usecase.FinishPasskeyRegistrationUC
+}
+
+func NewFinishPasskeyRegistrationCtrl(uc usecase.FinishPasskeyRegistrationUC) *FinishPasskeyRegistrationCtrl {
+	return &FinishPasskeyRegistrationCtrl{uc: uc}
+}
+
+// FinishPasskeyRegistrationReq has the credential created by navigator.credentials.create(), as its toJSON().
+type FinishPasskeyRegistrationReq struct {
+	CeremonyID string `json:"ceremony_id" validate:"required,uuid"`
+	Name       string `json:"name" validate:"max=64"`
+	Credential struct {
+		Response struct {
+			ClientDataJSON    webAuthnBytes `json:"clientDataJSON" validate:"required"`
+			AttestationObject webAuthnBytes `json:"attestationObject" validate:"required"`
+		} `json:"response"`
+	} `json:"credential"`
+}
+
+type PasskeyRes struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+func (f *FinishPasskeyRegistrationCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody FinishPasskeyRegistrationReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	passkey, err := f.uc.Execute(req.Context(), principalFrom(req.Context()), &usecase.FinishPasskeyRegistrationReq{
+		CeremonyID:        uuid.MustParse(reqBody.CeremonyID),
+		Name:              reqBody.Name,
+		ClientDataJSON:    reqBody.Credential.Response.ClientDataJSON,
+		AttestationObject: reqBody.Credential.Response.AttestationObject,
+	})
+	if errors.Is(err, usecase.ErrInvalidWebAuthnResponse) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidWebAuthnResponse, err.Error())
+	}
+	if errors.Is(err, usecase.ErrPasskeyAlreadyExists) {
+		return httputil.ResponseError(w, http.StatusConflict, CodePasskeyAlreadyExists, err.Error())
+	}
+	if errors.Is(err, usecase.ErrTooManyPasskeys) {
+		return httputil.ResponseError(w, http.StatusConflict, CodeTooManyPasskeys, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute FinishPasskeyRegistration", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &PasskeyRes{
+		ID:         passkey.EncodedID(),
+		Name:       passkey.Name,
+		CreatedAt:  passkey.CreatedAt,
+		LastUsedAt: passkey.LastUsedAt,
+	})
+}
+
+type BeginPasskeyLoginCtrl struct {
+	uc usecase.BeginPasskeyLoginUC
+}
+
+func NewBeginPasskeyLoginCtrl(uc usecase.BeginPasskeyLoginUC) *BeginPasskeyLoginCtrl {
+	return &BeginPasskeyLoginCtrl{uc: uc}
+}
+
+// PublicKeyCredentialRequestOptions is given to navigator.credentials.get() as publicKey.
+// No credentials are allowed explicitly, so that the user picks any passkey for the relying party.
+type PublicKeyCredentialRequestOptions struct {
+	Challenge        webAuthnBytes                    `json:"challenge"`
+	RPID             string                           `json:"rpId"`
+	Timeout          int64                            `json:"timeout"`
+	AllowCredentials []*PublicKeyCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                           `json:"userVerification"`
+}
+
+type BeginPasskeyLoginRes struct {
+	CeremonyID string                             `json:"ceremony_id"`
+	PublicKey  *PublicKeyCredentialRequestOptions `json:"public_key"`
+}
+
+func (b *BeginPasskeyLoginCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	res, err := b.uc.Execute(req.Context())
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute BeginPasskeyLogin", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &BeginPasskeyLoginRes{
+		CeremonyID: res.CeremonyID.String(),
+		PublicKey: &PublicKeyCredentialRequestOptions{
+			Challenge:        res.Challenge,
+			RPID:             res.RPID,
+			Timeout:          webAuthnTimeout,
+			AllowCredentials: []*PublicKeyCredentialDescriptor{},
+			UserVerification: "required",
+		},
+	})
+}
+
+type FinishPasskeyLoginCtrl struct {
+	uc usecase.FinishPasskeyLoginUC
+}
+
+func NewFinishPasskeyLoginCtrl(uc usecase.FinishPasskeyLoginUC) *FinishPasskeyLoginCtrl {
+	return &FinishPasskeyLoginCtrl{uc: uc}
+}
+
+// FinishPasskeyLoginReq has the credential asserted by navigator.credentials.get(), as its toJSON().
+type FinishPasskeyLoginReq struct {
+	CeremonyID string `json:"ceremony_id" validate:"required,uuid"`
+	Credential struct {
+		RawID    webAuthnBytes `json:"rawId" validate:"required"`
+		Response struct {
+			ClientDataJSON    webAuthnBytes `json:"clientDataJSON" validate:"required"`
+			AuthenticatorData webAuthnBytes `json:"authenticatorData" validate:"required"`
+			Signature         webAuthnBytes `json:"signature" validate:"required"`
+			UserHandle        webAuthnBytes `json:"userHandle" validate:"required"`
+		} `json:"response"`
+	} `json:"credential"`
+}
+
+type FinishPasskeyLoginRes struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+func (f *FinishPasskeyLoginCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody FinishPasskeyLoginReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	res, err := f.uc.Execute(req.Context(), &usecase.FinishPasskeyLoginReq{
+		CeremonyID:        uuid.MustParse(reqBody.CeremonyID),
+		CredentialID:      reqBody.Credential.RawID,
+		UserHandle:        reqBody.Credential.Response.UserHandle,
+		ClientDataJSON:    reqBody.Credential.Response.ClientDataJSON,
+		AuthenticatorData: reqBody.Credential.Response.AuthenticatorData,
+		Signature:         reqBody.Credential.Response.Signature,
+		Device:            deviceOf(req),
+	})
+	if errors.Is(err, usecase.ErrInvalidWebAuthnResponse) {
+		return httputil.ResponseError(w, http.StatusUnauthorized, CodeInvalidWebAuthnResponse, "invalid credentials")
+	}
+	if errors.Is(err, usecase.ErrPasskeyCloned) {
+		return httputil.ResponseError(w, http.StatusUnauthorized, CodePasskeyCloned, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUserDisabled) {
+		return httputil.ResponseError(w, http.StatusForbidden, CodeUserDisabled, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute FinishPasskeyLogin", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	token, refreshToken, err := issueTokens(w, req, res.AccessToken, res.RefreshToken)
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to issue session cookies", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, &FinishPasskeyLoginRes{Token: token, RefreshToken: refreshToken})
+}
+
+type ListPasskeysCtrl struct {
+	uc usecase.ListPasskeysUC
+}
+
+func NewListPasskeysCtrl(uc usecase.ListPasskeysUC) *ListPasskeysCtrl {
+	return &ListPasskeysCtrl{uc: uc}
+}
+
+type ListPasskeysRes struct {
+	Passkeys []*PasskeyRes `json:"passkeys"`
+}
+
+func (l *ListPasskeysCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	passkeys, err := l.uc.Execute(req.Context(), principalFrom(req.Context()))
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ListPasskeys", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	res := make([]*PasskeyRes, 0, len(passkeys))
+	for _, p := range passkeys {
+		res = append(res, &PasskeyRes{
+			ID:         p.EncodedID(),
+			Name:       p.Name,
+			CreatedAt:  p.CreatedAt,
+			LastUsedAt: p.LastUsedAt,
+		})
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &ListPasskeysRes{Passkeys: res})
+}
+
+type DeletePasskeyCtrl struct {
+	uc usecase.DeletePasskeyUC
+}
+
+func NewDeletePasskeyCtrl(uc usecase.DeletePasskeyUC) *DeletePasskeyCtrl {
+	return &DeletePasskeyCtrl{uc: uc}
+}
+
+func (d *DeletePasskeyCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	id, err := webauthnutil.Encoding.DecodeString(req.PathValue("id"))
+	if err != nil || len(id) == 0 {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid passkey id")
+	}
+
+	err = d.uc.Execute(req.Context(), principalFrom(req.Context()), id)
+	if errors.Is(err, usecase.ErrPasskeyNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodePasskeyNotFound, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute DeletePasskey", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
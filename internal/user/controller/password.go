@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/validutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+type ForgotPasswordCtrl struct {
+	uc usecase.ForgotPasswordUC
+}
+
+func NewForgotPasswordCtrl(uc usecase.ForgotPasswordUC) *ForgotPasswordCtrl {
+	return &ForgotPasswordCtrl{uc: uc}
+}
+
+type ForgotPasswordReq struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+func (f *ForgotPasswordCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody ForgotPasswordReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	if err := f.uc.Execute(req.Context(), reqBody.Email); err != nil {
+		logutil.From(req.Context()).Error("failed to execute ForgotPassword", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
+
+type ResetPasswordCtrl struct {
+	uc usecase.ResetPasswordUC
+}
+
+func NewResetPasswordCtrl(uc usecase.ResetPasswordUC) *ResetPasswordCtrl {
+	return &ResetPasswordCtrl{uc: uc}
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token" validate:"required,max=256"`
+	Password string `json:"password" validate:"required,password"`
+}
+
+func (r *ResetPasswordCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody ResetPasswordReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	err := r.uc.Execute(req.Context(), reqBody.Token, reqBody.Password)
+	if errors.Is(err, usecase.ErrInvalidPasswordReset) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidPasswordReset, err.Error())
+	}
+	if errors.Is(err, domain.ErrPasswordHasherBusy) {
+		return responseHasherBusy(w)
+	}
+	if errors.Is(err, usecase.ErrUserUpdated) {
+		return responseUserUpdated(w)
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ResetPassword", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
+
+type ChangePasswordCtrl struct {
+	uc usecase.ChangePasswordUC
+}
+
+func NewChangePasswordCtrl(uc usecase.ChangePasswordUC) *ChangePasswordCtrl {
+	return &ChangePasswordCtrl{uc: uc}
+}
+
+type ChangePasswordReq struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,password"`
+}
+
+type ChangePasswordRes struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+func (c *ChangePasswordCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody ChangePasswordReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	res, err := c.uc.Execute(req.Context(), principalFrom(req.Context()), &usecase.ChangePasswordReq{
+		CurrentPassword: reqBody.CurrentPassword,
+		NewPassword:     reqBody.NewPassword,
+		Device:          deviceOf(req),
+	})
+	if errors.Is(err, usecase.ErrReauthenticationRequired) {
+		return responseReauthenticationRequired(w)
+	}
+	if errors.Is(err, usecase.ErrImpersonationForbidden) {
+		return responseImpersonationForbidden(w)
+	}
+	if errors.Is(err, usecase.ErrInvalidPassword) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidPassword, "invalid current password")
+	}
+	if errors.Is(err, domain.ErrPasswordHasherBusy) {
+		return responseHasherBusy(w)
+	}
+	if errors.Is(err, usecase.ErrUserUpdated) {
+		return responseUserUpdated(w)
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ChangePassword", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	token, refreshToken, err := issueTokens(w, req, res.AccessToken, res.RefreshToken)
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to issue session cookies", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+	return httputil.ResponseJSON(w, http.StatusOK, &ChangePasswordRes{Token: token, RefreshToken: refreshToken})
+}
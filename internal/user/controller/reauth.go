@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/dpoputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/validutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+// responseReauthenticationRequired tells the client to re-authenticate at /reauthenticate and retry,
+// as the step-up authentication challenge of RFC 9470.
+func responseReauthenticationRequired(w http.ResponseWriter) error {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", max_age=%d`,
+		int(usecase.RecentAuthMaxAge.Seconds())))
+	return httputil.ResponseError(w, http.StatusUnauthorized, CodeReauthenticationRequired,
+		"re-authentication required for this operation")
+}
+
+type ReauthenticateCtrl struct {
+	uc usecase.ReauthenticateUC
+}
+
+func NewReauthenticateCtrl(uc usecase.ReauthenticateUC) *ReauthenticateCtrl {
+	return &ReauthenticateCtrl{uc: uc}
+}
+
+// ReauthenticateReq has the factors the user logs in by. Code is required only if MFA is enabled.
+type ReauthenticateReq struct {
+	Password string `json:"password" validate:"omitempty,max=256"`
+	Code     string `json:"code" validate:"omitempty,max=32"`
+}
+
+// ReauthenticateRes has an access token of the same session with the new auth time.
+type ReauthenticateRes struct {
+	Token     string `json:"token,omitempty"`
+	TokenType string `json:"token_type"`
+}
+
+func (r *ReauthenticateCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	var reqBody ReauthenticateReq
+	if err := httputil.ParseJSONBody(req, &reqBody); err != nil {
+		return httputil.HandleParseJSONBodyError(req.Context(), w, err)
+	}
+
+	if err := validutil.Validate(reqBody); err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, err.Error())
+	}
+
+	res, err := r.uc.Execute(req.Context(), principalFrom(req.Context()), &usecase.ReauthenticateReq{
+		Password:  reqBody.Password,
+		Code:      reqBody.Code,
+		IPAddress: httputil.ClientIP(req),
+	})
+	if errors.Is(err, usecase.ErrInvalidPassword) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidPassword, err.Error())
+	}
+	if errors.Is(err, usecase.ErrInvalidMFACode) {
+		return httputil.ResponseError(w, http.StatusBadRequest, CodeInvalidMFACode, err.Error())
+	}
+	if errors.Is(err, domain.ErrPasswordHasherBusy) {
+		return responseHasherBusy(w)
+	}
+	var lockedErr *usecase.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		w.Header().Set(httputil.RetryAfter, strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+		return httputil.ResponseError(w, http.StatusTooManyRequests, CodeLoginLocked, err.Error())
+	}
+	if errors.Is(err, usecase.ErrPermissionDenied) {
+		return httputil.ResponseError(w, http.StatusForbidden, httputil.CodePermissionDenied, err.Error())
+	}
+	if errors.Is(err, usecase.ErrInvalidToken) {
+		return httputil.ResponseError(w, http.StatusUnauthorized, httputil.CodeUnauthenticated, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUserDisabled) {
+		return httputil.ResponseError(w, http.StatusForbidden, CodeUserDisabled, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute Reauthenticate", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	token, _, err := issueTokens(w, req, res.AccessToken, "")
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to issue session cookies", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+	tokenType := httputil.Bearer
+	if res.DPoPBound {
+		tokenType = dpoputil.Scheme
+	}
+	w.Header().Set(httputil.CacheControl, "no-store")
+	return httputil.ResponseJSON(w, http.StatusOK, &ReauthenticateRes{Token: token, TokenType: tokenType})
+}
+
+type DeleteAccountCtrl struct {
+	uc usecase.DeleteAccountUC
+}
+
+func NewDeleteAccountCtrl(uc usecase.DeleteAccountUC) *DeleteAccountCtrl {
+	return &DeleteAccountCtrl{uc: uc}
+}
+
+func (d *DeleteAccountCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	err := d.uc.Execute(req.Context(), principalFrom(req.Context()))
+	if errors.Is(err, usecase.ErrReauthenticationRequired) {
+		return responseReauthenticationRequired(w)
+	}
+	if errors.Is(err, usecase.ErrImpersonationForbidden) {
+		return responseImpersonationForbidden(w)
+	}
+	if errors.Is(err, usecase.ErrPermissionDenied) {
+		return httputil.ResponseError(w, http.StatusForbidden, httputil.CodePermissionDenied, err.Error())
+	}
+	if errors.Is(err, usecase.ErrUserNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute DeleteAccount", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	if isCookieAuthenticated(req) {
+		clearSessionCookies(w)
+	}
+	return httputil.ResponseNoContent(w)
+}
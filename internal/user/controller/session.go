@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/httputil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+type ListSessionsCtrl struct {
+	uc usecase.ListSessionsUC
+}
+
+func NewListSessionsCtrl(uc usecase.ListSessionsUC) *ListSessionsCtrl {
+	return &ListSessionsCtrl{uc: uc}
+}
+
+type SessionRes struct {
+	ID         string `json:"id"`
+	DeviceName string `json:"device_name"`
+	IPAddress  string `json:"ip_address"`
+	// ClientID is the OAuth client the session was started for. It is empty for logins to zenbu itself.
+	ClientID   string    `json:"client_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	// Current is true for the session of the requesting device.
+	Current bool `json:"current"`
+}
+
+type ListSessionsRes struct {
+	Sessions []*SessionRes `json:"sessions"`
+}
+
+func (l *ListSessionsCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	res, err := l.uc.Execute(req.Context(), principalFrom(req.Context()))
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute ListSessions", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	sessions := make([]*SessionRes, 0, len(res.Sessions))
+	for _, s := range res.Sessions {
+		sessions = append(sessions, &SessionRes{
+			ID:         s.ID.String(),
+			DeviceName: s.Device.Name,
+			IPAddress:  s.Device.IPAddress,
+			ClientID:   s.ClientID,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			Current:    s.ID == res.CurrentSessionID,
+		})
+	}
+
+	return httputil.ResponseJSON(w, http.StatusOK, &ListSessionsRes{Sessions: sessions})
+}
+
+type RevokeSessionCtrl struct {
+	uc usecase.RevokeSessionUC
+}
+
+func NewRevokeSessionCtrl(uc usecase.RevokeSessionUC) *RevokeSessionCtrl {
+	return &RevokeSessionCtrl{uc: uc}
+}
+
+func (r *RevokeSessionCtrl) Handle(w http.ResponseWriter, req *http.Request) error {
+	sessionID, err := uuid.Parse(req.PathValue("id"))
+	if err != nil {
+		return httputil.ResponseError(w, http.StatusBadRequest, httputil.CodeInvalidRequestParams, "invalid session id")
+	}
+
+	err = r.uc.Execute(req.Context(), principalFrom(req.Context()), sessionID)
+	if errors.Is(err, usecase.ErrSessionNotFound) {
+		return httputil.ResponseError(w, http.StatusNotFound, CodeSessionNotFound, err.Error())
+	}
+	if err != nil {
+		logutil.From(req.Context()).Error("failed to execute RevokeSession", slog.Any("err", err))
+		return httputil.ResponseError(w, http.StatusInternalServerError, 0, "internal server error")
+	}
+
+	return httputil.ResponseNoContent(w)
+}
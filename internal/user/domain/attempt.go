@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// LoginAttempts counts failed login attempts by a username or an IP address in a fixed window.
+// Attempts being verified are counted as failures until they succeed.
+type LoginAttempts struct {
+	Failures int
+	// ExpiresAt is the end of the window. The count is reset afterward.
+	ExpiresAt time.Time
+}
+
+func (a *LoginAttempts) IsExpired(now time.Time) bool {
+	return !now.Before(a.ExpiresAt)
+}
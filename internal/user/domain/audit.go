@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEventType is what happened to the account of the user.
+type AuditEventType string
+
+const (
+	// AuditImpersonationStarted is recorded when an admin is issued a token to act as the user,
+	// and AuditImpersonatedRequest for every request the admin sends with it.
+	AuditImpersonationStarted AuditEventType = "impersonation.started"
+	AuditImpersonatedRequest  AuditEventType = "impersonation.request"
+
+	AuditLoginSucceeded AuditEventType = "login.succeeded"
+	AuditLoginFailed    AuditEventType = "login.failed"
+	// AuditPasswordChanged is recorded when the user changes the password, and AuditPasswordReset when
+	// the password is reset by a mailed link.
+	AuditPasswordChanged AuditEventType = "password.changed"
+	AuditPasswordReset   AuditEventType = "password.reset"
+	// AuditProfileImageUploadRequested is recorded when an upload URL is issued, as images are uploaded
+	// to the storage directly.
+	AuditProfileImageUploadRequested AuditEventType = "profile_image.upload_requested"
+
+	// events of actions of admins on the user.
+	AuditUserDisabled            AuditEventType = "user.disabled"
+	AuditUserEnabled             AuditEventType = "user.enabled"
+	AuditUserPasswordResetForced AuditEventType = "user.password_reset_forced"
+	AuditUserTokensRevoked       AuditEventType = "user.tokens_revoked"
+	AuditUserUsernameChanged     AuditEventType = "user.username_changed"
+	AuditUserDeleted             AuditEventType = "user.deleted"
+	AuditUserUnlocked            AuditEventType = "user.unlocked"
+	AuditUserMFAReset            AuditEventType = "user.mfa_reset"
+)
+
+// AuditEvent is a record of something done to the account of a user, kept for review.
+// Events are never changed once recorded.
+type AuditEvent struct {
+	ID     uuid.UUID
+	Type   AuditEventType
+	UserID uuid.UUID
+	// ActorID is the admin who acted, if not the user.
+	ActorID uuid.UUID
+	// Details describe the event, e.g. the method and path of a request.
+	Details map[string]string
+	// CorrelationID is of the request the event occurred in, to find its logs.
+	CorrelationID string
+	CreatedAt     time.Time
+}
+
+func NewAuditEvent(typ AuditEventType, userID, actorID uuid.UUID, details map[string]string) *AuditEvent {
+	return &AuditEvent{
+		ID:        uuid.New(),
+		Type:      typ,
+		UserID:    userID,
+		ActorID:   actorID,
+		Details:   details,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,34 @@
+package domain
+
+// AuthMethod is a method the user authenticated by, given in the amr claim of tokens.
+// Values are of the registry of RFC 8176 where one fits.
+type AuthMethod string
+
+const (
+	AuthMethodPassword AuthMethod = "pwd"
+	AuthMethodOTP      AuthMethod = "otp"
+	// AuthMethodMFA is given with the methods when more than one factor was used.
+	AuthMethodMFA AuthMethod = "mfa"
+	// AuthMethodPasskey is the proof-of-possession of a passkey.
+	AuthMethodPasskey AuthMethod = "pop"
+	// AuthMethodFederated and AuthMethodEmail are not registered: the user authenticated
+	// at an external identity provider, or by a link sent to the email address.
+	AuthMethodFederated AuthMethod = "fed"
+	AuthMethodEmail     AuthMethod = "email"
+)
+
+func FormatAuthMethods(methods []AuthMethod) []string {
+	s := make([]string, 0, len(methods))
+	for _, m := range methods {
+		s = append(s, string(m))
+	}
+	return s
+}
+
+func ParseAuthMethods(s []string) []AuthMethod {
+	methods := make([]AuthMethod, 0, len(s))
+	for _, m := range s {
+		methods = append(methods, AuthMethod(m))
+	}
+	return methods
+}
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"strings"
+)
+
+// Device is the client a session was started from.
+type Device struct {
+	// Name is a human-readable name derived from UserAgent. e.g. "Chrome on macOS"
+	Name      string
+	UserAgent string
+	IPAddress string
+}
+
+func NewDevice(userAgent, ipAddress string) *Device {
+	return &Device{Name: deviceName(userAgent), UserAgent: userAgent, IPAddress: ipAddress}
+}
+
+// browserPatterns and osPatterns are matched in order, so more specific tokens come first.
+// e.g. Edge and Opera also contain "Chrome", and Chrome also contains "Safari".
+var (
+	browserPatterns = [][2]string{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"SamsungBrowser/", "Samsung Internet"},
+		{"Firefox/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+	osPatterns = [][2]string{
+		{"Windows", "Windows"},
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+func deviceName(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := matchPattern(userAgent, browserPatterns)
+	platform := matchPattern(userAgent, osPatterns)
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case platform != "":
+		return platform
+	case browser != "":
+		return browser
+	}
+
+	// non-browser clients such as "curl/8.4.0" or "okhttp/4.12.0" are named after their product token.
+	product, _, _ := strings.Cut(userAgent, "/")
+	product, _, _ = strings.Cut(product, " ")
+	return product
+}
+
+func matchPattern(userAgent string, patterns [][2]string) string {
+	for _, p := range patterns {
+		if strings.Contains(userAgent, p[0]) {
+			return p[1]
+		}
+	}
+	return ""
+}
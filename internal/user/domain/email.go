@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// emailVerificationCodeDigits is the length of codes typed by users instead of clicking the link.
+	emailVerificationCodeDigits = 6
+	// MaxEmailVerificationAttempts bounds guesses of a code, which has little entropy.
+	MaxEmailVerificationAttempts = 5
+)
+
+var ErrMalformedEmailVerificationToken = errors.New("malformed email verification token")
+
+// NormalizeEmail lowercases the email address, so that the same address can't be registered twice.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// EmailVerification is a pending proof that the user owns the email address.
+// It is proved either by the token in the link sent to the address or by the code in the same mail.
+// Both are single-use: the verification is deleted once proved.
+type EmailVerification struct {
+	UserID uuid.UUID
+	Email  string
+
+	TokenHash string
+	CodeHash  string
+	// Attempts counts codes entered, including the one being verified.
+	Attempts int
+
+	ExpiresAt time.Time
+}
+
+// NewEmailVerification creates a verification of the email address of the user and returns it with the token
+// and the code to be sent.
+func NewEmailVerification(
+	userID uuid.UUID, email string, expiresIn time.Duration,
+) (v *EmailVerification, token, code string, err error) {
+	secret, tokenHash, err := newSecret()
+	if err != nil {
+		return nil, "", "", err
+	}
+	code, err = newNumericCode(emailVerificationCodeDigits)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	v = &EmailVerification{
+		UserID:    userID,
+		Email:     email,
+		TokenHash: tokenHash,
+		CodeHash:  hashCode(userID, code),
+		ExpiresAt: time.Now().Add(expiresIn),
+	}
+	return v, userID.String() + "." + secret, code, nil
+}
+
+func (v *EmailVerification) IsExpired(now time.Time) bool {
+	return !now.Before(v.ExpiresAt)
+}
+
+func (v *EmailVerification) MatchesToken(hash string) bool {
+	return equalHash(v.TokenHash, hash)
+}
+
+func (v *EmailVerification) MatchesCode(code string) bool {
+	return equalHash(v.CodeHash, hashCode(v.UserID, code))
+}
+
+// ParseEmailVerificationToken extracts the user the token was issued for and the hash of its secret.
+// Tokens are formatted as "<user id>.<secret>".
+func ParseEmailVerificationToken(token string) (userID uuid.UUID, hash string, err error) {
+	userID, hash, ok := parseUserToken(token)
+	if !ok {
+		return uuid.Nil, "", ErrMalformedEmailVerificationToken
+	}
+	return userID, hash, nil
+}
+
+// newNumericCode generates a random code of decimal digits.
+func newNumericCode(digits int) (string, error) {
+	n, err := rand.Int(rand.Reader, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+// hashCode hashes a code with the user ID, so that the same code of different users has different hashes.
+func hashCode(userID uuid.UUID, code string) string {
+	return hashSecret(userID.String() + ":" + code)
+}
@@ -1,66 +1,142 @@
 package domain
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
-	"fmt"
-	"log/slog"
-	"math/rand"
-	"strings"
+	"slices"
 	"time"
 
-	"golang.org/x/crypto/pbkdf2"
-
 	"github.com/google/uuid"
 )
 
-// Password is a type for user password.
-// It is formatted as "<algorithm>$<iterations>$<salt>$<hash>".
-type Password string
+type User struct {
+	ID uuid.UUID
 
-func (p Password) String() string {
-	return string(p)
-}
+	Username string
+	// Password is empty if the user signed up with an external identity and has not set one.
+	Password Password
+	Roles    []Role
 
-const (
-	keyLen           = 32
-	hashIterations   = 120000
-	encryptAlgorithm = "pbkdf2_sha256"
-	saltCharset      = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	saltLen          = 12
-)
+	// Email is normalized by NormalizeEmail. It is empty if the user has not given one.
+	Email string
+	// EmailVerifiedAt is the time the user proved to own Email. It is zero if not verified.
+	EmailVerifiedAt time.Time
 
-var seededRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	// DisabledAt is the time the user was disabled by an operator. It is zero for enabled users.
+	DisabledAt time.Time
+	// PasswordResetRequired forbids login until the user resets the password.
+	PasswordResetRequired bool
+	// GuestExpiresAt is when the guest user is deleted unless used again. It is zero for full accounts.
+	GuestExpiresAt time.Time
 
-func NewPassword(plain string) Password {
-	salt := make([]byte, saltLen)
-	for i := range salt {
-		salt[i] = saltCharset[seededRand.Intn(len(saltCharset))]
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// guestExtendInterval is how long the expiry of an active guest is kept before it is extended,
+// so that the user is not stored on every use.
+const guestExtendInterval = time.Hour * 24
+
+// NewGuest creates a guest user, who uses the service without credentials until upgraded by Upgrade.
+// It is expired after expiresIn unless it is used again.
+func NewGuest(username string, expiresIn time.Duration) *User {
+	now := time.Now()
+	return &User{
+		ID:             uuid.New(),
+		Username:       username,
+		Roles:          DefaultRoles(),
+		GuestExpiresAt: now.Add(expiresIn),
+		CreatedAt:      now,
+		UpdatedAt:      now,
 	}
-	encrypted := base64.StdEncoding.EncodeToString(
-		pbkdf2.Key([]byte(plain), salt, hashIterations, keyLen, sha256.New),
-	)
-	return Password(fmt.Sprintf("%s$%d$%s$%s", encryptAlgorithm, hashIterations, salt, encrypted))
 }
 
-func (p Password) Compare(plain string) bool {
-	pwd := strings.Split(string(p), "$")
-	if len(pwd) != 4 {
-		slog.Error("invalid password format")
+func (u *User) IsGuest() bool {
+	return !u.GuestExpiresAt.IsZero()
+}
+
+// ExtendGuest keeps an active guest from expiring for expiresIn from now.
+// It reports whether the expiry was changed, which happens at most once a day.
+func (u *User) ExtendGuest(expiresIn time.Duration) bool {
+	if !u.IsGuest() {
+		return false
+	}
+	now := time.Now()
+	if u.GuestExpiresAt.After(now.Add(expiresIn - guestExtendInterval)) {
 		return false
 	}
+	u.GuestExpiresAt = now.Add(expiresIn)
+	u.UpdatedAt = now
+	return true
+}
 
-	encrypted := base64.StdEncoding.EncodeToString(
-		pbkdf2.Key([]byte(plain), []byte(pwd[2]), hashIterations, keyLen, sha256.New),
-	)
-	return pwd[3] == encrypted
+// Upgrade makes the guest a full account, which is never expired. The ID and data of the guest are kept.
+func (u *User) Upgrade() {
+	u.GuestExpiresAt = time.Time{}
+	u.UpdatedAt = time.Now()
 }
 
-type User struct {
-	ID uuid.UUID
+func (u *User) IsEmailVerified() bool {
+	return u.Email != "" && !u.EmailVerifiedAt.IsZero()
+}
 
-	Username  string
-	Password  Password
-	CreatedAt time.Time
-	UpdatedAt time.Time
+func (u *User) VerifyEmail() {
+	u.EmailVerifiedAt = time.Now()
+	u.UpdatedAt = u.EmailVerifiedAt
+}
+
+func (u *User) HasPassword() bool {
+	return u.Password != ""
+}
+
+func (u *User) GrantRole(role Role) {
+	if u.HasRole(role) {
+		return
+	}
+	u.Roles = append(u.Roles, role)
+	u.UpdatedAt = time.Now()
+}
+
+func (u *User) IsDisabled() bool {
+	return !u.DisabledAt.IsZero()
+}
+
+func (u *User) Disable() {
+	if u.IsDisabled() {
+		return
+	}
+	u.DisabledAt = time.Now()
+	u.UpdatedAt = u.DisabledAt
+}
+
+func (u *User) Enable() {
+	u.DisabledAt = time.Time{}
+	u.UpdatedAt = time.Now()
+}
+
+func (u *User) RequirePasswordReset() {
+	u.PasswordResetRequired = true
+	u.UpdatedAt = time.Now()
+}
+
+// ChangePassword sets a new password, which also fulfills a required password reset.
+func (u *User) ChangePassword(password Password) {
+	u.Password = password
+	u.PasswordResetRequired = false
+	u.UpdatedAt = time.Now()
+}
+
+func (u *User) HasRole(role Role) bool {
+	return slices.Contains(u.Roles, role)
+}
+
+// Scopes returns every scope granted by the roles of the user, without duplicates.
+func (u *User) Scopes() []Scope {
+	var scopes []Scope
+	for _, r := range u.Roles {
+		for _, s := range r.Scopes() {
+			if !slices.Contains(scopes, s) {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes
 }
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/oidcutil"
+)
+
+// Identity links the user to an account at an external OpenID provider, which the user logs in with.
+// A user may link many identities, but an identity is linked to only one user.
+type Identity struct {
+	UserID uuid.UUID
+	// Provider is the name of the provider configured in zenbu, and Subject identifies the account at it.
+	Provider string
+	Subject  string
+	// Email is the address the provider asserted when the identity was linked.
+	Email string
+
+	CreatedAt time.Time
+}
+
+func NewIdentity(userID uuid.UUID, provider string, claims *oidcutil.Claims) *Identity {
+	return &Identity{
+		UserID:    userID,
+		Provider:  provider,
+		Subject:   claims.Subject,
+		Email:     NormalizeEmail(claims.Email),
+		CreatedAt: time.Now(),
+	}
+}
+
+// OIDCAuthPurpose tells what an authorization request is for, so that a callback can't be used for the other.
+type OIDCAuthPurpose string
+
+const (
+	OIDCLogin OIDCAuthPurpose = "login"
+	OIDCLink  OIDCAuthPurpose = "link"
+)
+
+// OIDCAuthRequest is an authorization request sent to a provider, pending the callback with the code.
+// It is single-use: the request is deleted once the callback is received.
+type OIDCAuthRequest struct {
+	// StateHash is the hash of the state given to the provider, which identifies the request on the callback.
+	StateHash string
+	Purpose   OIDCAuthPurpose
+	Provider  string
+	// UserID is the user linking an identity. It is nil for logins, where the user is not known yet.
+	UserID       uuid.UUID
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// NewOIDCAuthRequest creates an authorization request and returns it with the state and the code challenge
+// to be sent to the provider.
+func NewOIDCAuthRequest(
+	purpose OIDCAuthPurpose, provider string, userID uuid.UUID, expiresIn time.Duration,
+) (r *OIDCAuthRequest, state, codeChallenge string, err error) {
+	state, stateHash, err := newSecret()
+	if err != nil {
+		return nil, "", "", err
+	}
+	nonce, _, err := newSecret()
+	if err != nil {
+		return nil, "", "", err
+	}
+	verifier, codeChallenge, err := oidcutil.NewPKCE()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	r = &OIDCAuthRequest{
+		StateHash:    stateHash,
+		Purpose:      purpose,
+		Provider:     provider,
+		UserID:       userID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(expiresIn),
+	}
+	return r, state, codeChallenge, nil
+}
+
+func (r *OIDCAuthRequest) IsExpired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+// HashOIDCState hashes the state of the callback to look up its authorization request.
+func HashOIDCState(state string) string {
+	return hashSecret(state)
+}
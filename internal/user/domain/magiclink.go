@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrMalformedMagicLinkToken = errors.New("malformed magic link token")
+
+// MagicLink is a pending passwordless login, proved by the token sent to the email address of the user.
+// It is bound to the device which requested it by the nonce returned only to the device,
+// so that the link is useless to whom intercepts the mail. It is single-use, as PasswordReset.
+type MagicLink struct {
+	UserID uuid.UUID
+	// Email is the address the token was sent to.
+	Email     string
+	TokenHash string
+	NonceHash string
+	ExpiresAt time.Time
+}
+
+// NewMagicLink creates a magic link of the user bound to the nonce, and returns it with the token to be sent.
+func NewMagicLink(userID uuid.UUID, email, nonce string, expiresIn time.Duration) (l *MagicLink, token string, err error) {
+	secret, tokenHash, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	l = &MagicLink{
+		UserID:    userID,
+		Email:     email,
+		TokenHash: tokenHash,
+		NonceHash: hashSecret(nonce),
+		ExpiresAt: time.Now().Add(expiresIn),
+	}
+	return l, userID.String() + "." + secret, nil
+}
+
+// NewMagicLinkNonce returns a nonce to be returned to the requesting device. It is created before the address is
+// looked up, so that requests of unknown addresses are not told from the others.
+func NewMagicLinkNonce() (string, error) {
+	nonce, _, err := newSecret()
+	return nonce, err
+}
+
+func (l *MagicLink) IsExpired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// Matches reports whether the link is opened by the token with the nonce of the device which requested it.
+func (l *MagicLink) Matches(tokenHash, nonce string) bool {
+	// both are compared anyway, not to tell which one is wrong by response time.
+	tokenOK := equalHash(l.TokenHash, tokenHash)
+	nonceOK := equalHash(l.NonceHash, hashSecret(nonce))
+	return tokenOK && nonceOK
+}
+
+// ParseMagicLinkToken extracts the user the token was issued for and the hash of its secret.
+// Tokens are formatted as "<user id>.<secret>".
+func ParseMagicLinkToken(token string) (userID uuid.UUID, hash string, err error) {
+	userID, hash, ok := parseUserToken(token)
+	if !ok {
+		return uuid.Nil, "", ErrMalformedMagicLinkToken
+	}
+	return userID, hash, nil
+}
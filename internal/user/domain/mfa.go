@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/otputil"
+)
+
+const (
+	recoveryCodeCount = 10
+	// recoveryCodeLen is the length of recovery codes in base32 characters. (50 bits)
+	recoveryCodeLen = 10
+)
+
+var (
+	ErrMalformedMFAChallengeToken = errors.New("malformed mfa challenge token")
+
+	recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// MFA is the second factor of the user: a TOTP authenticator, and one-time recovery codes for when it is lost.
+// It is enrolled first, and enabled once the user proves the authenticator works by a code of it.
+type MFA struct {
+	UserID     uuid.UUID
+	TOTPSecret []byte
+	// LastUsedStep is the time step of the last accepted code, so that a code can't be used twice.
+	LastUsedStep       int64
+	RecoveryCodeHashes []string
+
+	EnabledAt time.Time
+	CreatedAt time.Time
+}
+
+// NewMFA enrolls a new TOTP authenticator of the user.
+func NewMFA(userID uuid.UUID) (*MFA, error) {
+	secret, err := otputil.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	return &MFA{UserID: userID, TOTPSecret: secret, CreatedAt: time.Now()}, nil
+}
+
+func (m *MFA) IsEnabled() bool {
+	return !m.EnabledAt.IsZero()
+}
+
+// ProvisioningURI returns the URI to add the authenticator to an app.
+func (m *MFA) ProvisioningURI(issuer, account string) string {
+	return otputil.DefaultTOTP.ProvisioningURI(issuer, account, m.TOTPSecret)
+}
+
+// VerifyTOTP returns the time step of the code if it is valid now and newer than the last accepted one.
+func (m *MFA) VerifyTOTP(code string, now time.Time) (step int64, ok bool) {
+	step, ok = otputil.DefaultTOTP.Validate(m.TOTPSecret, code, now)
+	if !ok || step <= m.LastUsedStep {
+		return 0, false
+	}
+	return step, true
+}
+
+// Enable enables the authenticator verified at the time step, and returns new recovery codes to be shown once.
+func (m *MFA) Enable(step int64) (recoveryCodes []string, err error) {
+	recoveryCodes = make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		recoveryCodes = append(recoveryCodes, code)
+		hashes = append(hashes, hashCode(m.UserID, normalizeRecoveryCode(code)))
+	}
+
+	m.RecoveryCodeHashes = hashes
+	m.LastUsedStep = step
+	m.EnabledAt = time.Now()
+	return recoveryCodes, nil
+}
+
+// MatchRecoveryCode returns the hash of the recovery code, to be removed once used, if it is one of the user.
+func (m *MFA) MatchRecoveryCode(code string) (hash string, ok bool) {
+	hash = hashCode(m.UserID, normalizeRecoveryCode(code))
+	if !slices.ContainsFunc(m.RecoveryCodeHashes, func(h string) bool { return equalHash(h, hash) }) {
+		return "", false
+	}
+	return hash, true
+}
+
+// newRecoveryCode generates a recovery code formatted as "xxxxx-xxxxx" for readability.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeLen*5/8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+	return code[:recoveryCodeLen/2] + "-" + code[recoveryCodeLen/2:], nil
+}
+
+// normalizeRecoveryCode accepts codes typed in any case, with or without separators.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// MFAChallenge is a login waiting for the second factor, after the password was verified.
+// It is single-use: the challenge is deleted once the login is completed.
+type MFAChallenge struct {
+	UserID    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+// NewMFAChallenge creates a challenge of the user and returns it with the token to complete the login.
+func NewMFAChallenge(userID uuid.UUID, expiresIn time.Duration) (c *MFAChallenge, token string, err error) {
+	secret, tokenHash, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	c = &MFAChallenge{UserID: userID, TokenHash: tokenHash, ExpiresAt: time.Now().Add(expiresIn)}
+	return c, userID.String() + "." + secret, nil
+}
+
+func (c *MFAChallenge) IsExpired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+func (c *MFAChallenge) MatchesToken(hash string) bool {
+	return equalHash(c.TokenHash, hash)
+}
+
+// ParseMFAChallengeToken extracts the user the token was issued for and the hash of its secret.
+// Tokens are formatted as "<user id>.<secret>".
+func ParseMFAChallengeToken(token string) (userID uuid.UUID, hash string, err error) {
+	userID, hash, ok := parseUserToken(token)
+	if !ok {
+		return uuid.Nil, "", ErrMalformedMFAChallengeToken
+	}
+	return userID, hash, nil
+}
@@ -0,0 +1,241 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/oidcutil"
+)
+
+// GrantType is a way for an OAuth client to get access tokens. (RFC 6749 Section 1.3)
+type GrantType string
+
+const (
+	GrantAuthorizationCode GrantType = "authorization_code"
+	GrantRefreshToken      GrantType = "refresh_token"
+	GrantClientCredentials GrantType = "client_credentials"
+)
+
+func (g GrantType) IsValid() bool {
+	switch g {
+	case GrantAuthorizationCode, GrantRefreshToken, GrantClientCredentials:
+		return true
+	}
+	return false
+}
+
+// OpenID Connect scopes. They are not granted by roles, but only to OAuth clients the user authorized.
+const (
+	ScopeOpenID  Scope = "openid"
+	ScopeEmail   Scope = "email"
+	ScopeProfile Scope = "profile"
+)
+
+// IsOIDC reports whether the scope is an OpenID Connect scope, which asks for the identity of the user.
+func (s Scope) IsOIDC() bool {
+	return s == ScopeOpenID || s == ScopeEmail || s == ScopeProfile
+}
+
+// clientCredentialsScopes are the scopes a client may be granted acting on its own by the client credentials grant.
+// The other scopes act on the resources of a user, which the client doesn't have.
+var clientCredentialsScopes = []Scope{ScopeUsersAdmin}
+
+// IsValidClientScope reports whether the scope can be registered for an OAuth client.
+func IsValidClientScope(scope Scope) bool {
+	if scope.IsOIDC() {
+		return true
+	}
+	for _, scopes := range roleScopes {
+		if slices.Contains(scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientScopes returns the scopes granted to a client the user authorized for the scopes, given the scopes of
+// the roles of the user. A client is never granted more than the user has, even if the user lost a role after
+// authorizing it.
+func ClientScopes(authorized, userScopes []Scope) []Scope {
+	scopes := make([]Scope, 0, len(authorized))
+	for _, s := range authorized {
+		if s.IsOIDC() || slices.Contains(userScopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// OAuthClient is an application acting on behalf of users, or on its own, with access tokens issued by zenbu.
+type OAuthClient struct {
+	ID   string
+	Name string
+	// SecretHash is the hash of the client secret. It is empty for public clients, such as mobile and SPA apps,
+	// which can't keep a secret.
+	SecretHash string
+	// RedirectURIs are the only URIs the authorization code can be sent to. They are compared exactly.
+	RedirectURIs []string
+	// Scopes are the most the client can be granted.
+	Scopes     []Scope
+	GrantTypes []GrantType
+	// FirstParty clients are operated by zenbu itself, so users are not asked to consent to them.
+	FirstParty bool
+
+	CreatedAt time.Time
+}
+
+// NewOAuthClient registers a client. The secret of a confidential client is returned only here.
+func NewOAuthClient(
+	name string, redirectURIs []string, scopes []Scope, grantTypes []GrantType, confidential, firstParty bool,
+) (c *OAuthClient, secret string, err error) {
+	c = &OAuthClient{
+		ID:           uuid.NewString(),
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+		GrantTypes:   grantTypes,
+		FirstParty:   firstParty,
+		CreatedAt:    time.Now(),
+	}
+	if confidential {
+		secret, c.SecretHash, err = newSecret()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return c, secret, nil
+}
+
+func (c *OAuthClient) IsConfidential() bool {
+	return c.SecretHash != ""
+}
+
+// VerifySecret authenticates a confidential client. Public clients have no secret to be verified.
+func (c *OAuthClient) VerifySecret(secret string) bool {
+	return c.IsConfidential() && secret != "" && equalHash(c.SecretHash, hashSecret(secret))
+}
+
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+func (c *OAuthClient) AllowsGrant(grantType GrantType) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// AllowsScopes reports whether the client may be granted every scope.
+func (c *OAuthClient) AllowsScopes(scopes []Scope) bool {
+	for _, s := range scopes {
+		if !slices.Contains(c.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// ClientCredentialsScopes returns the scopes of the client which can be granted by the client credentials grant.
+func (c *OAuthClient) ClientCredentialsScopes() []Scope {
+	var scopes []Scope
+	for _, s := range c.Scopes {
+		if slices.Contains(clientCredentialsScopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// Consent records the scopes a user authorized a client for, so that the user is asked only once.
+type Consent struct {
+	UserID   uuid.UUID
+	ClientID string
+	Scopes   []Scope
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func NewConsent(userID uuid.UUID, clientID string, scopes []Scope) *Consent {
+	now := time.Now()
+	return &Consent{
+		UserID:    userID,
+		ClientID:  clientID,
+		Scopes:    slices.Clone(scopes),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Covers reports whether the user already authorized every scope.
+func (c *Consent) Covers(scopes []Scope) bool {
+	for _, s := range scopes {
+		if !slices.Contains(c.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Grant adds the scopes to the consent. Scopes authorized before are kept.
+func (c *Consent) Grant(scopes []Scope) {
+	for _, s := range scopes {
+		if !slices.Contains(c.Scopes, s) {
+			c.Scopes = append(c.Scopes, s)
+		}
+	}
+	c.UpdatedAt = time.Now()
+}
+
+// AuthorizationCode is issued to a client when the user authorizes it, to be redeemed for tokens once.
+type AuthorizationCode struct {
+	// CodeHash is the hash of the code, which identifies it.
+	CodeHash    string
+	ClientID    string
+	UserID      uuid.UUID
+	RedirectURI string
+	Scopes      []Scope
+	// CodeChallenge is the S256 PKCE challenge the code verifier must match. (RFC 7636)
+	CodeChallenge string
+	// Nonce is given back in the ID token.
+	Nonce string
+	// AuthTime is when the user authenticated, given in the ID token.
+	AuthTime  time.Time
+	ExpiresAt time.Time
+}
+
+// NewAuthorizationCode creates an authorization code and returns it with the code to be sent to the client.
+func NewAuthorizationCode(
+	clientID string, userID uuid.UUID, redirectURI string, scopes []Scope, codeChallenge, nonce string,
+	authTime time.Time, expiresIn time.Duration,
+) (*AuthorizationCode, string, error) {
+	code, hash, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	return &AuthorizationCode{
+		CodeHash:      hash,
+		ClientID:      clientID,
+		UserID:        userID,
+		RedirectURI:   redirectURI,
+		Scopes:        scopes,
+		CodeChallenge: codeChallenge,
+		Nonce:         nonce,
+		AuthTime:      authTime,
+		ExpiresAt:     time.Now().Add(expiresIn),
+	}, code, nil
+}
+
+func (a *AuthorizationCode) IsExpired(now time.Time) bool {
+	return !now.Before(a.ExpiresAt)
+}
+
+// VerifyCodeVerifier checks the PKCE code verifier the client sent with the code.
+func (a *AuthorizationCode) VerifyCodeVerifier(verifier string) bool {
+	return verifier != "" && equalHash(a.CodeChallenge, oidcutil.PKCEChallenge(verifier))
+}
+
+// HashAuthorizationCode hashes the code sent by the client to look up its authorization code.
+func HashAuthorizationCode(code string) string {
+	return hashSecret(code)
+}
@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/webauthnutil"
+)
+
+// Passkey is a WebAuthn credential of the user, which logs in without a password.
+// A user may register many, e.g. one per device.
+type Passkey struct {
+	ID     []byte
+	UserID uuid.UUID
+	// Name is given by the user to tell passkeys apart.
+	Name string
+	// PublicKey is COSE_Key encoded.
+	PublicKey []byte
+	SignCount uint32
+	AAGUID    []byte
+
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+func NewPasskey(userID uuid.UUID, name string, cred *webauthnutil.Credential) *Passkey {
+	now := time.Now()
+	return &Passkey{
+		ID:         cred.ID,
+		UserID:     userID,
+		Name:       name,
+		PublicKey:  cred.PublicKey,
+		SignCount:  cred.SignCount,
+		AAGUID:     cred.AAGUID,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+}
+
+// EncodedID is the credential ID as encoded in WebAuthn JSON.
+func (p *Passkey) EncodedID() string {
+	return webauthnutil.Encoding.EncodeToString(p.ID)
+}
+
+// Use records a login with the sign count reported by the authenticator.
+// It returns false if the count didn't increase, which means the credential may have been cloned.
+// Authenticators not counting, e.g. of synced passkeys, always report zero.
+func (p *Passkey) Use(signCount uint32) bool {
+	if (signCount != 0 || p.SignCount != 0) && signCount <= p.SignCount {
+		return false
+	}
+	p.SignCount = signCount
+	p.LastUsedAt = time.Now()
+	return true
+}
+
+// WebAuthnCeremonyPurpose tells what a ceremony is for, so that a challenge can't be used for the other.
+type WebAuthnCeremonyPurpose string
+
+const (
+	WebAuthnRegistration WebAuthnCeremonyPurpose = "registration"
+	WebAuthnLogin        WebAuthnCeremonyPurpose = "login"
+)
+
+// WebAuthnCeremony is the challenge of a registration or a login pending the response of the authenticator.
+// It is single-use: the ceremony is deleted once the response is received.
+type WebAuthnCeremony struct {
+	ID      uuid.UUID
+	Purpose WebAuthnCeremonyPurpose
+	// UserID is the user registering a passkey. It is nil for logins, where the user is not known yet.
+	UserID    uuid.UUID
+	Challenge []byte
+	ExpiresAt time.Time
+}
+
+func NewWebAuthnCeremony(
+	purpose WebAuthnCeremonyPurpose, userID uuid.UUID, expiresIn time.Duration,
+) (*WebAuthnCeremony, error) {
+	challenge, err := webauthnutil.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnCeremony{
+		ID:        uuid.New(),
+		Purpose:   purpose,
+		UserID:    userID,
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(expiresIn),
+	}, nil
+}
+
+func (c *WebAuthnCeremony) IsExpired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime"
+	"sync"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/passwordutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/poolutil"
+)
+
+// ErrPasswordHasherBusy is returned when too many passwords are being hashed. Clients should retry later.
+var ErrPasswordHasherBusy = errors.New("password hasher busy")
+
+// Password is a type for user password.
+// It is formatted as "<algorithm>$<parameters and salt>$<hash>". e.g. "argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>"
+type Password string
+
+func (p Password) String() string {
+	return string(p)
+}
+
+// passwordHashers verifies passwords hashed by any supported algorithm, and hashes new passwords by the preferred one.
+var passwordHashers = passwordutil.DefaultRegistry()
+
+// passwordHashingPool bounds concurrent hashing, which is heavy on CPU and memory.
+var passwordHashingPool = poolutil.NewPool(runtime.NumCPU(), 4*runtime.NumCPU())
+
+// SetPasswordHashAlgorithm changes the algorithm hashing new passwords. Passwords hashed by other algorithms
+// are rehashed when the users log in. It must be called before serving requests.
+func SetPasswordHashAlgorithm(algorithm string) error {
+	return passwordHashers.Prefer(algorithm)
+}
+
+// SetPasswordHashingPool replaces the pool hashing passwords. It must be called before serving requests.
+func SetPasswordHashingPool(pool *poolutil.Pool) {
+	passwordHashingPool = pool
+}
+
+// hashInPool runs the task in passwordHashingPool, so that hashing bursts can't starve other requests.
+func hashInPool(ctx context.Context, task func()) error {
+	err := passwordHashingPool.Do(ctx, task)
+	if errors.Is(err, poolutil.ErrQueueFull) {
+		return errors.Join(ErrPasswordHasherBusy, err)
+	}
+	return err
+}
+
+func NewPassword(ctx context.Context, plain string) (Password, error) {
+	var hash string
+	var hashErr error
+	err := hashInPool(ctx, func() {
+		hash, hashErr = passwordHashers.Hash(plain)
+	})
+	if err := errors.Join(err, hashErr); err != nil {
+		return "", err
+	}
+	return Password(hash), nil
+}
+
+// Compare reports whether the plain password matches. It returns an error only if it couldn't compare.
+// An empty password never matches, but it takes as long as a wrong password.
+func (p Password) Compare(ctx context.Context, plain string) (bool, error) {
+	if p == "" {
+		return false, CompareDummyPassword(ctx, plain)
+	}
+
+	var ok bool
+	var verifyErr error
+	err := hashInPool(ctx, func() {
+		ok, verifyErr = passwordHashers.Verify(string(p), plain)
+	})
+	if err != nil {
+		return false, err
+	}
+	if verifyErr != nil {
+		slog.ErrorContext(ctx, "failed to verify password", slog.Any("err", verifyErr))
+		return false, nil
+	}
+	return ok, nil
+}
+
+// NeedsRehash reports whether the password was hashed by an outdated algorithm or parameters.
+// It should be rehashed while the plain password is known, i.e. on login.
+func (p Password) NeedsRehash() bool {
+	return passwordHashers.NeedsRehash(string(p))
+}
+
+// dummyPassword is compared when there is no such user, so that it takes as long as a wrong password.
+var dummyPassword = sync.OnceValue(func() Password {
+	hash, err := passwordHashers.Hash("")
+	if err != nil {
+		slog.Error("failed to hash dummy password", slog.Any("err", err))
+	}
+	return Password(hash)
+})
+
+// CompareDummyPassword costs the same time as Compare, to resist username enumeration by response time.
+func CompareDummyPassword(ctx context.Context, plain string) error {
+	dummy := dummyPassword()
+	if dummy == "" {
+		return nil
+	}
+	_, err := dummy.Compare(ctx, plain)
+	return err
+}
@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrMalformedPasswordResetToken = errors.New("malformed password reset token")
+
+// PasswordReset is a pending reset of the password, proved by the token sent to the email address of the user.
+// It is single-use: the reset is deleted once the password is reset.
+type PasswordReset struct {
+	UserID uuid.UUID
+	// Email is the address the token was sent to.
+	Email     string
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+// NewPasswordReset creates a password reset of the user and returns it with the token to be sent.
+func NewPasswordReset(
+	userID uuid.UUID, email string, expiresIn time.Duration,
+) (r *PasswordReset, token string, err error) {
+	secret, tokenHash, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	r = &PasswordReset{
+		UserID:    userID,
+		Email:     email,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(expiresIn),
+	}
+	return r, userID.String() + "." + secret, nil
+}
+
+func (r *PasswordReset) IsExpired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+func (r *PasswordReset) MatchesToken(hash string) bool {
+	return equalHash(r.TokenHash, hash)
+}
+
+// ParsePasswordResetToken extracts the user the token was issued for and the hash of its secret.
+// Tokens are formatted as "<user id>.<secret>".
+func ParsePasswordResetToken(token string) (userID uuid.UUID, hash string, err error) {
+	userID, hash, ok := parseUserToken(token)
+	if !ok {
+		return uuid.Nil, "", ErrMalformedPasswordResetToken
+	}
+	return userID, hash, nil
+}
@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+)
+
+// Role is a set of permissions granted to a user.
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+// Scope is a permission to call a group of APIs. It is carried in access tokens.
+// It is formatted as "<resource>:<action>".
+type Scope string
+
+const (
+	ScopeProfileRead   Scope = "profile:read"
+	ScopeProfileWrite  Scope = "profile:write"
+	ScopeSessionsRead  Scope = "sessions:read"
+	ScopeSessionsWrite Scope = "sessions:write"
+	ScopeUsersAdmin    Scope = "users:admin"
+)
+
+var roleScopes = map[Role][]Scope{
+	RoleUser:  {ScopeProfileRead, ScopeProfileWrite, ScopeSessionsRead, ScopeSessionsWrite},
+	RoleAdmin: {ScopeUsersAdmin},
+}
+
+// DefaultRoles are the roles of a newly created user.
+func DefaultRoles() []Role {
+	return []Role{RoleUser}
+}
+
+func (r Role) IsValid() bool {
+	_, ok := roleScopes[r]
+	return ok
+}
+
+// Scopes returns the scopes granted by the role.
+func (r Role) Scopes() []Scope {
+	return slices.Clone(roleScopes[r])
+}
+
+// ParseScopes parses space-delimited scopes. (RFC 6749 section 3.3)
+func ParseScopes(s string) []Scope {
+	fields := strings.Fields(s)
+	scopes := make([]Scope, 0, len(fields))
+	for _, f := range fields {
+		scopes = append(scopes, Scope(f))
+	}
+	return scopes
+}
+
+// FormatScopes formats scopes space-delimited. (RFC 6749 section 3.3)
+func FormatScopes(scopes []Scope) string {
+	s := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		s = append(s, string(scope))
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const secretLen = 32
+
+// newSecret generates a random secret for opaque tokens, and the hash of it to store instead of it.
+func newSecret() (secret string, hash string, err error) {
+	b := make([]byte, secretLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	secret = base64.RawURLEncoding.EncodeToString(b)
+	return secret, hashSecret(secret), nil
+}
+
+// hashSecret hashes a secret of opaque tokens. Secrets are random with enough entropy, so a plain hash suffices.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func equalHash(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// parseUserToken parses an opaque token of a user, formatted as "<user id>.<secret>",
+// into the user ID and the hash of the secret.
+func parseUserToken(token string) (userID uuid.UUID, hash string, ok bool) {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return uuid.Nil, "", false
+	}
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, "", false
+	}
+	return userID, hashSecret(secret), true
+}
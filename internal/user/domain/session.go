@@ -0,0 +1,149 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxRotatedTokenHashes bounds how many rotated refresh tokens are remembered per session for reuse detection.
+const maxRotatedTokenHashes = 100
+
+var ErrMalformedRefreshToken = errors.New("malformed refresh token")
+
+// Session is a login session of a user.
+// Refresh tokens issued for a session form a family: every refresh rotates the token and the hash of
+// the previous one is kept, so that reuse of an already rotated token can be detected.
+type Session struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+	Device *Device
+	// ClientID is the OAuth client the session was started for. It is empty for logins to zenbu itself.
+	ClientID string
+	// Scopes are the scopes the user authorized the client for. They are used only for client sessions,
+	// while the others are granted the scopes of the roles of the user.
+	Scopes []Scope
+	// Thumbprint is of the DPoP key the session is bound to. Its tokens are refreshed only with proofs of the key,
+	// and access tokens are bound to the key as well. It is empty for sessions not bound to any key.
+	Thumbprint string
+	// AuthTime is when the user last authenticated in the session, by logging in or re-authenticating,
+	// and AuthMethods are the methods the user authenticated by then.
+	AuthTime    time.Time
+	AuthMethods []AuthMethod
+
+	// RefreshTokenHash is the hash of the only refresh token currently valid for the session.
+	RefreshTokenHash string
+	// RotatedTokenHashes are hashes of refresh tokens already rotated out, the oldest first.
+	RotatedTokenHashes []string
+
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
+
+// NewSession creates a session for the user and returns it with its first refresh token.
+func NewSession(userID uuid.UUID, device *Device, expiresIn time.Duration) (*Session, string, error) {
+	now := time.Now()
+	s := &Session{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Device:     device,
+		AuthTime:   now,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(expiresIn),
+	}
+
+	token, hash, err := newRefreshToken(s.UserID, s.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	s.RefreshTokenHash = hash
+
+	return s, token, nil
+}
+
+// Reauthenticate records that the user authenticated again in the session by the methods.
+func (s *Session) Reauthenticate(methods []AuthMethod) {
+	s.AuthTime = time.Now()
+	s.AuthMethods = methods
+}
+
+// Rotate issues a new refresh token for the session and invalidates the current one.
+func (s *Session) Rotate() (string, error) {
+	token, hash, err := newRefreshToken(s.UserID, s.ID)
+	if err != nil {
+		return "", err
+	}
+
+	s.RotatedTokenHashes = append(s.RotatedTokenHashes, s.RefreshTokenHash)
+	if len(s.RotatedTokenHashes) > maxRotatedTokenHashes {
+		s.RotatedTokenHashes = s.RotatedTokenHashes[len(s.RotatedTokenHashes)-maxRotatedTokenHashes:]
+	}
+	s.RefreshTokenHash = hash
+	s.LastUsedAt = time.Now()
+
+	return token, nil
+}
+
+// Extend keeps the session from expiring for expiresIn from now.
+func (s *Session) Extend(expiresIn time.Duration) {
+	s.ExpiresAt = time.Now().Add(expiresIn)
+}
+
+// GrantedScopes returns the scopes of access tokens of the session, given the scopes of the roles of the user.
+func (s *Session) GrantedScopes(userScopes []Scope) []Scope {
+	if s.ClientID == "" {
+		return userScopes
+	}
+	return ClientScopes(s.Scopes, userScopes)
+}
+
+func (s *Session) IsExpired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// IsCurrentRefreshToken reports whether the hash belongs to the currently valid refresh token.
+func (s *Session) IsCurrentRefreshToken(hash string) bool {
+	return equalHash(s.RefreshTokenHash, hash)
+}
+
+// IsRotatedRefreshToken reports whether the hash belongs to a refresh token that was already rotated out.
+func (s *Session) IsRotatedRefreshToken(hash string) bool {
+	return slices.ContainsFunc(s.RotatedTokenHashes, func(h string) bool {
+		return equalHash(h, hash)
+	})
+}
+
+// Refresh tokens are opaque to clients. They are formatted as "<user id>.<session id>.<secret>"
+// so that the session can be looked up without a secondary index. Only the hash of the secret is stored.
+func newRefreshToken(userID, sessionID uuid.UUID) (token string, hash string, err error) {
+	secret, hash, err := newSecret()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return userID.String() + "." + sessionID.String() + "." + secret, hash, nil
+}
+
+// ParseRefreshToken extracts the session the refresh token was issued for and the hash of its secret.
+func ParseRefreshToken(token string) (userID, sessionID uuid.UUID, hash string, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[2] == "" {
+		return uuid.Nil, uuid.Nil, "", ErrMalformedRefreshToken
+	}
+
+	userID, err = uuid.Parse(parts[0])
+	if err != nil {
+		return uuid.Nil, uuid.Nil, "", ErrMalformedRefreshToken
+	}
+	sessionID, err = uuid.Parse(parts[1])
+	if err != nil {
+		return uuid.Nil, uuid.Nil, "", ErrMalformedRefreshToken
+	}
+
+	return userID, sessionID, hashSecret(parts[2]), nil
+}
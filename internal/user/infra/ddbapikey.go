@@ -0,0 +1,178 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const apiKeySortKeyPrefix = "APIKEY"
+
+// dynamoAPIKeyRepo is the implementation of usecase.APIKeyRepo interface using AWS DynamoDB. (adapter)
+// API keys are stored under the user partition, keyed by the key ID, and deleted by TTL when they expire.
+type dynamoAPIKeyRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoAPIKeyRepo(ddb *dynamo.DB, tableName string) usecase.APIKeyRepo {
+	return &dynamoAPIKeyRepo{ddb: ddb, tableName: tableName}
+}
+
+type APIKey struct {
+	nosqlutil.CommonSchema
+
+	Name       string    `dynamo:"nm"`
+	SecretHash string    `dynamo:"sh"`
+	Scope      string    `dynamo:"sc"`
+	CreatedAt  time.Time `dynamo:"ca"`
+	LastUsedAt time.Time `dynamo:"lu,omitempty"`
+	ExpiresAt  time.Time `dynamo:"ttl,unixtime"`
+}
+
+func apiKeySortKey(id uuid.UUID) string {
+	return apiKeySortKeyPrefix + "#" + id.String()
+}
+
+func (k *APIKey) toDomainEntity() *domain.APIKey {
+	return &domain.APIKey{
+		ID:         uuid.MustParse(k.SortKey[len(apiKeySortKeyPrefix)+1:]),
+		UserID:     uuid.MustParse(k.PartitionKey[len(userPartitionKeyPrefix)+1:]),
+		Name:       k.Name,
+		SecretHash: k.SecretHash,
+		Scopes:     domain.ParseScopes(k.Scope),
+		CreatedAt:  k.CreatedAt,
+		LastUsedAt: k.LastUsedAt,
+		ExpiresAt:  k.ExpiresAt,
+	}
+}
+
+func (dar *dynamoAPIKeyRepo) Create(ctx context.Context, k *domain.APIKey) error {
+	err := dar.ddb.Table(dar.tableName).Put(&APIKey{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(k.UserID),
+			SortKey:      apiKeySortKey(k.ID),
+		},
+		Name:       k.Name,
+		SecretHash: k.SecretHash,
+		Scope:      domain.FormatScopes(k.Scopes),
+		CreatedAt:  k.CreatedAt,
+		LastUsedAt: k.LastUsedAt,
+		ExpiresAt:  k.ExpiresAt,
+	}).Run(ctx)
+	if err != nil {
+		return fmt.Errorf("dynamoAPIKeyRepo.Create failed: %w", err)
+	}
+	return nil
+}
+
+func (dar *dynamoAPIKeyRepo) Get(ctx context.Context, userID, id uuid.UUID) (*domain.APIKey, error) {
+	var item APIKey
+	err := dar.ddb.Table(dar.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.Equal, apiKeySortKey(id)).
+		One(ctx, &item)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoAPIKeyRepo.Get failed: %w", err)
+	}
+
+	k := item.toDomainEntity()
+	// TTL deletion is not immediate, so expired keys may still be read.
+	if k.IsExpired(time.Now()) {
+		return nil, usecase.ErrAPIKeyNotFound
+	}
+	return k, nil
+}
+
+func (dar *dynamoAPIKeyRepo) List(ctx context.Context, userID uuid.UUID) ([]*domain.APIKey, error) {
+	var items []*APIKey
+	err := dar.ddb.Table(dar.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.BeginsWith, apiKeySortKeyPrefix+"#").
+		All(ctx, &items)
+	if err != nil {
+		return nil, fmt.Errorf("dynamoAPIKeyRepo.List failed: %w", err)
+	}
+
+	now := time.Now()
+	res := make([]*domain.APIKey, 0, len(items))
+	for _, item := range items {
+		k := item.toDomainEntity()
+		if k.IsExpired(now) {
+			continue
+		}
+		res = append(res, k)
+	}
+	slices.SortFunc(res, func(a, b *domain.APIKey) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return res, nil
+}
+
+func (dar *dynamoAPIKeyRepo) UpdateLastUsed(ctx context.Context, k *domain.APIKey) error {
+	err := dar.ddb.Table(dar.tableName).
+		Update("pk", userPartitionKey(k.UserID)).
+		Range("sk", apiKeySortKey(k.ID)).
+		Set("lu", k.LastUsedAt).
+		If("attribute_exists(pk)").
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoAPIKeyRepo.UpdateLastUsed failed: %w", err)
+	}
+	return nil
+}
+
+func (dar *dynamoAPIKeyRepo) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	err := dar.ddb.Table(dar.tableName).
+		Delete("pk", userPartitionKey(userID)).
+		Range("sk", apiKeySortKey(id)).
+		If("attribute_exists(pk)").
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoAPIKeyRepo.Delete failed: %w", err)
+	}
+	return nil
+}
+
+func (dar *dynamoAPIKeyRepo) DeleteAll(ctx context.Context, userID uuid.UUID) error {
+	table := dar.ddb.Table(dar.tableName)
+
+	var apiKeys []*APIKey
+	err := table.Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.BeginsWith, apiKeySortKeyPrefix+"#").
+		Project("pk", "sk").
+		All(ctx, &apiKeys)
+	if err != nil {
+		return fmt.Errorf("dynamoAPIKeyRepo.DeleteAll failed to query api keys: %w", err)
+	}
+	if len(apiKeys) == 0 {
+		return nil
+	}
+
+	keys := make([]dynamo.Keyed, 0, len(apiKeys))
+	for _, k := range apiKeys {
+		keys = append(keys, dynamo.Keys{k.PartitionKey, k.SortKey})
+	}
+	if _, err := table.Batch("pk", "sk").Write().Delete(keys...).Run(ctx); err != nil {
+		return fmt.Errorf("dynamoAPIKeyRepo.DeleteAll failed: %w", err)
+	}
+	return nil
+}
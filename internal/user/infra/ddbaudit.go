@@ -0,0 +1,156 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const (
+	auditEventSortKeyPrefix      = "AUDIT"
+	auditEventPartitionKeyPrefix = "AUDIT"
+	// auditEventTimeLayout has a fixed width, so that sort keys are sorted by time.
+	auditEventTimeLayout = "2006-01-02T15:04:05.000000000Z"
+	auditEventDayLayout  = "2006-01-02"
+	// auditEventRetention is how long events are kept, even after the user is deleted.
+	auditEventRetention = time.Hour * 24 * 365
+)
+
+// dynamoAuditEventRepo is the implementation of usecase.AuditEventRepo interface using AWS DynamoDB. (adapter)
+// Each event is stored twice, under the user partition and under the partition of the day it was recorded,
+// sorted by time in both, so that events can be queried by user and, for all users, by day.
+// Events are only put, never updated, and are deleted by TTL.
+type dynamoAuditEventRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoAuditEventRepo(ddb *dynamo.DB, tableName string) usecase.AuditEventRepo {
+	return &dynamoAuditEventRepo{ddb: ddb, tableName: tableName}
+}
+
+func auditEventPartitionKey(day time.Time) string {
+	return auditEventPartitionKeyPrefix + "#" + day.UTC().Format(auditEventDayLayout)
+}
+
+func auditEventSortKey(createdAt time.Time, id uuid.UUID) string {
+	return auditEventTimePrefix(createdAt) + "#" + id.String()
+}
+
+func auditEventTimePrefix(t time.Time) string {
+	return auditEventSortKeyPrefix + "#" + t.UTC().Format(auditEventTimeLayout)
+}
+
+type AuditEvent struct {
+	nosqlutil.CommonSchema
+
+	ID            string            `dynamo:"id"`
+	Type          string            `dynamo:"ty"`
+	UserID        string            `dynamo:"uid"`
+	ActorID       string            `dynamo:"act,omitempty"`
+	Details       map[string]string `dynamo:"det,omitempty"`
+	CorrelationID string            `dynamo:"cid,omitempty"`
+	CreatedAt     time.Time         `dynamo:"ca"`
+	ExpiresAt     time.Time         `dynamo:"ttl,unixtime"`
+}
+
+func (a *AuditEvent) toDomainEntity() *domain.AuditEvent {
+	e := &domain.AuditEvent{
+		ID:            uuid.MustParse(a.ID),
+		Type:          domain.AuditEventType(a.Type),
+		UserID:        uuid.MustParse(a.UserID),
+		Details:       a.Details,
+		CorrelationID: a.CorrelationID,
+		CreatedAt:     a.CreatedAt,
+	}
+	if a.ActorID != "" {
+		e.ActorID = uuid.MustParse(a.ActorID)
+	}
+	return e
+}
+
+func buildAuditEvent(pk string, e *domain.AuditEvent) *AuditEvent {
+	a := &AuditEvent{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: pk,
+			SortKey:      auditEventSortKey(e.CreatedAt, e.ID),
+		},
+		ID:            e.ID.String(),
+		Type:          string(e.Type),
+		UserID:        e.UserID.String(),
+		Details:       e.Details,
+		CorrelationID: e.CorrelationID,
+		CreatedAt:     e.CreatedAt,
+		ExpiresAt:     e.CreatedAt.Add(auditEventRetention),
+	}
+	if e.ActorID != uuid.Nil {
+		a.ActorID = e.ActorID.String()
+	}
+	return a
+}
+
+func (dar *dynamoAuditEventRepo) Record(ctx context.Context, e *domain.AuditEvent) error {
+	table := dar.ddb.Table(dar.tableName)
+	err := dar.ddb.WriteTx().
+		Put(table.Put(buildAuditEvent(userPartitionKey(e.UserID), e)).If("attribute_not_exists(pk)")).
+		Put(table.Put(buildAuditEvent(auditEventPartitionKey(e.CreatedAt), e)).If("attribute_not_exists(pk)")).
+		Run(ctx)
+	if err != nil {
+		return fmt.Errorf("dynamoAuditEventRepo.Record failed: %w", err)
+	}
+	return nil
+}
+
+func (dar *dynamoAuditEventRepo) List(
+	ctx context.Context, q *usecase.AuditEventQuery,
+) ([]*domain.AuditEvent, string, error) {
+	pk := auditEventPartitionKey(q.To)
+	from := q.From
+	if q.UserID != uuid.Nil {
+		pk = userPartitionKey(q.UserID)
+	} else if day := q.To.UTC().Truncate(time.Hour * 24); from.Before(day) {
+		from = day
+	}
+
+	startKey, err := nosqlutil.DecodeCursor(q.Cursor, pk)
+	if err != nil {
+		return nil, "", usecase.ErrInvalidCursor
+	}
+
+	// the upper bound follows every sort key of the time, whose IDs are hexadecimal.
+	query := dar.ddb.Table(dar.tableName).
+		Get("pk", pk).
+		Range("sk", dynamo.Between, auditEventTimePrefix(from), auditEventTimePrefix(q.To)+"#~").
+		Order(dynamo.Descending).
+		StartFrom(startKey).
+		Limit(q.Limit)
+	if q.ActorID != uuid.Nil {
+		query = query.Filter("act = ?", q.ActorID.String())
+	}
+	if q.Type != "" {
+		query = query.Filter("ty = ?", string(q.Type))
+	}
+
+	var items []*AuditEvent
+	lastKey, err := query.AllWithLastEvaluatedKey(ctx, &items)
+	if err != nil {
+		return nil, "", fmt.Errorf("dynamoAuditEventRepo.List failed: %w", err)
+	}
+	next, err := nosqlutil.EncodeCursor(lastKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("dynamoAuditEventRepo.List failed to encode cursor: %w", err)
+	}
+
+	events := make([]*domain.AuditEvent, 0, len(items))
+	for _, item := range items {
+		events = append(events, item.toDomainEntity())
+	}
+	return events, next, nil
+}
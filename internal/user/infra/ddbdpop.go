@@ -0,0 +1,60 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const (
+	dpopProofPartitionKeyPrefix = "DPOP_PROOF"
+	dpopProofSortKey            = "USED"
+)
+
+// dynamoDPoPReplayRepo is the implementation of usecase.DPoPReplayRepo interface using AWS DynamoDB. (adapter)
+// Each proof used has its own partition, so that a proof is accepted once across every server instance.
+// Items are deleted by DynamoDB TTL once the proofs are too old to be accepted anyway.
+type dynamoDPoPReplayRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoDPoPReplayRepo(ddb *dynamo.DB, tableName string) usecase.DPoPReplayRepo {
+	return &dynamoDPoPReplayRepo{ddb: ddb, tableName: tableName}
+}
+
+type DPoPProof struct {
+	nosqlutil.CommonSchema
+
+	ExpiresAt time.Time `dynamo:"ttl,unixtime"`
+}
+
+func dpopProofPartitionKey(proofID string) string {
+	return dpopProofPartitionKeyPrefix + "#" + proofID
+}
+
+func (ddr *dynamoDPoPReplayRepo) Use(ctx context.Context, proofID string, expiresAt time.Time) error {
+	item := &DPoPProof{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: dpopProofPartitionKey(proofID),
+			SortKey:      dpopProofSortKey,
+		},
+		ExpiresAt: expiresAt,
+	}
+	// TTL deletion is not immediate, so an expired item may still exist.
+	err := ddr.ddb.Table(ddr.tableName).Put(item).
+		If("attribute_not_exists(pk) OR $ <= ?", nosqlutil.TTLAttribute, time.Now().Unix()).
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrDPoPProofReplayed
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoDPoPReplayRepo.Use failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const (
+	identityPartitionKey   = "IDENTITY"
+	identitySortKeyPrefix  = "IDENTITY"
+	oidcAuthRequestSortKey = "REQUEST"
+
+	oidcAuthRequestPartitionKeyPrefix = "OIDC_AUTH_REQUEST"
+)
+
+// dynamoIdentityRepo is the implementation of usecase.IdentityRepo interface using AWS DynamoDB. (adapter)
+// Identities are stored under the user partition to be listed, and indexed in the identity partition to be
+// looked up on login, which also makes them unique like Username.
+type dynamoIdentityRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoIdentityRepo(ddb *dynamo.DB, tableName string) usecase.IdentityRepo {
+	return &dynamoIdentityRepo{ddb: ddb, tableName: tableName}
+}
+
+type Identity struct {
+	nosqlutil.CommonSchema
+
+	Provider  string    `dynamo:"pv"`
+	Subject   string    `dynamo:"sub"`
+	Email     string    `dynamo:"em,omitempty"`
+	CreatedAt time.Time `dynamo:"ca"`
+}
+
+// IdentityIndex maps an identity to the user it is linked to.
+type IdentityIndex struct {
+	nosqlutil.CommonSchema
+	UserID string `dynamo:"uid"`
+}
+
+// identityKey identifies the identity among all providers. Subjects are unique only within their provider.
+func identityKey(provider, subject string) string {
+	return provider + "#" + subject
+}
+
+func identitySortKey(provider, subject string) string {
+	return identitySortKeyPrefix + "#" + identityKey(provider, subject)
+}
+
+func (i *Identity) toDomainEntity() *domain.Identity {
+	return &domain.Identity{
+		UserID:    uuid.MustParse(i.PartitionKey[len(userPartitionKeyPrefix)+1:]),
+		Provider:  i.Provider,
+		Subject:   i.Subject,
+		Email:     i.Email,
+		CreatedAt: i.CreatedAt,
+	}
+}
+
+func (dir *dynamoIdentityRepo) Create(ctx context.Context, i *domain.Identity) error {
+	table := dir.ddb.Table(dir.tableName)
+	createIndex := table.Put(&IdentityIndex{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: identityPartitionKey,
+			SortKey:      identityKey(i.Provider, i.Subject),
+		},
+		UserID: i.UserID.String(),
+	}).If("attribute_not_exists(pk)")
+	createIdentity := table.Put(&Identity{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(i.UserID),
+			SortKey:      identitySortKey(i.Provider, i.Subject),
+		},
+		Provider:  i.Provider,
+		Subject:   i.Subject,
+		Email:     i.Email,
+		CreatedAt: i.CreatedAt,
+	})
+
+	err := dir.ddb.WriteTx().Put(createIndex).Put(createIdentity).Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrIdentityAlreadyLinked
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoIdentityRepo.Create failed: %w", err)
+	}
+	return nil
+}
+
+func (dir *dynamoIdentityRepo) Get(ctx context.Context, provider, subject string) (*domain.Identity, error) {
+	var index IdentityIndex
+	err := dir.ddb.Table(dir.tableName).
+		Get("pk", identityPartitionKey).
+		Range("sk", dynamo.Equal, identityKey(provider, subject)).
+		One(ctx, &index)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoIdentityRepo.Get failed: %w", err)
+	}
+
+	var item Identity
+	err = dir.ddb.Table(dir.tableName).
+		Get("pk", userPartitionKeyPrefix+"#"+index.UserID).
+		Range("sk", dynamo.Equal, identitySortKey(provider, subject)).
+		One(ctx, &item)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoIdentityRepo.Get failed: %w", err)
+	}
+	return item.toDomainEntity(), nil
+}
+
+func (dir *dynamoIdentityRepo) List(ctx context.Context, userID uuid.UUID) ([]*domain.Identity, error) {
+	var items []*Identity
+	err := dir.ddb.Table(dir.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.BeginsWith, identitySortKeyPrefix+"#").
+		All(ctx, &items)
+	if err != nil {
+		return nil, fmt.Errorf("dynamoIdentityRepo.List failed: %w", err)
+	}
+
+	res := make([]*domain.Identity, 0, len(items))
+	for _, item := range items {
+		res = append(res, item.toDomainEntity())
+	}
+	slices.SortFunc(res, func(a, b *domain.Identity) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return res, nil
+}
+
+func (dir *dynamoIdentityRepo) Delete(ctx context.Context, userID uuid.UUID, provider, subject string) error {
+	table := dir.ddb.Table(dir.tableName)
+	deleteIdentity := table.Delete("pk", userPartitionKey(userID)).Range("sk", identitySortKey(provider, subject)).
+		If("attribute_exists(pk)")
+	deleteIndex := table.Delete("pk", identityPartitionKey).Range("sk", identityKey(provider, subject)).
+		If("uid = ?", userID.String())
+
+	err := dir.ddb.WriteTx().Delete(deleteIdentity).Delete(deleteIndex).Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrIdentityNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoIdentityRepo.Delete failed: %w", err)
+	}
+	return nil
+}
+
+// dynamoOIDCAuthRequestRepo is the implementation of usecase.OIDCAuthRequestRepo interface using AWS DynamoDB.
+// (adapter) Requests have their own partitions keyed by the hash of the state, as the user is not known for logins.
+type dynamoOIDCAuthRequestRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoOIDCAuthRequestRepo(ddb *dynamo.DB, tableName string) usecase.OIDCAuthRequestRepo {
+	return &dynamoOIDCAuthRequestRepo{ddb: ddb, tableName: tableName}
+}
+
+type OIDCAuthRequest struct {
+	nosqlutil.CommonSchema
+
+	Purpose      string    `dynamo:"pu"`
+	Provider     string    `dynamo:"pv"`
+	UserID       string    `dynamo:"uid,omitempty"`
+	Nonce        string    `dynamo:"nc"`
+	CodeVerifier string    `dynamo:"cv"`
+	ExpiresAt    time.Time `dynamo:"ttl,unixtime"`
+}
+
+func oidcAuthRequestPartitionKey(stateHash string) string {
+	return oidcAuthRequestPartitionKeyPrefix + "#" + stateHash
+}
+
+func (dor *dynamoOIDCAuthRequestRepo) Save(ctx context.Context, r *domain.OIDCAuthRequest) error {
+	item := &OIDCAuthRequest{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: oidcAuthRequestPartitionKey(r.StateHash),
+			SortKey:      oidcAuthRequestSortKey,
+		},
+		Purpose:      string(r.Purpose),
+		Provider:     r.Provider,
+		Nonce:        r.Nonce,
+		CodeVerifier: r.CodeVerifier,
+		ExpiresAt:    r.ExpiresAt,
+	}
+	if r.UserID != uuid.Nil {
+		item.UserID = r.UserID.String()
+	}
+
+	if err := dor.ddb.Table(dor.tableName).Put(item).Run(ctx); err != nil {
+		return fmt.Errorf("dynamoOIDCAuthRequestRepo.Save failed: %w", err)
+	}
+	return nil
+}
+
+func (dor *dynamoOIDCAuthRequestRepo) Consume(ctx context.Context, stateHash string) (*domain.OIDCAuthRequest, error) {
+	// deleting with the old value makes the state single-use even if the callback is sent twice at once.
+	var item OIDCAuthRequest
+	err := dor.ddb.Table(dor.tableName).
+		Delete("pk", oidcAuthRequestPartitionKey(stateHash)).
+		Range("sk", oidcAuthRequestSortKey).
+		If("attribute_exists(pk)").
+		OldValue(ctx, &item)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return nil, usecase.ErrOIDCAuthRequestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoOIDCAuthRequestRepo.Consume failed: %w", err)
+	}
+
+	r := &domain.OIDCAuthRequest{
+		StateHash:    stateHash,
+		Purpose:      domain.OIDCAuthPurpose(item.Purpose),
+		Provider:     item.Provider,
+		Nonce:        item.Nonce,
+		CodeVerifier: item.CodeVerifier,
+		ExpiresAt:    item.ExpiresAt,
+	}
+	if item.UserID != "" {
+		r.UserID, err = uuid.Parse(item.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("dynamoOIDCAuthRequestRepo.Consume failed: %w", err)
+		}
+	}
+	// TTL deletion is not immediate, so expired items may still be read.
+	if r.IsExpired(time.Now()) {
+		return nil, usecase.ErrOIDCAuthRequestNotFound
+	}
+	return r, nil
+}
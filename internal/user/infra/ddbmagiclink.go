@@ -0,0 +1,101 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const magicLinkSortKey = "MAGIC_LINK"
+
+// dynamoMagicLinkRepo is the implementation of usecase.MagicLinkRepo interface using AWS DynamoDB. (adapter)
+// A user has at most one pending link under the user partition.
+type dynamoMagicLinkRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoMagicLinkRepo(ddb *dynamo.DB, tableName string) usecase.MagicLinkRepo {
+	return &dynamoMagicLinkRepo{ddb: ddb, tableName: tableName}
+}
+
+type MagicLink struct {
+	nosqlutil.CommonSchema
+
+	Email     string    `dynamo:"em"`
+	TokenHash string    `dynamo:"th"`
+	NonceHash string    `dynamo:"nh"`
+	ExpiresAt time.Time `dynamo:"ttl,unixtime"`
+}
+
+func (m *MagicLink) toDomainEntity() *domain.MagicLink {
+	return &domain.MagicLink{
+		UserID:    uuid.MustParse(m.PartitionKey[len(userPartitionKeyPrefix)+1:]),
+		Email:     m.Email,
+		TokenHash: m.TokenHash,
+		NonceHash: m.NonceHash,
+		ExpiresAt: m.ExpiresAt,
+	}
+}
+
+func (dml *dynamoMagicLinkRepo) Save(ctx context.Context, l *domain.MagicLink) error {
+	err := dml.ddb.Table(dml.tableName).Put(&MagicLink{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(l.UserID),
+			SortKey:      magicLinkSortKey,
+		},
+		Email:     l.Email,
+		TokenHash: l.TokenHash,
+		NonceHash: l.NonceHash,
+		ExpiresAt: l.ExpiresAt,
+	}).Run(ctx)
+	if err != nil {
+		return fmt.Errorf("dynamoMagicLinkRepo.Save failed: %w", err)
+	}
+	return nil
+}
+
+func (dml *dynamoMagicLinkRepo) Get(ctx context.Context, userID uuid.UUID) (*domain.MagicLink, error) {
+	var item MagicLink
+	err := dml.ddb.Table(dml.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.Equal, magicLinkSortKey).
+		One(ctx, &item)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrMagicLinkNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoMagicLinkRepo.Get failed: %w", err)
+	}
+
+	l := item.toDomainEntity()
+	// TTL deletion is not immediate, so expired items may still be read.
+	if l.IsExpired(time.Now()) {
+		return nil, usecase.ErrMagicLinkNotFound
+	}
+	return l, nil
+}
+
+func (dml *dynamoMagicLinkRepo) Consume(ctx context.Context, l *domain.MagicLink) error {
+	// the condition makes the link single-use even if the token is presented twice at once.
+	err := dml.ddb.Table(dml.tableName).
+		Delete("pk", userPartitionKey(l.UserID)).
+		Range("sk", magicLinkSortKey).
+		If("th = ?", l.TokenHash).
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrMagicLinkNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoMagicLinkRepo.Consume failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/cryptoutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const (
+	mfaSortKey          = "MFA"
+	mfaChallengeSortKey = "MFA_CHALLENGE"
+)
+
+// dynamoMFARepo is the implementation of usecase.MFARepo interface using AWS DynamoDB. (adapter)
+// The MFA item is a sibling of the profile, and its TOTP secret is encrypted, bound to the user.
+type dynamoMFARepo struct {
+	ddb       *dynamo.DB
+	tableName string
+	cipher    *cryptoutil.Cipher
+}
+
+func NewDynamoMFARepo(ddb *dynamo.DB, tableName string, cipher *cryptoutil.Cipher) usecase.MFARepo {
+	return &dynamoMFARepo{ddb: ddb, tableName: tableName, cipher: cipher}
+}
+
+type MFA struct {
+	nosqlutil.CommonSchema
+
+	EncryptedSecret    []byte    `dynamo:"sec"`
+	LastUsedStep       int64     `dynamo:"ls,omitempty"`
+	RecoveryCodeHashes []string  `dynamo:"rc,set,omitempty"`
+	EnabledAt          time.Time `dynamo:"en,omitempty"`
+	CreatedAt          time.Time `dynamo:"ca"`
+}
+
+func (dmr *dynamoMFARepo) Get(ctx context.Context, userID uuid.UUID) (*domain.MFA, error) {
+	var item MFA
+	err := dmr.ddb.Table(dmr.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.Equal, mfaSortKey).
+		One(ctx, &item)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrMFANotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoMFARepo.Get failed: %w", err)
+	}
+
+	secret, err := dmr.cipher.Decrypt(item.EncryptedSecret, userID[:])
+	if err != nil {
+		return nil, fmt.Errorf("dynamoMFARepo.Get failed: %w", err)
+	}
+	return &domain.MFA{
+		UserID:             userID,
+		TOTPSecret:         secret,
+		LastUsedStep:       item.LastUsedStep,
+		RecoveryCodeHashes: item.RecoveryCodeHashes,
+		EnabledAt:          item.EnabledAt,
+		CreatedAt:          item.CreatedAt,
+	}, nil
+}
+
+func (dmr *dynamoMFARepo) Save(ctx context.Context, m *domain.MFA) error {
+	secret, err := dmr.cipher.Encrypt(m.TOTPSecret, m.UserID[:])
+	if err != nil {
+		return fmt.Errorf("dynamoMFARepo.Save failed: %w", err)
+	}
+
+	err = dmr.ddb.Table(dmr.tableName).Put(&MFA{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(m.UserID),
+			SortKey:      mfaSortKey,
+		},
+		EncryptedSecret: secret,
+		CreatedAt:       m.CreatedAt,
+	}).If("attribute_not_exists(en)").Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrMFAAlreadyEnabled
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoMFARepo.Save failed: %w", err)
+	}
+	return nil
+}
+
+func (dmr *dynamoMFARepo) Enable(ctx context.Context, m *domain.MFA) error {
+	err := dmr.ddb.Table(dmr.tableName).
+		Update("pk", userPartitionKey(m.UserID)).
+		Range("sk", mfaSortKey).
+		Set("en", m.EnabledAt).
+		Set("ls", m.LastUsedStep).
+		SetSet("rc", m.RecoveryCodeHashes).
+		If("attribute_exists(pk) AND attribute_not_exists(en)").
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrMFANotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoMFARepo.Enable failed: %w", err)
+	}
+	return nil
+}
+
+func (dmr *dynamoMFARepo) UseTOTP(ctx context.Context, userID uuid.UUID, step int64) error {
+	// the condition makes a code single-use even if it is presented twice at once.
+	err := dmr.ddb.Table(dmr.tableName).
+		Update("pk", userPartitionKey(userID)).
+		Range("sk", mfaSortKey).
+		Set("ls", step).
+		If("attribute_exists(en) AND (attribute_not_exists(ls) OR ls < ?)", step).
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrInvalidMFACode
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoMFARepo.UseTOTP failed: %w", err)
+	}
+	return nil
+}
+
+func (dmr *dynamoMFARepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, hash string) error {
+	err := dmr.ddb.Table(dmr.tableName).
+		Update("pk", userPartitionKey(userID)).
+		Range("sk", mfaSortKey).
+		DeleteFromSet("rc", []string{hash}).
+		If("attribute_exists(en) AND contains(rc, ?)", hash).
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrInvalidMFACode
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoMFARepo.UseRecoveryCode failed: %w", err)
+	}
+	return nil
+}
+
+func (dmr *dynamoMFARepo) Delete(ctx context.Context, userID uuid.UUID) error {
+	err := dmr.ddb.Table(dmr.tableName).
+		Delete("pk", userPartitionKey(userID)).
+		Range("sk", mfaSortKey).
+		Run(ctx)
+	if err != nil {
+		return fmt.Errorf("dynamoMFARepo.Delete failed: %w", err)
+	}
+	return nil
+}
+
+// dynamoMFAChallengeRepo is the implementation of usecase.MFAChallengeRepo interface using AWS DynamoDB. (adapter)
+// A user has at most one pending challenge under the user partition.
+type dynamoMFAChallengeRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoMFAChallengeRepo(ddb *dynamo.DB, tableName string) usecase.MFAChallengeRepo {
+	return &dynamoMFAChallengeRepo{ddb: ddb, tableName: tableName}
+}
+
+type MFAChallenge struct {
+	nosqlutil.CommonSchema
+
+	TokenHash string    `dynamo:"th"`
+	ExpiresAt time.Time `dynamo:"ttl,unixtime"`
+}
+
+func (dcr *dynamoMFAChallengeRepo) Save(ctx context.Context, c *domain.MFAChallenge) error {
+	err := dcr.ddb.Table(dcr.tableName).Put(&MFAChallenge{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(c.UserID),
+			SortKey:      mfaChallengeSortKey,
+		},
+		TokenHash: c.TokenHash,
+		ExpiresAt: c.ExpiresAt,
+	}).Run(ctx)
+	if err != nil {
+		return fmt.Errorf("dynamoMFAChallengeRepo.Save failed: %w", err)
+	}
+	return nil
+}
+
+func (dcr *dynamoMFAChallengeRepo) Get(ctx context.Context, userID uuid.UUID) (*domain.MFAChallenge, error) {
+	var item MFAChallenge
+	err := dcr.ddb.Table(dcr.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.Equal, mfaChallengeSortKey).
+		One(ctx, &item)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrMFAChallengeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoMFAChallengeRepo.Get failed: %w", err)
+	}
+
+	c := &domain.MFAChallenge{UserID: userID, TokenHash: item.TokenHash, ExpiresAt: item.ExpiresAt}
+	// TTL deletion is not immediate, so expired items may still be read.
+	if c.IsExpired(time.Now()) {
+		return nil, usecase.ErrMFAChallengeNotFound
+	}
+	return c, nil
+}
+
+func (dcr *dynamoMFAChallengeRepo) Consume(ctx context.Context, c *domain.MFAChallenge) error {
+	// the condition makes the challenge single-use even if it is completed twice at once.
+	err := dcr.ddb.Table(dcr.tableName).
+		Delete("pk", userPartitionKey(c.UserID)).
+		Range("sk", mfaChallengeSortKey).
+		If("th = ?", c.TokenHash).
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrMFAChallengeNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoMFAChallengeRepo.Consume failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const (
+	oauthClientPartitionKey  = "OAUTH_CLIENT"
+	consentSortKeyPrefix     = "CONSENT"
+	authorizationCodeSortKey = "CODE"
+
+	authorizationCodePartitionKeyPrefix = "OAUTH_CODE"
+)
+
+// dynamoOAuthClientRepo is the implementation of usecase.OAuthClientRepo interface using AWS DynamoDB. (adapter)
+// Clients are few and managed by operators, so they are stored in a single partition to be listed at once.
+type dynamoOAuthClientRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoOAuthClientRepo(ddb *dynamo.DB, tableName string) usecase.OAuthClientRepo {
+	return &dynamoOAuthClientRepo{ddb: ddb, tableName: tableName}
+}
+
+type OAuthClient struct {
+	nosqlutil.CommonSchema
+
+	Name         string    `dynamo:"nm"`
+	SecretHash   string    `dynamo:"sh,omitempty"`
+	RedirectURIs []string  `dynamo:"ru"`
+	Scope        string    `dynamo:"sc"`
+	GrantTypes   []string  `dynamo:"gt"`
+	FirstParty   bool      `dynamo:"fp"`
+	CreatedAt    time.Time `dynamo:"ca"`
+}
+
+func (c *OAuthClient) toDomainEntity() *domain.OAuthClient {
+	grantTypes := make([]domain.GrantType, 0, len(c.GrantTypes))
+	for _, g := range c.GrantTypes {
+		grantTypes = append(grantTypes, domain.GrantType(g))
+	}
+	return &domain.OAuthClient{
+		ID:           c.SortKey,
+		Name:         c.Name,
+		SecretHash:   c.SecretHash,
+		RedirectURIs: c.RedirectURIs,
+		Scopes:       domain.ParseScopes(c.Scope),
+		GrantTypes:   grantTypes,
+		FirstParty:   c.FirstParty,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+func (dcr *dynamoOAuthClientRepo) Create(ctx context.Context, c *domain.OAuthClient) error {
+	grantTypes := make([]string, 0, len(c.GrantTypes))
+	for _, g := range c.GrantTypes {
+		grantTypes = append(grantTypes, string(g))
+	}
+	item := &OAuthClient{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: oauthClientPartitionKey,
+			SortKey:      c.ID,
+		},
+		Name:         c.Name,
+		SecretHash:   c.SecretHash,
+		RedirectURIs: c.RedirectURIs,
+		Scope:        domain.FormatScopes(c.Scopes),
+		GrantTypes:   grantTypes,
+		FirstParty:   c.FirstParty,
+		CreatedAt:    c.CreatedAt,
+	}
+
+	err := dcr.ddb.Table(dcr.tableName).Put(item).If("attribute_not_exists(pk)").Run(ctx)
+	if err != nil {
+		return fmt.Errorf("dynamoOAuthClientRepo.Create failed: %w", err)
+	}
+	return nil
+}
+
+func (dcr *dynamoOAuthClientRepo) Get(ctx context.Context, id string) (*domain.OAuthClient, error) {
+	var item OAuthClient
+	err := dcr.ddb.Table(dcr.tableName).
+		Get("pk", oauthClientPartitionKey).
+		Range("sk", dynamo.Equal, id).
+		One(ctx, &item)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoOAuthClientRepo.Get failed: %w", err)
+	}
+	return item.toDomainEntity(), nil
+}
+
+func (dcr *dynamoOAuthClientRepo) List(ctx context.Context) ([]*domain.OAuthClient, error) {
+	var items []*OAuthClient
+	err := dcr.ddb.Table(dcr.tableName).Get("pk", oauthClientPartitionKey).All(ctx, &items)
+	if err != nil {
+		return nil, fmt.Errorf("dynamoOAuthClientRepo.List failed: %w", err)
+	}
+
+	res := make([]*domain.OAuthClient, 0, len(items))
+	for _, item := range items {
+		res = append(res, item.toDomainEntity())
+	}
+	slices.SortFunc(res, func(a, b *domain.OAuthClient) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return res, nil
+}
+
+func (dcr *dynamoOAuthClientRepo) Delete(ctx context.Context, id string) error {
+	err := dcr.ddb.Table(dcr.tableName).
+		Delete("pk", oauthClientPartitionKey).
+		Range("sk", id).
+		If("attribute_exists(pk)").
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoOAuthClientRepo.Delete failed: %w", err)
+	}
+	return nil
+}
+
+// dynamoConsentRepo is the implementation of usecase.ConsentRepo interface using AWS DynamoDB. (adapter)
+// Consents are stored under the user partition, so that all consents of a user can be queried at once.
+type dynamoConsentRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoConsentRepo(ddb *dynamo.DB, tableName string) usecase.ConsentRepo {
+	return &dynamoConsentRepo{ddb: ddb, tableName: tableName}
+}
+
+type Consent struct {
+	nosqlutil.CommonSchema
+
+	Scope     string    `dynamo:"sc"`
+	CreatedAt time.Time `dynamo:"ca"`
+	UpdatedAt time.Time `dynamo:"ua"`
+}
+
+func consentSortKey(clientID string) string {
+	return consentSortKeyPrefix + "#" + clientID
+}
+
+func (c *Consent) toDomainEntity() *domain.Consent {
+	return &domain.Consent{
+		UserID:    uuid.MustParse(c.PartitionKey[len(userPartitionKeyPrefix)+1:]),
+		ClientID:  c.SortKey[len(consentSortKeyPrefix)+1:],
+		Scopes:    domain.ParseScopes(c.Scope),
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+	}
+}
+
+func (dcr *dynamoConsentRepo) Save(ctx context.Context, c *domain.Consent) error {
+	item := &Consent{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(c.UserID),
+			SortKey:      consentSortKey(c.ClientID),
+		},
+		Scope:     domain.FormatScopes(c.Scopes),
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+	}
+	if err := dcr.ddb.Table(dcr.tableName).Put(item).Run(ctx); err != nil {
+		return fmt.Errorf("dynamoConsentRepo.Save failed: %w", err)
+	}
+	return nil
+}
+
+func (dcr *dynamoConsentRepo) Get(ctx context.Context, userID uuid.UUID, clientID string) (*domain.Consent, error) {
+	var item Consent
+	err := dcr.ddb.Table(dcr.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.Equal, consentSortKey(clientID)).
+		One(ctx, &item)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrConsentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoConsentRepo.Get failed: %w", err)
+	}
+	return item.toDomainEntity(), nil
+}
+
+func (dcr *dynamoConsentRepo) List(ctx context.Context, userID uuid.UUID) ([]*domain.Consent, error) {
+	var items []*Consent
+	err := dcr.ddb.Table(dcr.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.BeginsWith, consentSortKeyPrefix+"#").
+		All(ctx, &items)
+	if err != nil {
+		return nil, fmt.Errorf("dynamoConsentRepo.List failed: %w", err)
+	}
+
+	res := make([]*domain.Consent, 0, len(items))
+	for _, item := range items {
+		res = append(res, item.toDomainEntity())
+	}
+	slices.SortFunc(res, func(a, b *domain.Consent) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return res, nil
+}
+
+func (dcr *dynamoConsentRepo) Delete(ctx context.Context, userID uuid.UUID, clientID string) error {
+	err := dcr.ddb.Table(dcr.tableName).
+		Delete("pk", userPartitionKey(userID)).
+		Range("sk", consentSortKey(clientID)).
+		If("attribute_exists(pk)").
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrConsentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoConsentRepo.Delete failed: %w", err)
+	}
+	return nil
+}
+
+// dynamoAuthorizationCodeRepo is the implementation of usecase.AuthorizationCodeRepo interface using AWS DynamoDB.
+// (adapter) Codes have their own partitions keyed by the hash of the code, as the client sends only the code.
+type dynamoAuthorizationCodeRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoAuthorizationCodeRepo(ddb *dynamo.DB, tableName string) usecase.AuthorizationCodeRepo {
+	return &dynamoAuthorizationCodeRepo{ddb: ddb, tableName: tableName}
+}
+
+type AuthorizationCode struct {
+	nosqlutil.CommonSchema
+
+	ClientID      string    `dynamo:"ci"`
+	UserID        string    `dynamo:"uid"`
+	RedirectURI   string    `dynamo:"ru"`
+	Scope         string    `dynamo:"sc"`
+	CodeChallenge string    `dynamo:"cc"`
+	Nonce         string    `dynamo:"nc,omitempty"`
+	AuthTime      time.Time `dynamo:"at"`
+	ExpiresAt     time.Time `dynamo:"ttl,unixtime"`
+}
+
+func authorizationCodePartitionKey(codeHash string) string {
+	return authorizationCodePartitionKeyPrefix + "#" + codeHash
+}
+
+func (dar *dynamoAuthorizationCodeRepo) Save(ctx context.Context, c *domain.AuthorizationCode) error {
+	item := &AuthorizationCode{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: authorizationCodePartitionKey(c.CodeHash),
+			SortKey:      authorizationCodeSortKey,
+		},
+		ClientID:      c.ClientID,
+		UserID:        c.UserID.String(),
+		RedirectURI:   c.RedirectURI,
+		Scope:         domain.FormatScopes(c.Scopes),
+		CodeChallenge: c.CodeChallenge,
+		Nonce:         c.Nonce,
+		AuthTime:      c.AuthTime,
+		ExpiresAt:     c.ExpiresAt,
+	}
+	if err := dar.ddb.Table(dar.tableName).Put(item).Run(ctx); err != nil {
+		return fmt.Errorf("dynamoAuthorizationCodeRepo.Save failed: %w", err)
+	}
+	return nil
+}
+
+func (dar *dynamoAuthorizationCodeRepo) Consume(ctx context.Context, codeHash string) (*domain.AuthorizationCode, error) {
+	// deleting with the old value makes the code single-use even if it is redeemed twice at once.
+	var item AuthorizationCode
+	err := dar.ddb.Table(dar.tableName).
+		Delete("pk", authorizationCodePartitionKey(codeHash)).
+		Range("sk", authorizationCodeSortKey).
+		If("attribute_exists(pk)").
+		OldValue(ctx, &item)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return nil, usecase.ErrAuthorizationCodeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoAuthorizationCodeRepo.Consume failed: %w", err)
+	}
+
+	userID, err := uuid.Parse(item.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("dynamoAuthorizationCodeRepo.Consume failed: %w", err)
+	}
+	c := &domain.AuthorizationCode{
+		CodeHash:      codeHash,
+		ClientID:      item.ClientID,
+		UserID:        userID,
+		RedirectURI:   item.RedirectURI,
+		Scopes:        domain.ParseScopes(item.Scope),
+		CodeChallenge: item.CodeChallenge,
+		Nonce:         item.Nonce,
+		AuthTime:      item.AuthTime,
+		ExpiresAt:     item.ExpiresAt,
+	}
+	// TTL deletion is not immediate, so expired items may still be read.
+	if c.IsExpired(time.Now()) {
+		return nil, usecase.ErrAuthorizationCodeNotFound
+	}
+	return c, nil
+}
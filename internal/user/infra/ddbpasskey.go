@@ -0,0 +1,231 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/webauthnutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const (
+	passkeySortKeyPrefix = "PASSKEY"
+
+	webAuthnCeremonyPartitionKeyPrefix = "WEBAUTHN_CEREMONY"
+	webAuthnCeremonySortKey            = "CHALLENGE"
+)
+
+// dynamoPasskeyRepo is the implementation of usecase.PasskeyRepo interface using AWS DynamoDB. (adapter)
+// Passkeys are stored under the user partition, keyed by the credential ID.
+type dynamoPasskeyRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoPasskeyRepo(ddb *dynamo.DB, tableName string) usecase.PasskeyRepo {
+	return &dynamoPasskeyRepo{ddb: ddb, tableName: tableName}
+}
+
+type Passkey struct {
+	nosqlutil.CommonSchema
+
+	Name       string    `dynamo:"nm"`
+	PublicKey  []byte    `dynamo:"pub"`
+	SignCount  uint32    `dynamo:"sc"`
+	AAGUID     []byte    `dynamo:"ag,omitempty"`
+	CreatedAt  time.Time `dynamo:"ca"`
+	LastUsedAt time.Time `dynamo:"lu"`
+}
+
+func passkeySortKey(id []byte) string {
+	return passkeySortKeyPrefix + "#" + webauthnutil.Encoding.EncodeToString(id)
+}
+
+func (p *Passkey) toDomainEntity() *domain.Passkey {
+	id, _ := webauthnutil.Encoding.DecodeString(p.SortKey[len(passkeySortKeyPrefix)+1:])
+	return &domain.Passkey{
+		ID:         id,
+		UserID:     uuid.MustParse(p.PartitionKey[len(userPartitionKeyPrefix)+1:]),
+		Name:       p.Name,
+		PublicKey:  p.PublicKey,
+		SignCount:  p.SignCount,
+		AAGUID:     p.AAGUID,
+		CreatedAt:  p.CreatedAt,
+		LastUsedAt: p.LastUsedAt,
+	}
+}
+
+func (dpr *dynamoPasskeyRepo) Create(ctx context.Context, p *domain.Passkey) error {
+	err := dpr.ddb.Table(dpr.tableName).Put(&Passkey{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(p.UserID),
+			SortKey:      passkeySortKey(p.ID),
+		},
+		Name:       p.Name,
+		PublicKey:  p.PublicKey,
+		SignCount:  p.SignCount,
+		AAGUID:     p.AAGUID,
+		CreatedAt:  p.CreatedAt,
+		LastUsedAt: p.LastUsedAt,
+	}).If("attribute_not_exists(pk)").Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrPasskeyAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoPasskeyRepo.Create failed: %w", err)
+	}
+	return nil
+}
+
+func (dpr *dynamoPasskeyRepo) Get(ctx context.Context, userID uuid.UUID, id []byte) (*domain.Passkey, error) {
+	var item Passkey
+	err := dpr.ddb.Table(dpr.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.Equal, passkeySortKey(id)).
+		One(ctx, &item)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrPasskeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoPasskeyRepo.Get failed: %w", err)
+	}
+	return item.toDomainEntity(), nil
+}
+
+func (dpr *dynamoPasskeyRepo) List(ctx context.Context, userID uuid.UUID) ([]*domain.Passkey, error) {
+	var items []*Passkey
+	err := dpr.ddb.Table(dpr.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.BeginsWith, passkeySortKeyPrefix+"#").
+		All(ctx, &items)
+	if err != nil {
+		return nil, fmt.Errorf("dynamoPasskeyRepo.List failed: %w", err)
+	}
+
+	res := make([]*domain.Passkey, 0, len(items))
+	for _, item := range items {
+		res = append(res, item.toDomainEntity())
+	}
+	slices.SortFunc(res, func(a, b *domain.Passkey) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return res, nil
+}
+
+func (dpr *dynamoPasskeyRepo) UpdateUsage(ctx context.Context, p *domain.Passkey, prevSignCount uint32) error {
+	err := dpr.ddb.Table(dpr.tableName).
+		Update("pk", userPartitionKey(p.UserID)).
+		Range("sk", passkeySortKey(p.ID)).
+		Set("sc", p.SignCount).
+		Set("lu", p.LastUsedAt).
+		If("sc = ?", prevSignCount).
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrPasskeyCloned
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoPasskeyRepo.UpdateUsage failed: %w", err)
+	}
+	return nil
+}
+
+func (dpr *dynamoPasskeyRepo) Delete(ctx context.Context, userID uuid.UUID, id []byte) error {
+	err := dpr.ddb.Table(dpr.tableName).
+		Delete("pk", userPartitionKey(userID)).
+		Range("sk", passkeySortKey(id)).
+		If("attribute_exists(pk)").
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrPasskeyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoPasskeyRepo.Delete failed: %w", err)
+	}
+	return nil
+}
+
+// dynamoWebAuthnCeremonyRepo is the implementation of usecase.WebAuthnCeremonyRepo interface using AWS DynamoDB.
+// (adapter) Ceremonies have their own partitions, as the user is not known for logins.
+type dynamoWebAuthnCeremonyRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoWebAuthnCeremonyRepo(ddb *dynamo.DB, tableName string) usecase.WebAuthnCeremonyRepo {
+	return &dynamoWebAuthnCeremonyRepo{ddb: ddb, tableName: tableName}
+}
+
+type WebAuthnCeremony struct {
+	nosqlutil.CommonSchema
+
+	Purpose   string    `dynamo:"pu"`
+	UserID    string    `dynamo:"uid,omitempty"`
+	Challenge []byte    `dynamo:"ch"`
+	ExpiresAt time.Time `dynamo:"ttl,unixtime"`
+}
+
+func webAuthnCeremonyPartitionKey(id uuid.UUID) string {
+	return webAuthnCeremonyPartitionKeyPrefix + "#" + id.String()
+}
+
+func (dcr *dynamoWebAuthnCeremonyRepo) Save(ctx context.Context, c *domain.WebAuthnCeremony) error {
+	item := &WebAuthnCeremony{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: webAuthnCeremonyPartitionKey(c.ID),
+			SortKey:      webAuthnCeremonySortKey,
+		},
+		Purpose:   string(c.Purpose),
+		Challenge: c.Challenge,
+		ExpiresAt: c.ExpiresAt,
+	}
+	if c.UserID != uuid.Nil {
+		item.UserID = c.UserID.String()
+	}
+
+	if err := dcr.ddb.Table(dcr.tableName).Put(item).Run(ctx); err != nil {
+		return fmt.Errorf("dynamoWebAuthnCeremonyRepo.Save failed: %w", err)
+	}
+	return nil
+}
+
+func (dcr *dynamoWebAuthnCeremonyRepo) Consume(ctx context.Context, id uuid.UUID) (*domain.WebAuthnCeremony, error) {
+	// deleting with the old value makes the challenge single-use even if it is responded twice at once.
+	var item WebAuthnCeremony
+	err := dcr.ddb.Table(dcr.tableName).
+		Delete("pk", webAuthnCeremonyPartitionKey(id)).
+		Range("sk", webAuthnCeremonySortKey).
+		If("attribute_exists(pk)").
+		OldValue(ctx, &item)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return nil, usecase.ErrWebAuthnCeremonyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoWebAuthnCeremonyRepo.Consume failed: %w", err)
+	}
+
+	c := &domain.WebAuthnCeremony{
+		ID:        id,
+		Purpose:   domain.WebAuthnCeremonyPurpose(item.Purpose),
+		Challenge: item.Challenge,
+		ExpiresAt: item.ExpiresAt,
+	}
+	if item.UserID != "" {
+		c.UserID, err = uuid.Parse(item.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("dynamoWebAuthnCeremonyRepo.Consume failed: %w", err)
+		}
+	}
+	// TTL deletion is not immediate, so expired items may still be read.
+	if c.IsExpired(time.Now()) {
+		return nil, usecase.ErrWebAuthnCeremonyNotFound
+	}
+	return c, nil
+}
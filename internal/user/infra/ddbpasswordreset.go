@@ -0,0 +1,98 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const passwordResetSortKey = "PASSWORD_RESET"
+
+// dynamoPasswordResetRepo is the implementation of usecase.PasswordResetRepo interface using AWS DynamoDB. (adapter)
+// A user has at most one pending reset under the user partition.
+type dynamoPasswordResetRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoPasswordResetRepo(ddb *dynamo.DB, tableName string) usecase.PasswordResetRepo {
+	return &dynamoPasswordResetRepo{ddb: ddb, tableName: tableName}
+}
+
+type PasswordReset struct {
+	nosqlutil.CommonSchema
+
+	Email     string    `dynamo:"em"`
+	TokenHash string    `dynamo:"th"`
+	ExpiresAt time.Time `dynamo:"ttl,unixtime"`
+}
+
+func (p *PasswordReset) toDomainEntity() *domain.PasswordReset {
+	return &domain.PasswordReset{
+		UserID:    uuid.MustParse(p.PartitionKey[len(userPartitionKeyPrefix)+1:]),
+		Email:     p.Email,
+		TokenHash: p.TokenHash,
+		ExpiresAt: p.ExpiresAt,
+	}
+}
+
+func (dpr *dynamoPasswordResetRepo) Save(ctx context.Context, r *domain.PasswordReset) error {
+	err := dpr.ddb.Table(dpr.tableName).Put(&PasswordReset{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(r.UserID),
+			SortKey:      passwordResetSortKey,
+		},
+		Email:     r.Email,
+		TokenHash: r.TokenHash,
+		ExpiresAt: r.ExpiresAt,
+	}).Run(ctx)
+	if err != nil {
+		return fmt.Errorf("dynamoPasswordResetRepo.Save failed: %w", err)
+	}
+	return nil
+}
+
+func (dpr *dynamoPasswordResetRepo) Get(ctx context.Context, userID uuid.UUID) (*domain.PasswordReset, error) {
+	var item PasswordReset
+	err := dpr.ddb.Table(dpr.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.Equal, passwordResetSortKey).
+		One(ctx, &item)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrPasswordResetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoPasswordResetRepo.Get failed: %w", err)
+	}
+
+	r := item.toDomainEntity()
+	// TTL deletion is not immediate, so expired items may still be read.
+	if r.IsExpired(time.Now()) {
+		return nil, usecase.ErrPasswordResetNotFound
+	}
+	return r, nil
+}
+
+func (dpr *dynamoPasswordResetRepo) Consume(ctx context.Context, r *domain.PasswordReset) error {
+	// the condition makes the reset single-use even if the token is presented twice at once.
+	err := dpr.ddb.Table(dpr.tableName).
+		Delete("pk", userPartitionKey(r.UserID)).
+		Range("sk", passwordResetSortKey).
+		If("th = ?", r.TokenHash).
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrPasswordResetNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoPasswordResetRepo.Consume failed: %w", err)
+	}
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,6 +19,7 @@ import (
 const (
 	userPartitionKeyPrefix = "USER"
 	usernamePartitionKey   = "USERNAME"
+	emailPartitionKey      = "EMAIL"
 	userProfileSortKey     = "PROFILE"
 )
 
@@ -26,6 +29,10 @@ type dynamoUserRepo struct {
 	tableName string
 }
 
+func userPartitionKey(id uuid.UUID) string {
+	return userPartitionKeyPrefix + "#" + id.String()
+}
+
 func NewDynamoUserRepo(ddb *dynamo.DB, tableName string) usecase.UserRepo {
 	return &dynamoUserRepo{ddb: ddb, tableName: tableName}
 }
@@ -35,36 +42,80 @@ type UserProfile struct {
 
 	Username  string    `dynamo:"un"`
 	Password  string    `dynamo:"pw"`
+	Roles     []string  `dynamo:"rl,omitempty"`
 	CreatedAt time.Time `dynamo:"ca"`
 	UpdatedAt time.Time `dynamo:"ua"`
+
+	Email           string    `dynamo:"em,omitempty"`
+	EmailVerifiedAt time.Time `dynamo:"ev,omitempty"`
+
+	DisabledAt            time.Time `dynamo:"da,omitempty"`
+	PasswordResetRequired bool      `dynamo:"prr,omitempty"`
+
+	// GuestExpiresAt lets DynamoDB delete stale guests. It is not set for full accounts.
+	GuestExpiresAt time.Time `dynamo:"ttl,unixtime,omitempty"`
 }
 
 func (un *UserProfile) toDomainEntity() *domain.User {
+	roles := make([]domain.Role, 0, len(un.Roles))
+	for _, r := range un.Roles {
+		roles = append(roles, domain.Role(r))
+	}
+	// users created before roles were introduced have no roles stored.
+	if len(roles) == 0 {
+		roles = domain.DefaultRoles()
+	}
+
 	return &domain.User{
 		ID:        uuid.MustParse(un.PartitionKey[len(userPartitionKeyPrefix)+1:]),
 		Username:  un.Username,
 		Password:  domain.Password(un.Password),
+		Roles:     roles,
 		CreatedAt: un.CreatedAt,
 		UpdatedAt: un.UpdatedAt,
+
+		Email:           un.Email,
+		EmailVerifiedAt: un.EmailVerifiedAt,
+
+		DisabledAt:            un.DisabledAt,
+		PasswordResetRequired: un.PasswordResetRequired,
+
+		GuestExpiresAt: un.GuestExpiresAt,
 	}
 }
 
 func buildUserProfile(u *domain.User) *UserProfile {
+	roles := make([]string, 0, len(u.Roles))
+	for _, r := range u.Roles {
+		roles = append(roles, string(r))
+	}
+
 	return &UserProfile{
 		CommonSchema: nosqlutil2.CommonSchema{
-			PartitionKey: userPartitionKeyPrefix + "#" + u.ID.String(),
+			PartitionKey: userPartitionKey(u.ID),
 			SortKey:      userProfileSortKey,
 		},
 		Username:  u.Username,
 		Password:  u.Password.String(),
+		Roles:     roles,
 		CreatedAt: u.CreatedAt,
 		UpdatedAt: u.UpdatedAt,
+
+		Email:           u.Email,
+		EmailVerifiedAt: u.EmailVerifiedAt,
+
+		DisabledAt:            u.DisabledAt,
+		PasswordResetRequired: u.PasswordResetRequired,
+
+		GuestExpiresAt: u.GuestExpiresAt,
 	}
 }
 
 type Username struct {
 	nosqlutil2.CommonSchema
 	UserID string `dynamo:"uid"`
+	// ExpiresAt releases the username of a guest together with the guest.
+	ExpiresAt time.Time `dynamo:"ttl,unixtime,omitempty"`
 }
 
 func buildUsername(u *domain.User) *Username {
@@ -73,7 +124,24 @@ func buildUsername(u *domain.User) *Username {
 			PartitionKey: usernamePartitionKey,
 			SortKey:      u.Username,
 		},
-		UserID: u.ID.String(),
+		UserID:    u.ID.String(),
+		ExpiresAt: u.GuestExpiresAt,
+	}
+}
+
+// Email is the item making email addresses unique, like Username.
+type Email struct {
+	nosqlutil2.CommonSchema
+	UserID string `dynamo:"uid"`
+}
+
+func buildEmail(userID uuid.UUID, email string) *Email {
+	return &Email{
+		CommonSchema: nosqlutil2.CommonSchema{
+			PartitionKey: emailPartitionKey,
+			SortKey:      email,
+		},
+		UserID: userID.String(),
 	}
 }
 
@@ -83,8 +151,16 @@ func (dur *dynamoUserRepo) Create(ctx context.Context, u *domain.User) (*domain.
 	createUserProfile := dur.ddb.Table(dur.tableName).
 		Put(buildUserProfile(u)).If("attribute_not_exists(pk)")
 
-	err := dur.ddb.WriteTx().Put(createUsername).Put(createUserProfile).Run(ctx)
+	tx := dur.ddb.WriteTx().Put(createUsername).Put(createUserProfile)
+	if u.Email != "" {
+		tx = tx.Put(dur.ddb.Table(dur.tableName).Put(buildEmail(u.ID, u.Email)).If("attribute_not_exists(pk)"))
+	}
+	err := tx.Run(ctx)
 
+	// items are indexed in the order they are added to the transaction.
+	if nosqlutil2.IsConditionalCheckFailedAt(err, 2) {
+		return nil, usecase.ErrEmailAlreadyExists
+	}
 	if nosqlutil2.IsConditionalCheckFailed(err) {
 		return nil, usecase.ErrUsernameAlreadyExists
 	}
@@ -98,7 +174,7 @@ func (dur *dynamoUserRepo) Create(ctx context.Context, u *domain.User) (*domain.
 func (dur *dynamoUserRepo) Get(ctx context.Context, id uuid.UUID) (*domain.User, error) {
 	userProfile := &UserProfile{}
 	err := dur.ddb.Table(dur.tableName).
-		Get("pk", userPartitionKeyPrefix+"#"+id.String()).
+		Get("pk", userPartitionKey(id)).
 		Range("sk", dynamo.Equal, userProfileSortKey).
 		One(ctx, &userProfile)
 
@@ -126,3 +202,326 @@ func (dur *dynamoUserRepo) GetByName(ctx context.Context, username string) (*dom
 
 	return dur.Get(ctx, uuid.MustParse(un.UserID))
 }
+
+func (dur *dynamoUserRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	em := &Email{}
+	err := dur.ddb.Table(dur.tableName).
+		Get("pk", emailPartitionKey).
+		Range("sk", dynamo.Equal, email).One(ctx, &em)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoUserRepo.GetByEmail failed: %w", err)
+	}
+
+	return dur.Get(ctx, uuid.MustParse(em.UserID))
+}
+
+func (dur *dynamoUserRepo) List(ctx context.Context, limit int, cursor string) ([]*domain.User, string, error) {
+	startKey, err := nosqlutil2.DecodeCursor(cursor, usernamePartitionKey)
+	if err != nil {
+		return nil, "", usecase.ErrInvalidCursor
+	}
+
+	// usernames are stored in a single partition sorted by username, so they are paginated instead of profiles.
+	var usernames []*Username
+	lastKey, err := dur.ddb.Table(dur.tableName).
+		Get("pk", usernamePartitionKey).
+		StartFrom(startKey).
+		Limit(limit).
+		AllWithLastEvaluatedKey(ctx, &usernames)
+	if err != nil {
+		return nil, "", fmt.Errorf("dynamoUserRepo.List failed to query usernames: %w", err)
+	}
+	next, err := nosqlutil2.EncodeCursor(lastKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("dynamoUserRepo.List failed to encode cursor: %w", err)
+	}
+	if len(usernames) == 0 {
+		return []*domain.User{}, next, nil
+	}
+
+	keys := make([]dynamo.Keyed, 0, len(usernames))
+	for _, un := range usernames {
+		keys = append(keys, dynamo.Keys{userPartitionKeyPrefix + "#" + un.UserID, userProfileSortKey})
+	}
+	var profiles []*UserProfile
+	err = dur.ddb.Table(dur.tableName).Batch("pk", "sk").Get(keys...).All(ctx, &profiles)
+	if err != nil && !errors.Is(err, dynamo.ErrNotFound) {
+		return nil, "", fmt.Errorf("dynamoUserRepo.List failed to get profiles: %w", err)
+	}
+
+	// batch get doesn't keep the order of keys.
+	users := make([]*domain.User, 0, len(profiles))
+	for _, p := range profiles {
+		users = append(users, p.toDomainEntity())
+	}
+	slices.SortFunc(users, func(a, b *domain.User) int {
+		return strings.Compare(a.Username, b.Username)
+	})
+	return users, next, nil
+}
+
+// Update is conditioned on "ua", which every update of the profile sets, so that a user read before another update
+// can't overwrite it.
+func (dur *dynamoUserRepo) Update(ctx context.Context, u *domain.User, prevUpdatedAt time.Time) error {
+	p := buildUserProfile(u)
+	update := dur.ddb.Table(dur.tableName).
+		Update("pk", p.PartitionKey).
+		Range("sk", p.SortKey).
+		Set("pw", p.Password).
+		Set("rl", p.Roles).
+		Set("prr", p.PasswordResetRequired).
+		Set("ua", p.UpdatedAt).
+		If("ua = ?", prevUpdatedAt)
+	if u.IsDisabled() {
+		update = update.Set("da", p.DisabledAt)
+	} else {
+		update = update.Remove("da")
+	}
+	if u.IsEmailVerified() {
+		update = update.Set("ev", p.EmailVerifiedAt)
+	} else {
+		update = update.Remove("ev")
+	}
+
+	err := update.Run(ctx)
+	if nosqlutil2.IsConditionalCheckFailed(err) {
+		// the condition fails for deleted users as well.
+		if _, err := dur.Get(ctx, u.ID); err != nil {
+			return err
+		}
+		return usecase.ErrUserUpdated
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoUserRepo.Update failed: %w", err)
+	}
+	return nil
+}
+
+func (dur *dynamoUserRepo) UpdatePassword(
+	ctx context.Context, userID uuid.UUID, password, prev domain.Password,
+) error {
+	err := dur.ddb.Table(dur.tableName).
+		Update("pk", userPartitionKey(userID)).
+		Range("sk", userProfileSortKey).
+		Set("pw", password.String()).
+		Set("ua", time.Now()).
+		If("pw = ?", prev.String()).
+		Run(ctx)
+	if nosqlutil2.IsConditionalCheckFailed(err) {
+		return usecase.ErrPasswordChanged
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoUserRepo.UpdatePassword failed: %w", err)
+	}
+	return nil
+}
+
+func (dur *dynamoUserRepo) ChangeUsername(ctx context.Context, u *domain.User, username string) error {
+	table := dur.ddb.Table(dur.tableName)
+	updatedAt := time.Now()
+
+	releaseUsername := table.Delete("pk", usernamePartitionKey).Range("sk", u.Username).
+		If("uid = ?", u.ID.String())
+	takeUsername := table.Put(buildUsername(&domain.User{ID: u.ID, Username: username, GuestExpiresAt: u.GuestExpiresAt})).
+		If("attribute_not_exists(pk)")
+	updateProfile := table.Update("pk", userPartitionKey(u.ID)).Range("sk", userProfileSortKey).
+		Set("un", username).
+		Set("ua", updatedAt).
+		If("attribute_exists(pk)")
+
+	err := dur.ddb.WriteTx().Delete(releaseUsername).Put(takeUsername).Update(updateProfile).Run(ctx)
+	if nosqlutil2.IsConditionalCheckFailed(err) {
+		return usecase.ErrUsernameAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoUserRepo.ChangeUsername failed: %w", err)
+	}
+
+	u.Username = username
+	u.UpdatedAt = updatedAt
+	return nil
+}
+
+func (dur *dynamoUserRepo) ChangeEmail(ctx context.Context, u *domain.User, email string) error {
+	table := dur.ddb.Table(dur.tableName)
+	updatedAt := time.Now()
+
+	takeEmail := table.Put(buildEmail(u.ID, email)).If("attribute_not_exists(pk)")
+	// the new email address is not verified yet.
+	updateProfile := table.Update("pk", userPartitionKey(u.ID)).Range("sk", userProfileSortKey).
+		Set("em", email).
+		Remove("ev").
+		Set("ua", updatedAt).
+		If("attribute_exists(pk)")
+	tx := dur.ddb.WriteTx().Put(takeEmail).Update(updateProfile)
+	if u.Email != "" {
+		tx = tx.Delete(table.Delete("pk", emailPartitionKey).Range("sk", u.Email).If("uid = ?", u.ID.String()))
+	}
+
+	err := tx.Run(ctx)
+	if nosqlutil2.IsConditionalCheckFailedAt(err, 0) {
+		return usecase.ErrEmailAlreadyExists
+	}
+	if nosqlutil2.IsConditionalCheckFailed(err) {
+		return usecase.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoUserRepo.ChangeEmail failed: %w", err)
+	}
+
+	u.Email = email
+	u.EmailVerifiedAt = time.Time{}
+	u.UpdatedAt = updatedAt
+	return nil
+}
+
+func (dur *dynamoUserRepo) ExtendGuest(ctx context.Context, u *domain.User) error {
+	table := dur.ddb.Table(dur.tableName)
+	expiresAt := u.GuestExpiresAt.Unix()
+
+	updateProfile := table.Update("pk", userPartitionKey(u.ID)).Range("sk", userProfileSortKey).
+		Set(nosqlutil2.TTLAttribute, expiresAt).
+		Set("ua", u.UpdatedAt).
+		If("attribute_exists(pk) AND attribute_exists($)", nosqlutil2.TTLAttribute)
+	updateUsername := table.Update("pk", usernamePartitionKey).Range("sk", u.Username).
+		Set(nosqlutil2.TTLAttribute, expiresAt).
+		If("uid = ?", u.ID.String())
+
+	err := dur.ddb.WriteTx().Update(updateProfile).Update(updateUsername).Run(ctx)
+	if nosqlutil2.IsConditionalCheckFailed(err) {
+		return usecase.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoUserRepo.ExtendGuest failed: %w", err)
+	}
+	return nil
+}
+
+func (dur *dynamoUserRepo) UpgradeGuest(ctx context.Context, u *domain.User, prevUsername string) error {
+	table := dur.ddb.Table(dur.tableName)
+	p := buildUserProfile(u)
+
+	// the profile is still of a guest, so that a guest is upgraded only once.
+	updateProfile := table.Update("pk", p.PartitionKey).Range("sk", p.SortKey).
+		Set("un", p.Username).
+		Set("pw", p.Password).
+		Set("ua", p.UpdatedAt).
+		Remove(nosqlutil2.TTLAttribute).
+		If("attribute_exists(pk) AND attribute_exists($)", nosqlutil2.TTLAttribute)
+	if u.Email != "" {
+		updateProfile = updateProfile.Set("em", p.Email)
+	}
+	if u.IsEmailVerified() {
+		updateProfile = updateProfile.Set("ev", p.EmailVerifiedAt)
+	}
+	tx := dur.ddb.WriteTx().Update(updateProfile)
+
+	// items are indexed in the order they are added to the transaction.
+	usernameIndex, emailIndex := 1, -1
+	if u.Username == prevUsername {
+		tx = tx.Update(table.Update("pk", usernamePartitionKey).Range("sk", u.Username).
+			Remove(nosqlutil2.TTLAttribute).
+			If("uid = ?", u.ID.String()))
+	} else {
+		tx = tx.Delete(table.Delete("pk", usernamePartitionKey).Range("sk", prevUsername).
+			If("uid = ?", u.ID.String()))
+		tx = tx.Put(table.Put(buildUsername(u)).If("attribute_not_exists(pk)"))
+		usernameIndex = 2
+	}
+	if u.Email != "" {
+		tx = tx.Put(table.Put(buildEmail(u.ID, u.Email)).If("attribute_not_exists(pk)"))
+		emailIndex = usernameIndex + 1
+	}
+
+	err := tx.Run(ctx)
+	if u.Username != prevUsername && nosqlutil2.IsConditionalCheckFailedAt(err, usernameIndex) {
+		return usecase.ErrUsernameAlreadyExists
+	}
+	if emailIndex >= 0 && nosqlutil2.IsConditionalCheckFailedAt(err, emailIndex) {
+		return usecase.ErrEmailAlreadyExists
+	}
+	if nosqlutil2.IsConditionalCheckFailed(err) {
+		return usecase.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoUserRepo.UpgradeGuest failed: %w", err)
+	}
+	return nil
+}
+
+// Delete deletes the user in a transaction, and then the items depending on the user.
+// The transaction is kept to the items of the user itself, since a transaction is limited to 100 items.
+func (dur *dynamoUserRepo) Delete(ctx context.Context, u *domain.User) error {
+	table := dur.ddb.Table(dur.tableName)
+	deleteUsername := table.Delete("pk", usernamePartitionKey).Range("sk", u.Username).
+		If("uid = ?", u.ID.String())
+	deleteProfile := table.Delete("pk", userPartitionKey(u.ID)).Range("sk", userProfileSortKey).
+		If("attribute_exists(pk)")
+
+	tx := dur.ddb.WriteTx().Delete(deleteUsername).Delete(deleteProfile)
+	if u.Email != "" {
+		tx = tx.Delete(table.Delete("pk", emailPartitionKey).Range("sk", u.Email).If("uid = ?", u.ID.String()))
+	}
+	err := tx.Run(ctx)
+	if nosqlutil2.IsConditionalCheckFailed(err) {
+		// the user may have been deleted by a previous call that failed to delete the dependents.
+		if err := dur.deleteDependents(ctx, u.ID); err != nil {
+			return err
+		}
+		return usecase.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoUserRepo.Delete failed: %w", err)
+	}
+	return dur.deleteDependents(ctx, u.ID)
+}
+
+// deleteDependents deletes the MFA item, passkeys, identities, consents and API keys of the deleted user.
+// They are not deleted by TTL, except API keys that may live up to a year.
+// It is idempotent, so that it can be retried on failure.
+func (dur *dynamoUserRepo) deleteDependents(ctx context.Context, userID uuid.UUID) error {
+	table := dur.ddb.Table(dur.tableName)
+
+	// identities are deleted from the index first, since they can't be found from the user afterwards.
+	var identities []*Identity
+	err := table.Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.BeginsWith, identitySortKeyPrefix+"#").
+		All(ctx, &identities)
+	if err != nil {
+		return fmt.Errorf("dynamoUserRepo.Delete failed to query identities: %w", err)
+	}
+	for _, i := range identities {
+		err := table.Delete("pk", identityPartitionKey).Range("sk", identityKey(i.Provider, i.Subject)).
+			If("uid = ?", userID.String()).
+			Run(ctx)
+		if err != nil && !nosqlutil2.IsConditionalCheckFailed(err) {
+			return fmt.Errorf("dynamoUserRepo.Delete failed to delete identity index: %w", err)
+		}
+	}
+
+	// audit events and revocations in the partition are kept until they expire.
+	keys := []dynamo.Keyed{dynamo.Keys{userPartitionKey(userID), mfaSortKey}}
+	for _, i := range identities {
+		keys = append(keys, dynamo.Keys{i.PartitionKey, i.SortKey})
+	}
+	for _, prefix := range []string{passkeySortKeyPrefix, consentSortKeyPrefix, apiKeySortKeyPrefix} {
+		var items []*nosqlutil2.CommonSchema
+		err := table.Get("pk", userPartitionKey(userID)).
+			Range("sk", dynamo.BeginsWith, prefix+"#").
+			Project("pk", "sk").
+			All(ctx, &items)
+		if err != nil {
+			return fmt.Errorf("dynamoUserRepo.Delete failed to query dependents: %w", err)
+		}
+		for _, item := range items {
+			keys = append(keys, dynamo.Keys{item.PartitionKey, item.SortKey})
+		}
+	}
+	if _, err := table.Batch("pk", "sk").Write().Delete(keys...).Run(ctx); err != nil {
+		return fmt.Errorf("dynamoUserRepo.Delete failed to delete dependents: %w", err)
+	}
+	return nil
+}
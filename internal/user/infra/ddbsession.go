@@ -0,0 +1,232 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const (
+	sessionSortKeyPrefix = "SESSION"
+)
+
+// dynamoSessionRepo is the implementation of usecase.SessionRepo interface using AWS DynamoDB. (adapter)
+// Sessions are stored under the user partition, so that all sessions of a user can be queried at once.
+type dynamoSessionRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoSessionRepo(ddb *dynamo.DB, tableName string) usecase.SessionRepo {
+	return &dynamoSessionRepo{ddb: ddb, tableName: tableName}
+}
+
+func sessionSortKey(id uuid.UUID) string {
+	return sessionSortKeyPrefix + "#" + id.String()
+}
+
+type Session struct {
+	nosqlutil.CommonSchema
+
+	DeviceName         string    `dynamo:"dn"`
+	UserAgent          string    `dynamo:"ua"`
+	IPAddress          string    `dynamo:"ip"`
+	ClientID           string    `dynamo:"ci,omitempty"`
+	Scope              string    `dynamo:"sc,omitempty"`
+	Thumbprint         string    `dynamo:"jkt,omitempty"`
+	AuthTime           time.Time `dynamo:"aut"`
+	AuthMethods        []string  `dynamo:"amr,omitempty"`
+	TokenHash          string    `dynamo:"th"`
+	RotatedTokenHashes []string  `dynamo:"rth"`
+	CreatedAt          time.Time `dynamo:"ca"`
+	LastUsedAt         time.Time `dynamo:"lu"`
+	// ExpiresAt lets DynamoDB delete the session once its refresh token can no longer be used.
+	ExpiresAt time.Time `dynamo:"ttl,unixtime"`
+}
+
+func (s *Session) toDomainEntity() *domain.Session {
+	// sessions started before auth_time was recorded authenticated when they were created.
+	authTime := s.AuthTime
+	if authTime.IsZero() {
+		authTime = s.CreatedAt
+	}
+
+	return &domain.Session{
+		ID:                 uuid.MustParse(s.SortKey[len(sessionSortKeyPrefix)+1:]),
+		UserID:             uuid.MustParse(s.PartitionKey[len(userPartitionKeyPrefix)+1:]),
+		Device:             &domain.Device{Name: s.DeviceName, UserAgent: s.UserAgent, IPAddress: s.IPAddress},
+		ClientID:           s.ClientID,
+		Scopes:             domain.ParseScopes(s.Scope),
+		Thumbprint:         s.Thumbprint,
+		AuthTime:           authTime,
+		AuthMethods:        domain.ParseAuthMethods(s.AuthMethods),
+		RefreshTokenHash:   s.TokenHash,
+		RotatedTokenHashes: s.RotatedTokenHashes,
+		CreatedAt:          s.CreatedAt,
+		LastUsedAt:         s.LastUsedAt,
+		ExpiresAt:          s.ExpiresAt,
+	}
+}
+
+func buildSession(s *domain.Session) *Session {
+	device := s.Device
+	if device == nil {
+		device = &domain.Device{}
+	}
+
+	return &Session{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(s.UserID),
+			SortKey:      sessionSortKey(s.ID),
+		},
+		DeviceName:         device.Name,
+		UserAgent:          device.UserAgent,
+		IPAddress:          device.IPAddress,
+		ClientID:           s.ClientID,
+		Scope:              domain.FormatScopes(s.Scopes),
+		Thumbprint:         s.Thumbprint,
+		AuthTime:           s.AuthTime,
+		AuthMethods:        domain.FormatAuthMethods(s.AuthMethods),
+		TokenHash:          s.RefreshTokenHash,
+		RotatedTokenHashes: s.RotatedTokenHashes,
+		CreatedAt:          s.CreatedAt,
+		LastUsedAt:         s.LastUsedAt,
+		ExpiresAt:          s.ExpiresAt,
+	}
+}
+
+func (dsr *dynamoSessionRepo) Create(ctx context.Context, s *domain.Session) error {
+	err := dsr.ddb.Table(dsr.tableName).Put(buildSession(s)).If("attribute_not_exists(pk)").Run(ctx)
+	if err != nil {
+		return fmt.Errorf("dynamoSessionRepo.Create failed: %w", err)
+	}
+	return nil
+}
+
+func (dsr *dynamoSessionRepo) Get(ctx context.Context, userID, sessionID uuid.UUID) (*domain.Session, error) {
+	session := &Session{}
+	err := dsr.ddb.Table(dsr.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.Equal, sessionSortKey(sessionID)).
+		One(ctx, &session)
+
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoSessionRepo.Get failed: %w", err)
+	}
+
+	return session.toDomainEntity(), nil
+}
+
+func (dsr *dynamoSessionRepo) Rotate(ctx context.Context, s *domain.Session, prevHash string) error {
+	update := dsr.ddb.Table(dsr.tableName).
+		Update("pk", userPartitionKey(s.UserID)).
+		Range("sk", sessionSortKey(s.ID)).
+		Set("th", s.RefreshTokenHash).
+		Set("rth", s.RotatedTokenHashes).
+		Set("lu", s.LastUsedAt).
+		Set(nosqlutil.TTLAttribute, s.ExpiresAt.Unix())
+	// a session is bound to a DPoP key by the first refresh with a proof.
+	if s.Thumbprint != "" {
+		update = update.Set("jkt", s.Thumbprint)
+	}
+	err := update.If("th = ?", prevHash).Run(ctx)
+
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrRefreshTokenReused
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoSessionRepo.Rotate failed: %w", err)
+	}
+	return nil
+}
+
+func (dsr *dynamoSessionRepo) UpdateAuthentication(ctx context.Context, s *domain.Session) error {
+	err := dsr.ddb.Table(dsr.tableName).
+		Update("pk", userPartitionKey(s.UserID)).
+		Range("sk", sessionSortKey(s.ID)).
+		Set("aut", s.AuthTime).
+		Set("amr", domain.FormatAuthMethods(s.AuthMethods)).
+		If("attribute_exists(pk)").
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrSessionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoSessionRepo.UpdateAuthentication failed: %w", err)
+	}
+	return nil
+}
+
+func (dsr *dynamoSessionRepo) List(ctx context.Context, userID uuid.UUID) ([]*domain.Session, error) {
+	var sessions []*Session
+	err := dsr.ddb.Table(dsr.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.BeginsWith, sessionSortKeyPrefix+"#").
+		All(ctx, &sessions)
+	if err != nil {
+		return nil, fmt.Errorf("dynamoSessionRepo.List failed: %w", err)
+	}
+
+	now := time.Now()
+	res := make([]*domain.Session, 0, len(sessions))
+	for _, s := range sessions {
+		session := s.toDomainEntity()
+		// TTL deletion is not immediate, so expired items may still be read.
+		if session.IsExpired(now) {
+			continue
+		}
+		res = append(res, session)
+	}
+	slices.SortFunc(res, func(a, b *domain.Session) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return res, nil
+}
+
+func (dsr *dynamoSessionRepo) Delete(ctx context.Context, userID, sessionID uuid.UUID) error {
+	err := dsr.ddb.Table(dsr.tableName).
+		Delete("pk", userPartitionKey(userID)).
+		Range("sk", sessionSortKey(sessionID)).
+		Run(ctx)
+	if err != nil {
+		return fmt.Errorf("dynamoSessionRepo.Delete failed: %w", err)
+	}
+	return nil
+}
+
+func (dsr *dynamoSessionRepo) DeleteAll(ctx context.Context, userID uuid.UUID) error {
+	table := dsr.ddb.Table(dsr.tableName)
+
+	var sessions []*Session
+	err := table.Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.BeginsWith, sessionSortKeyPrefix+"#").
+		Project("pk", "sk").
+		All(ctx, &sessions)
+	if err != nil {
+		return fmt.Errorf("dynamoSessionRepo.DeleteAll failed to query sessions: %w", err)
+	}
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	keys := make([]dynamo.Keyed, 0, len(sessions))
+	for _, s := range sessions {
+		keys = append(keys, dynamo.Keys{s.PartitionKey, s.SortKey})
+	}
+	if _, err := table.Batch("pk", "sk").Write().Delete(keys...).Run(ctx); err != nil {
+		return fmt.Errorf("dynamoSessionRepo.DeleteAll failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const emailVerificationSortKey = "EMAIL_VERIFICATION"
+
+// dynamoEmailVerificationRepo is the implementation of usecase.EmailVerificationRepo interface
+// using AWS DynamoDB. (adapter) A user has at most one pending verification under the user partition.
+type dynamoEmailVerificationRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoEmailVerificationRepo(ddb *dynamo.DB, tableName string) usecase.EmailVerificationRepo {
+	return &dynamoEmailVerificationRepo{ddb: ddb, tableName: tableName}
+}
+
+type EmailVerification struct {
+	nosqlutil.CommonSchema
+
+	Email     string    `dynamo:"em"`
+	TokenHash string    `dynamo:"th"`
+	CodeHash  string    `dynamo:"ch"`
+	Attempts  int       `dynamo:"at"`
+	ExpiresAt time.Time `dynamo:"ttl,unixtime"`
+}
+
+func (e *EmailVerification) toDomainEntity() *domain.EmailVerification {
+	return &domain.EmailVerification{
+		UserID:    uuid.MustParse(e.PartitionKey[len(userPartitionKeyPrefix)+1:]),
+		Email:     e.Email,
+		TokenHash: e.TokenHash,
+		CodeHash:  e.CodeHash,
+		Attempts:  e.Attempts,
+		ExpiresAt: e.ExpiresAt,
+	}
+}
+
+func (der *dynamoEmailVerificationRepo) Save(ctx context.Context, v *domain.EmailVerification) error {
+	err := der.ddb.Table(der.tableName).Put(&EmailVerification{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(v.UserID),
+			SortKey:      emailVerificationSortKey,
+		},
+		Email:     v.Email,
+		TokenHash: v.TokenHash,
+		CodeHash:  v.CodeHash,
+		Attempts:  v.Attempts,
+		ExpiresAt: v.ExpiresAt,
+	}).Run(ctx)
+	if err != nil {
+		return fmt.Errorf("dynamoEmailVerificationRepo.Save failed: %w", err)
+	}
+	return nil
+}
+
+func (der *dynamoEmailVerificationRepo) Get(ctx context.Context, userID uuid.UUID) (*domain.EmailVerification, error) {
+	var item EmailVerification
+	err := der.ddb.Table(der.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.Equal, emailVerificationSortKey).
+		One(ctx, &item)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, usecase.ErrEmailVerificationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dynamoEmailVerificationRepo.Get failed: %w", err)
+	}
+
+	v := item.toDomainEntity()
+	// TTL deletion is not immediate, so expired items may still be read.
+	if v.IsExpired(time.Now()) {
+		return nil, usecase.ErrEmailVerificationNotFound
+	}
+	return v, nil
+}
+
+func (der *dynamoEmailVerificationRepo) CountAttempt(
+	ctx context.Context, v *domain.EmailVerification, max int,
+) error {
+	var item EmailVerification
+	err := der.ddb.Table(der.tableName).
+		Update("pk", userPartitionKey(v.UserID)).
+		Range("sk", emailVerificationSortKey).
+		Add("at", 1).
+		If("th = ? AND $ < ?", v.TokenHash, "at", max).
+		Value(ctx, &item)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		// tell the limit from the verification replaced or consumed in the meantime.
+		current, err := der.Get(ctx, v.UserID)
+		if err != nil {
+			return err
+		}
+		if current.TokenHash == v.TokenHash && current.Attempts >= max {
+			return usecase.ErrTooManyVerificationAttempts
+		}
+		return usecase.ErrEmailVerificationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoEmailVerificationRepo.CountAttempt failed: %w", err)
+	}
+	v.Attempts = item.Attempts
+	return nil
+}
+
+func (der *dynamoEmailVerificationRepo) Consume(ctx context.Context, v *domain.EmailVerification) error {
+	// the condition makes the verification single-use even if it is proved twice at once.
+	err := der.ddb.Table(der.tableName).
+		Delete("pk", userPartitionKey(v.UserID)).
+		Range("sk", emailVerificationSortKey).
+		If("th = ?", v.TokenHash).
+		Run(ctx)
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return usecase.ErrEmailVerificationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoEmailVerificationRepo.Consume failed: %w", err)
+	}
+	return nil
+}
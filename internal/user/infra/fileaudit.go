@@ -0,0 +1,78 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+// fileAuditLog is the implementation of usecase.AuditLog interface appending events to a file as JSON lines. (adapter)
+// If the path is empty, events are logged instead.
+type fileAuditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileAuditLog(path string) usecase.AuditLog {
+	return &fileAuditLog{path: path}
+}
+
+type auditLine struct {
+	ID            string            `json:"id"`
+	Type          string            `json:"type"`
+	UserID        string            `json:"user_id"`
+	ActorID       string            `json:"actor_id,omitempty"`
+	Details       map[string]string `json:"details,omitempty"`
+	CorrelationID string            `json:"correlation_id,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+func buildAuditLine(e *domain.AuditEvent) *auditLine {
+	l := &auditLine{
+		ID:            e.ID.String(),
+		Type:          string(e.Type),
+		UserID:        e.UserID.String(),
+		Details:       e.Details,
+		CorrelationID: e.CorrelationID,
+		CreatedAt:     e.CreatedAt,
+	}
+	if e.ActorID != uuid.Nil {
+		l.ActorID = e.ActorID.String()
+	}
+	return l
+}
+
+func (f *fileAuditLog) Record(ctx context.Context, e *domain.AuditEvent) error {
+	line, err := json.Marshal(buildAuditLine(e))
+	if err != nil {
+		return fmt.Errorf("fileAuditLog.Record failed: %w", err)
+	}
+
+	if f.path == "" {
+		logutil.From(ctx).Info("audit", slog.String("event", string(line)))
+		return nil
+	}
+
+	// a single write of a line is not interleaved with the others, which the lock ensures within the process.
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("fileAuditLog.Record failed to open file: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("fileAuditLog.Record failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package infra
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/jwkutil"
+	"github.com/buzzryan/zenbu/internal/config"
+)
+
+// signingKey is a key used to sign or verify JWS tokens.
+// Keys loaded from a public key PEM block can only verify tokens. They are kept during key rotation,
+// so that tokens signed by a retired key remain valid until they expire.
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   crypto.PrivateKey
+	verifyKey crypto.PublicKey
+}
+
+func (k *signingKey) canSign() bool {
+	return k.signKey != nil
+}
+
+// Keyring holds the keys of jwsTokenManager. Tokens are signed by the active key with its ID in the "kid" header,
+// and verified by the key matching the header.
+type Keyring struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	// legacyHMAC verifies tokens without "kid" which were signed by HS256 before asymmetric keys were introduced.
+	legacyHMAC *signingKey
+}
+
+// LoadKeyring loads PEM encoded keys from files and environment variable.
+// The first private key becomes the active signing key unless JWSActiveKeyID is set.
+// If no asymmetric key is configured, tokens are signed by HS256 with JWSSigningKey.
+func LoadKeyring(cfg config.JWSConfig) (*Keyring, error) {
+	var pemData []byte
+	for _, file := range cfg.JWSKeyFiles {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file %s: %w", file, err)
+		}
+		pemData = append(pemData, b...)
+		pemData = append(pemData, '\n')
+	}
+	pemData = append(pemData, cfg.JWSKeys...)
+
+	keys, err := parsePEMKeys(pemData)
+	if err != nil {
+		return nil, err
+	}
+
+	kr := &Keyring{keys: make(map[string]*signingKey, len(keys))}
+	if cfg.JWSSigningKey != "" {
+		kr.legacyHMAC = &signingKey{
+			method:    jwt.SigningMethodHS256,
+			signKey:   []byte(cfg.JWSSigningKey),
+			verifyKey: []byte(cfg.JWSSigningKey),
+		}
+	}
+
+	for _, k := range keys {
+		// the same key may be given both as a private key and as a public key.
+		if existing, ok := kr.keys[k.id]; ok && existing.canSign() {
+			continue
+		}
+		kr.keys[k.id] = k
+		if kr.active != nil || !k.canSign() {
+			continue
+		}
+		if cfg.JWSActiveKeyID == "" || cfg.JWSActiveKeyID == k.id {
+			kr.active = k
+		}
+	}
+
+	if cfg.JWSActiveKeyID != "" && kr.active == nil {
+		return nil, fmt.Errorf("active key %s not found among private keys", cfg.JWSActiveKeyID)
+	}
+	if kr.active == nil {
+		if kr.legacyHMAC == nil {
+			return nil, errors.New("no JWS signing key configured")
+		}
+		kr.active = kr.legacyHMAC
+	}
+
+	return kr, nil
+}
+
+func parsePEMKeys(data []byte) ([]*signingKey, error) {
+	var keys []*signingKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return keys, nil
+		}
+
+		var (
+			key *signingKey
+			err error
+		)
+		switch block.Type {
+		case "PRIVATE KEY", "EC PRIVATE KEY", "RSA PRIVATE KEY":
+			key, err = parsePrivateKey(block)
+		case "PUBLIC KEY":
+			key, err = parsePublicKey(block)
+		default:
+			err = fmt.Errorf("unexpected PEM block %s", block.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+}
+
+func parsePrivateKey(block *pem.Block) (*signingKey, error) {
+	var (
+		priv any
+		err  error
+	)
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		priv, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key %T", priv)
+	}
+	key, err := newSigningKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.signKey = priv
+	return key, nil
+}
+
+func parsePublicKey(block *pem.Block) (*signingKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	return newSigningKey(pub)
+}
+
+// newSigningKey chooses the signing method by the type of the key, and uses JWK thumbprint as the key ID.
+func newSigningKey(pub crypto.PublicKey) (*signingKey, error) {
+	var method jwt.SigningMethod
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 curve is supported for ECDSA keys")
+		}
+		method = jwt.SigningMethodES256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("unsupported public key %T", pub)
+	}
+
+	jwk, err := jwkutil.FromPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+
+	return &signingKey{id: kid, method: method, verifyKey: pub}, nil
+}
+
+// verificationKey is jwt.Keyfunc. It also makes sure that the token is signed by the algorithm of the key,
+// so that a public key can never be used as an HMAC secret.
+func (kr *Keyring) verificationKey(token *jwt.Token) (any, error) {
+	key := kr.legacyHMAC
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = kr.keys[kid]
+	}
+	if key == nil {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+// jwks returns the JWK set of asymmetric keys sorted by key ID. HMAC secret must never be published.
+func (kr *Keyring) jwks() (*jwkutil.Set, error) {
+	jwks := make([]*jwkutil.JWK, 0, len(kr.keys))
+	for _, k := range kr.keys {
+		jwk, err := jwkutil.FromPublicKey(k.verifyKey)
+		if err != nil {
+			return nil, err
+		}
+		jwk.KeyID = k.id
+		jwk.Algorithm = k.method.Alg()
+		jwk.Use = "sig"
+		jwks = append(jwks, jwk)
+	}
+	slices.SortFunc(jwks, func(a, b *jwkutil.JWK) int {
+		return strings.Compare(a.KeyID, b.KeyID)
+	})
+	return &jwkutil.Set{Keys: jwks}, nil
+}
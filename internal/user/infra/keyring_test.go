@@ -0,0 +1,145 @@
+package infra
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/config"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+// encodePEM encodes the private key, or only its public key if public is true.
+func encodePEM(t *testing.T, key crypto.Signer, public bool) string {
+	t.Helper()
+	if public {
+		der, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			t.Fatalf("failed to marshal public key: %v", err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal private key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func newTestTokenManager(t *testing.T, cfg config.JWSConfig) usecase.TokenManager {
+	t.Helper()
+	kr, err := LoadKeyring(cfg)
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+	return NewJWSTokenManager(kr)
+}
+
+func generateTestToken(t *testing.T, tokens usecase.TokenManager) string {
+	t.Helper()
+	token, err := tokens.Generate(&usecase.Claims{UserID: uuid.New(), ExpiresAt: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	return token
+}
+
+func TestKeyring_VerifiesTokens(t *testing.T) {
+	retired, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	_, active, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	_, unknown, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	// the active key signs new tokens, and the retired one only verifies tokens signed before the rotation.
+	tokens := newTestTokenManager(t, config.JWSConfig{
+		JWSKeys: encodePEM(t, active, false) + encodePEM(t, retired, true),
+	})
+	retiredKey, err := newSigningKey(retired.Public())
+	if err != nil {
+		t.Fatalf("failed to get key id: %v", err)
+	}
+	activeKey, err := newSigningKey(active.Public())
+	if err != nil {
+		t.Fatalf("failed to get key id: %v", err)
+	}
+	signed, _, err := jwt.NewParser().ParseUnverified(generateTestToken(t, tokens), &jwsClaims{})
+	if err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	if kid := signed.Header["kid"]; kid != activeKey.id {
+		t.Fatalf("token is signed by %v, want the active key %s", kid, activeKey.id)
+	}
+
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		wantErr error
+	}{
+		{
+			name:  "signed by active key",
+			token: func(t *testing.T) string { return generateTestToken(t, tokens) },
+		},
+		{
+			name: "signed by retired key",
+			token: func(t *testing.T) string {
+				before := newTestTokenManager(t, config.JWSConfig{JWSKeys: encodePEM(t, retired, false)})
+				return generateTestToken(t, before)
+			},
+		},
+		{
+			name: "signed by unknown key",
+			token: func(t *testing.T) string {
+				other := newTestTokenManager(t, config.JWSConfig{JWSKeys: encodePEM(t, unknown, false)})
+				return generateTestToken(t, other)
+			},
+			wantErr: usecase.ErrInvalidToken,
+		},
+		{
+			// the public key of the retired key must not be accepted as an HMAC secret.
+			name: "algorithm not of the key",
+			token: func(t *testing.T) string {
+				der, err := x509.MarshalPKIXPublicKey(retired.Public())
+				if err != nil {
+					t.Fatalf("failed to marshal public key: %v", err)
+				}
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwsClaims{
+					RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+					UserID:           uuid.NewString(),
+				})
+				token.Header["kid"] = retiredKey.id
+				signed, err := token.SignedString(der)
+				if err != nil {
+					t.Fatalf("failed to sign token: %v", err)
+				}
+				return signed
+			},
+			wantErr: usecase.ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tokens.Parse(tt.token(t))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const (
+	loginAttemptPartitionKeyPrefix = "LOGIN_ATTEMPT"
+	loginAttemptSortKey            = "FAILURES"
+)
+
+// dynamoLoginAttemptRepo is the implementation of usecase.LoginAttemptRepo interface using AWS DynamoDB. (adapter)
+// Each key has its own partition holding an atomic counter, which is deleted by DynamoDB TTL after the window.
+type dynamoLoginAttemptRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoLoginAttemptRepo(ddb *dynamo.DB, tableName string) usecase.LoginAttemptRepo {
+	return &dynamoLoginAttemptRepo{ddb: ddb, tableName: tableName}
+}
+
+type LoginAttempt struct {
+	nosqlutil.CommonSchema
+
+	Failures  int       `dynamo:"fc"`
+	ExpiresAt time.Time `dynamo:"ttl,unixtime"`
+}
+
+func (l *LoginAttempt) toDomainEntity() *domain.LoginAttempts {
+	return &domain.LoginAttempts{Failures: l.Failures, ExpiresAt: l.ExpiresAt}
+}
+
+func loginAttemptPartitionKey(key string) string {
+	return loginAttemptPartitionKeyPrefix + "#" + key
+}
+
+func (dlr *dynamoLoginAttemptRepo) get(ctx context.Context, key string) (*domain.LoginAttempts, error) {
+	var item LoginAttempt
+	err := dlr.ddb.Table(dlr.tableName).
+		Get("pk", loginAttemptPartitionKey(key)).
+		Range("sk", dynamo.Equal, loginAttemptSortKey).
+		Consistent(true).
+		One(ctx, &item)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return &domain.LoginAttempts{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := item.toDomainEntity()
+	// TTL deletion is not immediate, so expired items may still be read.
+	if attempts.IsExpired(time.Now()) {
+		return &domain.LoginAttempts{}, nil
+	}
+	return attempts, nil
+}
+
+func (dlr *dynamoLoginAttemptRepo) Reserve(
+	ctx context.Context, key string, max int, window time.Duration,
+) (*domain.LoginAttempts, bool, error) {
+	table := dlr.ddb.Table(dlr.tableName)
+	pk := loginAttemptPartitionKey(key)
+
+	// the update counts within the current window, below the limit. If it fails, either there is no window yet,
+	// or the limit is reached, which is told by reading the window. A new window is started in the former case,
+	// which fails only if another request started one in between, and then the next round counts within that one.
+	for range 2 {
+		now := time.Now()
+		var item LoginAttempt
+		err := table.Update("pk", pk).Range("sk", loginAttemptSortKey).
+			Add("fc", 1).
+			If("$ > ? AND fc < ?", nosqlutil.TTLAttribute, now.Unix(), max).
+			Value(ctx, &item)
+		if err == nil {
+			return item.toDomainEntity(), true, nil
+		}
+		if !nosqlutil.IsConditionalCheckFailed(err) {
+			return nil, false, fmt.Errorf("dynamoLoginAttemptRepo.Reserve failed: %w", err)
+		}
+
+		attempts, err := dlr.get(ctx, key)
+		if err != nil {
+			return nil, false, fmt.Errorf("dynamoLoginAttemptRepo.Reserve failed: %w", err)
+		}
+		if attempts.Failures >= max {
+			return attempts, false, nil
+		}
+
+		item = LoginAttempt{
+			CommonSchema: nosqlutil.CommonSchema{PartitionKey: pk, SortKey: loginAttemptSortKey},
+			Failures:     1,
+			ExpiresAt:    now.Add(window),
+		}
+		err = table.Put(&item).If("attribute_not_exists(pk) OR $ <= ?", nosqlutil.TTLAttribute, now.Unix()).Run(ctx)
+		if err == nil {
+			return item.toDomainEntity(), true, nil
+		}
+		if !nosqlutil.IsConditionalCheckFailed(err) {
+			return nil, false, fmt.Errorf("dynamoLoginAttemptRepo.Reserve failed: %w", err)
+		}
+	}
+	return nil, false, errors.New("dynamoLoginAttemptRepo.Reserve failed: too much contention")
+}
+
+func (dlr *dynamoLoginAttemptRepo) Release(ctx context.Context, key string) error {
+	err := dlr.ddb.Table(dlr.tableName).
+		Update("pk", loginAttemptPartitionKey(key)).Range("sk", loginAttemptSortKey).
+		Add("fc", -1).
+		If("$ > ? AND fc > ?", nosqlutil.TTLAttribute, time.Now().Unix(), 0).
+		Run(ctx)
+	// the window is over or was reset, so there is nothing to uncount.
+	if nosqlutil.IsConditionalCheckFailed(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("dynamoLoginAttemptRepo.Release failed: %w", err)
+	}
+	return nil
+}
+
+func (dlr *dynamoLoginAttemptRepo) Reset(ctx context.Context, key string) error {
+	err := dlr.ddb.Table(dlr.tableName).
+		Delete("pk", loginAttemptPartitionKey(key)).
+		Range("sk", loginAttemptSortKey).
+		Run(ctx)
+	if err != nil {
+		return fmt.Errorf("dynamoLoginAttemptRepo.Reset failed: %w", err)
+	}
+	return nil
+}
+
+// memoryLoginAttemptRepo is the in-memory implementation of usecase.LoginAttemptRepo interface.
+// Counters are not shared between server instances, so it fits tests and single instance deployments only.
+type memoryLoginAttemptRepo struct {
+	mu        sync.Mutex
+	attempts  map[string]domain.LoginAttempts
+	lastSweep time.Time
+}
+
+// memoryLoginAttemptSweepInterval is how often expired windows are deleted, so that the map doesn't grow without bound.
+const memoryLoginAttemptSweepInterval = time.Minute
+
+func NewMemoryLoginAttemptRepo() usecase.LoginAttemptRepo {
+	return &memoryLoginAttemptRepo{attempts: make(map[string]domain.LoginAttempts)}
+}
+
+func (m *memoryLoginAttemptRepo) Reserve(
+	_ context.Context, key string, max int, window time.Duration,
+) (*domain.LoginAttempts, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= memoryLoginAttemptSweepInterval {
+		for k, v := range m.attempts {
+			if v.IsExpired(now) {
+				delete(m.attempts, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	a, ok := m.attempts[key]
+	if !ok || a.IsExpired(now) {
+		a = domain.LoginAttempts{ExpiresAt: now.Add(window)}
+	}
+	if a.Failures >= max {
+		return &a, false, nil
+	}
+	a.Failures++
+	m.attempts[key] = a
+	return &a, true, nil
+}
+
+func (m *memoryLoginAttemptRepo) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attempts[key]
+	if !ok || a.IsExpired(time.Now()) || a.Failures == 0 {
+		return nil
+	}
+	a.Failures--
+	m.attempts[key] = a
+	return nil
+}
+
+func (m *memoryLoginAttemptRepo) Reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
@@ -0,0 +1,30 @@
+package infra
+
+import (
+	"context"
+	"errors"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+// multiAuditLog is the implementation of usecase.AuditLog interface recording events to every log. (adapter)
+// e.g. to DynamoDB for queries, and to a file shipped to the log pipeline.
+type multiAuditLog struct {
+	logs []usecase.AuditLog
+}
+
+func NewMultiAuditLog(logs ...usecase.AuditLog) usecase.AuditLog {
+	return &multiAuditLog{logs: logs}
+}
+
+// Record records the event to every log, even if some of them fail, and returns the failures joined.
+func (m *multiAuditLog) Record(ctx context.Context, e *domain.AuditEvent) error {
+	var errs []error
+	for _, l := range m.logs {
+		if err := l.Record(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
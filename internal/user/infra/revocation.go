@@ -0,0 +1,239 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo/v2"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/cacheutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/nosqlutil"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const (
+	revokedTokenSortKeyPrefix   = "REVOKED_TOKEN"
+	revokedSessionSortKeyPrefix = "REVOKED_SESSION"
+	tokensRevokedBeforeSortKey  = "TOKENS_REVOKED_BEFORE"
+)
+
+// dynamoRevocationRepo is the implementation of usecase.RevocationRepo interface using AWS DynamoDB. (adapter)
+// Revocations are stored under the user partition and deleted by DynamoDB TTL once the tokens are expired.
+type dynamoRevocationRepo struct {
+	ddb       *dynamo.DB
+	tableName string
+}
+
+func NewDynamoRevocationRepo(ddb *dynamo.DB, tableName string) usecase.RevocationRepo {
+	return &dynamoRevocationRepo{ddb: ddb, tableName: tableName}
+}
+
+// Revocation is an item revoking a token, a session or every token issued at or before RevokedUntil.
+type Revocation struct {
+	nosqlutil.CommonSchema
+
+	RevokedUntil time.Time `dynamo:"rb,omitempty"`
+	ExpiresAt    time.Time `dynamo:"ttl,unixtime"`
+}
+
+func revokedTokenSortKey(tokenID string) string {
+	return revokedTokenSortKeyPrefix + "#" + tokenID
+}
+
+func revokedSessionSortKey(sessionID uuid.UUID) string {
+	return revokedSessionSortKeyPrefix + "#" + sessionID.String()
+}
+
+func (drr *dynamoRevocationRepo) put(ctx context.Context, r *Revocation) error {
+	return drr.ddb.Table(drr.tableName).Put(r).Run(ctx)
+}
+
+func (drr *dynamoRevocationRepo) RevokeToken(ctx context.Context, userID uuid.UUID, tokenID string, expiresAt time.Time) error {
+	err := drr.put(ctx, &Revocation{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(userID),
+			SortKey:      revokedTokenSortKey(tokenID),
+		},
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("dynamoRevocationRepo.RevokeToken failed: %w", err)
+	}
+	return nil
+}
+
+func (drr *dynamoRevocationRepo) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID, expiresAt time.Time) error {
+	err := drr.put(ctx, &Revocation{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(userID),
+			SortKey:      revokedSessionSortKey(sessionID),
+		},
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("dynamoRevocationRepo.RevokeSession failed: %w", err)
+	}
+	return nil
+}
+
+func (drr *dynamoRevocationRepo) RevokeTokensIssuedUntil(
+	ctx context.Context, userID uuid.UUID, issuedUntil, expiresAt time.Time,
+) error {
+	err := drr.put(ctx, &Revocation{
+		CommonSchema: nosqlutil.CommonSchema{
+			PartitionKey: userPartitionKey(userID),
+			SortKey:      tokensRevokedBeforeSortKey,
+		},
+		RevokedUntil: issuedUntil,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("dynamoRevocationRepo.RevokeTokensIssuedUntil failed: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked gets every revocation which may apply to the token in a single batch request.
+func (drr *dynamoRevocationRepo) IsRevoked(ctx context.Context, claims *usecase.Claims) (bool, error) {
+	pk := userPartitionKey(claims.UserID)
+	keys := []dynamo.Keyed{
+		dynamo.Keys{pk, tokensRevokedBeforeSortKey},
+		dynamo.Keys{pk, revokedTokenSortKey(claims.ID)},
+	}
+	if claims.SessionID != uuid.Nil {
+		keys = append(keys, dynamo.Keys{pk, revokedSessionSortKey(claims.SessionID)})
+	}
+
+	var revocations []*Revocation
+	err := drr.ddb.Table(drr.tableName).Batch("pk", "sk").Get(keys...).All(ctx, &revocations)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("dynamoRevocationRepo.IsRevoked failed: %w", err)
+	}
+
+	now := time.Now()
+	for _, r := range revocations {
+		// TTL deletion is not immediate, so expired items may still be read.
+		if !now.Before(r.ExpiresAt) {
+			continue
+		}
+		if r.SortKey != tokensRevokedBeforeSortKey || !claims.IssuedAt.After(r.RevokedUntil) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (drr *dynamoRevocationRepo) RevokedUntil(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	var r Revocation
+	err := drr.ddb.Table(drr.tableName).
+		Get("pk", userPartitionKey(userID)).
+		Range("sk", dynamo.Equal, tokensRevokedBeforeSortKey).
+		One(ctx, &r)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("dynamoRevocationRepo.RevokedUntil failed: %w", err)
+	}
+	// TTL deletion is not immediate, so expired items may still be read.
+	if !time.Now().Before(r.ExpiresAt) {
+		return time.Time{}, nil
+	}
+	return r.RevokedUntil, nil
+}
+
+const (
+	revocationCacheSize = 100_000
+	// revocationCacheTTL bounds how long a revocation made by another server instance may go unnoticed.
+	revocationCacheTTL = 10 * time.Second
+)
+
+// cachedRevocationRepo caches lookups of another usecase.RevocationRepo in memory.
+// Revocations made by this instance are visible immediately, and the others after revocationCacheTTL at most.
+type cachedRevocationRepo struct {
+	repo usecase.RevocationRepo
+	// results caches whether a token is revoked, by token ID.
+	results         *cacheutil.TTLCache[string, bool]
+	revokedSessions *cacheutil.TTLCache[uuid.UUID, bool]
+	revokedUntil    *cacheutil.TTLCache[uuid.UUID, time.Time]
+	// lookedUpUntil caches RevokedUntil looked up, apart from revokedUntil so that a stale lookup can't replace
+	// a revocation made by this instance.
+	lookedUpUntil *cacheutil.TTLCache[uuid.UUID, time.Time]
+}
+
+func NewCachedRevocationRepo(repo usecase.RevocationRepo) usecase.RevocationRepo {
+	return &cachedRevocationRepo{
+		repo:            repo,
+		results:         cacheutil.NewTTLCache[string, bool](revocationCacheSize),
+		revokedSessions: cacheutil.NewTTLCache[uuid.UUID, bool](revocationCacheSize),
+		revokedUntil:    cacheutil.NewTTLCache[uuid.UUID, time.Time](revocationCacheSize),
+		lookedUpUntil:   cacheutil.NewTTLCache[uuid.UUID, time.Time](revocationCacheSize),
+	}
+}
+
+func (c *cachedRevocationRepo) RevokeToken(ctx context.Context, userID uuid.UUID, tokenID string, expiresAt time.Time) error {
+	if err := c.repo.RevokeToken(ctx, userID, tokenID, expiresAt); err != nil {
+		return err
+	}
+	c.results.Set(tokenID, true, time.Until(expiresAt))
+	return nil
+}
+
+func (c *cachedRevocationRepo) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID, expiresAt time.Time) error {
+	if err := c.repo.RevokeSession(ctx, userID, sessionID, expiresAt); err != nil {
+		return err
+	}
+	c.revokedSessions.Set(sessionID, true, time.Until(expiresAt))
+	return nil
+}
+
+func (c *cachedRevocationRepo) RevokeTokensIssuedUntil(
+	ctx context.Context, userID uuid.UUID, issuedUntil, expiresAt time.Time,
+) error {
+	if err := c.repo.RevokeTokensIssuedUntil(ctx, userID, issuedUntil, expiresAt); err != nil {
+		return err
+	}
+	c.revokedUntil.Set(userID, issuedUntil, time.Until(expiresAt))
+	return nil
+}
+
+func (c *cachedRevocationRepo) IsRevoked(ctx context.Context, claims *usecase.Claims) (bool, error) {
+	if _, ok := c.revokedSessions.Get(claims.SessionID); ok {
+		return true, nil
+	}
+	if revokedUntil, ok := c.revokedUntil.Get(claims.UserID); ok && !claims.IssuedAt.After(revokedUntil) {
+		return true, nil
+	}
+	if revoked, ok := c.results.Get(claims.ID); ok {
+		return revoked, nil
+	}
+
+	revoked, err := c.repo.IsRevoked(ctx, claims)
+	if err != nil {
+		return false, err
+	}
+	c.results.Set(claims.ID, revoked, revocationCacheTTL)
+	return revoked, nil
+}
+
+func (c *cachedRevocationRepo) RevokedUntil(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	if revokedUntil, ok := c.revokedUntil.Get(userID); ok {
+		return revokedUntil, nil
+	}
+	if revokedUntil, ok := c.lookedUpUntil.Get(userID); ok {
+		return revokedUntil, nil
+	}
+
+	revokedUntil, err := c.repo.RevokedUntil(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	c.lookedUpUntil.Set(userID, revokedUntil, revocationCacheTTL)
+	return revokedUntil, nil
+}
@@ -8,26 +8,54 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 
+	"github.com/buzzryan/zenbu/internal/commonutil/jwkutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
 	"github.com/buzzryan/zenbu/internal/user/usecase"
 )
 
 type jwsTokenManager struct {
-	signingKey string
+	keyring *Keyring
 }
 
 type jwsClaims struct {
 	jwt.RegisteredClaims
-	UserID string
+	UserID    string
+	SessionID string `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	// Confirmation binds the token to a DPoP key. (RFC 9449 Section 6.1)
+	Confirmation *confirmation `json:"cnf,omitempty"`
+	// AuthTime and AuthMethods are named as OpenID Connect Core 1.0 Section 2.
+	AuthTime    int64    `json:"auth_time,omitempty"`
+	AuthMethods []string `json:"amr,omitempty"`
+	// Actor is the admin impersonating the user. (RFC 8693 Section 4.1)
+	Actor *actor `json:"act,omitempty"`
 }
 
-func NewJWSTokenManager(signingKey string) usecase.TokenManager {
-	return &jwsTokenManager{signingKey: signingKey}
+type confirmation struct {
+	Thumbprint string `json:"jkt"`
+}
+
+type actor struct {
+	Subject string `json:"sub"`
+}
+
+// idTokenClaims are the claims of ID tokens, named as OpenID Connect Core 1.0 Section 2 and 5.1.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce,omitempty"`
+	AuthTime          int64  `json:"auth_time,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+func NewJWSTokenManager(keyring *Keyring) usecase.TokenManager {
+	return &jwsTokenManager{keyring: keyring}
 }
 
 func (j *jwsTokenManager) Parse(token string) (*usecase.Claims, error) {
-	t, err := jwt.ParseWithClaims(token, &jwsClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(j.signingKey), nil
-	})
+	t, err := jwt.ParseWithClaims(token, &jwsClaims{}, j.keyring.verificationKey)
 	if errors.Is(err, jwt.ErrTokenExpired) {
 		return nil, usecase.ErrTokenExpired
 	}
@@ -42,26 +70,136 @@ func (j *jwsTokenManager) Parse(token string) (*usecase.Claims, error) {
 
 	userID, err := uuid.Parse(claims.UserID)
 	if err != nil {
-		return nil, fmt.Errorf("user id is not a valid UUID: %w", err)
+		// e.g. an ID token, which is signed by the same key but is not an access token.
+		return nil, errors.Join(usecase.ErrInvalidToken, fmt.Errorf("user id is not a valid UUID: %w", err))
+	}
+	var sessionID uuid.UUID
+	if claims.SessionID != "" {
+		sessionID, err = uuid.Parse(claims.SessionID)
+		if err != nil {
+			return nil, fmt.Errorf("session id is not a valid UUID: %w", err)
+		}
+	}
+
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
 	}
+
+	var thumbprint string
+	if claims.Confirmation != nil {
+		thumbprint = claims.Confirmation.Thumbprint
+	}
+
+	var authTime time.Time
+	if claims.AuthTime != 0 {
+		authTime = time.Unix(claims.AuthTime, 0)
+	}
+
+	var actorID uuid.UUID
+	if claims.Actor != nil {
+		actorID, err = uuid.Parse(claims.Actor.Subject)
+		if err != nil {
+			return nil, errors.Join(usecase.ErrInvalidToken, fmt.Errorf("actor is not a valid UUID: %w", err))
+		}
+	}
+
 	return &usecase.Claims{
-		UserID:    userID,
-		ExpiresAt: claims.ExpiresAt.Time,
+		ID:          claims.ID,
+		UserID:      userID,
+		SessionID:   sessionID,
+		ClientID:    claims.ClientID,
+		Scopes:      domain.ParseScopes(claims.Scope),
+		Thumbprint:  thumbprint,
+		AuthTime:    authTime,
+		AuthMethods: domain.ParseAuthMethods(claims.AuthMethods),
+		ActorID:     actorID,
+		IssuedAt:    issuedAt,
+		ExpiresAt:   claims.ExpiresAt.Time,
 	}, nil
 }
 
 func (j *jwsTokenManager) Generate(claims *usecase.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwsClaims{
-		UserID: claims.UserID.String(),
+	var sessionID string
+	if claims.SessionID != uuid.Nil {
+		sessionID = claims.SessionID.String()
+	}
+
+	tokenID := claims.ID
+	if tokenID == "" {
+		tokenID = uuid.NewString()
+	}
+
+	now := time.Now()
+	issuedAt := claims.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = now
+	}
+
+	c := jwsClaims{
+		UserID:    claims.UserID.String(),
+		SessionID: sessionID,
+		ClientID:  claims.ClientID,
+		Scope:     domain.FormatScopes(claims.Scopes),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(claims.ExpiresAt),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ID:        tokenID,
+		}}
+	if claims.Thumbprint != "" {
+		c.Confirmation = &confirmation{Thumbprint: claims.Thumbprint}
+	}
+	if !claims.AuthTime.IsZero() {
+		c.AuthTime = claims.AuthTime.Unix()
+	}
+	if len(claims.AuthMethods) > 0 {
+		c.AuthMethods = domain.FormatAuthMethods(claims.AuthMethods)
+	}
+	if claims.ActorID != uuid.Nil {
+		c.Actor = &actor{Subject: claims.ActorID.String()}
+	}
+	return j.sign(c)
+}
+
+func (j *jwsTokenManager) GenerateIDToken(claims *usecase.IDTokenClaims) (string, error) {
+	now := time.Now()
+	c := idTokenClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    claims.Issuer,
+			Subject:   claims.Subject.String(),
+			Audience:  jwt.ClaimStrings{claims.Audience},
 			ExpiresAt: jwt.NewNumericDate(claims.ExpiresAt),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ID:        uuid.NewString(),
-		}})
-	signed, err := token.SignedString([]byte(j.signingKey))
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Nonce:             claims.Nonce,
+		Email:             claims.Email,
+		PreferredUsername: claims.Username,
+	}
+	if !claims.AuthTime.IsZero() {
+		c.AuthTime = claims.AuthTime.Unix()
+	}
+	if claims.Email != "" {
+		c.EmailVerified = &claims.EmailVerified
+	}
+	return j.sign(c)
+}
+
+// sign signs the claims with the active key, whose ID is given in the header so that verifiers can pick the key.
+func (j *jwsTokenManager) sign(claims jwt.Claims) (string, error) {
+	active := j.keyring.active
+	token := jwt.NewWithClaims(active.method, claims)
+	if active.id != "" {
+		token.Header["kid"] = active.id
+	}
+
+	signed, err := token.SignedString(active.signKey)
 	if err != nil {
 		return "", fmt.Errorf("unexpected error when generating JWS token: %w", err)
 	}
 	return signed, nil
 }
+
+func (j *jwsTokenManager) JWKS() (*jwkutil.Set, error) {
+	return j.keyring.jwks()
+}
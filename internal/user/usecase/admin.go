@@ -0,0 +1,292 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+const (
+	DefaultListUsersLimit = 20
+	MaxListUsersLimit     = 100
+)
+
+type ListUsersRes struct {
+	Users []*domain.User
+	// NextCursor is the cursor of the next page. It is empty on the last page.
+	NextCursor string
+}
+
+// ListUsersUC lists users ordered by username for operators.
+type ListUsersUC interface {
+	Execute(ctx context.Context, limit int, cursor string) (*ListUsersRes, error)
+}
+
+type listUsersUC struct {
+	userRepo UserRepo
+}
+
+func NewListUsersUC(userRepo UserRepo) ListUsersUC {
+	return &listUsersUC{userRepo: userRepo}
+}
+
+func (l *listUsersUC) Execute(ctx context.Context, limit int, cursor string) (*ListUsersRes, error) {
+	if limit <= 0 {
+		limit = DefaultListUsersLimit
+	}
+	limit = min(limit, MaxListUsersLimit)
+
+	users, next, err := l.userRepo.List(ctx, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+	return &ListUsersRes{Users: users, NextCursor: next}, nil
+}
+
+type GetUserUC interface {
+	Execute(ctx context.Context, userID uuid.UUID) (*domain.User, error)
+}
+
+type getUserUC struct {
+	userRepo UserRepo
+}
+
+func NewGetUserUC(userRepo UserRepo) GetUserUC {
+	return &getUserUC{userRepo: userRepo}
+}
+
+func (g *getUserUC) Execute(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	return g.userRepo.Get(ctx, userID)
+}
+
+// SetUserDisabledUC disables or enables a user.
+// Disabled users are logged out from every device, and can't log in until they are enabled again.
+type SetUserDisabledUC interface {
+	Execute(ctx context.Context, p *Principal, userID uuid.UUID, disabled bool) (*domain.User, error)
+}
+
+type setUserDisabledUC struct {
+	userRepo       UserRepo
+	sessionRepo    SessionRepo
+	revocationRepo RevocationRepo
+	apiKeyRepo     APIKeyRepo
+	auditLog       AuditLog
+}
+
+func NewSetUserDisabledUC(
+	userRepo UserRepo, sessionRepo SessionRepo, revocationRepo RevocationRepo, apiKeyRepo APIKeyRepo,
+	auditLog AuditLog,
+) SetUserDisabledUC {
+	return &setUserDisabledUC{
+		userRepo: userRepo, sessionRepo: sessionRepo, revocationRepo: revocationRepo, apiKeyRepo: apiKeyRepo,
+		auditLog: auditLog,
+	}
+}
+
+func (s *setUserDisabledUC) Execute(
+	ctx context.Context, p *Principal, userID uuid.UUID, disabled bool,
+) (*domain.User, error) {
+	u, err := s.userRepo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	prevUpdatedAt := u.UpdatedAt
+
+	if !disabled {
+		u.Enable()
+		if err := s.userRepo.Update(ctx, u, prevUpdatedAt); err != nil {
+			return nil, err
+		}
+		recordAudit(ctx, s.auditLog, domain.AuditUserEnabled, u.ID, actorOf(p, u.ID), nil)
+		return u, nil
+	}
+
+	u.Disable()
+	if err := s.userRepo.Update(ctx, u, prevUpdatedAt); err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, s.auditLog, domain.AuditUserDisabled, u.ID, actorOf(p, u.ID), nil)
+	if _, err := revokeAll(ctx, s.sessionRepo, s.revocationRepo, s.apiKeyRepo, u.ID); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// ForcePasswordResetUC logs the user out from every device and forbids login until the password is reset.
+// API keys of the user are deleted as well.
+type ForcePasswordResetUC interface {
+	Execute(ctx context.Context, p *Principal, userID uuid.UUID) error
+}
+
+type forcePasswordResetUC struct {
+	userRepo       UserRepo
+	sessionRepo    SessionRepo
+	revocationRepo RevocationRepo
+	apiKeyRepo     APIKeyRepo
+	auditLog       AuditLog
+}
+
+func NewForcePasswordResetUC(
+	userRepo UserRepo, sessionRepo SessionRepo, revocationRepo RevocationRepo, apiKeyRepo APIKeyRepo,
+	auditLog AuditLog,
+) ForcePasswordResetUC {
+	return &forcePasswordResetUC{
+		userRepo: userRepo, sessionRepo: sessionRepo, revocationRepo: revocationRepo, apiKeyRepo: apiKeyRepo,
+		auditLog: auditLog,
+	}
+}
+
+func (f *forcePasswordResetUC) Execute(ctx context.Context, p *Principal, userID uuid.UUID) error {
+	u, err := f.userRepo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	prevUpdatedAt := u.UpdatedAt
+	u.RequirePasswordReset()
+	if err := f.userRepo.Update(ctx, u, prevUpdatedAt); err != nil {
+		return err
+	}
+	recordAudit(ctx, f.auditLog, domain.AuditUserPasswordResetForced, u.ID, actorOf(p, u.ID), nil)
+	_, err = revokeAll(ctx, f.sessionRepo, f.revocationRepo, f.apiKeyRepo, u.ID)
+	return err
+}
+
+// RevokeUserTokensUC logs the user out from every device, and deletes the API keys of the user.
+type RevokeUserTokensUC interface {
+	Execute(ctx context.Context, p *Principal, userID uuid.UUID) error
+}
+
+type revokeUserTokensUC struct {
+	userRepo       UserRepo
+	sessionRepo    SessionRepo
+	revocationRepo RevocationRepo
+	apiKeyRepo     APIKeyRepo
+	auditLog       AuditLog
+}
+
+func NewRevokeUserTokensUC(
+	userRepo UserRepo, sessionRepo SessionRepo, revocationRepo RevocationRepo, apiKeyRepo APIKeyRepo,
+	auditLog AuditLog,
+) RevokeUserTokensUC {
+	return &revokeUserTokensUC{
+		userRepo: userRepo, sessionRepo: sessionRepo, revocationRepo: revocationRepo, apiKeyRepo: apiKeyRepo,
+		auditLog: auditLog,
+	}
+}
+
+func (r *revokeUserTokensUC) Execute(ctx context.Context, p *Principal, userID uuid.UUID) error {
+	if _, err := r.userRepo.Get(ctx, userID); err != nil {
+		return err
+	}
+	if _, err := revokeAll(ctx, r.sessionRepo, r.revocationRepo, r.apiKeyRepo, userID); err != nil {
+		return err
+	}
+	recordAudit(ctx, r.auditLog, domain.AuditUserTokensRevoked, userID, actorOf(p, userID), nil)
+	return nil
+}
+
+type ChangeUsernameUC interface {
+	Execute(ctx context.Context, p *Principal, userID uuid.UUID, username string) (*domain.User, error)
+}
+
+type changeUsernameUC struct {
+	userRepo UserRepo
+	auditLog AuditLog
+}
+
+func NewChangeUsernameUC(userRepo UserRepo, auditLog AuditLog) ChangeUsernameUC {
+	return &changeUsernameUC{userRepo: userRepo, auditLog: auditLog}
+}
+
+func (c *changeUsernameUC) Execute(
+	ctx context.Context, p *Principal, userID uuid.UUID, username string,
+) (*domain.User, error) {
+	u, err := c.userRepo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Username == username {
+		return u, nil
+	}
+
+	prevUsername := u.Username
+	if err := c.userRepo.ChangeUsername(ctx, u, username); err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, c.auditLog, domain.AuditUserUsernameChanged, u.ID, actorOf(p, u.ID),
+		map[string]string{"from": prevUsername, "to": username})
+	return u, nil
+}
+
+// DeleteUserUC deletes the user and logs the user out from every device.
+type DeleteUserUC interface {
+	Execute(ctx context.Context, p *Principal, userID uuid.UUID) error
+}
+
+type deleteUserUC struct {
+	userRepo       UserRepo
+	sessionRepo    SessionRepo
+	revocationRepo RevocationRepo
+	apiKeyRepo     APIKeyRepo
+	auditLog       AuditLog
+}
+
+func NewDeleteUserUC(
+	userRepo UserRepo, sessionRepo SessionRepo, revocationRepo RevocationRepo, apiKeyRepo APIKeyRepo,
+	auditLog AuditLog,
+) DeleteUserUC {
+	return &deleteUserUC{
+		userRepo: userRepo, sessionRepo: sessionRepo, revocationRepo: revocationRepo, apiKeyRepo: apiKeyRepo,
+		auditLog: auditLog,
+	}
+}
+
+// Execute deletes the user as the principal, who is either an admin or the user.
+// Audit events of the user are kept after the deletion until they expire.
+func (d *deleteUserUC) Execute(ctx context.Context, p *Principal, userID uuid.UUID) error {
+	u, err := d.userRepo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// tokens are revoked first, so that a failure can't leave a deleted user logged in.
+	if _, err := revokeAll(ctx, d.sessionRepo, d.revocationRepo, d.apiKeyRepo, u.ID); err != nil {
+		return err
+	}
+	if err := d.userRepo.Delete(ctx, u); err != nil {
+		return err
+	}
+	recordAudit(ctx, d.auditLog, domain.AuditUserDeleted, u.ID, actorOf(p, u.ID),
+		map[string]string{"username": u.Username})
+	return nil
+}
+
+// DeleteAccountUC deletes the account of the user, who must have authenticated recently.
+type DeleteAccountUC interface {
+	Execute(ctx context.Context, p *Principal) error
+}
+
+type deleteAccountUC struct {
+	deleteUser DeleteUserUC
+}
+
+func NewDeleteAccountUC(
+	userRepo UserRepo, sessionRepo SessionRepo, revocationRepo RevocationRepo, apiKeyRepo APIKeyRepo,
+	auditLog AuditLog,
+) DeleteAccountUC {
+	return &deleteAccountUC{deleteUser: NewDeleteUserUC(userRepo, sessionRepo, revocationRepo, apiKeyRepo, auditLog)}
+}
+
+func (d *deleteAccountUC) Execute(ctx context.Context, p *Principal) error {
+	if !p.IsFirstParty() {
+		return fmt.Errorf("%w: the account can only be deleted by the user logged in", ErrPermissionDenied)
+	}
+	if err := p.RequireRecentAuth(RecentAuthMaxAge); err != nil {
+		return err
+	}
+	return d.deleteUser.Execute(ctx, p, p.UserID)
+}
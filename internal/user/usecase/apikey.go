@@ -0,0 +1,127 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+const (
+	DefaultAPIKeyExpiresIn = 30 * 24 * time.Hour
+	MaxAPIKeyExpiresIn     = 365 * 24 * time.Hour
+	MaxAPIKeysPerUser      = 20
+)
+
+type CreateAPIKeyReq struct {
+	Name   string
+	Scopes []domain.Scope
+	// ExpiresIn is DefaultAPIKeyExpiresIn if zero, and at most MaxAPIKeyExpiresIn.
+	ExpiresIn time.Duration
+}
+
+type CreateAPIKeyRes struct {
+	APIKey *domain.APIKey
+	// Key is shown to the user only once, as only its hash is stored.
+	Key string
+}
+
+// CreateAPIKeyUC creates an API key for scripts and integrations of the user.
+// It must be created by the user logged in, so that a leaked key can't be used to create more keys.
+type CreateAPIKeyUC interface {
+	Execute(ctx context.Context, p *Principal, req *CreateAPIKeyReq) (*CreateAPIKeyRes, error)
+}
+
+type createAPIKeyUC struct {
+	userRepo   UserRepo
+	apiKeyRepo APIKeyRepo
+}
+
+func NewCreateAPIKeyUC(userRepo UserRepo, apiKeyRepo APIKeyRepo) CreateAPIKeyUC {
+	return &createAPIKeyUC{userRepo: userRepo, apiKeyRepo: apiKeyRepo}
+}
+
+func (c *createAPIKeyUC) Execute(ctx context.Context, p *Principal, req *CreateAPIKeyReq) (*CreateAPIKeyRes, error) {
+	if !p.IsFirstParty() {
+		return nil, fmt.Errorf("%w: api keys can only be created by the user logged in", ErrPermissionDenied)
+	}
+	if err := p.RequireRecentAuth(RecentAuthMaxAge); err != nil {
+		return nil, err
+	}
+
+	expiresIn := req.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = DefaultAPIKeyExpiresIn
+	}
+	expiresIn = min(expiresIn, MaxAPIKeyExpiresIn)
+
+	u, err := c.userRepo.Get(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := rejectGuest(u, "create an api key"); err != nil {
+		return nil, err
+	}
+	userScopes := u.Scopes()
+	for _, s := range req.Scopes {
+		if !slices.Contains(userScopes, s) {
+			return nil, fmt.Errorf("%w: %s scope is not granted to the user", ErrPermissionDenied, s)
+		}
+	}
+
+	keys, err := c.apiKeyRepo.List(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) >= MaxAPIKeysPerUser {
+		return nil, ErrTooManyAPIKeys
+	}
+
+	k, key, err := domain.NewAPIKey(u.ID, req.Name, req.Scopes, expiresIn)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.apiKeyRepo.Create(ctx, k); err != nil {
+		return nil, err
+	}
+	return &CreateAPIKeyRes{APIKey: k, Key: key}, nil
+}
+
+// ListAPIKeysUC lists the API keys of the user. The keys themselves are never shown again.
+type ListAPIKeysUC interface {
+	Execute(ctx context.Context, p *Principal) ([]*domain.APIKey, error)
+}
+
+type listAPIKeysUC struct {
+	apiKeyRepo APIKeyRepo
+}
+
+func NewListAPIKeysUC(apiKeyRepo APIKeyRepo) ListAPIKeysUC {
+	return &listAPIKeysUC{apiKeyRepo: apiKeyRepo}
+}
+
+func (l *listAPIKeysUC) Execute(ctx context.Context, p *Principal) ([]*domain.APIKey, error) {
+	return l.apiKeyRepo.List(ctx, p.UserID)
+}
+
+// RevokeAPIKeyUC revokes an API key of the user. It is rejected by the next request made with it.
+type RevokeAPIKeyUC interface {
+	Execute(ctx context.Context, p *Principal, id uuid.UUID) error
+}
+
+type revokeAPIKeyUC struct {
+	apiKeyRepo APIKeyRepo
+}
+
+func NewRevokeAPIKeyUC(apiKeyRepo APIKeyRepo) RevokeAPIKeyUC {
+	return &revokeAPIKeyUC{apiKeyRepo: apiKeyRepo}
+}
+
+func (r *revokeAPIKeyUC) Execute(ctx context.Context, p *Principal, id uuid.UUID) error {
+	// keys are looked up under the user partition, so a user can never revoke keys of others.
+	return r.apiKeyRepo.Delete(ctx, p.UserID, id)
+}
@@ -0,0 +1,110 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+const (
+	DefaultListAuditEventsLimit = 20
+	MaxListAuditEventsLimit     = 100
+)
+
+// newAuditEvent makes an event carrying the correlation ID of the request it occurred in.
+func newAuditEvent(
+	ctx context.Context, typ domain.AuditEventType, userID, actorID uuid.UUID, details map[string]string,
+) *domain.AuditEvent {
+	e := domain.NewAuditEvent(typ, userID, actorID, details)
+	e.CorrelationID = logutil.CorrelationIDFrom(ctx)
+	return e
+}
+
+// recordAudit records the event of what was already done, which is not undone if it fails to be recorded.
+// So the failure is logged instead of being returned.
+func recordAudit(
+	ctx context.Context, auditLog AuditLog, typ domain.AuditEventType, userID, actorID uuid.UUID,
+	details map[string]string,
+) {
+	err := auditLog.Record(ctx, newAuditEvent(ctx, typ, userID, actorID, details))
+	if err != nil {
+		logutil.From(ctx).Error("failed to record audit event",
+			slog.String("type", string(typ)), slog.Any("err", err))
+	}
+}
+
+// actorOf returns who acted on the user by the principal: the admin impersonating the user,
+// or the principal unless it is the user.
+func actorOf(p *Principal, userID uuid.UUID) uuid.UUID {
+	if p.IsImpersonated() {
+		return p.ActorID
+	}
+	if p.UserID == userID {
+		return uuid.Nil
+	}
+	return p.UserID
+}
+
+type ListAuditEventsRes struct {
+	Events []*domain.AuditEvent
+	// NextCursor is the cursor of the next page. It is empty on the last page.
+	NextCursor string
+}
+
+func listAuditEvents(ctx context.Context, auditEventRepo AuditEventRepo, q *AuditEventQuery) (*ListAuditEventsRes, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultListAuditEventsLimit
+	}
+	q.Limit = min(q.Limit, MaxListAuditEventsLimit)
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+
+	events, next, err := auditEventRepo.List(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return &ListAuditEventsRes{Events: events, NextCursor: next}, nil
+}
+
+// ListActivityUC lists the audit events of the user, newest first, for the user to review.
+type ListActivityUC interface {
+	Execute(ctx context.Context, p *Principal, limit int, cursor string) (*ListAuditEventsRes, error)
+}
+
+type listActivityUC struct {
+	auditEventRepo AuditEventRepo
+}
+
+func NewListActivityUC(auditEventRepo AuditEventRepo) ListActivityUC {
+	return &listActivityUC{auditEventRepo: auditEventRepo}
+}
+
+func (l *listActivityUC) Execute(
+	ctx context.Context, p *Principal, limit int, cursor string,
+) (*ListAuditEventsRes, error) {
+	return listAuditEvents(ctx, l.auditEventRepo, &AuditEventQuery{UserID: p.UserID, Limit: limit, Cursor: cursor})
+}
+
+// ListAuditEventsUC lists audit events matching the query, newest first, for operators.
+// Without a user, events of all users are listed a day at a time, of the day of the end of the range.
+type ListAuditEventsUC interface {
+	Execute(ctx context.Context, q *AuditEventQuery) (*ListAuditEventsRes, error)
+}
+
+type listAuditEventsUC struct {
+	auditEventRepo AuditEventRepo
+}
+
+func NewListAuditEventsUC(auditEventRepo AuditEventRepo) ListAuditEventsUC {
+	return &listAuditEventsUC{auditEventRepo: auditEventRepo}
+}
+
+func (l *listAuditEventsUC) Execute(ctx context.Context, q *AuditEventQuery) (*ListAuditEventsRes, error) {
+	return listAuditEvents(ctx, l.auditEventRepo, q)
+}
@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/dpoputil"
+)
+
+// DPoPProofReq is a DPoP proof with the request it was sent with. (RFC 9449)
+type DPoPProofReq struct {
+	Proof  string
+	Method string
+	// URL is the URL the request was sent to, as seen by the client.
+	URL string
+}
+
+// verifyDPoPProof verifies the proof for the request and returns the thumbprint of its key.
+// accessToken is given if the proof is sent with an access token, which the proof must be bound to.
+func verifyDPoPProof(ctx context.Context, replayRepo DPoPReplayRepo, req *DPoPProofReq, accessToken string) (string, error) {
+	proof, err := dpoputil.Parse(req.Proof)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidDPoPProof, err)
+	}
+	if err := proof.Verify(req.Method, req.URL, accessToken, time.Now()); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidDPoPProof, err)
+	}
+
+	// a proof is used only once. It is remembered until it is too old to be accepted anyway.
+	// IDs are unique to each key only, so that a client can't make proofs of others rejected.
+	err = replayRepo.Use(ctx, proof.Thumbprint+"."+proof.ID, proof.ExpiresAt())
+	if errors.Is(err, ErrDPoPProofReplayed) {
+		return "", fmt.Errorf("%w: %w", ErrInvalidDPoPProof, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return proof.Thumbprint, nil
+}
@@ -0,0 +1,310 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/mailutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+const EmailVerificationExpiresIn = 24 * time.Hour
+
+const (
+	// MaxEmailVerificationMails is how many verification mails a user can request in EmailVerificationMailWindow.
+	// Each mail allows MaxEmailVerificationAttempts more guesses of a code, so mails are limited as well.
+	MaxEmailVerificationMails   = 5
+	EmailVerificationMailWindow = time.Hour
+)
+
+// verificationMailAttemptKey counts verification mails requested by the user, by LoginAttemptRepo.
+func verificationMailAttemptKey(userID uuid.UUID) string {
+	return "verification_mail:" + userID.String()
+}
+
+// emailVerifier sends email verification mails and completes verifications.
+type emailVerifier struct {
+	userRepo         UserRepo
+	verificationRepo EmailVerificationRepo
+	// mailLimit counts mails requested by users. It is nil where mails are not requested by users, e.g. signup.
+	mailLimit LoginAttemptRepo
+	mailer    mailutil.Mailer
+	// appBaseURL is the URL of the web app, which handles the link in the mail.
+	appBaseURL string
+}
+
+// reserveMail counts a mail requested by the user, or returns ErrTooManyVerificationMails over the limit.
+func (e *emailVerifier) reserveMail(ctx context.Context, userID uuid.UUID) error {
+	_, ok, err := e.mailLimit.Reserve(
+		ctx, verificationMailAttemptKey(userID), MaxEmailVerificationMails, EmailVerificationMailWindow,
+	)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTooManyVerificationMails
+	}
+	return nil
+}
+
+func (e *emailVerifier) send(ctx context.Context, u *domain.User) error {
+	if u.Email == "" {
+		return ErrEmailNotSet
+	}
+	if u.IsEmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+
+	v, token, code, err := domain.NewEmailVerification(u.ID, u.Email, EmailVerificationExpiresIn)
+	if err != nil {
+		return err
+	}
+	if err := e.verificationRepo.Save(ctx, v); err != nil {
+		return err
+	}
+
+	link := e.appBaseURL + "/verify-email?token=" + url.QueryEscape(token)
+	return e.mailer.Send(ctx, &mailutil.Mail{
+		To:      u.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Open the link below to verify your email address.\n%s\n\n"+
+			"Or enter this code: %s\n\n"+
+			"The link and the code expire in %s. If you didn't request this, ignore this mail.\n",
+			u.Username, link, code, EmailVerificationExpiresIn),
+	})
+}
+
+// complete marks the email address verified. The verification can be used only once.
+func (e *emailVerifier) complete(ctx context.Context, v *domain.EmailVerification) error {
+	if err := e.verificationRepo.Consume(ctx, v); err != nil {
+		if errors.Is(err, ErrEmailVerificationNotFound) {
+			return ErrInvalidEmailVerification
+		}
+		return err
+	}
+
+	// the address may have been changed after the mail was sent.
+	_, err := verifyEmailOf(ctx, e.userRepo, v.UserID, v.Email, ErrInvalidEmailVerification)
+	return err
+}
+
+// updateUserRetries bounds how many times updateUser reads the user again on concurrent updates.
+const updateUserRetries = 3
+
+// updateUser applies change to the user and stores it. If the user was updated concurrently,
+// the user is read again and change is applied to it, so that neither update is lost.
+// It is called after a token is consumed, which the client can't retry.
+func updateUser(
+	ctx context.Context, userRepo UserRepo, userID uuid.UUID, change func(u *domain.User) error,
+) (*domain.User, error) {
+	for i := 0; ; i++ {
+		u, err := userRepo.Get(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		prevUpdatedAt := u.UpdatedAt
+		if err := change(u); err != nil {
+			return nil, err
+		}
+		err = userRepo.Update(ctx, u, prevUpdatedAt)
+		if errors.Is(err, ErrUserUpdated) && i < updateUserRetries {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return u, nil
+	}
+}
+
+// verifyEmailOf marks the address of the user verified if it is still the address of the user, or returns invalid.
+func verifyEmailOf(
+	ctx context.Context, userRepo UserRepo, userID uuid.UUID, email string, invalid error,
+) (*domain.User, error) {
+	return updateUser(ctx, userRepo, userID, func(u *domain.User) error {
+		if u.Email != email {
+			return invalid
+		}
+		u.VerifyEmail()
+		return nil
+	})
+}
+
+// ChangeEmailUC sets the email address of the user and sends a verification mail to it.
+// Guests give their address by signing up instead, as it would not be released when they are expired.
+type ChangeEmailUC interface {
+	Execute(ctx context.Context, p *Principal, email string) (*domain.User, error)
+}
+
+type changeEmailUC struct {
+	userRepo UserRepo
+	verifier *emailVerifier
+}
+
+func NewChangeEmailUC(
+	userRepo UserRepo, verificationRepo EmailVerificationRepo, loginAttemptRepo LoginAttemptRepo,
+	mailer mailutil.Mailer, appBaseURL string,
+) ChangeEmailUC {
+	return &changeEmailUC{
+		userRepo: userRepo,
+		verifier: &emailVerifier{
+			userRepo: userRepo, verificationRepo: verificationRepo, mailLimit: loginAttemptRepo, mailer: mailer,
+			appBaseURL: appBaseURL,
+		},
+	}
+}
+
+func (c *changeEmailUC) Execute(ctx context.Context, p *Principal, email string) (*domain.User, error) {
+	email = domain.NormalizeEmail(email)
+
+	u, err := c.userRepo.Get(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := rejectGuest(u, "set the email address"); err != nil {
+		return nil, err
+	}
+	if u.Email == email {
+		return u, nil
+	}
+
+	// a new address gets a new verification, so changing back and forth must not allow more guesses of a code.
+	if err := c.verifier.reserveMail(ctx, u.ID); err != nil {
+		return nil, err
+	}
+	if err := c.userRepo.ChangeEmail(ctx, u, email); err != nil {
+		return nil, err
+	}
+	if err := c.verifier.send(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// SendEmailVerificationUC sends a verification mail to the email address of the user again.
+// The verification sent before can't be used anymore. Only MaxEmailVerificationMails can be sent in a window.
+type SendEmailVerificationUC interface {
+	Execute(ctx context.Context, p *Principal) error
+}
+
+type sendEmailVerificationUC struct {
+	userRepo UserRepo
+	verifier *emailVerifier
+}
+
+func NewSendEmailVerificationUC(
+	userRepo UserRepo, verificationRepo EmailVerificationRepo, loginAttemptRepo LoginAttemptRepo,
+	mailer mailutil.Mailer, appBaseURL string,
+) SendEmailVerificationUC {
+	return &sendEmailVerificationUC{
+		userRepo: userRepo,
+		verifier: &emailVerifier{
+			userRepo: userRepo, verificationRepo: verificationRepo, mailLimit: loginAttemptRepo, mailer: mailer,
+			appBaseURL: appBaseURL,
+		},
+	}
+}
+
+func (s *sendEmailVerificationUC) Execute(ctx context.Context, p *Principal) error {
+	u, err := s.userRepo.Get(ctx, p.UserID)
+	if err != nil {
+		return err
+	}
+	if u.Email == "" {
+		return ErrEmailNotSet
+	}
+	if u.IsEmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+	if err := s.verifier.reserveMail(ctx, u.ID); err != nil {
+		return err
+	}
+	return s.verifier.send(ctx, u)
+}
+
+// VerifyEmailUC verifies the email address by the token in the link of the verification mail.
+// It needs no authentication, as the link may be opened on another device.
+type VerifyEmailUC interface {
+	Execute(ctx context.Context, token string) error
+}
+
+type verifyEmailUC struct {
+	verificationRepo EmailVerificationRepo
+	verifier         *emailVerifier
+}
+
+func NewVerifyEmailUC(userRepo UserRepo, verificationRepo EmailVerificationRepo) VerifyEmailUC {
+	return &verifyEmailUC{
+		verificationRepo: verificationRepo,
+		verifier:         &emailVerifier{userRepo: userRepo, verificationRepo: verificationRepo},
+	}
+}
+
+func (v *verifyEmailUC) Execute(ctx context.Context, token string) error {
+	userID, hash, err := domain.ParseEmailVerificationToken(token)
+	if err != nil {
+		return ErrInvalidEmailVerification
+	}
+
+	verification, err := v.verificationRepo.Get(ctx, userID)
+	if errors.Is(err, ErrEmailVerificationNotFound) {
+		return ErrInvalidEmailVerification
+	}
+	if err != nil {
+		return err
+	}
+	if !verification.MatchesToken(hash) {
+		return ErrInvalidEmailVerification
+	}
+
+	return v.verifier.complete(ctx, verification)
+}
+
+// VerifyEmailCodeUC verifies the email address by the code in the verification mail.
+// Codes are short, so only a few attempts are allowed per mail.
+type VerifyEmailCodeUC interface {
+	Execute(ctx context.Context, p *Principal, code string) error
+}
+
+type verifyEmailCodeUC struct {
+	verificationRepo EmailVerificationRepo
+	verifier         *emailVerifier
+}
+
+func NewVerifyEmailCodeUC(userRepo UserRepo, verificationRepo EmailVerificationRepo) VerifyEmailCodeUC {
+	return &verifyEmailCodeUC{
+		verificationRepo: verificationRepo,
+		verifier:         &emailVerifier{userRepo: userRepo, verificationRepo: verificationRepo},
+	}
+}
+
+func (v *verifyEmailCodeUC) Execute(ctx context.Context, p *Principal, code string) error {
+	verification, err := v.verificationRepo.Get(ctx, p.UserID)
+	if errors.Is(err, ErrEmailVerificationNotFound) {
+		return ErrInvalidEmailVerification
+	}
+	if err != nil {
+		return err
+	}
+
+	// the attempt is counted before the code is compared, so that parallel guesses can't exceed the limit.
+	err = v.verificationRepo.CountAttempt(ctx, verification, domain.MaxEmailVerificationAttempts)
+	if errors.Is(err, ErrEmailVerificationNotFound) {
+		return ErrInvalidEmailVerification
+	}
+	if err != nil {
+		return err
+	}
+	if !verification.MatchesCode(code) {
+		return ErrInvalidEmailVerification
+	}
+
+	return v.verifier.complete(ctx, verification)
+}
@@ -6,4 +6,66 @@ var (
 	ErrUsernameAlreadyExists = errors.New("user with this username already exists")
 	ErrUserNotFound          = errors.New("user not found")
 	ErrInvalidPassword       = errors.New("invalid password")
+	ErrSessionNotFound       = errors.New("session not found")
+	ErrInvalidRefreshToken   = errors.New("invalid refresh token")
+	ErrRefreshTokenReused    = errors.New("refresh token reused")
+	ErrPermissionDenied      = errors.New("permission denied")
+	ErrUserDisabled          = errors.New("user disabled")
+	ErrPasswordResetRequired = errors.New("password reset required")
+	ErrInvalidCursor         = errors.New("invalid cursor")
+	ErrLoginLocked           = errors.New("too many failed login attempts")
+	ErrPasswordChanged       = errors.New("password changed concurrently")
+	ErrUserUpdated           = errors.New("user updated concurrently")
+
+	ErrReauthenticationRequired = errors.New("reauthentication required")
+	ErrImpersonationForbidden   = errors.New("forbidden while impersonating")
+
+	ErrEmailAlreadyExists          = errors.New("user with this email already exists")
+	ErrEmailNotSet                 = errors.New("email not set")
+	ErrEmailAlreadyVerified        = errors.New("email already verified")
+	ErrEmailVerificationNotFound   = errors.New("email verification not found")
+	ErrInvalidEmailVerification    = errors.New("invalid email verification")
+	ErrTooManyVerificationAttempts = errors.New("too many verification attempts")
+	ErrTooManyVerificationMails    = errors.New("too many verification mails")
+
+	ErrPasswordResetNotFound = errors.New("password reset not found")
+	ErrInvalidPasswordReset  = errors.New("invalid password reset")
+
+	ErrMagicLinkNotFound     = errors.New("magic link not found")
+	ErrInvalidMagicLink      = errors.New("invalid magic link")
+	ErrTooManyMagicLinkMails = errors.New("too many magic link mails")
+
+	ErrMFANotFound          = errors.New("mfa not found")
+	ErrMFAAlreadyEnabled    = errors.New("mfa already enabled")
+	ErrMFANotEnabled        = errors.New("mfa not enabled")
+	ErrInvalidMFACode       = errors.New("invalid mfa code")
+	ErrMFAChallengeNotFound = errors.New("mfa challenge not found")
+	ErrInvalidMFAChallenge  = errors.New("invalid mfa challenge")
+
+	ErrPasskeyAlreadyExists     = errors.New("passkey already exists")
+	ErrPasskeyNotFound          = errors.New("passkey not found")
+	ErrPasskeyCloned            = errors.New("passkey may be cloned")
+	ErrWebAuthnCeremonyNotFound = errors.New("webauthn ceremony not found")
+	ErrInvalidWebAuthnResponse  = errors.New("invalid webauthn response")
+	ErrTooManyPasskeys          = errors.New("too many passkeys")
+
+	ErrUnknownIdentityProvider = errors.New("unknown identity provider")
+	ErrOIDCAuthRequestNotFound = errors.New("oidc authorization request not found")
+	ErrInvalidOIDCCallback     = errors.New("invalid oidc callback")
+	ErrIdentityAlreadyLinked   = errors.New("identity already linked")
+	ErrIdentityNotFound        = errors.New("identity not found")
+	ErrIdentityNotLinked       = errors.New("identity not linked to the user with this email")
+	ErrLastLoginMethod         = errors.New("last login method can't be removed")
+
+	ErrOAuthClientNotFound       = errors.New("oauth client not found")
+	ErrInvalidClientMetadata     = errors.New("invalid client metadata")
+	ErrInvalidAuthorization      = errors.New("invalid authorization request")
+	ErrConsentNotFound           = errors.New("consent not found")
+	ErrAuthorizationCodeNotFound = errors.New("authorization code not found")
+
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrTooManyAPIKeys = errors.New("too many api keys")
+
+	ErrInvalidDPoPProof  = errors.New("invalid dpop proof")
+	ErrDPoPProofReplayed = errors.New("dpop proof replayed")
 )
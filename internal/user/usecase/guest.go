@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+// GuestExpiresIn is how long a guest is kept after it was last used. Guests have no credentials to log in by,
+// so they are expired a day after their sessions, whose expiry is extended on every refresh while that of
+// the guest is extended only once a day.
+const GuestExpiresIn = SessionExpiresIn + time.Hour*24
+
+// guestUsernamePrefix is of the usernames generated for guests, e.g. "guest_1b4e28ba".
+const guestUsernamePrefix = "guest"
+
+// CreateGuestUC creates a guest user without credentials, and starts a session of it.
+// Guests use the API as other users do, except adding credentials or consents, and sign up later by BasicSignupUC
+// or FinishOIDCLoginUC to keep their data. Guests not used for GuestExpiresIn are deleted.
+type CreateGuestUC interface {
+	Execute(ctx context.Context, device *domain.Device) (*TokenPair, error)
+}
+
+type createGuestUC struct {
+	userRepo UserRepo
+	issuer   *sessionIssuer
+}
+
+func NewCreateGuestUC(userRepo UserRepo, sessionRepo SessionRepo, manager TokenManager) CreateGuestUC {
+	return &createGuestUC{
+		userRepo: userRepo,
+		issuer:   &sessionIssuer{sessionRepo: sessionRepo, tokenManager: manager},
+	}
+}
+
+func (c *createGuestUC) Execute(ctx context.Context, device *domain.Device) (*TokenPair, error) {
+	var (
+		u   *domain.User
+		err error
+	)
+	for range maxSignupUsernameAttempts {
+		u, err = c.userRepo.Create(ctx, domain.NewGuest(signupUsername(guestUsernamePrefix), GuestExpiresIn))
+		if !errors.Is(err, ErrUsernameAlreadyExists) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the guest authenticated by no method.
+	return c.issuer.start(ctx, u, device)
+}
+
+// guestOf returns the user of the principal if it is a guest logged in to zenbu itself, or nil otherwise.
+func guestOf(ctx context.Context, userRepo UserRepo, p *Principal) (*domain.User, error) {
+	if p == nil || !p.IsFirstParty() {
+		return nil, nil
+	}
+	u, err := userRepo.Get(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsGuest() {
+		return nil, nil
+	}
+	return u, nil
+}
+
+// rejectGuest denies a guest what would outlive it. Only the guest and its username are deleted when it expires,
+// so it must sign up before registering credentials or authorizing clients.
+func rejectGuest(u *domain.User, action string) error {
+	if u.IsGuest() {
+		return fmt.Errorf("%w: guests must sign up to %s", ErrPermissionDenied, action)
+	}
+	return nil
+}
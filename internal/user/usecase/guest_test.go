@@ -0,0 +1,61 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/webauthnutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+func TestGuest_CannotAddCredentials(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUserRepo()
+	guest, err := users.Create(ctx, domain.NewGuest("guest_test", usecase.GuestExpiresIn))
+	if err != nil {
+		t.Fatalf("failed to create guest: %v", err)
+	}
+	p := &usecase.Principal{UserID: guest.ID, AuthTime: time.Now()}
+	rp := &webauthnutil.RelyingParty{ID: "zenbu.example.com", Origins: []string{passkeyTestOrigin}}
+
+	tests := []struct {
+		name string
+		add  func() error
+	}{
+		{
+			name: "passkey",
+			add: func() error {
+				uc := usecase.NewBeginPasskeyRegistrationUC(
+					users, newMemPasskeyRepo(), newMemWebAuthnCeremonyRepo(), rp, "zenbu",
+				)
+				_, err := uc.Execute(ctx, p)
+				return err
+			},
+		},
+		{
+			name: "totp",
+			add: func() error {
+				_, err := usecase.NewEnrollTOTPUC(users, noMFARepo{}, "zenbu").Execute(ctx, p)
+				return err
+			},
+		},
+		{
+			name: "api key",
+			add: func() error {
+				uc := usecase.NewCreateAPIKeyUC(users, newMemAPIKeyRepo())
+				_, err := uc.Execute(ctx, p, &usecase.CreateAPIKeyReq{Name: "ci"})
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.add(); !errors.Is(err, usecase.ErrPermissionDenied) {
+				t.Errorf("got %v, want %v", err, usecase.ErrPermissionDenied)
+			}
+		})
+	}
+}
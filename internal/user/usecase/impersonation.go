@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+// ImpersonationExpiresIn is how long an admin may act as the user by a token. It is never refreshed.
+const ImpersonationExpiresIn = time.Minute * 15
+
+type ImpersonateReq struct {
+	UserID uuid.UUID
+	// Reason is why the admin acts as the user, e.g. the support ticket, which is kept in the audit log.
+	Reason string
+}
+
+type ImpersonateRes struct {
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+// ImpersonateUC issues an admin an access token acting as the user, for support to reproduce problems of the user.
+// The token carries both the user and the admin, and is bound to no session, so it can't be refreshed.
+// Sensitive operations are forbidden with it, and every request with it is recorded in the audit log.
+type ImpersonateUC interface {
+	Execute(ctx context.Context, p *Principal, req *ImpersonateReq) (*ImpersonateRes, error)
+}
+
+type impersonateUC struct {
+	userRepo     UserRepo
+	tokenManager TokenManager
+	auditLog     AuditLog
+}
+
+func NewImpersonateUC(userRepo UserRepo, tokenManager TokenManager, auditLog AuditLog) ImpersonateUC {
+	return &impersonateUC{userRepo: userRepo, tokenManager: tokenManager, auditLog: auditLog}
+}
+
+func (i *impersonateUC) Execute(ctx context.Context, p *Principal, req *ImpersonateReq) (*ImpersonateRes, error) {
+	if !p.IsFirstParty() || p.IsImpersonated() {
+		return nil, fmt.Errorf("%w: only the admin logged in can impersonate users", ErrPermissionDenied)
+	}
+	if req.UserID == p.UserID {
+		return nil, fmt.Errorf("%w: admins can't impersonate themselves", ErrPermissionDenied)
+	}
+
+	u, err := i.userRepo.Get(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// the token is granted the scopes of the user, which must not make an admin of whom impersonates.
+	if u.HasRole(domain.RoleAdmin) {
+		return nil, fmt.Errorf("%w: admins can't be impersonated", ErrPermissionDenied)
+	}
+	if u.IsDisabled() {
+		return nil, ErrUserDisabled
+	}
+
+	// the token is issued only if the impersonation is recorded.
+	err = i.auditLog.Record(ctx, newAuditEvent(ctx, domain.AuditImpersonationStarted, u.ID, p.UserID,
+		map[string]string{"reason": req.Reason}))
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(ImpersonationExpiresIn)
+	accessToken, err := i.tokenManager.Generate(&Claims{
+		UserID:    u.ID,
+		ActorID:   p.UserID,
+		Scopes:    u.Scopes(),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ImpersonateRes{AccessToken: accessToken, ExpiresAt: expiresAt}, nil
+}
+
+type ImpersonatedRequest struct {
+	Method string
+	Path   string
+}
+
+// RecordImpersonatedRequestUC records a request an admin sent impersonating the user.
+type RecordImpersonatedRequestUC interface {
+	Execute(ctx context.Context, p *Principal, req *ImpersonatedRequest) error
+}
+
+type recordImpersonatedRequestUC struct {
+	auditLog AuditLog
+}
+
+func NewRecordImpersonatedRequestUC(auditLog AuditLog) RecordImpersonatedRequestUC {
+	return &recordImpersonatedRequestUC{auditLog: auditLog}
+}
+
+func (r *recordImpersonatedRequestUC) Execute(ctx context.Context, p *Principal, req *ImpersonatedRequest) error {
+	return r.auditLog.Record(ctx, newAuditEvent(ctx, domain.AuditImpersonatedRequest, p.UserID, p.ActorID,
+		map[string]string{"method": req.Method, "path": req.Path, "token_id": p.TokenID}))
+}
@@ -0,0 +1,66 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+)
+
+type IntrospectReq struct {
+	ClientID     string
+	ClientSecret string
+	Token        string
+}
+
+// Introspection is the state of a token as seen by zenbu. (RFC 7662 Section 2.2)
+// Principal is nil if the token is not active, so that nothing is revealed about invalid tokens.
+type Introspection struct {
+	Active    bool
+	Principal *Principal
+}
+
+// IntrospectUC tells other services whether a token is active, so that they don't need the signing keys.
+// Only confidential clients can introspect tokens, as the answer reveals the user of the token.
+type IntrospectUC interface {
+	Execute(ctx context.Context, req *IntrospectReq) (*Introspection, error)
+}
+
+type introspectUC struct {
+	clientRepo OAuthClientRepo
+	resolver   *resolvePrincipalUC
+}
+
+func NewIntrospectUC(
+	userRepo UserRepo, apiKeyRepo APIKeyRepo, clientRepo OAuthClientRepo, revocationRepo RevocationRepo,
+	tokenManager TokenManager,
+) IntrospectUC {
+	return &introspectUC{
+		clientRepo: clientRepo,
+		resolver: &resolvePrincipalUC{
+			userRepo: userRepo, apiKeyRepo: apiKeyRepo, tokenManager: tokenManager, revocationRepo: revocationRepo,
+		},
+	}
+}
+
+func (i *introspectUC) Execute(ctx context.Context, req *IntrospectReq) (*Introspection, error) {
+	client, err := authenticateClient(ctx, i.clientRepo, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.IsConfidential() {
+		return nil, oauthError(OAuthInvalidClient, "public clients can't introspect tokens")
+	}
+	if req.Token == "" {
+		return nil, oauthError(OAuthInvalidRequest, "token is required")
+	}
+
+	// tokens are verified as on any request, so that revoked tokens and API keys are inactive as well.
+	// Proofs of DPoP-bound tokens are verified by the resource server, which is given the thumbprint.
+	p, err := i.resolver.resolve(ctx, req.Token)
+	if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenExpired) {
+		return &Introspection{Active: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Introspection{Active: true, Principal: p}, nil
+}
@@ -0,0 +1,172 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+// LockoutPolicy limits failed login attempts per username and per IP address.
+type LockoutPolicy struct {
+	// Window is how long failed attempts are counted. Lockouts last until the window is over.
+	Window time.Duration
+	// MaxUsernameFailures and MaxIPFailures are the failed attempts allowed in a window before lockout.
+	// IP addresses may be shared by many users, e.g. behind NAT, so they are allowed more.
+	MaxUsernameFailures int
+	MaxIPFailures       int
+	// After DelayAfter failures of the username, every attempt is delayed by BaseDelay, doubled per failure.
+	DelayAfter int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+var DefaultLockoutPolicy = LockoutPolicy{
+	Window:              15 * time.Minute,
+	MaxUsernameFailures: 10,
+	MaxIPFailures:       100,
+	DelayAfter:          3,
+	BaseDelay:           250 * time.Millisecond,
+	MaxDelay:            4 * time.Second,
+}
+
+// LoginLockedError is returned while login is locked out. It wraps ErrLoginLocked.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return ErrLoginLocked.Error()
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrLoginLocked
+}
+
+func usernameAttemptKey(username string) string {
+	return "username:" + username
+}
+
+func emailAttemptKey(email string) string {
+	return "email:" + email
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginThrottle applies LockoutPolicy to login attempts.
+// Every attempt is counted as a failure before it is verified, and uncounted once it succeeds,
+// so that parallel attempts can't exceed the limit while they are verified.
+type loginThrottle struct {
+	repo   LoginAttemptRepo
+	policy LockoutPolicy
+}
+
+// reserve counts the attempt for the account and the IP address, or returns LoginLockedError if either
+// is locked out. Otherwise, it delays the attempt progressively by the earlier failures of the account.
+// The account is identified by the attempt key of the username or the email address given for login.
+// The attempt stays counted as a failure unless succeed is called.
+func (l *loginThrottle) reserve(ctx context.Context, accountKey, ip string) error {
+	now := time.Now()
+
+	byAccount, ok, err := l.repo.Reserve(ctx, accountKey, l.policy.MaxUsernameFailures, l.policy.Window)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &LoginLockedError{RetryAfter: byAccount.ExpiresAt.Sub(now)}
+	}
+
+	if ip != "" {
+		byIP, ok, err := l.repo.Reserve(ctx, ipAttemptKey(ip), l.policy.MaxIPFailures, l.policy.Window)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// the attempt is not made, so it must not count towards the lockout of the account.
+			if err := l.repo.Release(ctx, accountKey); err != nil {
+				return err
+			}
+			return &LoginLockedError{RetryAfter: byIP.ExpiresAt.Sub(now)}
+		}
+	}
+
+	// the attempt itself is already counted.
+	delay := l.delay(byAccount.Failures - 1)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *loginThrottle) delay(failures int) time.Duration {
+	if failures < l.policy.DelayAfter {
+		return 0
+	}
+	delay := l.policy.BaseDelay
+	for range failures - l.policy.DelayAfter {
+		if delay >= l.policy.MaxDelay {
+			break
+		}
+		delay *= 2
+	}
+	return min(delay, l.policy.MaxDelay)
+}
+
+// succeed resets failures of the account, and uncounts the attempt reserved for the IP address.
+// Other failures of the IP address are kept, otherwise an attacker could reset them by logging in to an own
+// account in between.
+func (l *loginThrottle) succeed(ctx context.Context, accountKey, ip string) error {
+	if err := l.repo.Reset(ctx, accountKey); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return l.repo.Release(ctx, ipAttemptKey(ip))
+}
+
+// UnlockUserUC lifts the login lockout of a user before the window is over.
+type UnlockUserUC interface {
+	Execute(ctx context.Context, p *Principal, userID uuid.UUID) error
+}
+
+type unlockUserUC struct {
+	userRepo         UserRepo
+	loginAttemptRepo LoginAttemptRepo
+	auditLog         AuditLog
+}
+
+func NewUnlockUserUC(userRepo UserRepo, loginAttemptRepo LoginAttemptRepo, auditLog AuditLog) UnlockUserUC {
+	return &unlockUserUC{userRepo: userRepo, loginAttemptRepo: loginAttemptRepo, auditLog: auditLog}
+}
+
+func (u *unlockUserUC) Execute(ctx context.Context, p *Principal, userID uuid.UUID) error {
+	user, err := u.userRepo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := u.loginAttemptRepo.Reset(ctx, usernameAttemptKey(user.Username)); err != nil {
+		return err
+	}
+	if err := u.loginAttemptRepo.Reset(ctx, mfaAttemptKey(user.ID)); err != nil {
+		return err
+	}
+	if user.Email != "" {
+		if err := u.loginAttemptRepo.Reset(ctx, emailAttemptKey(user.Email)); err != nil {
+			return err
+		}
+	}
+	recordAudit(ctx, u.auditLog, domain.AuditUserUnlocked, user.ID, actorOf(p, user.ID), nil)
+	return nil
+}
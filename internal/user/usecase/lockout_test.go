@@ -0,0 +1,194 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/infra"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const (
+	lockoutTestPassword      = "correct horse battery"
+	lockoutTestWrongPassword = "wrong horse battery"
+)
+
+// lockoutTestPolicy locks out after 3 failures, without delays unless a test sets them.
+var lockoutTestPolicy = usecase.LockoutPolicy{
+	Window:              time.Minute,
+	MaxUsernameFailures: 3,
+	MaxIPFailures:       100,
+	DelayAfter:          100,
+}
+
+type lockoutFixture struct {
+	users    *memUserRepo
+	attempts usecase.LoginAttemptRepo
+	login    usecase.BasicLoginUC
+}
+
+func newLockoutFixture(t *testing.T, policy usecase.LockoutPolicy) *lockoutFixture {
+	t.Helper()
+	users := newMemUserRepo()
+	attempts := infra.NewMemoryLoginAttemptRepo()
+	createUser(t, users, "alice", lockoutTestPassword)
+	return &lockoutFixture{
+		users:    users,
+		attempts: attempts,
+		login: usecase.NewBasicLoginUC(users, newMemSessionRepo(), attempts, noMFARepo{}, nil,
+			newTokenManager(t), &discardAuditLog{}, policy),
+	}
+}
+
+func (f *lockoutFixture) tryLogin(password string) error {
+	_, err := f.login.Execute(context.Background(), &usecase.BasicLoginReq{
+		Username: "alice",
+		Password: password,
+		Device:   domain.NewDevice("test", "203.0.113.7"),
+	})
+	return err
+}
+
+func (f *lockoutFixture) fail(t *testing.T, times int) {
+	t.Helper()
+	for i := range times {
+		if err := f.tryLogin(lockoutTestWrongPassword); !errors.Is(err, usecase.ErrInvalidPassword) {
+			t.Fatalf("failure %d: got %v, want ErrInvalidPassword", i+1, err)
+		}
+	}
+}
+
+func TestBasicLogin_LockedOutAfterMaxFailures(t *testing.T) {
+	f := newLockoutFixture(t, lockoutTestPolicy)
+	f.fail(t, lockoutTestPolicy.MaxUsernameFailures)
+
+	// even the correct password is rejected while locked out.
+	err := f.tryLogin(lockoutTestPassword)
+	var locked *usecase.LoginLockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("got %v, want LoginLockedError", err)
+	}
+	if locked.RetryAfter <= 0 || locked.RetryAfter > lockoutTestPolicy.Window {
+		t.Errorf("RetryAfter = %v, want within the window", locked.RetryAfter)
+	}
+}
+
+func TestBasicLogin_ParallelAttemptsDoNotExceedLimit(t *testing.T) {
+	f := newLockoutFixture(t, lockoutTestPolicy)
+
+	var (
+		wg                  sync.WaitGroup
+		mu                  sync.Mutex
+		invalid, lockedOuts int
+	)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := f.tryLogin(lockoutTestWrongPassword)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, usecase.ErrInvalidPassword):
+				invalid++
+			case errors.Is(err, usecase.ErrLoginLocked):
+				lockedOuts++
+			default:
+				t.Errorf("got %v, want ErrInvalidPassword or ErrLoginLocked", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if invalid != lockoutTestPolicy.MaxUsernameFailures {
+		t.Errorf("%d passwords were verified, want %d", invalid, lockoutTestPolicy.MaxUsernameFailures)
+	}
+	if lockedOuts != 10-lockoutTestPolicy.MaxUsernameFailures {
+		t.Errorf("%d attempts were locked out, want %d", lockedOuts, 10-lockoutTestPolicy.MaxUsernameFailures)
+	}
+}
+
+func TestBasicLogin_LockoutEndsWithWindow(t *testing.T) {
+	policy := lockoutTestPolicy
+	policy.Window = time.Second
+	f := newLockoutFixture(t, policy)
+	f.fail(t, policy.MaxUsernameFailures)
+	if err := f.tryLogin(lockoutTestPassword); !errors.Is(err, usecase.ErrLoginLocked) {
+		t.Fatalf("got %v, want ErrLoginLocked", err)
+	}
+
+	time.Sleep(policy.Window)
+
+	if err := f.tryLogin(lockoutTestPassword); err != nil {
+		t.Fatalf("failed to log in after the window: %v", err)
+	}
+}
+
+func TestBasicLogin_SuccessResetsFailures(t *testing.T) {
+	f := newLockoutFixture(t, lockoutTestPolicy)
+	f.fail(t, lockoutTestPolicy.MaxUsernameFailures-1)
+	if err := f.tryLogin(lockoutTestPassword); err != nil {
+		t.Fatalf("failed to log in: %v", err)
+	}
+
+	// failures before the success are not counted anymore.
+	f.fail(t, lockoutTestPolicy.MaxUsernameFailures-1)
+	if err := f.tryLogin(lockoutTestPassword); err != nil {
+		t.Fatalf("failed to log in: %v", err)
+	}
+}
+
+func TestUnlockUser_LiftsLockout(t *testing.T) {
+	f := newLockoutFixture(t, lockoutTestPolicy)
+	f.fail(t, lockoutTestPolicy.MaxUsernameFailures)
+	if err := f.tryLogin(lockoutTestPassword); !errors.Is(err, usecase.ErrLoginLocked) {
+		t.Fatalf("got %v, want ErrLoginLocked", err)
+	}
+
+	u, err := f.users.GetByName(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	admin := &usecase.Principal{UserID: uuid.New()}
+	err = usecase.NewUnlockUserUC(f.users, f.attempts, &discardAuditLog{}).Execute(context.Background(), admin, u.ID)
+	if err != nil {
+		t.Fatalf("failed to unlock: %v", err)
+	}
+
+	if err := f.tryLogin(lockoutTestPassword); err != nil {
+		t.Fatalf("failed to log in after unlock: %v", err)
+	}
+}
+
+func TestBasicLogin_DelaysAfterFailures(t *testing.T) {
+	policy := lockoutTestPolicy
+	policy.MaxUsernameFailures = 10
+	policy.DelayAfter = 2
+	policy.BaseDelay = 200 * time.Millisecond
+	policy.MaxDelay = 400 * time.Millisecond
+	f := newLockoutFixture(t, policy)
+
+	elapsed := func(password string) time.Duration {
+		start := time.Now()
+		_ = f.tryLogin(password)
+		return time.Since(start)
+	}
+
+	// hashing takes some time, so only delays of the policy are told apart.
+	if d := elapsed(lockoutTestWrongPassword); d >= policy.BaseDelay {
+		t.Errorf("the first attempt took %v, want no delay", d)
+	}
+	f.fail(t, 1)
+	if d := elapsed(lockoutTestWrongPassword); d < policy.BaseDelay {
+		t.Errorf("the attempt after %d failures took %v, want at least %v", policy.DelayAfter, d, policy.BaseDelay)
+	}
+	if d := elapsed(lockoutTestWrongPassword); d < policy.MaxDelay {
+		t.Errorf("the next attempt took %v, want the delay doubled to %v", d, policy.MaxDelay)
+	}
+}
@@ -0,0 +1,257 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/mailutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+const MagicLinkExpiresIn = time.Minute * 15
+
+const (
+	// MaxMagicLinkMails is how many magic links can be requested for an email address in MagicLinkMailWindow,
+	// so that the address is not flooded with mails.
+	MaxMagicLinkMails = 5
+	// MaxMagicLinkMailsPerIP is how many magic links an IP address can request in MagicLinkMailWindow.
+	// IP addresses may be shared by many users, e.g. behind NAT, so they are allowed more.
+	MaxMagicLinkMailsPerIP = 30
+	MagicLinkMailWindow    = time.Hour
+	// magicLinkSendTimeout bounds sending a link in background, after the request is responded.
+	magicLinkSendTimeout = time.Minute
+)
+
+// magicLinkMailAttemptKey counts magic links requested for the email address, by LoginAttemptRepo.
+func magicLinkMailAttemptKey(email string) string {
+	return "magic_link_mail:" + email
+}
+
+// magicLinkIPAttemptKey counts magic links requested by the IP address, by LoginAttemptRepo.
+func magicLinkIPAttemptKey(ip string) string {
+	return "magic_link_ip:" + ip
+}
+
+type SendMagicLinkReq struct {
+	Email string
+	// IPAddress is of the device requesting the link, whose requests are limited as well as those of the address.
+	IPAddress string
+}
+
+// SendMagicLinkUC sends a login link to the email address of the user, for users logging in without password.
+// It returns the nonce the link is bound to, which the requesting device must present with the link.
+// A nonce is returned whether the address is registered or not, so that it can't be used to find out registered addresses.
+// The link is sent in background for the same reason, as it takes longer only for registered addresses.
+type SendMagicLinkUC interface {
+	Execute(ctx context.Context, req *SendMagicLinkReq) (nonce string, err error)
+}
+
+type sendMagicLinkUC struct {
+	userRepo      UserRepo
+	magicLinkRepo MagicLinkRepo
+	// mailLimit counts links requested for each address and by each IP address.
+	mailLimit LoginAttemptRepo
+	mailer    mailutil.Mailer
+	// appBaseURL is the URL of the web app, which handles the link in the mail.
+	appBaseURL string
+}
+
+func NewSendMagicLinkUC(
+	userRepo UserRepo, magicLinkRepo MagicLinkRepo, loginAttemptRepo LoginAttemptRepo, mailer mailutil.Mailer,
+	appBaseURL string,
+) SendMagicLinkUC {
+	return &sendMagicLinkUC{
+		userRepo: userRepo, magicLinkRepo: magicLinkRepo, mailLimit: loginAttemptRepo, mailer: mailer,
+		appBaseURL: appBaseURL,
+	}
+}
+
+func (s *sendMagicLinkUC) Execute(ctx context.Context, req *SendMagicLinkReq) (string, error) {
+	email := domain.NormalizeEmail(req.Email)
+	// links are counted whether the address is registered or not, so that the limit tells nothing either.
+	if err := s.reserveMail(ctx, email, req.IPAddress); err != nil {
+		return "", err
+	}
+
+	nonce, err := domain.NewMagicLinkNonce()
+	if err != nil {
+		return "", err
+	}
+
+	// the request may be canceled once responded, while the link is still to be sent.
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), magicLinkSendTimeout)
+	go func() {
+		defer cancel()
+		if err := s.send(sendCtx, email, nonce); err != nil {
+			logutil.From(sendCtx).Error("failed to send magic link", slog.Any("err", err))
+		}
+	}()
+	return nonce, nil
+}
+
+// reserveMail counts a link requested for the address by the IP address, or returns ErrTooManyMagicLinkMails if
+// either is over the limit.
+func (s *sendMagicLinkUC) reserveMail(ctx context.Context, email, ip string) error {
+	_, ok, err := s.mailLimit.Reserve(ctx, magicLinkMailAttemptKey(email), MaxMagicLinkMails, MagicLinkMailWindow)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTooManyMagicLinkMails
+	}
+	if ip == "" {
+		return nil
+	}
+
+	_, ok, err = s.mailLimit.Reserve(ctx, magicLinkIPAttemptKey(ip), MaxMagicLinkMailsPerIP, MagicLinkMailWindow)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// no link is sent, so it must not count towards the limit of the address.
+		if err := s.mailLimit.Release(ctx, magicLinkMailAttemptKey(email)); err != nil {
+			return err
+		}
+		return ErrTooManyMagicLinkMails
+	}
+	return nil
+}
+
+// send sends a link bound to the nonce, if the address is of a user who can log in.
+func (s *sendMagicLinkUC) send(ctx context.Context, email, nonce string) error {
+	u, err := s.userRepo.GetByEmail(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if u.IsDisabled() {
+		return nil
+	}
+
+	l, token, err := domain.NewMagicLink(u.ID, u.Email, nonce, MagicLinkExpiresIn)
+	if err != nil {
+		return err
+	}
+	if err := s.magicLinkRepo.Save(ctx, l); err != nil {
+		return err
+	}
+
+	link := s.appBaseURL + "/login/magic?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, &mailutil.Mail{
+		To:      u.Email,
+		Subject: "Log in to your account",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Open the link below on the device you requested it from to log in.\n%s\n\n"+
+			"The link expires in %s and can be used only once. If you didn't request this, ignore this mail.\n",
+			u.Username, link, MagicLinkExpiresIn),
+	})
+}
+
+type VerifyMagicLinkReq struct {
+	Token string
+	// Nonce is the one returned to the device by SendMagicLinkUC.
+	Nonce  string
+	Device *domain.Device
+}
+
+// VerifyMagicLinkUC logs the user in by the link in the mail, as BasicLoginUC does by the password.
+// The link is invalidated on first use.
+type VerifyMagicLinkUC interface {
+	Execute(ctx context.Context, req *VerifyMagicLinkReq) (*BasicLoginRes, error)
+}
+
+type verifyMagicLinkUC struct {
+	userRepo      UserRepo
+	magicLinkRepo MagicLinkRepo
+	mfaRepo       MFARepo
+	challengeRepo MFAChallengeRepo
+	issuer        *sessionIssuer
+}
+
+func NewVerifyMagicLinkUC(
+	userRepo UserRepo, magicLinkRepo MagicLinkRepo, sessionRepo SessionRepo, mfaRepo MFARepo,
+	challengeRepo MFAChallengeRepo, manager TokenManager, auditLog AuditLog,
+) VerifyMagicLinkUC {
+	return &verifyMagicLinkUC{
+		userRepo:      userRepo,
+		magicLinkRepo: magicLinkRepo,
+		mfaRepo:       mfaRepo,
+		challengeRepo: challengeRepo,
+		issuer:        &sessionIssuer{sessionRepo: sessionRepo, tokenManager: manager, auditLog: auditLog},
+	}
+}
+
+func (v *verifyMagicLinkUC) Execute(ctx context.Context, req *VerifyMagicLinkReq) (*BasicLoginRes, error) {
+	userID, hash, err := domain.ParseMagicLinkToken(req.Token)
+	if err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+
+	l, err := v.magicLinkRepo.Get(ctx, userID)
+	if errors.Is(err, ErrMagicLinkNotFound) {
+		return nil, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a link opened on another device is not consumed, so that the user can still open it on the right one.
+	if !l.Matches(hash, req.Nonce) {
+		return nil, ErrInvalidMagicLink
+	}
+
+	u, err := v.userRepo.Get(ctx, userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the address may have been changed after the mail was sent.
+	if u.Email != l.Email {
+		return nil, ErrInvalidMagicLink
+	}
+
+	if err := v.magicLinkRepo.Consume(ctx, l); err != nil {
+		if errors.Is(err, ErrMagicLinkNotFound) {
+			return nil, ErrInvalidMagicLink
+		}
+		return nil, err
+	}
+
+	if u.IsDisabled() {
+		return nil, ErrUserDisabled
+	}
+	// the reset was forced because the account may be compromised, which the mailbox may be as well.
+	if u.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+	// the token was received at the address, which proves the user owns it.
+	if !u.IsEmailVerified() {
+		u, err = verifyEmailOf(ctx, v.userRepo, u.ID, l.Email, ErrInvalidMagicLink)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the mailbox is a single factor, so the second factor is required as for passwords.
+	mfaToken, err := challengeMFA(ctx, v.mfaRepo, v.challengeRepo, u)
+	if err != nil {
+		return nil, err
+	}
+	if mfaToken != "" {
+		return &BasicLoginRes{MFAToken: mfaToken}, nil
+	}
+
+	tokens, err := v.issuer.start(ctx, u, req.Device, domain.AuthMethodEmail)
+	if err != nil {
+		return nil, err
+	}
+	return &BasicLoginRes{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+}
@@ -0,0 +1,51 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/buzzryan/zenbu/internal/user/infra"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+func TestSendMagicLink_LimitsMails(t *testing.T) {
+	tests := []struct {
+		name string
+		max  int
+		req  func(i int) *usecase.SendMagicLinkReq
+	}{
+		{
+			name: "per address",
+			max:  usecase.MaxMagicLinkMails,
+			req: func(i int) *usecase.SendMagicLinkReq {
+				return &usecase.SendMagicLinkReq{Email: "alice@example.com", IPAddress: fmt.Sprintf("203.0.113.%d", i)}
+			},
+		},
+		{
+			name: "per ip address",
+			max:  usecase.MaxMagicLinkMailsPerIP,
+			req: func(i int) *usecase.SendMagicLinkReq {
+				return &usecase.SendMagicLinkReq{Email: fmt.Sprintf("user%d@example.com", i), IPAddress: "203.0.113.7"}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			// the addresses are not registered, so that no mail is sent.
+			uc := usecase.NewSendMagicLinkUC(newMemUserRepo(), nil, infra.NewMemoryLoginAttemptRepo(), nil, "")
+
+			for i := range tt.max {
+				if _, err := uc.Execute(ctx, tt.req(i)); err != nil {
+					t.Fatalf("request %d: %v", i+1, err)
+				}
+			}
+			_, err := uc.Execute(ctx, tt.req(tt.max))
+			if !errors.Is(err, usecase.ErrTooManyMagicLinkMails) {
+				t.Errorf("got %v, want %v", err, usecase.ErrTooManyMagicLinkMails)
+			}
+		})
+	}
+}
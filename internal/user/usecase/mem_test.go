@@ -0,0 +1,700 @@
+package usecase_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/config"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/infra"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+// memUserRepo keeps users in memory for tests.
+type memUserRepo struct {
+	mu    sync.Mutex
+	users map[uuid.UUID]*domain.User
+}
+
+func newMemUserRepo() *memUserRepo {
+	return &memUserRepo{users: map[uuid.UUID]*domain.User{}}
+}
+
+func (r *memUserRepo) Create(_ context.Context, u *domain.User) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.users {
+		if existing.Username == u.Username {
+			return nil, usecase.ErrUsernameAlreadyExists
+		}
+	}
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	stored := *u
+	r.users[u.ID] = &stored
+	return u, nil
+}
+
+func (r *memUserRepo) Get(_ context.Context, id uuid.UUID) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[id]
+	if !ok {
+		return nil, usecase.ErrUserNotFound
+	}
+	got := *u
+	return &got, nil
+}
+
+func (r *memUserRepo) GetByName(_ context.Context, name string) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Username == name {
+			got := *u
+			return &got, nil
+		}
+	}
+	return nil, usecase.ErrUserNotFound
+}
+
+func (r *memUserRepo) GetByEmail(_ context.Context, email string) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Email == email {
+			got := *u
+			return &got, nil
+		}
+	}
+	return nil, usecase.ErrUserNotFound
+}
+
+func (r *memUserRepo) List(_ context.Context, limit int, cursor string) ([]*domain.User, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var users []*domain.User
+	for _, u := range r.users {
+		if u.Username > cursor {
+			got := *u
+			users = append(users, &got)
+		}
+	}
+	slices.SortFunc(users, func(a, b *domain.User) int { return strings.Compare(a.Username, b.Username) })
+	if len(users) <= limit {
+		return users, "", nil
+	}
+	return users[:limit], users[limit-1].Username, nil
+}
+
+func (r *memUserRepo) Update(_ context.Context, u *domain.User, prevUpdatedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	got, ok := r.users[u.ID]
+	if !ok {
+		return usecase.ErrUserNotFound
+	}
+	if !got.UpdatedAt.Equal(prevUpdatedAt) {
+		return usecase.ErrUserUpdated
+	}
+	stored := *u
+	r.users[u.ID] = &stored
+	return nil
+}
+
+func (r *memUserRepo) UpdatePassword(_ context.Context, userID uuid.UUID, password, prev domain.Password) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[userID]
+	if !ok {
+		return usecase.ErrUserNotFound
+	}
+	if u.Password != prev {
+		return usecase.ErrPasswordChanged
+	}
+	u.Password = password
+	return nil
+}
+
+func (r *memUserRepo) ChangeUsername(_ context.Context, u *domain.User, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.usernameTakenLocked(username, u.ID) {
+		return usecase.ErrUsernameAlreadyExists
+	}
+	stored, ok := r.users[u.ID]
+	if !ok {
+		return usecase.ErrUserNotFound
+	}
+	u.Username = username
+	u.UpdatedAt = time.Now()
+	stored.Username = u.Username
+	stored.UpdatedAt = u.UpdatedAt
+	return nil
+}
+
+func (r *memUserRepo) ChangeEmail(_ context.Context, u *domain.User, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.emailTakenLocked(email, u.ID) {
+		return usecase.ErrEmailAlreadyExists
+	}
+	stored, ok := r.users[u.ID]
+	if !ok {
+		return usecase.ErrUserNotFound
+	}
+	u.Email = email
+	u.EmailVerifiedAt = time.Time{}
+	u.UpdatedAt = time.Now()
+	stored.Email = u.Email
+	stored.EmailVerifiedAt = u.EmailVerifiedAt
+	stored.UpdatedAt = u.UpdatedAt
+	return nil
+}
+
+func (r *memUserRepo) ExtendGuest(_ context.Context, u *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.users[u.ID]
+	if !ok || !stored.IsGuest() {
+		return usecase.ErrUserNotFound
+	}
+	stored.GuestExpiresAt = u.GuestExpiresAt
+	stored.UpdatedAt = u.UpdatedAt
+	return nil
+}
+
+func (r *memUserRepo) UpgradeGuest(_ context.Context, u *domain.User, _ string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.users[u.ID]
+	if !ok || !stored.IsGuest() {
+		return usecase.ErrUserNotFound
+	}
+	if r.usernameTakenLocked(u.Username, u.ID) {
+		return usecase.ErrUsernameAlreadyExists
+	}
+	if u.Email != "" && r.emailTakenLocked(u.Email, u.ID) {
+		return usecase.ErrEmailAlreadyExists
+	}
+	upgraded := *u
+	r.users[u.ID] = &upgraded
+	return nil
+}
+
+// usernameTakenLocked reports whether another user has the username. It must be called with the lock held.
+func (r *memUserRepo) usernameTakenLocked(username string, id uuid.UUID) bool {
+	for _, u := range r.users {
+		if u.Username == username && u.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// emailTakenLocked reports whether another user has the email address. It must be called with the lock held.
+func (r *memUserRepo) emailTakenLocked(email string, id uuid.UUID) bool {
+	for _, u := range r.users {
+		if u.Email == email && u.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memUserRepo) Delete(_ context.Context, u *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.users, u.ID)
+	return nil
+}
+
+// memSessionRepo keeps sessions in memory for tests.
+type memSessionRepo struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*domain.Session
+}
+
+func newMemSessionRepo() *memSessionRepo {
+	return &memSessionRepo{sessions: map[uuid.UUID]*domain.Session{}}
+}
+
+func (r *memSessionRepo) Create(_ context.Context, s *domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *s
+	r.sessions[s.ID] = &stored
+	return nil
+}
+
+func (r *memSessionRepo) Get(_ context.Context, userID, sessionID uuid.UUID) (*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[sessionID]
+	if !ok || s.UserID != userID {
+		return nil, usecase.ErrSessionNotFound
+	}
+	got := *s
+	return &got, nil
+}
+
+func (r *memSessionRepo) Rotate(_ context.Context, s *domain.Session, prevHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.sessions[s.ID]
+	if !ok || stored.RefreshTokenHash != prevHash {
+		return usecase.ErrRefreshTokenReused
+	}
+	rotated := *s
+	r.sessions[s.ID] = &rotated
+	return nil
+}
+
+func (r *memSessionRepo) UpdateAuthentication(_ context.Context, s *domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.sessions[s.ID]
+	if !ok {
+		return usecase.ErrSessionNotFound
+	}
+	stored.AuthTime = s.AuthTime
+	stored.AuthMethods = s.AuthMethods
+	return nil
+}
+
+func (r *memSessionRepo) List(_ context.Context, userID uuid.UUID) ([]*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sessions []*domain.Session
+	for _, s := range r.sessions {
+		if s.UserID == userID {
+			got := *s
+			sessions = append(sessions, &got)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *memSessionRepo) Delete(_ context.Context, _, sessionID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, sessionID)
+	return nil
+}
+
+func (r *memSessionRepo) DeleteAll(_ context.Context, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, s := range r.sessions {
+		if s.UserID == userID {
+			delete(r.sessions, id)
+		}
+	}
+	return nil
+}
+
+// noRevocationRepo is a shared store without any revocation made by other instances.
+// Wrapped by infra.NewCachedRevocationRepo, revocations made in tests are checked by the cache of the instance.
+type noRevocationRepo struct{}
+
+func (noRevocationRepo) RevokeToken(context.Context, uuid.UUID, string, time.Time) error { return nil }
+
+func (noRevocationRepo) RevokeSession(context.Context, uuid.UUID, uuid.UUID, time.Time) error {
+	return nil
+}
+
+func (noRevocationRepo) RevokeTokensIssuedUntil(context.Context, uuid.UUID, time.Time, time.Time) error {
+	return nil
+}
+
+func (noRevocationRepo) IsRevoked(context.Context, *usecase.Claims) (bool, error) { return false, nil }
+
+func (noRevocationRepo) RevokedUntil(context.Context, uuid.UUID) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func newTokenManager(t *testing.T) usecase.TokenManager {
+	t.Helper()
+	keyring, err := infra.LoadKeyring(config.JWSConfig{JWSSigningKey: "test-signing-key"})
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+	return infra.NewJWSTokenManager(keyring)
+}
+
+// createUser creates a user who logs in by the password.
+func createUser(t *testing.T, users *memUserRepo, username, plain string) *domain.User {
+	t.Helper()
+	password, err := domain.NewPassword(context.Background(), plain)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	u, err := users.Create(context.Background(), &domain.User{
+		ID:        uuid.New(),
+		Username:  username,
+		Password:  password,
+		Roles:     []domain.Role{domain.RoleUser},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return u
+}
+
+// discardAuditLog records nothing, for tests not about audit events.
+type discardAuditLog struct{}
+
+func (*discardAuditLog) Record(context.Context, *domain.AuditEvent) error { return nil }
+
+// noMFARepo has no user enabled MFA, so that login completes by the password. Enrollments are discarded.
+type noMFARepo struct{}
+
+func (noMFARepo) Get(context.Context, uuid.UUID) (*domain.MFA, error) {
+	return nil, usecase.ErrMFANotFound
+}
+
+func (noMFARepo) Save(context.Context, *domain.MFA) error { return nil }
+
+func (noMFARepo) Enable(context.Context, *domain.MFA) error { return usecase.ErrMFANotFound }
+
+func (noMFARepo) UseTOTP(context.Context, uuid.UUID, int64) error { return usecase.ErrMFANotFound }
+
+func (noMFARepo) UseRecoveryCode(context.Context, uuid.UUID, string) error {
+	return usecase.ErrMFANotFound
+}
+
+func (noMFARepo) Delete(context.Context, uuid.UUID) error { return usecase.ErrMFANotFound }
+
+// memAPIKeyRepo keeps API keys in memory for tests.
+type memAPIKeyRepo struct {
+	mu   sync.Mutex
+	keys map[uuid.UUID]*domain.APIKey
+}
+
+func newMemAPIKeyRepo() *memAPIKeyRepo {
+	return &memAPIKeyRepo{keys: map[uuid.UUID]*domain.APIKey{}}
+}
+
+func (r *memAPIKeyRepo) Create(_ context.Context, k *domain.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *k
+	r.keys[k.ID] = &stored
+	return nil
+}
+
+func (r *memAPIKeyRepo) Get(_ context.Context, userID, id uuid.UUID) (*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.keys[id]
+	if !ok || k.UserID != userID {
+		return nil, usecase.ErrAPIKeyNotFound
+	}
+	got := *k
+	return &got, nil
+}
+
+func (r *memAPIKeyRepo) List(_ context.Context, userID uuid.UUID) ([]*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []*domain.APIKey
+	for _, k := range r.keys {
+		if k.UserID == userID {
+			got := *k
+			keys = append(keys, &got)
+		}
+	}
+	return keys, nil
+}
+
+func (r *memAPIKeyRepo) UpdateLastUsed(_ context.Context, k *domain.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.keys[k.ID]
+	if !ok {
+		return usecase.ErrAPIKeyNotFound
+	}
+	stored.LastUsedAt = k.LastUsedAt
+	return nil
+}
+
+func (r *memAPIKeyRepo) Delete(_ context.Context, userID, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.keys[id]
+	if !ok || k.UserID != userID {
+		return usecase.ErrAPIKeyNotFound
+	}
+	delete(r.keys, id)
+	return nil
+}
+
+func (r *memAPIKeyRepo) DeleteAll(_ context.Context, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, k := range r.keys {
+		if k.UserID == userID {
+			delete(r.keys, id)
+		}
+	}
+	return nil
+}
+
+// memPasskeyRepo keeps passkeys in memory for tests.
+type memPasskeyRepo struct {
+	mu       sync.Mutex
+	passkeys map[string]*domain.Passkey
+}
+
+func newMemPasskeyRepo() *memPasskeyRepo {
+	return &memPasskeyRepo{passkeys: map[string]*domain.Passkey{}}
+}
+
+func (r *memPasskeyRepo) Create(_ context.Context, p *domain.Passkey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.passkeys[string(p.ID)]; ok {
+		return usecase.ErrPasskeyAlreadyExists
+	}
+	stored := *p
+	r.passkeys[string(p.ID)] = &stored
+	return nil
+}
+
+func (r *memPasskeyRepo) Get(_ context.Context, userID uuid.UUID, id []byte) (*domain.Passkey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.passkeys[string(id)]
+	if !ok || p.UserID != userID {
+		return nil, usecase.ErrPasskeyNotFound
+	}
+	got := *p
+	return &got, nil
+}
+
+func (r *memPasskeyRepo) List(_ context.Context, userID uuid.UUID) ([]*domain.Passkey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var passkeys []*domain.Passkey
+	for _, p := range r.passkeys {
+		if p.UserID == userID {
+			got := *p
+			passkeys = append(passkeys, &got)
+		}
+	}
+	return passkeys, nil
+}
+
+func (r *memPasskeyRepo) UpdateUsage(_ context.Context, p *domain.Passkey, prevSignCount uint32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.passkeys[string(p.ID)]
+	if !ok {
+		return usecase.ErrPasskeyNotFound
+	}
+	if stored.SignCount != prevSignCount {
+		return usecase.ErrPasskeyCloned
+	}
+	stored.SignCount = p.SignCount
+	stored.LastUsedAt = p.LastUsedAt
+	return nil
+}
+
+func (r *memPasskeyRepo) Delete(_ context.Context, userID uuid.UUID, id []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.passkeys[string(id)]
+	if !ok || p.UserID != userID {
+		return usecase.ErrPasskeyNotFound
+	}
+	delete(r.passkeys, string(id))
+	return nil
+}
+
+// memWebAuthnCeremonyRepo keeps pending ceremonies in memory for tests.
+type memWebAuthnCeremonyRepo struct {
+	mu         sync.Mutex
+	ceremonies map[uuid.UUID]*domain.WebAuthnCeremony
+}
+
+func newMemWebAuthnCeremonyRepo() *memWebAuthnCeremonyRepo {
+	return &memWebAuthnCeremonyRepo{ceremonies: map[uuid.UUID]*domain.WebAuthnCeremony{}}
+}
+
+func (r *memWebAuthnCeremonyRepo) Save(_ context.Context, c *domain.WebAuthnCeremony) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *c
+	r.ceremonies[c.ID] = &stored
+	return nil
+}
+
+func (r *memWebAuthnCeremonyRepo) Consume(_ context.Context, id uuid.UUID) (*domain.WebAuthnCeremony, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.ceremonies[id]
+	if !ok || c.IsExpired(time.Now()) {
+		return nil, usecase.ErrWebAuthnCeremonyNotFound
+	}
+	delete(r.ceremonies, id)
+	return c, nil
+}
+
+// memIdentityRepo keeps linked identities in memory for tests.
+type memIdentityRepo struct {
+	mu         sync.Mutex
+	identities map[string]*domain.Identity
+}
+
+func newMemIdentityRepo() *memIdentityRepo {
+	return &memIdentityRepo{identities: map[string]*domain.Identity{}}
+}
+
+func (r *memIdentityRepo) Create(_ context.Context, i *domain.Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := i.Provider + "#" + i.Subject
+	if _, ok := r.identities[key]; ok {
+		return usecase.ErrIdentityAlreadyLinked
+	}
+	stored := *i
+	r.identities[key] = &stored
+	return nil
+}
+
+func (r *memIdentityRepo) Get(_ context.Context, provider, subject string) (*domain.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, ok := r.identities[provider+"#"+subject]
+	if !ok {
+		return nil, usecase.ErrIdentityNotFound
+	}
+	got := *i
+	return &got, nil
+}
+
+func (r *memIdentityRepo) List(_ context.Context, userID uuid.UUID) ([]*domain.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var identities []*domain.Identity
+	for _, i := range r.identities {
+		if i.UserID == userID {
+			got := *i
+			identities = append(identities, &got)
+		}
+	}
+	return identities, nil
+}
+
+func (r *memIdentityRepo) Delete(_ context.Context, userID uuid.UUID, provider, subject string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := provider + "#" + subject
+	i, ok := r.identities[key]
+	if !ok || i.UserID != userID {
+		return usecase.ErrIdentityNotFound
+	}
+	delete(r.identities, key)
+	return nil
+}
+
+// memOIDCAuthRequestRepo keeps pending authorization requests in memory for tests.
+type memOIDCAuthRequestRepo struct {
+	mu       sync.Mutex
+	requests map[string]*domain.OIDCAuthRequest
+}
+
+func newMemOIDCAuthRequestRepo() *memOIDCAuthRequestRepo {
+	return &memOIDCAuthRequestRepo{requests: map[string]*domain.OIDCAuthRequest{}}
+}
+
+func (r *memOIDCAuthRequestRepo) Save(_ context.Context, req *domain.OIDCAuthRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *req
+	r.requests[req.StateHash] = &stored
+	return nil
+}
+
+func (r *memOIDCAuthRequestRepo) Consume(_ context.Context, stateHash string) (*domain.OIDCAuthRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	req, ok := r.requests[stateHash]
+	if !ok || time.Now().After(req.ExpiresAt) {
+		return nil, usecase.ErrOIDCAuthRequestNotFound
+	}
+	delete(r.requests, stateHash)
+	return req, nil
+}
+
+type memPasswordResetRepo struct {
+	mu     sync.Mutex
+	resets map[uuid.UUID]*domain.PasswordReset
+}
+
+func newMemPasswordResetRepo() *memPasswordResetRepo {
+	return &memPasswordResetRepo{resets: map[uuid.UUID]*domain.PasswordReset{}}
+}
+
+func (r *memPasswordResetRepo) Save(_ context.Context, reset *domain.PasswordReset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *reset
+	r.resets[reset.UserID] = &stored
+	return nil
+}
+
+func (r *memPasswordResetRepo) Get(_ context.Context, userID uuid.UUID) (*domain.PasswordReset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reset, ok := r.resets[userID]
+	if !ok || reset.IsExpired(time.Now()) {
+		return nil, usecase.ErrPasswordResetNotFound
+	}
+	got := *reset
+	return &got, nil
+}
+
+func (r *memPasswordResetRepo) Consume(_ context.Context, reset *domain.PasswordReset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	got, ok := r.resets[reset.UserID]
+	if !ok || got.TokenHash != reset.TokenHash {
+		return usecase.ErrPasswordResetNotFound
+	}
+	delete(r.resets, reset.UserID)
+	return nil
+}
+
+// racingUserRepo disables the user right after the first read, as an admin would concurrently.
+type racingUserRepo struct {
+	*memUserRepo
+
+	raced bool
+}
+
+func (r *racingUserRepo) Get(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	u, err := r.memUserRepo.Get(ctx, id)
+	if err != nil || r.raced {
+		return u, err
+	}
+	r.raced = true
+
+	concurrent := *u
+	concurrent.Disable()
+	// the clock may not advance between the reads.
+	concurrent.UpdatedAt = u.UpdatedAt.Add(time.Second)
+	if err := r.memUserRepo.Update(ctx, &concurrent, u.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,316 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/otputil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+// MFAChallengeExpiresIn is how long the second factor can be entered after the password.
+const MFAChallengeExpiresIn = 5 * time.Minute
+
+// mfaAttemptKey counts wrong codes of the user. Unlike the username, it is not reset by a correct password,
+// so that a code can't be guessed by logging in again and again.
+func mfaAttemptKey(userID uuid.UUID) string {
+	return "mfa:" + userID.String()
+}
+
+// verifyMFACode accepts a code of the authenticator or one of the recovery codes, each only once.
+func verifyMFACode(ctx context.Context, mfaRepo MFARepo, m *domain.MFA, code string) error {
+	if step, ok := m.VerifyTOTP(code, time.Now()); ok {
+		return mfaRepo.UseTOTP(ctx, m.UserID, step)
+	}
+	if hash, ok := m.MatchRecoveryCode(code); ok {
+		return mfaRepo.UseRecoveryCode(ctx, m.UserID, hash)
+	}
+	return ErrInvalidMFACode
+}
+
+// challengeMFA starts a login waiting for the second factor if the user has enabled MFA.
+// It returns an empty token otherwise.
+func challengeMFA(
+	ctx context.Context, mfaRepo MFARepo, challengeRepo MFAChallengeRepo, u *domain.User,
+) (token string, err error) {
+	m, err := mfaRepo.Get(ctx, u.ID)
+	if errors.Is(err, ErrMFANotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !m.IsEnabled() {
+		return "", nil
+	}
+
+	c, token, err := domain.NewMFAChallenge(u.ID, MFAChallengeExpiresIn)
+	if err != nil {
+		return "", err
+	}
+	if err := challengeRepo.Save(ctx, c); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+type CompleteMFALoginReq struct {
+	MFAToken string
+	// Code is either a code of the authenticator or a recovery code.
+	Code   string
+	Device *domain.Device
+}
+
+// CompleteMFALoginUC completes the login by the second factor, after the password was verified by BasicLoginUC.
+type CompleteMFALoginUC interface {
+	Execute(ctx context.Context, req *CompleteMFALoginReq) (*TokenPair, error)
+}
+
+type completeMFALoginUC struct {
+	userRepo      UserRepo
+	mfaRepo       MFARepo
+	challengeRepo MFAChallengeRepo
+	issuer        *sessionIssuer
+	throttle      *loginThrottle
+	auditLog      AuditLog
+}
+
+func NewCompleteMFALoginUC(
+	userRepo UserRepo, sessionRepo SessionRepo, loginAttemptRepo LoginAttemptRepo, mfaRepo MFARepo,
+	challengeRepo MFAChallengeRepo, manager TokenManager, auditLog AuditLog, lockoutPolicy LockoutPolicy,
+) CompleteMFALoginUC {
+	return &completeMFALoginUC{
+		userRepo:      userRepo,
+		mfaRepo:       mfaRepo,
+		challengeRepo: challengeRepo,
+		issuer:        &sessionIssuer{sessionRepo: sessionRepo, tokenManager: manager, auditLog: auditLog},
+		throttle:      &loginThrottle{repo: loginAttemptRepo, policy: lockoutPolicy},
+		auditLog:      auditLog,
+	}
+}
+
+func (c *completeMFALoginUC) Execute(ctx context.Context, req *CompleteMFALoginReq) (*TokenPair, error) {
+	userID, hash, err := domain.ParseMFAChallengeToken(req.MFAToken)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	var ip string
+	if req.Device != nil {
+		ip = req.Device.IPAddress
+	}
+	challenge, err := c.challengeRepo.Get(ctx, userID)
+	if errors.Is(err, ErrMFAChallengeNotFound) {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !challenge.MatchesToken(hash) {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	m, err := c.mfaRepo.Get(ctx, userID)
+	// MFA may have been disabled after the password was verified. The login must be started again.
+	if errors.Is(err, ErrMFANotFound) {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !m.IsEnabled() {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	// attempts are counted only with a valid challenge, so that others can't lock the user out by the user ID.
+	if err := c.throttle.reserve(ctx, mfaAttemptKey(userID), ip); err != nil {
+		return nil, err
+	}
+	err = verifyMFACode(ctx, c.mfaRepo, m, req.Code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		recordAudit(ctx, c.auditLog, domain.AuditLoginFailed, userID, uuid.Nil,
+			map[string]string{"reason": "invalid_mfa_code", "ip_address": ip})
+		return nil, ErrInvalidMFACode
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := c.throttle.succeed(ctx, mfaAttemptKey(userID), ip); err != nil {
+		return nil, err
+	}
+
+	if err := c.challengeRepo.Consume(ctx, challenge); err != nil {
+		if errors.Is(err, ErrMFAChallengeNotFound) {
+			return nil, ErrInvalidMFAChallenge
+		}
+		return nil, err
+	}
+
+	u, err := c.userRepo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsDisabled() {
+		return nil, ErrUserDisabled
+	}
+
+	// the first factor was verified already when the challenge was started.
+	return c.issuer.start(ctx, u, req.Device, domain.AuthMethodOTP, domain.AuthMethodMFA)
+}
+
+type EnrollTOTPRes struct {
+	// Secret is the secret in base32, for authenticators the URI can't be given to.
+	Secret          string
+	ProvisioningURI string
+}
+
+// EnrollTOTPUC enrolls a new TOTP authenticator. It is not used for login until enabled by EnableMFAUC.
+// Enrolling again replaces the authenticator not enabled yet.
+type EnrollTOTPUC interface {
+	Execute(ctx context.Context, p *Principal) (*EnrollTOTPRes, error)
+}
+
+type enrollTOTPUC struct {
+	userRepo UserRepo
+	mfaRepo  MFARepo
+	// issuer names the service in authenticator apps.
+	issuer string
+}
+
+func NewEnrollTOTPUC(userRepo UserRepo, mfaRepo MFARepo, issuer string) EnrollTOTPUC {
+	return &enrollTOTPUC{userRepo: userRepo, mfaRepo: mfaRepo, issuer: issuer}
+}
+
+func (e *enrollTOTPUC) Execute(ctx context.Context, p *Principal) (*EnrollTOTPRes, error) {
+	u, err := e.userRepo.Get(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := rejectGuest(u, "enroll an authenticator"); err != nil {
+		return nil, err
+	}
+
+	m, err := domain.NewMFA(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.mfaRepo.Save(ctx, m); err != nil {
+		return nil, err
+	}
+
+	return &EnrollTOTPRes{
+		Secret:          otputil.EncodeSecret(m.TOTPSecret),
+		ProvisioningURI: m.ProvisioningURI(e.issuer, u.Username),
+	}, nil
+}
+
+// EnableMFAUC enables the enrolled authenticator by a code of it, and returns recovery codes.
+// The recovery codes are shown only once, as only their hashes are stored.
+type EnableMFAUC interface {
+	Execute(ctx context.Context, p *Principal, code string) (recoveryCodes []string, err error)
+}
+
+type enableMFAUC struct {
+	mfaRepo MFARepo
+}
+
+func NewEnableMFAUC(mfaRepo MFARepo) EnableMFAUC {
+	return &enableMFAUC{mfaRepo: mfaRepo}
+}
+
+func (e *enableMFAUC) Execute(ctx context.Context, p *Principal, code string) ([]string, error) {
+	m, err := e.mfaRepo.Get(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if m.IsEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := m.VerifyTOTP(code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	recoveryCodes, err := m.Enable(step)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.mfaRepo.Enable(ctx, m); err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+// DisableMFAUC disables MFA by a code of the authenticator or a recovery code,
+// so that a stolen access token alone can't weaken the account.
+type DisableMFAUC interface {
+	Execute(ctx context.Context, p *Principal, code string) error
+}
+
+type disableMFAUC struct {
+	mfaRepo  MFARepo
+	throttle *loginThrottle
+}
+
+func NewDisableMFAUC(mfaRepo MFARepo, loginAttemptRepo LoginAttemptRepo, lockoutPolicy LockoutPolicy) DisableMFAUC {
+	return &disableMFAUC{mfaRepo: mfaRepo, throttle: &loginThrottle{repo: loginAttemptRepo, policy: lockoutPolicy}}
+}
+
+func (d *disableMFAUC) Execute(ctx context.Context, p *Principal, code string) error {
+	m, err := d.mfaRepo.Get(ctx, p.UserID)
+	if errors.Is(err, ErrMFANotFound) {
+		return ErrMFANotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if !m.IsEnabled() {
+		return ErrMFANotEnabled
+	}
+
+	// wrong codes count towards the same lockout as login, so that codes can't be guessed here instead.
+	if err := d.throttle.reserve(ctx, mfaAttemptKey(p.UserID), ""); err != nil {
+		return err
+	}
+	err = verifyMFACode(ctx, d.mfaRepo, m, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		return ErrInvalidMFACode
+	}
+	if err != nil {
+		return err
+	}
+	if err := d.throttle.succeed(ctx, mfaAttemptKey(p.UserID), ""); err != nil {
+		return err
+	}
+
+	return d.mfaRepo.Delete(ctx, p.UserID)
+}
+
+// ResetMFAUC disables MFA of a user who lost both the authenticator and the recovery codes.
+type ResetMFAUC interface {
+	Execute(ctx context.Context, p *Principal, userID uuid.UUID) error
+}
+
+type resetMFAUC struct {
+	userRepo UserRepo
+	mfaRepo  MFARepo
+	auditLog AuditLog
+}
+
+func NewResetMFAUC(userRepo UserRepo, mfaRepo MFARepo, auditLog AuditLog) ResetMFAUC {
+	return &resetMFAUC{userRepo: userRepo, mfaRepo: mfaRepo, auditLog: auditLog}
+}
+
+func (r *resetMFAUC) Execute(ctx context.Context, p *Principal, userID uuid.UUID) error {
+	if _, err := r.userRepo.Get(ctx, userID); err != nil {
+		return err
+	}
+	if err := r.mfaRepo.Delete(ctx, userID); err != nil {
+		return err
+	}
+	recordAudit(ctx, r.auditLog, domain.AuditUserMFAReset, userID, actorOf(p, userID), nil)
+	return nil
+}
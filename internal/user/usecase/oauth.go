@@ -0,0 +1,673 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+// AuthorizationCodeExpiresIn is how long a client has to redeem an authorization code.
+const AuthorizationCodeExpiresIn = time.Minute
+
+// OAuth error codes sent to clients. (RFC 6749 Section 4.1.2.1 and 5.2)
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthAccessDenied            = "access_denied"
+	OAuthInvalidDPoPProof        = "invalid_dpop_proof" // RFC 9449 Section 5
+)
+
+// OAuthError is an error of the OAuth protocol, which is sent to the client as it is.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) error {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// authenticateClient authenticates a client by its credentials. Public clients are identified, but not authenticated.
+func authenticateClient(ctx context.Context, clientRepo OAuthClientRepo, id, secret string) (*domain.OAuthClient, error) {
+	client, err := clientRepo.Get(ctx, id)
+	if errors.Is(err, ErrOAuthClientNotFound) {
+		return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.IsConfidential() && !client.VerifySecret(secret) {
+		return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+	}
+	if !client.IsConfidential() && secret != "" {
+		return nil, oauthError(OAuthInvalidClient, "public client has no secret")
+	}
+	return client, nil
+}
+
+type AuthorizeReq struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	// Approve is the answer of the user when asked to consent. It is nil until the user is asked.
+	Approve *bool
+}
+
+type AuthorizeRes struct {
+	// RedirectURI is where the user is sent back to the client, with the code or the error.
+	// It is empty if the user has to consent first.
+	RedirectURI string
+	// ConsentRequired asks the user to consent to Client for Scopes, and to send the request again with the answer.
+	ConsentRequired bool
+	Client          *domain.OAuthClient
+	Scopes          []domain.Scope
+}
+
+// AuthorizeUC lets the logged-in user authorize a client, which gets an authorization code to redeem for tokens.
+// Users are asked to consent to third-party clients once for each scope.
+//
+// Errors about the client or the redirect URI are returned as ErrInvalidAuthorization, as the user must not be
+// redirected to an unverified URI. The other errors are sent to the client in the redirect URI.
+type AuthorizeUC interface {
+	Execute(ctx context.Context, p *Principal, req *AuthorizeReq) (*AuthorizeRes, error)
+}
+
+type authorizeUC struct {
+	userRepo    UserRepo
+	sessionRepo SessionRepo
+	clientRepo  OAuthClientRepo
+	consentRepo ConsentRepo
+	codeRepo    AuthorizationCodeRepo
+}
+
+func NewAuthorizeUC(
+	userRepo UserRepo, sessionRepo SessionRepo, clientRepo OAuthClientRepo, consentRepo ConsentRepo,
+	codeRepo AuthorizationCodeRepo,
+) AuthorizeUC {
+	return &authorizeUC{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		clientRepo:  clientRepo,
+		consentRepo: consentRepo,
+		codeRepo:    codeRepo,
+	}
+}
+
+func (a *authorizeUC) Execute(ctx context.Context, p *Principal, req *AuthorizeReq) (*AuthorizeRes, error) {
+	// a client must not authorize other clients with the tokens it was given.
+	if !p.IsFirstParty() {
+		return nil, ErrPermissionDenied
+	}
+
+	client, err := a.clientRepo.Get(ctx, req.ClientID)
+	if errors.Is(err, ErrOAuthClientNotFound) {
+		return nil, fmt.Errorf("%w: unknown client_id", ErrInvalidAuthorization)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, fmt.Errorf("%w: redirect_uri is not registered for the client", ErrInvalidAuthorization)
+	}
+	redirectURI, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid redirect_uri", ErrInvalidAuthorization)
+	}
+	redirect := func(params url.Values) *AuthorizeRes {
+		query := redirectURI.Query()
+		for k, v := range params {
+			query[k] = v
+		}
+		if req.State != "" {
+			query.Set("state", req.State)
+		}
+		u := *redirectURI
+		u.RawQuery = query.Encode()
+		return &AuthorizeRes{RedirectURI: u.String(), Client: client}
+	}
+	redirectError := func(code, description string) *AuthorizeRes {
+		return redirect(url.Values{"error": {code}, "error_description": {description}})
+	}
+
+	if req.ResponseType != "code" {
+		return redirectError(OAuthUnsupportedResponseType, "only code is supported"), nil
+	}
+	if !client.AllowsGrant(domain.GrantAuthorizationCode) {
+		return redirectError(OAuthUnauthorizedClient, "authorization code grant is not allowed for the client"), nil
+	}
+	// PKCE is required even for confidential clients, as it also prevents injection of stolen codes.
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return redirectError(OAuthInvalidRequest, "S256 code challenge is required"), nil
+	}
+	scopes := domain.ParseScopes(req.Scope)
+	if len(scopes) == 0 {
+		return redirectError(OAuthInvalidScope, "scope is required"), nil
+	}
+	if !client.AllowsScopes(scopes) {
+		return redirectError(OAuthInvalidScope, "scope is not allowed for the client"), nil
+	}
+
+	session, err := sessionOf(ctx, a.sessionRepo, p)
+	if err != nil {
+		return nil, err
+	}
+	u, err := a.userRepo.Get(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsDisabled() {
+		return nil, ErrUserDisabled
+	}
+	if err := rejectGuest(u, "authorize a client"); err != nil {
+		return nil, err
+	}
+
+	if !client.FirstParty {
+		consent, err := a.consentRepo.Get(ctx, u.ID, client.ID)
+		if err != nil && !errors.Is(err, ErrConsentNotFound) {
+			return nil, err
+		}
+		if consent == nil || !consent.Covers(scopes) {
+			if req.Approve == nil {
+				return &AuthorizeRes{ConsentRequired: true, Client: client, Scopes: scopes}, nil
+			}
+			if !*req.Approve {
+				return redirectError(OAuthAccessDenied, "the user denied the request"), nil
+			}
+
+			if consent == nil {
+				consent = domain.NewConsent(u.ID, client.ID, scopes)
+			} else {
+				consent.Grant(scopes)
+			}
+			if err := a.consentRepo.Save(ctx, consent); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// the user authenticated last when logging in to the session or re-authenticating in it.
+	code, plainCode, err := domain.NewAuthorizationCode(
+		client.ID, u.ID, req.RedirectURI, scopes, req.CodeChallenge, req.Nonce, session.AuthTime,
+		AuthorizationCodeExpiresIn,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.codeRepo.Save(ctx, code); err != nil {
+		return nil, err
+	}
+	return redirect(url.Values{"code": {plainCode}}), nil
+}
+
+type OAuthTokenReq struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	// Code, RedirectURI and CodeVerifier are for the authorization code grant.
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	// RefreshToken is for the refresh token grant.
+	RefreshToken string
+	// Scope is for the client credentials grant. If empty, every scope the client may be granted.
+	Scope  string
+	Device *domain.Device
+	// DPoP is the proof of the key the tokens are to be bound to. It is nil for bearer tokens.
+	DPoP *DPoPProofReq
+}
+
+type OAuthTokenRes struct {
+	AccessToken string
+	// RefreshToken is issued only to clients allowed the refresh token grant.
+	RefreshToken string
+	// IDToken is issued only for the openid scope.
+	IDToken   string
+	ExpiresIn time.Duration
+	// Scopes are the scopes granted. It is nil if they are not changed by the request.
+	Scopes []domain.Scope
+	// DPoPBound reports whether the tokens are bound to a DPoP key, which makes the token type DPoP.
+	DPoPBound bool
+}
+
+// OAuthTokenUC is the token endpoint of the authorization server. (RFC 6749 Section 3.2)
+// Errors of the protocol are returned as *OAuthError.
+type OAuthTokenUC interface {
+	Execute(ctx context.Context, req *OAuthTokenReq) (*OAuthTokenRes, error)
+}
+
+type oauthTokenUC struct {
+	userRepo   UserRepo
+	clientRepo OAuthClientRepo
+	codeRepo   AuthorizationCodeRepo
+	replayRepo DPoPReplayRepo
+	manager    TokenManager
+	issuer     *sessionIssuer
+	refresher  *refreshTokenUC
+	// oidcIssuer is the URL of zenbu as an OpenID provider, given in ID tokens.
+	oidcIssuer string
+}
+
+func NewOAuthTokenUC(
+	userRepo UserRepo, sessionRepo SessionRepo, clientRepo OAuthClientRepo, codeRepo AuthorizationCodeRepo,
+	replayRepo DPoPReplayRepo, manager TokenManager, oidcIssuer string,
+) OAuthTokenUC {
+	issuer := &sessionIssuer{sessionRepo: sessionRepo, tokenManager: manager}
+	return &oauthTokenUC{
+		userRepo:   userRepo,
+		clientRepo: clientRepo,
+		codeRepo:   codeRepo,
+		replayRepo: replayRepo,
+		manager:    manager,
+		issuer:     issuer,
+		refresher:  &refreshTokenUC{userRepo: userRepo, sessionRepo: sessionRepo, replayRepo: replayRepo, issuer: issuer},
+		oidcIssuer: oidcIssuer,
+	}
+}
+
+func (o *oauthTokenUC) Execute(ctx context.Context, req *OAuthTokenReq) (*OAuthTokenRes, error) {
+	grantType := domain.GrantType(req.GrantType)
+	if !grantType.IsValid() {
+		return nil, oauthError(OAuthUnsupportedGrantType, "unsupported grant_type")
+	}
+
+	client, err := authenticateClient(ctx, o.clientRepo, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsGrant(grantType) {
+		return nil, oauthError(OAuthUnauthorizedClient, "grant_type is not allowed for the client")
+	}
+
+	var thumbprint string
+	if req.DPoP != nil {
+		thumbprint, err = verifyDPoPProof(ctx, o.replayRepo, req.DPoP, "")
+		if errors.Is(err, ErrInvalidDPoPProof) {
+			return nil, oauthError(OAuthInvalidDPoPProof, err.Error())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch grantType {
+	case domain.GrantAuthorizationCode:
+		return o.redeemCode(ctx, client, req, thumbprint)
+	case domain.GrantRefreshToken:
+		return o.refresh(ctx, client, req, thumbprint)
+	default:
+		return o.clientCredentials(client, req, thumbprint)
+	}
+}
+
+func (o *oauthTokenUC) redeemCode(
+	ctx context.Context, client *domain.OAuthClient, req *OAuthTokenReq, thumbprint string,
+) (*OAuthTokenRes, error) {
+	code, err := o.codeRepo.Consume(ctx, domain.HashAuthorizationCode(req.Code))
+	if errors.Is(err, ErrAuthorizationCodeNotFound) {
+		return nil, oauthError(OAuthInvalidGrant, "invalid code")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if code.ClientID != client.ID || code.RedirectURI != req.RedirectURI {
+		return nil, oauthError(OAuthInvalidGrant, "invalid code")
+	}
+	if !code.VerifyCodeVerifier(req.CodeVerifier) {
+		return nil, oauthError(OAuthInvalidGrant, "code_verifier does not match the code challenge")
+	}
+
+	u, err := o.userRepo.Get(ctx, code.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, oauthError(OAuthInvalidGrant, "user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.IsDisabled() {
+		return nil, oauthError(OAuthInvalidGrant, "user disabled")
+	}
+
+	tokens, err := o.issuer.startForClient(ctx, u, req.Device, client.ID, code.Scopes, thumbprint)
+	if err != nil {
+		return nil, err
+	}
+	res := &OAuthTokenRes{
+		AccessToken: tokens.AccessToken,
+		ExpiresIn:   AccessTokenExpiresIn,
+		Scopes:      domain.ClientScopes(code.Scopes, u.Scopes()),
+		DPoPBound:   tokens.DPoPBound,
+	}
+	if client.AllowsGrant(domain.GrantRefreshToken) {
+		res.RefreshToken = tokens.RefreshToken
+	}
+
+	if slices.Contains(code.Scopes, domain.ScopeOpenID) {
+		res.IDToken, err = o.idToken(client, u, code)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (o *oauthTokenUC) idToken(client *domain.OAuthClient, u *domain.User, code *domain.AuthorizationCode) (string, error) {
+	claims := &IDTokenClaims{
+		Issuer:    o.oidcIssuer,
+		Subject:   u.ID,
+		Audience:  client.ID,
+		Nonce:     code.Nonce,
+		AuthTime:  code.AuthTime,
+		ExpiresAt: time.Now().Add(AccessTokenExpiresIn),
+	}
+	if slices.Contains(code.Scopes, domain.ScopeEmail) {
+		claims.Email = u.Email
+		claims.EmailVerified = u.IsEmailVerified()
+	}
+	if slices.Contains(code.Scopes, domain.ScopeProfile) {
+		claims.Username = u.Username
+	}
+	return o.manager.GenerateIDToken(claims)
+}
+
+func (o *oauthTokenUC) refresh(
+	ctx context.Context, client *domain.OAuthClient, req *OAuthTokenReq, thumbprint string,
+) (*OAuthTokenRes, error) {
+	tokens, err := o.refresher.refresh(ctx, req.RefreshToken, client.ID, thumbprint)
+	if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) ||
+		errors.Is(err, ErrUserDisabled) || errors.Is(err, ErrUserNotFound) {
+		return nil, oauthError(OAuthInvalidGrant, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthTokenRes{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    AccessTokenExpiresIn,
+		DPoPBound:    tokens.DPoPBound,
+	}, nil
+}
+
+// clientCredentials issues a token to the client acting on its own. It has no user, and no refresh token
+// as the client can authenticate again.
+func (o *oauthTokenUC) clientCredentials(
+	client *domain.OAuthClient, req *OAuthTokenReq, thumbprint string,
+) (*OAuthTokenRes, error) {
+	// a public client can't be authenticated, so anyone could act as it.
+	if !client.IsConfidential() {
+		return nil, oauthError(OAuthUnauthorizedClient, "public client can't use client_credentials")
+	}
+
+	allowed := client.ClientCredentialsScopes()
+	scopes := domain.ParseScopes(req.Scope)
+	if len(scopes) == 0 {
+		scopes = allowed
+	}
+	for _, s := range scopes {
+		if !slices.Contains(allowed, s) {
+			return nil, oauthError(OAuthInvalidScope, fmt.Sprintf("%s scope is not allowed for the client", s))
+		}
+	}
+
+	accessToken, err := o.manager.Generate(&Claims{
+		ClientID:   client.ID,
+		Scopes:     scopes,
+		Thumbprint: thumbprint,
+		ExpiresAt:  time.Now().Add(AccessTokenExpiresIn),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthTokenRes{
+		AccessToken: accessToken,
+		ExpiresIn:   AccessTokenExpiresIn,
+		Scopes:      scopes,
+		DPoPBound:   thumbprint != "",
+	}, nil
+}
+
+type UserInfoRes struct {
+	Subject uuid.UUID
+	// Email and EmailVerified are given only for the email scope, and Username only for the profile scope.
+	Email         string
+	EmailVerified bool
+	Username      string
+}
+
+// UserInfoUC returns the claims of the user to the client the user authorized. (OpenID Connect Core 1.0 Section 5.3)
+type UserInfoUC interface {
+	Execute(ctx context.Context, p *Principal) (*UserInfoRes, error)
+}
+
+type userInfoUC struct {
+	userRepo UserRepo
+}
+
+func NewUserInfoUC(userRepo UserRepo) UserInfoUC {
+	return &userInfoUC{userRepo: userRepo}
+}
+
+func (u *userInfoUC) Execute(ctx context.Context, p *Principal) (*UserInfoRes, error) {
+	user, err := u.userRepo.Get(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &UserInfoRes{Subject: user.ID}
+	if p.HasScope(domain.ScopeEmail) {
+		res.Email = user.Email
+		res.EmailVerified = user.IsEmailVerified()
+	}
+	if p.HasScope(domain.ScopeProfile) {
+		res.Username = user.Username
+	}
+	return res, nil
+}
+
+// ConsentOfClient is a consent of the user with the name of its client.
+type ConsentOfClient struct {
+	*domain.Consent
+	// ClientName is empty if the client was deleted.
+	ClientName string
+}
+
+// ListConsentsUC lists the clients the user authorized.
+type ListConsentsUC interface {
+	Execute(ctx context.Context, p *Principal) ([]*ConsentOfClient, error)
+}
+
+type listConsentsUC struct {
+	clientRepo  OAuthClientRepo
+	consentRepo ConsentRepo
+}
+
+func NewListConsentsUC(clientRepo OAuthClientRepo, consentRepo ConsentRepo) ListConsentsUC {
+	return &listConsentsUC{clientRepo: clientRepo, consentRepo: consentRepo}
+}
+
+func (l *listConsentsUC) Execute(ctx context.Context, p *Principal) ([]*ConsentOfClient, error) {
+	consents, err := l.consentRepo.List(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*ConsentOfClient, 0, len(consents))
+	for _, c := range consents {
+		client, err := l.clientRepo.Get(ctx, c.ClientID)
+		if err != nil && !errors.Is(err, ErrOAuthClientNotFound) {
+			return nil, err
+		}
+		consent := &ConsentOfClient{Consent: c}
+		if client != nil {
+			consent.ClientName = client.Name
+		}
+		res = append(res, consent)
+	}
+	return res, nil
+}
+
+// RevokeConsentUC withdraws the consent of the user to a client, and ends the sessions of the client,
+// so that the client has to ask the user again.
+type RevokeConsentUC interface {
+	Execute(ctx context.Context, p *Principal, clientID string) error
+}
+
+type revokeConsentUC struct {
+	consentRepo    ConsentRepo
+	sessionRepo    SessionRepo
+	revocationRepo RevocationRepo
+}
+
+func NewRevokeConsentUC(consentRepo ConsentRepo, sessionRepo SessionRepo, revocationRepo RevocationRepo) RevokeConsentUC {
+	return &revokeConsentUC{consentRepo: consentRepo, sessionRepo: sessionRepo, revocationRepo: revocationRepo}
+}
+
+func (r *revokeConsentUC) Execute(ctx context.Context, p *Principal, clientID string) error {
+	if err := r.consentRepo.Delete(ctx, p.UserID, clientID); err != nil {
+		return err
+	}
+
+	sessions, err := r.sessionRepo.List(ctx, p.UserID)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if s.ClientID != clientID {
+			continue
+		}
+		if err := endSession(ctx, r.sessionRepo, r.revocationRepo, p.UserID, s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type RegisterOAuthClientReq struct {
+	Name         string
+	RedirectURIs []string
+	Scopes       []domain.Scope
+	GrantTypes   []domain.GrantType
+	Confidential bool
+	FirstParty   bool
+}
+
+// RegisterOAuthClientUC registers a client for operators. The secret of a confidential client is returned once.
+type RegisterOAuthClientUC interface {
+	Execute(ctx context.Context, req *RegisterOAuthClientReq) (client *domain.OAuthClient, secret string, err error)
+}
+
+type registerOAuthClientUC struct {
+	clientRepo OAuthClientRepo
+}
+
+func NewRegisterOAuthClientUC(clientRepo OAuthClientRepo) RegisterOAuthClientUC {
+	return &registerOAuthClientUC{clientRepo: clientRepo}
+}
+
+func (r *registerOAuthClientUC) Execute(
+	ctx context.Context, req *RegisterOAuthClientReq,
+) (*domain.OAuthClient, string, error) {
+	if err := validateClientMetadata(req); err != nil {
+		return nil, "", err
+	}
+
+	client, secret, err := domain.NewOAuthClient(
+		req.Name, req.RedirectURIs, req.Scopes, req.GrantTypes, req.Confidential, req.FirstParty,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := r.clientRepo.Create(ctx, client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+func validateClientMetadata(req *RegisterOAuthClientReq) error {
+	for _, g := range req.GrantTypes {
+		if !g.IsValid() {
+			return fmt.Errorf("%w: unsupported grant type %s", ErrInvalidClientMetadata, g)
+		}
+	}
+	for _, s := range req.Scopes {
+		if !domain.IsValidClientScope(s) {
+			return fmt.Errorf("%w: unknown scope %s", ErrInvalidClientMetadata, s)
+		}
+	}
+	if slices.Contains(req.GrantTypes, domain.GrantClientCredentials) && !req.Confidential {
+		return fmt.Errorf("%w: client_credentials requires a confidential client", ErrInvalidClientMetadata)
+	}
+	if slices.Contains(req.GrantTypes, domain.GrantRefreshToken) &&
+		!slices.Contains(req.GrantTypes, domain.GrantAuthorizationCode) {
+		return fmt.Errorf("%w: refresh_token requires authorization_code", ErrInvalidClientMetadata)
+	}
+	if slices.Contains(req.GrantTypes, domain.GrantAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		return fmt.Errorf("%w: authorization_code requires redirect URIs", ErrInvalidClientMetadata)
+	}
+	for _, uri := range req.RedirectURIs {
+		// fragments are not allowed, as the code is sent in the query. (RFC 6749 Section 3.1.2)
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return fmt.Errorf("%w: invalid redirect URI %s", ErrInvalidClientMetadata, uri)
+		}
+	}
+	return nil
+}
+
+// ListOAuthClientsUC lists the registered clients for operators.
+type ListOAuthClientsUC interface {
+	Execute(ctx context.Context) ([]*domain.OAuthClient, error)
+}
+
+type listOAuthClientsUC struct {
+	clientRepo OAuthClientRepo
+}
+
+func NewListOAuthClientsUC(clientRepo OAuthClientRepo) ListOAuthClientsUC {
+	return &listOAuthClientsUC{clientRepo: clientRepo}
+}
+
+func (l *listOAuthClientsUC) Execute(ctx context.Context) ([]*domain.OAuthClient, error) {
+	return l.clientRepo.List(ctx)
+}
+
+// DeleteOAuthClientUC deletes a client. Its refresh tokens can't be used anymore, as the client can't be
+// authenticated, and its access tokens expire soon.
+type DeleteOAuthClientUC interface {
+	Execute(ctx context.Context, id string) error
+}
+
+type deleteOAuthClientUC struct {
+	clientRepo OAuthClientRepo
+}
+
+func NewDeleteOAuthClientUC(clientRepo OAuthClientRepo) DeleteOAuthClientUC {
+	return &deleteOAuthClientUC{clientRepo: clientRepo}
+}
+
+func (d *deleteOAuthClientUC) Execute(ctx context.Context, id string) error {
+	return d.clientRepo.Delete(ctx, id)
+}
@@ -0,0 +1,462 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/oidcutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+const (
+	// OIDCAuthRequestExpiresIn is how long the user has to sign in at the provider.
+	OIDCAuthRequestExpiresIn = 10 * time.Minute
+	// maxSignupUsernameAttempts bounds retries of generated usernames which happen to be taken.
+	maxSignupUsernameAttempts = 3
+)
+
+// oidcAuthenticator sends users to OpenID providers and verifies them when they come back.
+type oidcAuthenticator struct {
+	providers   map[string]*oidcutil.Provider
+	requestRepo OIDCAuthRequestRepo
+}
+
+// begin saves an authorization request for the purpose and returns the URL of the provider to sign in at.
+func (o *oidcAuthenticator) begin(
+	ctx context.Context, providerName string, purpose domain.OIDCAuthPurpose, userID uuid.UUID,
+) (string, error) {
+	provider, ok := o.providers[providerName]
+	if !ok {
+		return "", ErrUnknownIdentityProvider
+	}
+
+	r, state, codeChallenge, err := domain.NewOIDCAuthRequest(purpose, providerName, userID, OIDCAuthRequestExpiresIn)
+	if err != nil {
+		return "", err
+	}
+	if err := o.requestRepo.Save(ctx, r); err != nil {
+		return "", err
+	}
+	return provider.AuthCodeURL(ctx, state, r.Nonce, codeChallenge)
+}
+
+// finish consumes the authorization request of the state, and redeems the code for the claims of the user.
+func (o *oidcAuthenticator) finish(
+	ctx context.Context, state, code string, purpose domain.OIDCAuthPurpose,
+) (*domain.OIDCAuthRequest, *oidcutil.Claims, error) {
+	r, err := o.requestRepo.Consume(ctx, domain.HashOIDCState(state))
+	if errors.Is(err, ErrOIDCAuthRequestNotFound) {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidOIDCCallback, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.Purpose != purpose {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidOIDCCallback, ErrOIDCAuthRequestNotFound)
+	}
+	// the provider may have been removed from the configuration in the meantime.
+	provider, ok := o.providers[r.Provider]
+	if !ok {
+		return nil, nil, ErrUnknownIdentityProvider
+	}
+
+	claims, err := provider.Exchange(ctx, code, r.CodeVerifier, r.Nonce)
+	if errors.Is(err, oidcutil.ErrTokenRejected) || errors.Is(err, oidcutil.ErrInvalidIDToken) {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidOIDCCallback, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, claims, nil
+}
+
+// BeginOIDCLoginUC starts a login with an OpenID provider, which users without an account sign up with.
+// The user is sent to the returned URL, and the provider redirects back to the web app with the state and the code.
+type BeginOIDCLoginUC interface {
+	Execute(ctx context.Context, provider string) (authURL string, err error)
+}
+
+type beginOIDCLoginUC struct {
+	oidc *oidcAuthenticator
+}
+
+func NewBeginOIDCLoginUC(providers map[string]*oidcutil.Provider, requestRepo OIDCAuthRequestRepo) BeginOIDCLoginUC {
+	return &beginOIDCLoginUC{oidc: &oidcAuthenticator{providers: providers, requestRepo: requestRepo}}
+}
+
+func (b *beginOIDCLoginUC) Execute(ctx context.Context, provider string) (string, error) {
+	return b.oidc.begin(ctx, provider, domain.OIDCLogin, uuid.Nil)
+}
+
+type FinishOIDCLoginReq struct {
+	State  string
+	Code   string
+	Device *domain.Device
+	// Principal is of the user logging in. A guest logging in with an identity not linked to any user yet
+	// is upgraded to a full account with it, instead of signing up a new user.
+	Principal *Principal
+}
+
+type OIDCLoginRes struct {
+	Token        string
+	RefreshToken string
+	// MFAToken is set instead of the tokens if the user has enabled MFA, as for BasicLoginUC.
+	MFAToken string
+	// SignedUp tells that a user was created for the identity, or the guest was upgraded with it.
+	SignedUp bool
+}
+
+// FinishOIDCLoginUC logs in the user the identity is linked to, or signs up a new user with it.
+// An identity is never linked automatically to an existing user with the same email address,
+// as it would let whoever controls the address at the provider take over the account.
+// The user must log in and link the identity instead.
+type FinishOIDCLoginUC interface {
+	Execute(ctx context.Context, req *FinishOIDCLoginReq) (*OIDCLoginRes, error)
+}
+
+type finishOIDCLoginUC struct {
+	userRepo      UserRepo
+	identityRepo  IdentityRepo
+	mfaRepo       MFARepo
+	challengeRepo MFAChallengeRepo
+	oidc          *oidcAuthenticator
+	issuer        *sessionIssuer
+}
+
+func NewFinishOIDCLoginUC(
+	userRepo UserRepo, sessionRepo SessionRepo, identityRepo IdentityRepo, mfaRepo MFARepo,
+	challengeRepo MFAChallengeRepo, manager TokenManager, auditLog AuditLog,
+	providers map[string]*oidcutil.Provider, requestRepo OIDCAuthRequestRepo,
+) FinishOIDCLoginUC {
+	return &finishOIDCLoginUC{
+		userRepo:      userRepo,
+		identityRepo:  identityRepo,
+		mfaRepo:       mfaRepo,
+		challengeRepo: challengeRepo,
+		oidc:          &oidcAuthenticator{providers: providers, requestRepo: requestRepo},
+		issuer:        &sessionIssuer{sessionRepo: sessionRepo, tokenManager: manager, auditLog: auditLog},
+	}
+}
+
+func (f *finishOIDCLoginUC) Execute(ctx context.Context, req *FinishOIDCLoginReq) (*OIDCLoginRes, error) {
+	r, claims, err := f.oidc.finish(ctx, req.State, req.Code, domain.OIDCLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	var u *domain.User
+	signedUp := false
+	identity, err := f.identityRepo.Get(ctx, r.Provider, claims.Subject)
+	switch {
+	case errors.Is(err, ErrIdentityNotFound):
+		u, err = guestOf(ctx, f.userRepo, req.Principal)
+		if err != nil {
+			return nil, err
+		}
+		if u != nil {
+			err = f.upgrade(ctx, u, r.Provider, claims)
+		} else {
+			u, err = f.signup(ctx, r.Provider, claims)
+		}
+		if err != nil {
+			return nil, err
+		}
+		signedUp = true
+	case err != nil:
+		return nil, err
+	default:
+		u, err = f.userRepo.Get(ctx, identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if u.IsDisabled() {
+		return nil, ErrUserDisabled
+	}
+
+	// the provider is a single factor, so the second factor is required as for passwords.
+	mfaToken, err := challengeMFA(ctx, f.mfaRepo, f.challengeRepo, u)
+	if err != nil {
+		return nil, err
+	}
+	if mfaToken != "" {
+		return &OIDCLoginRes{MFAToken: mfaToken}, nil
+	}
+
+	tokens, err := f.issuer.start(ctx, u, req.Device, domain.AuthMethodFederated)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCLoginRes{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken, SignedUp: signedUp}, nil
+}
+
+// signup creates a user without password for the identity. The username is generated, and can be changed later.
+func (f *finishOIDCLoginUC) signup(ctx context.Context, provider string, claims *oidcutil.Claims) (*domain.User, error) {
+	email, err := f.signupEmail(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	u := &domain.User{
+		ID:        uuid.New(),
+		Roles:     domain.DefaultRoles(),
+		Email:     email,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	// the address is trusted only if the provider verified it.
+	if email != "" && bool(claims.EmailVerified) {
+		u.EmailVerifiedAt = now
+	}
+
+	for range maxSignupUsernameAttempts {
+		u.Username = signupUsername(provider)
+		_, err = f.userRepo.Create(ctx, u)
+		if !errors.Is(err, ErrUsernameAlreadyExists) {
+			break
+		}
+	}
+	if errors.Is(err, ErrEmailAlreadyExists) {
+		return nil, ErrIdentityNotLinked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.identityRepo.Create(ctx, domain.NewIdentity(u.ID, provider, claims)); err != nil {
+		// the same identity signed up concurrently. The user created for nothing must not be left behind.
+		if err := f.userRepo.Delete(ctx, u); err != nil {
+			logutil.From(ctx).Warn("failed to delete user of failed signup", slog.Any("err", err))
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+// upgrade links the identity to the guest, and upgrades the guest to a full account logging in with it.
+// The username of the guest is replaced by one generated as for signup.
+func (f *finishOIDCLoginUC) upgrade(
+	ctx context.Context, u *domain.User, provider string, claims *oidcutil.Claims,
+) error {
+	email, err := f.signupEmail(ctx, claims)
+	if err != nil {
+		return err
+	}
+
+	// the identity is linked first, so that the upgraded user can always log in with it.
+	identity := domain.NewIdentity(u.ID, provider, claims)
+	if err := f.identityRepo.Create(ctx, identity); err != nil {
+		return err
+	}
+
+	prevUsername := u.Username
+	u.Email = email
+	if email != "" && bool(claims.EmailVerified) {
+		u.EmailVerifiedAt = time.Now()
+	}
+	u.Upgrade()
+	for range maxSignupUsernameAttempts {
+		u.Username = signupUsername(provider)
+		err = f.userRepo.UpgradeGuest(ctx, u, prevUsername)
+		if !errors.Is(err, ErrUsernameAlreadyExists) {
+			break
+		}
+	}
+	if err != nil {
+		// the guest is left as it was, and its identity must not outlive it.
+		if err := f.identityRepo.Delete(ctx, u.ID, identity.Provider, identity.Subject); err != nil {
+			logutil.From(ctx).Warn("failed to unlink identity of failed upgrade", slog.Any("err", err))
+		}
+		if errors.Is(err, ErrEmailAlreadyExists) {
+			return ErrIdentityNotLinked
+		}
+		return err
+	}
+	return nil
+}
+
+// signupEmail returns the email address of the identity for the user signing up with it.
+// ErrIdentityNotLinked is returned if the address is of another user, who must log in and link the identity.
+func (f *finishOIDCLoginUC) signupEmail(ctx context.Context, claims *oidcutil.Claims) (string, error) {
+	email := domain.NormalizeEmail(claims.Email)
+	if email == "" {
+		return "", nil
+	}
+	_, err := f.userRepo.GetByEmail(ctx, email)
+	if err == nil {
+		return "", ErrIdentityNotLinked
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return "", err
+	}
+	return email, nil
+}
+
+// signupUsername generates a username for users signed up with a provider, e.g. "google_1b4e28ba".
+func signupUsername(provider string) string {
+	if len(provider) > 20 {
+		provider = provider[:20]
+	}
+	return provider + "_" + uuid.NewString()[:8]
+}
+
+// BeginOIDCLinkUC starts linking an identity of an OpenID provider to the user.
+type BeginOIDCLinkUC interface {
+	Execute(ctx context.Context, p *Principal, provider string) (authURL string, err error)
+}
+
+type beginOIDCLinkUC struct {
+	oidc *oidcAuthenticator
+}
+
+func NewBeginOIDCLinkUC(providers map[string]*oidcutil.Provider, requestRepo OIDCAuthRequestRepo) BeginOIDCLinkUC {
+	return &beginOIDCLinkUC{oidc: &oidcAuthenticator{providers: providers, requestRepo: requestRepo}}
+}
+
+func (b *beginOIDCLinkUC) Execute(ctx context.Context, p *Principal, provider string) (string, error) {
+	return b.oidc.begin(ctx, provider, domain.OIDCLink, p.UserID)
+}
+
+type FinishOIDCLinkReq struct {
+	State string
+	Code  string
+}
+
+// FinishOIDCLinkUC links the identity the user signed in with at the provider.
+// A guest linking an identity is upgraded to a full account logging in with it.
+type FinishOIDCLinkUC interface {
+	Execute(ctx context.Context, p *Principal, req *FinishOIDCLinkReq) (*domain.Identity, error)
+}
+
+type finishOIDCLinkUC struct {
+	userRepo     UserRepo
+	identityRepo IdentityRepo
+	oidc         *oidcAuthenticator
+}
+
+func NewFinishOIDCLinkUC(
+	userRepo UserRepo, identityRepo IdentityRepo, providers map[string]*oidcutil.Provider,
+	requestRepo OIDCAuthRequestRepo,
+) FinishOIDCLinkUC {
+	return &finishOIDCLinkUC{
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		oidc:         &oidcAuthenticator{providers: providers, requestRepo: requestRepo},
+	}
+}
+
+func (f *finishOIDCLinkUC) Execute(ctx context.Context, p *Principal, req *FinishOIDCLinkReq) (*domain.Identity, error) {
+	r, claims, err := f.oidc.finish(ctx, req.State, req.Code, domain.OIDCLink)
+	if err != nil {
+		return nil, err
+	}
+	// the request must have been started by the same user.
+	if r.UserID != p.UserID {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOIDCCallback, ErrOIDCAuthRequestNotFound)
+	}
+
+	identity := domain.NewIdentity(p.UserID, r.Provider, claims)
+	if err := f.identityRepo.Create(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	// a guest can log in with the identity from now on, so it is no longer a guest.
+	u, err := guestOf(ctx, f.userRepo, p)
+	if err != nil {
+		return nil, err
+	}
+	if u != nil {
+		u.Upgrade()
+		if err := f.userRepo.UpgradeGuest(ctx, u, u.Username); err != nil {
+			return nil, err
+		}
+	}
+	return identity, nil
+}
+
+// ListIdentitiesUC lists the identities linked to the user.
+type ListIdentitiesUC interface {
+	Execute(ctx context.Context, p *Principal) ([]*domain.Identity, error)
+}
+
+type listIdentitiesUC struct {
+	identityRepo IdentityRepo
+}
+
+func NewListIdentitiesUC(identityRepo IdentityRepo) ListIdentitiesUC {
+	return &listIdentitiesUC{identityRepo: identityRepo}
+}
+
+func (l *listIdentitiesUC) Execute(ctx context.Context, p *Principal) ([]*domain.Identity, error) {
+	return l.identityRepo.List(ctx, p.UserID)
+}
+
+// UnlinkIdentityUC unlinks an identity from the user.
+// The last identity of a user without password nor passkey can't be unlinked, or the user couldn't log in anymore.
+type UnlinkIdentityUC interface {
+	Execute(ctx context.Context, p *Principal, provider, subject string) error
+}
+
+type unlinkIdentityUC struct {
+	userRepo     UserRepo
+	identityRepo IdentityRepo
+	passkeyRepo  PasskeyRepo
+}
+
+func NewUnlinkIdentityUC(userRepo UserRepo, identityRepo IdentityRepo, passkeyRepo PasskeyRepo) UnlinkIdentityUC {
+	return &unlinkIdentityUC{userRepo: userRepo, identityRepo: identityRepo, passkeyRepo: passkeyRepo}
+}
+
+func (u *unlinkIdentityUC) Execute(ctx context.Context, p *Principal, provider, subject string) error {
+	hasOtherLogin, err := u.hasOtherLogin(ctx, p.UserID, provider, subject)
+	if err != nil {
+		return err
+	}
+	if !hasOtherLogin {
+		return ErrLastLoginMethod
+	}
+
+	// identities are looked up under the user partition, so a user can never unlink identities of others.
+	return u.identityRepo.Delete(ctx, p.UserID, provider, subject)
+}
+
+// hasOtherLogin reports whether the user can log in without the identity.
+func (u *unlinkIdentityUC) hasOtherLogin(ctx context.Context, userID uuid.UUID, provider, subject string) (bool, error) {
+	user, err := u.userRepo.Get(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if user.HasPassword() {
+		return true, nil
+	}
+
+	identities, err := u.identityRepo.List(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	for _, i := range identities {
+		if i.Provider == provider && i.Subject == subject {
+			found = true
+		} else {
+			return true, nil
+		}
+	}
+	if !found {
+		return false, ErrIdentityNotFound
+	}
+
+	passkeys, err := u.passkeyRepo.List(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return len(passkeys) > 0, nil
+}
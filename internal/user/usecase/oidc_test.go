@@ -0,0 +1,214 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/oidcutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/infra"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+type oidcFixture struct {
+	fake        *oidcutil.FakeProvider
+	users       *memUserRepo
+	identities  *memIdentityRepo
+	resolve     usecase.ResolvePrincipalUC
+	beginLogin  usecase.BeginOIDCLoginUC
+	finishLogin usecase.FinishOIDCLoginUC
+	beginLink   usecase.BeginOIDCLinkUC
+	finishLink  usecase.FinishOIDCLinkUC
+}
+
+// newOIDCFixture serves a FakeProvider configured as the provider "fake".
+func newOIDCFixture(t *testing.T) *oidcFixture {
+	t.Helper()
+	fake, err := oidcutil.NewFakeProvider("zenbu", "secret")
+	if err != nil {
+		t.Fatalf("failed to create fake provider: %v", err)
+	}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	providers := map[string]*oidcutil.Provider{
+		"fake": {
+			Issuer:       srv.URL,
+			ClientID:     "zenbu",
+			ClientSecret: "secret",
+			RedirectURL:  "https://zenbu.example.com/oidc/callback",
+			HTTPClient:   srv.Client(),
+		},
+	}
+
+	users := newMemUserRepo()
+	sessions := newMemSessionRepo()
+	identities := newMemIdentityRepo()
+	requests := newMemOIDCAuthRequestRepo()
+	tokens := newTokenManager(t)
+	return &oidcFixture{
+		fake:       fake,
+		users:      users,
+		identities: identities,
+		resolve: usecase.NewResolvePrincipalUC(
+			users, nil, infra.NewCachedRevocationRepo(noRevocationRepo{}), nil, tokens,
+		),
+		beginLogin: usecase.NewBeginOIDCLoginUC(providers, requests),
+		finishLogin: usecase.NewFinishOIDCLoginUC(users, sessions, identities, noMFARepo{}, nil, tokens,
+			&discardAuditLog{}, providers, requests),
+		beginLink:  usecase.NewBeginOIDCLinkUC(providers, requests),
+		finishLink: usecase.NewFinishOIDCLinkUC(users, identities, providers, requests),
+	}
+}
+
+// signIn follows the authorization URL at the fake provider and returns the callback to zenbu.
+func (f *oidcFixture) signIn(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	callback, err := f.fake.SignIn(context.Background(), authURL)
+	if err != nil {
+		t.Fatalf("failed to sign in at the provider: %v", err)
+	}
+	return callback.Query()
+}
+
+func (f *oidcFixture) login(t *testing.T) (*usecase.OIDCLoginRes, error) {
+	t.Helper()
+	authURL, err := f.beginLogin.Execute(context.Background(), "fake")
+	if err != nil {
+		t.Fatalf("failed to begin login: %v", err)
+	}
+	callback := f.signIn(t, authURL)
+	return f.finishLogin.Execute(context.Background(), &usecase.FinishOIDCLoginReq{
+		State:  callback.Get("state"),
+		Code:   callback.Get("code"),
+		Device: &domain.Device{Name: "test"},
+	})
+}
+
+func TestOIDCLogin_SignsUpThenLogsIn(t *testing.T) {
+	f := newOIDCFixture(t)
+	f.fake.SetIdentity(oidcutil.FakeIdentity{Subject: "bob", Email: "bob@example.com", EmailVerified: true})
+
+	res, err := f.login(t)
+	if err != nil {
+		t.Fatalf("failed to sign up: %v", err)
+	}
+	if !res.SignedUp {
+		t.Error("the first login didn't sign up")
+	}
+	p, err := f.resolve.Execute(context.Background(), &usecase.ResolvePrincipalReq{Token: res.Token})
+	if err != nil {
+		t.Fatalf("failed to resolve the token: %v", err)
+	}
+	u, err := f.users.Get(context.Background(), p.UserID)
+	if err != nil {
+		t.Fatalf("failed to get the user signed up: %v", err)
+	}
+	if u.Email != "bob@example.com" || !u.IsEmailVerified() {
+		t.Errorf("email = %q (verified: %v), want the verified one of the identity", u.Email, u.IsEmailVerified())
+	}
+
+	res, err = f.login(t)
+	if err != nil {
+		t.Fatalf("failed to log in: %v", err)
+	}
+	if res.SignedUp {
+		t.Error("the second login signed up again")
+	}
+	p2, err := f.resolve.Execute(context.Background(), &usecase.ResolvePrincipalReq{Token: res.Token})
+	if err != nil {
+		t.Fatalf("failed to resolve the token: %v", err)
+	}
+	if p2.UserID != p.UserID {
+		t.Errorf("logged in as %s, want %s", p2.UserID, p.UserID)
+	}
+}
+
+func TestOIDCLink_ExistingAccount(t *testing.T) {
+	ctx := context.Background()
+	f := newOIDCFixture(t)
+	u := createUser(t, f.users, "alice", "correct horse battery")
+	u.Email = "alice@example.com"
+	if err := f.users.Update(ctx, u, u.UpdatedAt); err != nil {
+		t.Fatalf("failed to set email: %v", err)
+	}
+	f.fake.SetIdentity(oidcutil.FakeIdentity{Subject: "alice", Email: "alice@example.com", EmailVerified: true})
+
+	// the address is of an existing user, who must link the identity rather than sign up again.
+	if _, err := f.login(t); !errors.Is(err, usecase.ErrIdentityNotLinked) {
+		t.Fatalf("login before linking: got %v, want %v", err, usecase.ErrIdentityNotLinked)
+	}
+
+	p := &usecase.Principal{UserID: u.ID}
+	authURL, err := f.beginLink.Execute(ctx, p, "fake")
+	if err != nil {
+		t.Fatalf("failed to begin link: %v", err)
+	}
+	callback := f.signIn(t, authURL)
+	identity, err := f.finishLink.Execute(ctx, p, &usecase.FinishOIDCLinkReq{
+		State: callback.Get("state"),
+		Code:  callback.Get("code"),
+	})
+	if err != nil {
+		t.Fatalf("failed to link: %v", err)
+	}
+	if identity.UserID != u.ID || identity.Subject != "alice" {
+		t.Errorf("linked %+v, want the identity linked to alice", identity)
+	}
+
+	res, err := f.login(t)
+	if err != nil {
+		t.Fatalf("failed to log in after linking: %v", err)
+	}
+	if res.SignedUp {
+		t.Error("login after linking signed up")
+	}
+	loggedIn, err := f.resolve.Execute(ctx, &usecase.ResolvePrincipalReq{Token: res.Token})
+	if err != nil {
+		t.Fatalf("failed to resolve the token: %v", err)
+	}
+	if loggedIn.UserID != u.ID {
+		t.Errorf("logged in as %s, want alice %s", loggedIn.UserID, u.ID)
+	}
+}
+
+func TestOIDCLogin_StateMismatch(t *testing.T) {
+	ctx := context.Background()
+	f := newOIDCFixture(t)
+
+	authURL, err := f.beginLogin.Execute(ctx, "fake")
+	if err != nil {
+		t.Fatalf("failed to begin login: %v", err)
+	}
+	callback := f.signIn(t, authURL)
+
+	_, err = f.finishLogin.Execute(ctx, &usecase.FinishOIDCLoginReq{
+		State: "forged state",
+		Code:  callback.Get("code"),
+	})
+	if !errors.Is(err, usecase.ErrInvalidOIDCCallback) {
+		t.Errorf("got %v, want %v", err, usecase.ErrInvalidOIDCCallback)
+	}
+}
+
+func TestOIDCLogin_StateOfLinkIsRejected(t *testing.T) {
+	ctx := context.Background()
+	f := newOIDCFixture(t)
+	u := createUser(t, f.users, "alice", "correct horse battery")
+
+	authURL, err := f.beginLink.Execute(ctx, &usecase.Principal{UserID: u.ID}, "fake")
+	if err != nil {
+		t.Fatalf("failed to begin link: %v", err)
+	}
+	callback := f.signIn(t, authURL)
+
+	_, err = f.finishLogin.Execute(ctx, &usecase.FinishOIDCLoginReq{
+		State: callback.Get("state"),
+		Code:  callback.Get("code"),
+	})
+	if !errors.Is(err, usecase.ErrInvalidOIDCCallback) {
+		t.Errorf("got %v, want %v", err, usecase.ErrInvalidOIDCCallback)
+	}
+}
@@ -0,0 +1,314 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/webauthnutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+const (
+	// WebAuthnCeremonyExpiresIn is how long the user has to respond to the authenticator prompt.
+	WebAuthnCeremonyExpiresIn = 5 * time.Minute
+	MaxPasskeysPerUser        = 20
+)
+
+// consumeWebAuthnCeremony returns the pending ceremony for the purpose. A ceremony can be consumed only once.
+func consumeWebAuthnCeremony(
+	ctx context.Context, ceremonyRepo WebAuthnCeremonyRepo, id uuid.UUID, purpose domain.WebAuthnCeremonyPurpose,
+) (*domain.WebAuthnCeremony, error) {
+	c, err := ceremonyRepo.Consume(ctx, id)
+	if errors.Is(err, ErrWebAuthnCeremonyNotFound) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidWebAuthnResponse, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.Purpose != purpose {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidWebAuthnResponse, ErrWebAuthnCeremonyNotFound)
+	}
+	return c, nil
+}
+
+type PasskeyRegistrationOptions struct {
+	CeremonyID uuid.UUID
+	Challenge  []byte
+	RPID       string
+	RPName     string
+	UserID     uuid.UUID
+	Username   string
+	// ExcludeCredentialIDs are passkeys registered already, so that an authenticator doesn't register twice.
+	ExcludeCredentialIDs [][]byte
+}
+
+// BeginPasskeyRegistrationUC starts registering a passkey of the user.
+// The options are given to navigator.credentials.create() and the response to FinishPasskeyRegistrationUC.
+type BeginPasskeyRegistrationUC interface {
+	Execute(ctx context.Context, p *Principal) (*PasskeyRegistrationOptions, error)
+}
+
+type beginPasskeyRegistrationUC struct {
+	userRepo     UserRepo
+	passkeyRepo  PasskeyRepo
+	ceremonyRepo WebAuthnCeremonyRepo
+	rp           *webauthnutil.RelyingParty
+	rpName       string
+}
+
+func NewBeginPasskeyRegistrationUC(
+	userRepo UserRepo, passkeyRepo PasskeyRepo, ceremonyRepo WebAuthnCeremonyRepo,
+	rp *webauthnutil.RelyingParty, rpName string,
+) BeginPasskeyRegistrationUC {
+	return &beginPasskeyRegistrationUC{
+		userRepo: userRepo, passkeyRepo: passkeyRepo, ceremonyRepo: ceremonyRepo, rp: rp, rpName: rpName,
+	}
+}
+
+func (b *beginPasskeyRegistrationUC) Execute(ctx context.Context, p *Principal) (*PasskeyRegistrationOptions, error) {
+	u, err := b.userRepo.Get(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := rejectGuest(u, "register a passkey"); err != nil {
+		return nil, err
+	}
+	passkeys, err := b.passkeyRepo.List(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(passkeys) >= MaxPasskeysPerUser {
+		return nil, ErrTooManyPasskeys
+	}
+
+	c, err := domain.NewWebAuthnCeremony(domain.WebAuthnRegistration, u.ID, WebAuthnCeremonyExpiresIn)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.ceremonyRepo.Save(ctx, c); err != nil {
+		return nil, err
+	}
+
+	exclude := make([][]byte, 0, len(passkeys))
+	for _, pk := range passkeys {
+		exclude = append(exclude, pk.ID)
+	}
+	return &PasskeyRegistrationOptions{
+		CeremonyID:           c.ID,
+		Challenge:            c.Challenge,
+		RPID:                 b.rp.ID,
+		RPName:               b.rpName,
+		UserID:               u.ID,
+		Username:             u.Username,
+		ExcludeCredentialIDs: exclude,
+	}, nil
+}
+
+type FinishPasskeyRegistrationReq struct {
+	CeremonyID        uuid.UUID
+	Name              string
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// FinishPasskeyRegistrationUC verifies the response of the authenticator and registers the passkey.
+type FinishPasskeyRegistrationUC interface {
+	Execute(ctx context.Context, p *Principal, req *FinishPasskeyRegistrationReq) (*domain.Passkey, error)
+}
+
+type finishPasskeyRegistrationUC struct {
+	passkeyRepo  PasskeyRepo
+	ceremonyRepo WebAuthnCeremonyRepo
+	rp           *webauthnutil.RelyingParty
+}
+
+func NewFinishPasskeyRegistrationUC(
+	passkeyRepo PasskeyRepo, ceremonyRepo WebAuthnCeremonyRepo, rp *webauthnutil.RelyingParty,
+) FinishPasskeyRegistrationUC {
+	return &finishPasskeyRegistrationUC{passkeyRepo: passkeyRepo, ceremonyRepo: ceremonyRepo, rp: rp}
+}
+
+func (f *finishPasskeyRegistrationUC) Execute(
+	ctx context.Context, p *Principal, req *FinishPasskeyRegistrationReq,
+) (*domain.Passkey, error) {
+	c, err := consumeWebAuthnCeremony(ctx, f.ceremonyRepo, req.CeremonyID, domain.WebAuthnRegistration)
+	if err != nil {
+		return nil, err
+	}
+	// the ceremony must have been started by the same user.
+	if c.UserID != p.UserID {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidWebAuthnResponse, ErrWebAuthnCeremonyNotFound)
+	}
+
+	cred, err := f.rp.VerifyRegistration(c.Challenge, req.ClientDataJSON, req.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidWebAuthnResponse, err)
+	}
+
+	passkeys, err := f.passkeyRepo.List(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(passkeys) >= MaxPasskeysPerUser {
+		return nil, ErrTooManyPasskeys
+	}
+
+	passkey := domain.NewPasskey(p.UserID, req.Name, cred)
+	if err := f.passkeyRepo.Create(ctx, passkey); err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
+
+type PasskeyLoginOptions struct {
+	CeremonyID uuid.UUID
+	Challenge  []byte
+	RPID       string
+}
+
+// BeginPasskeyLoginUC starts a login by a passkey.
+// The user is not known until the authenticator responds, as passkeys are discoverable.
+type BeginPasskeyLoginUC interface {
+	Execute(ctx context.Context) (*PasskeyLoginOptions, error)
+}
+
+type beginPasskeyLoginUC struct {
+	ceremonyRepo WebAuthnCeremonyRepo
+	rp           *webauthnutil.RelyingParty
+}
+
+func NewBeginPasskeyLoginUC(ceremonyRepo WebAuthnCeremonyRepo, rp *webauthnutil.RelyingParty) BeginPasskeyLoginUC {
+	return &beginPasskeyLoginUC{ceremonyRepo: ceremonyRepo, rp: rp}
+}
+
+func (b *beginPasskeyLoginUC) Execute(ctx context.Context) (*PasskeyLoginOptions, error) {
+	c, err := domain.NewWebAuthnCeremony(domain.WebAuthnLogin, uuid.Nil, WebAuthnCeremonyExpiresIn)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.ceremonyRepo.Save(ctx, c); err != nil {
+		return nil, err
+	}
+	return &PasskeyLoginOptions{CeremonyID: c.ID, Challenge: c.Challenge, RPID: b.rp.ID}, nil
+}
+
+type FinishPasskeyLoginReq struct {
+	CeremonyID        uuid.UUID
+	CredentialID      []byte
+	UserHandle        []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	Device            *domain.Device
+}
+
+// FinishPasskeyLoginUC verifies the assertion of the passkey and starts a session.
+// The authenticator verifies the user, so neither a password nor another factor is needed.
+type FinishPasskeyLoginUC interface {
+	Execute(ctx context.Context, req *FinishPasskeyLoginReq) (*TokenPair, error)
+}
+
+type finishPasskeyLoginUC struct {
+	userRepo     UserRepo
+	passkeyRepo  PasskeyRepo
+	ceremonyRepo WebAuthnCeremonyRepo
+	rp           *webauthnutil.RelyingParty
+	issuer       *sessionIssuer
+}
+
+func NewFinishPasskeyLoginUC(
+	userRepo UserRepo, sessionRepo SessionRepo, passkeyRepo PasskeyRepo, ceremonyRepo WebAuthnCeremonyRepo,
+	manager TokenManager, auditLog AuditLog, rp *webauthnutil.RelyingParty,
+) FinishPasskeyLoginUC {
+	return &finishPasskeyLoginUC{
+		userRepo:     userRepo,
+		passkeyRepo:  passkeyRepo,
+		ceremonyRepo: ceremonyRepo,
+		rp:           rp,
+		issuer:       &sessionIssuer{sessionRepo: sessionRepo, tokenManager: manager, auditLog: auditLog},
+	}
+}
+
+func (f *finishPasskeyLoginUC) Execute(ctx context.Context, req *FinishPasskeyLoginReq) (*TokenPair, error) {
+	c, err := consumeWebAuthnCeremony(ctx, f.ceremonyRepo, req.CeremonyID, domain.WebAuthnLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	// the user handle is the user ID given at registration.
+	userID, err := uuid.FromBytes(req.UserHandle)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid user handle", ErrInvalidWebAuthnResponse)
+	}
+	passkey, err := f.passkeyRepo.Get(ctx, userID, req.CredentialID)
+	if errors.Is(err, ErrPasskeyNotFound) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidWebAuthnResponse, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signCount, err := f.rp.VerifyAssertion(
+		c.Challenge, passkey.PublicKey, req.ClientDataJSON, req.AuthenticatorData, req.Signature,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidWebAuthnResponse, err)
+	}
+
+	prevSignCount := passkey.SignCount
+	if !passkey.Use(signCount) {
+		return nil, ErrPasskeyCloned
+	}
+	if err := f.passkeyRepo.UpdateUsage(ctx, passkey, prevSignCount); err != nil {
+		return nil, err
+	}
+
+	u, err := f.userRepo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsDisabled() {
+		return nil, ErrUserDisabled
+	}
+
+	return f.issuer.start(ctx, u, req.Device, domain.AuthMethodPasskey)
+}
+
+// ListPasskeysUC lists the passkeys of the user.
+type ListPasskeysUC interface {
+	Execute(ctx context.Context, p *Principal) ([]*domain.Passkey, error)
+}
+
+type listPasskeysUC struct {
+	passkeyRepo PasskeyRepo
+}
+
+func NewListPasskeysUC(passkeyRepo PasskeyRepo) ListPasskeysUC {
+	return &listPasskeysUC{passkeyRepo: passkeyRepo}
+}
+
+func (l *listPasskeysUC) Execute(ctx context.Context, p *Principal) ([]*domain.Passkey, error) {
+	return l.passkeyRepo.List(ctx, p.UserID)
+}
+
+// DeletePasskeyUC deletes a passkey of the user, e.g. of a lost device.
+type DeletePasskeyUC interface {
+	Execute(ctx context.Context, p *Principal, id []byte) error
+}
+
+type deletePasskeyUC struct {
+	passkeyRepo PasskeyRepo
+}
+
+func NewDeletePasskeyUC(passkeyRepo PasskeyRepo) DeletePasskeyUC {
+	return &deletePasskeyUC{passkeyRepo: passkeyRepo}
+}
+
+func (d *deletePasskeyUC) Execute(ctx context.Context, p *Principal, id []byte) error {
+	// passkeys are looked up under the user partition, so a user can never delete passkeys of others.
+	return d.passkeyRepo.Delete(ctx, p.UserID, id)
+}
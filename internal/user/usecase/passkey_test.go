@@ -0,0 +1,121 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/webauthnutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+const passkeyTestOrigin = "https://zenbu.example.com"
+
+type passkeyFixture struct {
+	authenticator *webauthnutil.Authenticator
+	beginLogin    usecase.BeginPasskeyLoginUC
+	finishLogin   usecase.FinishPasskeyLoginUC
+}
+
+// newPasskeyFixture registers a passkey of a user by a software authenticator.
+func newPasskeyFixture(t *testing.T) *passkeyFixture {
+	t.Helper()
+	ctx := context.Background()
+	users := newMemUserRepo()
+	passkeys := newMemPasskeyRepo()
+	ceremonies := newMemWebAuthnCeremonyRepo()
+	rp := &webauthnutil.RelyingParty{
+		ID: "zenbu.example.com", Origins: []string{passkeyTestOrigin}, RequireUserVerification: true,
+	}
+
+	u := createUser(t, users, "alice", "correct horse battery")
+	p := &usecase.Principal{UserID: u.ID}
+	opts, err := usecase.NewBeginPasskeyRegistrationUC(users, passkeys, ceremonies, rp, "zenbu").Execute(ctx, p)
+	if err != nil {
+		t.Fatalf("failed to begin registration: %v", err)
+	}
+	authenticator := webauthnutil.NewAuthenticator(passkeyTestOrigin)
+	att, err := authenticator.Register(opts.RPID, opts.Challenge, opts.UserID[:])
+	if err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	_, err = usecase.NewFinishPasskeyRegistrationUC(passkeys, ceremonies, rp).Execute(ctx, p,
+		&usecase.FinishPasskeyRegistrationReq{
+			CeremonyID:        opts.CeremonyID,
+			Name:              "laptop",
+			ClientDataJSON:    att.ClientDataJSON,
+			AttestationObject: att.AttestationObject,
+		})
+	if err != nil {
+		t.Fatalf("failed to finish registration: %v", err)
+	}
+
+	return &passkeyFixture{
+		authenticator: authenticator,
+		beginLogin:    usecase.NewBeginPasskeyLoginUC(ceremonies, rp),
+		finishLogin: usecase.NewFinishPasskeyLoginUC(users, newMemSessionRepo(), passkeys, ceremonies,
+			newTokenManager(t), &discardAuditLog{}, rp),
+	}
+}
+
+// assert begins a login and asserts its challenge, without finishing it.
+func (f *passkeyFixture) assert(t *testing.T) *usecase.FinishPasskeyLoginReq {
+	t.Helper()
+	opts, err := f.beginLogin.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("failed to begin login: %v", err)
+	}
+	assertion, err := f.authenticator.Assert(opts.RPID, opts.Challenge)
+	if err != nil {
+		t.Fatalf("failed to assert: %v", err)
+	}
+	return &usecase.FinishPasskeyLoginReq{
+		CeremonyID:        opts.CeremonyID,
+		CredentialID:      assertion.CredentialID,
+		UserHandle:        assertion.UserHandle,
+		ClientDataJSON:    assertion.ClientDataJSON,
+		AuthenticatorData: assertion.AuthenticatorData,
+		Signature:         assertion.Signature,
+		Device:            &domain.Device{Name: "test"},
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	f := newPasskeyFixture(t)
+
+	for range 2 {
+		pair, err := f.finishLogin.Execute(context.Background(), f.assert(t))
+		if err != nil {
+			t.Fatalf("failed to log in: %v", err)
+		}
+		if pair.AccessToken == "" || pair.RefreshToken == "" {
+			t.Errorf("tokens are not issued: %+v", pair)
+		}
+	}
+}
+
+func TestPasskeyLogin_SignCountGoingBackwardsIsRejected(t *testing.T) {
+	f := newPasskeyFixture(t)
+	// the earlier assertion has the lower sign count, as if it was made by a clone of the authenticator.
+	earlier := f.assert(t)
+	later := f.assert(t)
+
+	if _, err := f.finishLogin.Execute(context.Background(), later); err != nil {
+		t.Fatalf("failed to log in: %v", err)
+	}
+	_, err := f.finishLogin.Execute(context.Background(), earlier)
+	if !errors.Is(err, usecase.ErrPasskeyCloned) {
+		t.Errorf("got %v, want %v", err, usecase.ErrPasskeyCloned)
+	}
+}
+
+func TestPasskeyLogin_WrongOriginIsRejected(t *testing.T) {
+	f := newPasskeyFixture(t)
+	f.authenticator.Origin = "https://zenbu.example.com.evil.example"
+
+	_, err := f.finishLogin.Execute(context.Background(), f.assert(t))
+	if !errors.Is(err, usecase.ErrInvalidWebAuthnResponse) {
+		t.Errorf("got %v, want %v", err, usecase.ErrInvalidWebAuthnResponse)
+	}
+}
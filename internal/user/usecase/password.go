@@ -0,0 +1,228 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/mailutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+const PasswordResetExpiresIn = time.Hour
+
+// ForgotPasswordUC sends a password reset mail to the email address of the user.
+// It succeeds whether the address is registered or not, so that it can't be used to find out registered addresses.
+type ForgotPasswordUC interface {
+	Execute(ctx context.Context, email string) error
+}
+
+type forgotPasswordUC struct {
+	userRepo  UserRepo
+	resetRepo PasswordResetRepo
+	mailer    mailutil.Mailer
+	// appBaseURL is the URL of the web app, which handles the link in the mail.
+	appBaseURL string
+}
+
+func NewForgotPasswordUC(
+	userRepo UserRepo, resetRepo PasswordResetRepo, mailer mailutil.Mailer, appBaseURL string,
+) ForgotPasswordUC {
+	return &forgotPasswordUC{userRepo: userRepo, resetRepo: resetRepo, mailer: mailer, appBaseURL: appBaseURL}
+}
+
+func (f *forgotPasswordUC) Execute(ctx context.Context, email string) error {
+	u, err := f.userRepo.GetByEmail(ctx, domain.NormalizeEmail(email))
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if u.IsDisabled() {
+		return nil
+	}
+
+	r, token, err := domain.NewPasswordReset(u.ID, u.Email, PasswordResetExpiresIn)
+	if err != nil {
+		return err
+	}
+	if err := f.resetRepo.Save(ctx, r); err != nil {
+		return err
+	}
+
+	link := f.appBaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	return f.mailer.Send(ctx, &mailutil.Mail{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Open the link below to reset your password.\n%s\n\n"+
+			"The link expires in %s. If you didn't request this, ignore this mail.\n",
+			u.Username, link, PasswordResetExpiresIn),
+	})
+}
+
+// ResetPasswordUC sets a new password by the token in the password reset mail.
+// Every token, session and API key of the user is revoked, as the old password may have been leaked.
+type ResetPasswordUC interface {
+	Execute(ctx context.Context, token, password string) error
+}
+
+type resetPasswordUC struct {
+	userRepo       UserRepo
+	resetRepo      PasswordResetRepo
+	sessionRepo    SessionRepo
+	revocationRepo RevocationRepo
+	apiKeyRepo     APIKeyRepo
+	auditLog       AuditLog
+}
+
+func NewResetPasswordUC(
+	userRepo UserRepo, resetRepo PasswordResetRepo, sessionRepo SessionRepo, revocationRepo RevocationRepo,
+	apiKeyRepo APIKeyRepo, auditLog AuditLog,
+) ResetPasswordUC {
+	return &resetPasswordUC{
+		userRepo: userRepo, resetRepo: resetRepo, sessionRepo: sessionRepo, revocationRepo: revocationRepo,
+		apiKeyRepo: apiKeyRepo, auditLog: auditLog,
+	}
+}
+
+func (r *resetPasswordUC) Execute(ctx context.Context, token, plain string) error {
+	userID, hash, err := domain.ParsePasswordResetToken(token)
+	if err != nil {
+		return ErrInvalidPasswordReset
+	}
+
+	reset, err := r.resetRepo.Get(ctx, userID)
+	if errors.Is(err, ErrPasswordResetNotFound) {
+		return ErrInvalidPasswordReset
+	}
+	if err != nil {
+		return err
+	}
+	if !reset.MatchesToken(hash) {
+		return ErrInvalidPasswordReset
+	}
+
+	u, err := r.userRepo.Get(ctx, userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return ErrInvalidPasswordReset
+	}
+	if err != nil {
+		return err
+	}
+	// the address may have been changed after the mail was sent.
+	if u.Email != reset.Email {
+		return ErrInvalidPasswordReset
+	}
+
+	// the password is hashed before consuming the reset, so that the token is not lost when the hasher is busy.
+	password, err := domain.NewPassword(ctx, plain)
+	if err != nil {
+		return err
+	}
+	if err := r.resetRepo.Consume(ctx, reset); err != nil {
+		if errors.Is(err, ErrPasswordResetNotFound) {
+			return ErrInvalidPasswordReset
+		}
+		return err
+	}
+
+	// the user is read again when updated concurrently, e.g. disabled by an admin, instead of overwriting it.
+	u, err = updateUser(ctx, r.userRepo, userID, func(u *domain.User) error {
+		if u.Email != reset.Email {
+			return ErrInvalidPasswordReset
+		}
+		u.ChangePassword(password)
+		// the token was received at the address, which proves the user owns it.
+		if !u.IsEmailVerified() {
+			u.VerifyEmail()
+		}
+		return nil
+	})
+	if errors.Is(err, ErrUserNotFound) {
+		return ErrInvalidPasswordReset
+	}
+	if err != nil {
+		return err
+	}
+	recordAudit(ctx, r.auditLog, domain.AuditPasswordReset, u.ID, uuid.Nil, nil)
+
+	_, err = revokeAll(ctx, r.sessionRepo, r.revocationRepo, r.apiKeyRepo, u.ID)
+	return err
+}
+
+type ChangePasswordReq struct {
+	CurrentPassword string
+	NewPassword     string
+	Device          *domain.Device
+}
+
+// ChangePasswordUC changes the password of the user, who must know the current one.
+// Every token, session and API key of the user is revoked, and a new session is started for the device changing it.
+type ChangePasswordUC interface {
+	Execute(ctx context.Context, p *Principal, req *ChangePasswordReq) (*TokenPair, error)
+}
+
+type changePasswordUC struct {
+	userRepo       UserRepo
+	sessionRepo    SessionRepo
+	revocationRepo RevocationRepo
+	apiKeyRepo     APIKeyRepo
+	issuer         *sessionIssuer
+	auditLog       AuditLog
+}
+
+func NewChangePasswordUC(
+	userRepo UserRepo, sessionRepo SessionRepo, revocationRepo RevocationRepo, apiKeyRepo APIKeyRepo,
+	manager TokenManager, auditLog AuditLog,
+) ChangePasswordUC {
+	return &changePasswordUC{
+		userRepo:       userRepo,
+		sessionRepo:    sessionRepo,
+		revocationRepo: revocationRepo,
+		apiKeyRepo:     apiKeyRepo,
+		issuer:         &sessionIssuer{sessionRepo: sessionRepo, tokenManager: manager},
+		auditLog:       auditLog,
+	}
+}
+
+func (c *changePasswordUC) Execute(ctx context.Context, p *Principal, req *ChangePasswordReq) (*TokenPair, error) {
+	if err := p.RequireRecentAuth(RecentAuthMaxAge); err != nil {
+		return nil, err
+	}
+
+	u, err := c.userRepo.Get(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := u.Password.Compare(ctx, req.CurrentPassword)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidPassword
+	}
+
+	password, err := domain.NewPassword(ctx, req.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+	prevUpdatedAt := u.UpdatedAt
+	u.ChangePassword(password)
+	if err := c.userRepo.Update(ctx, u, prevUpdatedAt); err != nil {
+		return nil, err
+	}
+	recordAudit(ctx, c.auditLog, domain.AuditPasswordChanged, u.ID, uuid.Nil, nil)
+
+	issuedUntil, err := revokeAll(ctx, c.sessionRepo, c.revocationRepo, c.apiKeyRepo, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	return c.issuer.startAfter(ctx, u, req.Device, issuedUntil, domain.AuthMethodPassword)
+}
@@ -0,0 +1,160 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/infra"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+func TestChangePassword_ReturnedTokenIsAccepted(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUserRepo()
+	sessions := newMemSessionRepo()
+	revocations := infra.NewCachedRevocationRepo(noRevocationRepo{})
+	tokens := newTokenManager(t)
+	resolve := usecase.NewResolvePrincipalUC(users, nil, revocations, nil, tokens)
+
+	u := createUser(t, users, "alice", "correct horse battery")
+	// the token is issued just before the change, and must be revoked even though it is in the same second.
+	oldToken, err := tokens.Generate(&usecase.Claims{
+		UserID:    u.ID,
+		Scopes:    u.Scopes(),
+		AuthTime:  time.Now(),
+		ExpiresAt: time.Now().Add(usecase.AccessTokenExpiresIn),
+	})
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+	p, err := resolve.Execute(ctx, &usecase.ResolvePrincipalReq{Token: oldToken})
+	if err != nil {
+		t.Fatalf("failed to resolve the token before the change: %v", err)
+	}
+
+	uc := usecase.NewChangePasswordUC(users, sessions, revocations, newMemAPIKeyRepo(), tokens, &discardAuditLog{})
+	pair, err := uc.Execute(ctx, p, &usecase.ChangePasswordReq{
+		CurrentPassword: "correct horse battery",
+		NewPassword:     "staple battery horse",
+		Device:          &domain.Device{Name: "test"},
+	})
+	if err != nil {
+		t.Fatalf("failed to change password: %v", err)
+	}
+
+	if _, err := resolve.Execute(ctx, &usecase.ResolvePrincipalReq{Token: pair.AccessToken}); err != nil {
+		t.Errorf("token returned by the change is rejected: %v", err)
+	}
+	_, err = resolve.Execute(ctx, &usecase.ResolvePrincipalReq{Token: oldToken})
+	if !errors.Is(err, usecase.ErrTokenRevoked) {
+		t.Errorf("token issued before the change: got %v, want %v", err, usecase.ErrTokenRevoked)
+	}
+}
+
+func TestChangePassword_DeletesAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUserRepo()
+	sessions := newMemSessionRepo()
+	revocations := infra.NewCachedRevocationRepo(noRevocationRepo{})
+	apiKeys := newMemAPIKeyRepo()
+	tokens := newTokenManager(t)
+	resolve := usecase.NewResolvePrincipalUC(users, apiKeys, revocations, nil, tokens)
+
+	u := createUser(t, users, "alice", "correct horse battery")
+	k, apiKey, err := domain.NewAPIKey(u.ID, "ci", u.Scopes(), time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create api key: %v", err)
+	}
+	if err := apiKeys.Create(ctx, k); err != nil {
+		t.Fatalf("failed to save api key: %v", err)
+	}
+	if _, err := resolve.Execute(ctx, &usecase.ResolvePrincipalReq{Token: apiKey}); err != nil {
+		t.Fatalf("failed to resolve the api key before the change: %v", err)
+	}
+	p := &usecase.Principal{UserID: u.ID, AuthTime: time.Now()}
+
+	uc := usecase.NewChangePasswordUC(users, sessions, revocations, apiKeys, tokens, &discardAuditLog{})
+	_, err = uc.Execute(ctx, p, &usecase.ChangePasswordReq{
+		CurrentPassword: "correct horse battery",
+		NewPassword:     "staple battery horse",
+		Device:          &domain.Device{Name: "test"},
+	})
+	if err != nil {
+		t.Fatalf("failed to change password: %v", err)
+	}
+
+	_, err = resolve.Execute(ctx, &usecase.ResolvePrincipalReq{Token: apiKey})
+	if !errors.Is(err, usecase.ErrInvalidToken) {
+		t.Errorf("api key created before the change: got %v, want %v", err, usecase.ErrInvalidToken)
+	}
+}
+
+func TestChangePassword_RejectsStaleUser(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUserRepo()
+	tokens := newTokenManager(t)
+
+	u := createUser(t, users, "alice", "correct horse battery")
+	p := &usecase.Principal{UserID: u.ID, AuthTime: time.Now()}
+
+	racing := &racingUserRepo{memUserRepo: users}
+	uc := usecase.NewChangePasswordUC(
+		racing, newMemSessionRepo(), noRevocationRepo{}, newMemAPIKeyRepo(), tokens, &discardAuditLog{},
+	)
+	_, err := uc.Execute(ctx, p, &usecase.ChangePasswordReq{
+		CurrentPassword: "correct horse battery",
+		NewPassword:     "staple battery horse",
+		Device:          &domain.Device{Name: "test"},
+	})
+	if !errors.Is(err, usecase.ErrUserUpdated) {
+		t.Fatalf("got %v, want %v", err, usecase.ErrUserUpdated)
+	}
+
+	got, err := users.Get(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if !got.IsDisabled() {
+		t.Error("the concurrent update is overwritten")
+	}
+	if ok, _ := got.Password.Compare(ctx, "correct horse battery"); !ok {
+		t.Error("the password is changed by a stale read")
+	}
+}
+
+func TestResetPassword_KeepsConcurrentUpdate(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUserRepo()
+	resets := newMemPasswordResetRepo()
+
+	u := createUser(t, users, "alice", "correct horse battery")
+	reset, token, err := domain.NewPasswordReset(u.ID, u.Email, usecase.PasswordResetExpiresIn)
+	if err != nil {
+		t.Fatalf("failed to create password reset: %v", err)
+	}
+	if err := resets.Save(ctx, reset); err != nil {
+		t.Fatalf("failed to save password reset: %v", err)
+	}
+
+	racing := &racingUserRepo{memUserRepo: users}
+	uc := usecase.NewResetPasswordUC(
+		racing, resets, newMemSessionRepo(), noRevocationRepo{}, newMemAPIKeyRepo(), &discardAuditLog{},
+	)
+	if err := uc.Execute(ctx, token, "staple battery horse"); err != nil {
+		t.Fatalf("failed to reset password: %v", err)
+	}
+
+	got, err := users.Get(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if !got.IsDisabled() {
+		t.Error("the concurrent update is overwritten")
+	}
+	if ok, _ := got.Password.Compare(ctx, "staple battery horse"); !ok {
+		t.Error("the password is not reset")
+	}
+}
@@ -0,0 +1,271 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+// Principal is the subject a request is made by.
+// It is resolved once per request by the authentication middleware and passed to usecases.
+type Principal struct {
+	UserID uuid.UUID
+	// SessionID is the login session of the access token. It is uuid.Nil for tokens not bound to a session.
+	SessionID uuid.UUID
+	// ClientID is the OAuth client the access token was issued to. It is empty for tokens of zenbu itself.
+	// A client acting on its own by the client credentials grant has no UserID.
+	ClientID string
+	// APIKeyID is the API key the request was authenticated by. It is uuid.Nil for access tokens.
+	APIKeyID uuid.UUID
+	// Scopes are the permissions granted to the access token.
+	Scopes []domain.Scope
+	// TokenID and TokenExpiresAt identify the access token, so that it can be revoked.
+	TokenID        string
+	TokenExpiresAt time.Time
+	// Thumbprint is of the DPoP key the access token is bound to. It is empty for bearer tokens.
+	Thumbprint string
+	// AuthTime is when the user last authenticated, and AuthMethods are how.
+	// They are zero for API keys, which never count as a recent authentication.
+	AuthTime    time.Time
+	AuthMethods []domain.AuthMethod
+	// ActorID is the admin impersonating the user. It is uuid.Nil unless impersonated.
+	ActorID uuid.UUID
+}
+
+// AnonymousPrincipal is the principal of requests without credentials.
+func AnonymousPrincipal() *Principal {
+	return &Principal{}
+}
+
+func (p *Principal) IsAnonymous() bool {
+	return p.UserID == uuid.Nil && p.ClientID == ""
+}
+
+// IsFirstParty reports whether the principal is a user logged in to zenbu itself,
+// neither through an OAuth client nor by an API key.
+func (p *Principal) IsFirstParty() bool {
+	return p.UserID != uuid.Nil && p.ClientID == "" && p.APIKeyID == uuid.Nil
+}
+
+// IsImpersonated reports whether an admin is acting as the user.
+func (p *Principal) IsImpersonated() bool {
+	return p.ActorID != uuid.Nil
+}
+
+func (p *Principal) HasScope(scope domain.Scope) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// RequireRecentAuth checks that the user authenticated within maxAge, for sensitive operations
+// not to be done by whom only holds a token. Otherwise, the user must re-authenticate.
+func (p *Principal) RequireRecentAuth(maxAge time.Duration) error {
+	// an admin impersonating the user can't authenticate as the user.
+	if p.IsImpersonated() {
+		return ErrImpersonationForbidden
+	}
+	if p.AuthTime.IsZero() || time.Since(p.AuthTime) > maxAge {
+		return ErrReauthenticationRequired
+	}
+	return nil
+}
+
+// Authorize checks that the principal is granted every required scope.
+func (p *Principal) Authorize(required ...domain.Scope) error {
+	if p.IsAnonymous() {
+		return ErrPermissionDenied
+	}
+	for _, scope := range required {
+		if !p.HasScope(scope) {
+			return fmt.Errorf("%w: %s scope is required", ErrPermissionDenied, scope)
+		}
+	}
+	return nil
+}
+
+func newPrincipal(claims *Claims) *Principal {
+	return &Principal{
+		UserID:         claims.UserID,
+		SessionID:      claims.SessionID,
+		ClientID:       claims.ClientID,
+		Scopes:         claims.Scopes,
+		TokenID:        claims.ID,
+		TokenExpiresAt: claims.ExpiresAt,
+		Thumbprint:     claims.Thumbprint,
+		AuthTime:       claims.AuthTime,
+		AuthMethods:    claims.AuthMethods,
+		ActorID:        claims.ActorID,
+	}
+}
+
+type ResolvePrincipalReq struct {
+	Token string
+	// DPoP is the proof sent with a token of the DPoP scheme. It is nil for the Bearer scheme.
+	DPoP *DPoPProofReq
+}
+
+// ResolvePrincipalUC verifies the access token or the API key and returns the principal it was issued for.
+type ResolvePrincipalUC interface {
+	Execute(ctx context.Context, req *ResolvePrincipalReq) (*Principal, error)
+}
+
+type resolvePrincipalUC struct {
+	userRepo       UserRepo
+	apiKeyRepo     APIKeyRepo
+	tokenManager   TokenManager
+	revocationRepo RevocationRepo
+	replayRepo     DPoPReplayRepo
+}
+
+func NewResolvePrincipalUC(
+	userRepo UserRepo, apiKeyRepo APIKeyRepo, revocationRepo RevocationRepo, replayRepo DPoPReplayRepo,
+	tokenManager TokenManager,
+) ResolvePrincipalUC {
+	return &resolvePrincipalUC{
+		userRepo:       userRepo,
+		apiKeyRepo:     apiKeyRepo,
+		tokenManager:   tokenManager,
+		revocationRepo: revocationRepo,
+		replayRepo:     replayRepo,
+	}
+}
+
+func (r *resolvePrincipalUC) Execute(ctx context.Context, req *ResolvePrincipalReq) (*Principal, error) {
+	p, err := r.resolve(ctx, req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	// a stolen token bound to a key is useless without the key, unless it is accepted as a bearer token.
+	// (RFC 9449 Section 7.1)
+	if req.DPoP == nil {
+		if p.Thumbprint != "" {
+			return nil, errors.Join(ErrInvalidToken, errors.New("dpop-bound token sent as a bearer token"))
+		}
+		return p, nil
+	}
+	if p.Thumbprint == "" {
+		return nil, errors.Join(ErrInvalidToken, errors.New("token is not bound to a dpop key"))
+	}
+	thumbprint, err := verifyDPoPProof(ctx, r.replayRepo, req.DPoP, req.Token)
+	if err != nil {
+		return nil, err
+	}
+	if thumbprint != p.Thumbprint {
+		return nil, fmt.Errorf("%w: proof is not signed by the key the token is bound to", ErrInvalidDPoPProof)
+	}
+	return p, nil
+}
+
+// resolve verifies the token, but not whether it is sent with a proof of the key it is bound to.
+func (r *resolvePrincipalUC) resolve(ctx context.Context, token string) (*Principal, error) {
+	if domain.IsAPIKey(token) {
+		return r.resolveAPIKey(ctx, token)
+	}
+
+	claims, err := r.tokenManager.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := r.revocationRepo.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.Join(ErrInvalidToken, ErrTokenRevoked)
+	}
+	if claims.ActorID != uuid.Nil {
+		if err := r.verifyActor(ctx, claims); err != nil {
+			return nil, err
+		}
+	}
+
+	return newPrincipal(claims), nil
+}
+
+// verifyActor verifies that the admin impersonating the user still may, as the token would otherwise outlive
+// the admin being disabled, demoted or logged out everywhere.
+func (r *resolvePrincipalUC) verifyActor(ctx context.Context, claims *Claims) error {
+	actor, err := r.userRepo.Get(ctx, claims.ActorID)
+	if errors.Is(err, ErrUserNotFound) {
+		return errors.Join(ErrInvalidToken, err)
+	}
+	if err != nil {
+		return err
+	}
+	if actor.IsDisabled() {
+		return errors.Join(ErrInvalidToken, ErrUserDisabled)
+	}
+	if !actor.HasRole(domain.RoleAdmin) {
+		return errors.Join(ErrInvalidToken, errors.New("actor is not an admin"))
+	}
+
+	revokedUntil, err := r.revocationRepo.RevokedUntil(ctx, claims.ActorID)
+	if err != nil {
+		return err
+	}
+	if !claims.IssuedAt.After(revokedUntil) {
+		return errors.Join(ErrInvalidToken, ErrTokenRevoked)
+	}
+	return nil
+}
+
+// resolveAPIKey verifies the API key. Unlike access tokens, the key is looked up on every request,
+// so a revoked key or a disabled user is rejected at once.
+func (r *resolvePrincipalUC) resolveAPIKey(ctx context.Context, token string) (*Principal, error) {
+	userID, keyID, hash, err := domain.ParseAPIKey(token)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+
+	k, err := r.apiKeyRepo.Get(ctx, userID, keyID)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !k.VerifySecret(hash) || k.IsExpired(now) {
+		return nil, ErrInvalidToken
+	}
+
+	u, err := r.userRepo.Get(ctx, userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.IsDisabled() {
+		return nil, errors.Join(ErrInvalidToken, ErrUserDisabled)
+	}
+	if u.PasswordResetRequired {
+		return nil, errors.Join(ErrInvalidToken, ErrPasswordResetRequired)
+	}
+
+	if k.Touch(now) {
+		// the key may have been revoked since it was read.
+		err := r.apiKeyRepo.UpdateLastUsed(ctx, k)
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			return nil, errors.Join(ErrInvalidToken, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Principal{
+		UserID:         u.ID,
+		APIKeyID:       k.ID,
+		Scopes:         k.GrantedScopes(u.Scopes()),
+		TokenID:        k.ID.String(),
+		TokenExpiresAt: k.ExpiresAt,
+	}, nil
+}
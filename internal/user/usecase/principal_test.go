@@ -0,0 +1,106 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/infra"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+func TestResolvePrincipal_ImpersonationEndsWithActor(t *testing.T) {
+	tests := []struct {
+		name string
+		// change changes the admin after the impersonation token is issued.
+		change func(t *testing.T, users *memUserRepo, revocations usecase.RevocationRepo, admin *domain.User)
+		want   error
+	}{
+		{
+			name:   "unchanged",
+			change: func(*testing.T, *memUserRepo, usecase.RevocationRepo, *domain.User) {},
+		},
+		{
+			name: "disabled",
+			change: func(t *testing.T, users *memUserRepo, _ usecase.RevocationRepo, admin *domain.User) {
+				prevUpdatedAt := admin.UpdatedAt
+				admin.Disable()
+				if err := users.Update(context.Background(), admin, prevUpdatedAt); err != nil {
+					t.Fatalf("failed to disable admin: %v", err)
+				}
+			},
+			want: usecase.ErrUserDisabled,
+		},
+		{
+			name: "no longer admin",
+			change: func(t *testing.T, users *memUserRepo, _ usecase.RevocationRepo, admin *domain.User) {
+				prevUpdatedAt := admin.UpdatedAt
+				admin.Roles = []domain.Role{domain.RoleUser}
+				if err := users.Update(context.Background(), admin, prevUpdatedAt); err != nil {
+					t.Fatalf("failed to demote admin: %v", err)
+				}
+			},
+			want: usecase.ErrInvalidToken,
+		},
+		{
+			name: "deleted",
+			change: func(t *testing.T, users *memUserRepo, _ usecase.RevocationRepo, admin *domain.User) {
+				if err := users.Delete(context.Background(), admin); err != nil {
+					t.Fatalf("failed to delete admin: %v", err)
+				}
+			},
+			want: usecase.ErrUserNotFound,
+		},
+		{
+			name: "tokens revoked",
+			change: func(t *testing.T, _ *memUserRepo, revocations usecase.RevocationRepo, admin *domain.User) {
+				err := revocations.RevokeTokensIssuedUntil(
+					context.Background(), admin.ID, time.Now().Add(time.Second), time.Now().Add(time.Hour),
+				)
+				if err != nil {
+					t.Fatalf("failed to revoke tokens of admin: %v", err)
+				}
+			},
+			want: usecase.ErrTokenRevoked,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			users := newMemUserRepo()
+			revocations := infra.NewCachedRevocationRepo(noRevocationRepo{})
+			tokens := newTokenManager(t)
+			resolve := usecase.NewResolvePrincipalUC(users, nil, revocations, nil, tokens)
+
+			u := createUser(t, users, "alice", "correct horse battery")
+			admin := createUser(t, users, "admin", "correct horse battery")
+			prevUpdatedAt := admin.UpdatedAt
+			admin.GrantRole(domain.RoleAdmin)
+			if err := users.Update(ctx, admin, prevUpdatedAt); err != nil {
+				t.Fatalf("failed to grant admin: %v", err)
+			}
+			token, err := tokens.Generate(&usecase.Claims{
+				UserID:    u.ID,
+				ActorID:   admin.ID,
+				Scopes:    u.Scopes(),
+				AuthTime:  time.Now(),
+				ExpiresAt: time.Now().Add(time.Minute),
+			})
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			tt.change(t, users, revocations, admin)
+
+			_, err = resolve.Execute(ctx, &usecase.ResolvePrincipalReq{Token: token})
+			if tt.want == nil && err != nil {
+				t.Errorf("got %v, want the token accepted", err)
+			}
+			if tt.want != nil && (!errors.Is(err, tt.want) || !errors.Is(err, usecase.ErrInvalidToken)) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
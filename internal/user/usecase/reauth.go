@@ -0,0 +1,132 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+// RecentAuthMaxAge is how recently the user must have authenticated for sensitive operations,
+// such as changing the password, deleting the account or creating API keys.
+const RecentAuthMaxAge = 10 * time.Minute
+
+type ReauthenticateReq struct {
+	Password string
+	// Code is of the second factor, required if the user has enabled MFA.
+	Code string
+	// IPAddress is of the device re-authenticating, whose failures are throttled as logins.
+	IPAddress string
+}
+
+type ReauthenticateRes struct {
+	AccessToken string
+	// DPoPBound reports whether the token is bound to the DPoP key of the session.
+	DPoPBound bool
+}
+
+// ReauthenticateUC proves again that the user of the session is present, by the factors of the login,
+// and issues an access token with the new auth time for sensitive operations.
+// Users with neither password nor MFA, e.g. logging in only by passkeys, re-authenticate by logging in again.
+type ReauthenticateUC interface {
+	Execute(ctx context.Context, p *Principal, req *ReauthenticateReq) (*ReauthenticateRes, error)
+}
+
+type reauthenticateUC struct {
+	userRepo    UserRepo
+	sessionRepo SessionRepo
+	mfaRepo     MFARepo
+	issuer      *sessionIssuer
+	throttle    *loginThrottle
+}
+
+func NewReauthenticateUC(
+	userRepo UserRepo, sessionRepo SessionRepo, loginAttemptRepo LoginAttemptRepo, mfaRepo MFARepo,
+	manager TokenManager, lockoutPolicy LockoutPolicy,
+) ReauthenticateUC {
+	return &reauthenticateUC{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		mfaRepo:     mfaRepo,
+		issuer:      &sessionIssuer{sessionRepo: sessionRepo, tokenManager: manager},
+		throttle:    &loginThrottle{repo: loginAttemptRepo, policy: lockoutPolicy},
+	}
+}
+
+func (r *reauthenticateUC) Execute(ctx context.Context, p *Principal, req *ReauthenticateReq) (*ReauthenticateRes, error) {
+	if !p.IsFirstParty() {
+		return nil, fmt.Errorf("%w: only the user logged in can re-authenticate", ErrPermissionDenied)
+	}
+	session, err := sessionOf(ctx, r.sessionRepo, p)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := r.userRepo.Get(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsDisabled() {
+		return nil, ErrUserDisabled
+	}
+
+	// failures are counted as those of login, so that a stolen token can't be used to guess the password.
+	accountKey := usernameAttemptKey(u.Username)
+	if err := r.throttle.reserve(ctx, accountKey, req.IPAddress); err != nil {
+		return nil, err
+	}
+
+	var methods []domain.AuthMethod
+	if u.HasPassword() {
+		ok, err := u.Password.Compare(ctx, req.Password)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrInvalidPassword
+		}
+		methods = append(methods, domain.AuthMethodPassword)
+	}
+
+	m, err := r.mfaRepo.Get(ctx, u.ID)
+	if err != nil && !errors.Is(err, ErrMFANotFound) {
+		return nil, err
+	}
+	if m != nil && m.IsEnabled() {
+		err := verifyMFACode(ctx, r.mfaRepo, m, req.Code)
+		if errors.Is(err, ErrInvalidMFACode) {
+			return nil, ErrInvalidMFACode
+		}
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, domain.AuthMethodOTP)
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("%w: no password or mfa to re-authenticate by, log in again", ErrPermissionDenied)
+	}
+	if len(methods) > 1 {
+		methods = append(methods, domain.AuthMethodMFA)
+	}
+	if err := r.throttle.succeed(ctx, accountKey, req.IPAddress); err != nil {
+		return nil, err
+	}
+
+	session.Reauthenticate(methods)
+	err = r.sessionRepo.UpdateAuthentication(ctx, session)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := r.issuer.accessToken(session, u)
+	if err != nil {
+		return nil, err
+	}
+	return &ReauthenticateRes{AccessToken: accessToken, DPoPBound: session.Thumbprint != ""}, nil
+}
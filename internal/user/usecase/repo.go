@@ -2,6 +2,7 @@ package usecase
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -13,4 +14,247 @@ type UserRepo interface {
 	Create(ctx context.Context, u *domain.User) (*domain.User, error)
 	Get(ctx context.Context, id uuid.UUID) (*domain.User, error)
 	GetByName(ctx context.Context, name string) (*domain.User, error)
+	// GetByEmail finds the user by the email address normalized by domain.NormalizeEmail.
+	GetByEmail(ctx context.Context, email string) (*domain.User, error)
+	// List returns users ordered by username, at most limit users at once.
+	// Pass the returned cursor to get the next page. It is empty on the last page.
+	List(ctx context.Context, limit int, cursor string) (users []*domain.User, next string, err error)
+	// Update stores the user only if it is not updated since it was read with prevUpdatedAt.
+	// Otherwise, ErrUserUpdated is returned.
+	// The username can't be changed by Update, but only by ChangeUsername.
+	Update(ctx context.Context, u *domain.User, prevUpdatedAt time.Time) error
+	// UpdatePassword replaces the password of the user only if it is still prev.
+	// Otherwise, ErrPasswordChanged is returned.
+	UpdatePassword(ctx context.Context, userID uuid.UUID, password, prev domain.Password) error
+	// ChangeUsername releases the current username of the user and takes the new one.
+	ChangeUsername(ctx context.Context, u *domain.User, username string) error
+	// ChangeEmail releases the current email address of the user and takes the new one, which is not verified yet.
+	ChangeEmail(ctx context.Context, u *domain.User, email string) error
+	// ExtendGuest stores the expiry of the guest extended by domain.User.ExtendGuest.
+	// It returns ErrUserNotFound if the user is expired or no longer a guest.
+	ExtendGuest(ctx context.Context, u *domain.User) error
+	// UpgradeGuest stores the guest upgraded to a full account, with the username, password and email address
+	// set before domain.User.Upgrade. The username prevUsername of the guest is released if it was changed.
+	UpgradeGuest(ctx context.Context, u *domain.User, prevUsername string) error
+	Delete(ctx context.Context, u *domain.User) error
+}
+
+// AuditLog records audit events. (port)
+type AuditLog interface {
+	Record(ctx context.Context, e *domain.AuditEvent) error
+}
+
+// AuditEventQuery filters audit events. Zero fields don't filter.
+type AuditEventQuery struct {
+	UserID  uuid.UUID
+	ActorID uuid.UUID
+	Type    domain.AuditEventType
+	// From and To bound the time events were recorded at, inclusive.
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Cursor string
+}
+
+// AuditEventRepo is the AuditLog which events can be queried from. (port)
+type AuditEventRepo interface {
+	AuditLog
+	// List returns the events newest first, with the cursor of the next page.
+	// Events of all users are listed a day at a time, of the day of To, if the query has no UserID.
+	// It returns ErrInvalidCursor if the cursor is not of the query.
+	List(ctx context.Context, q *AuditEventQuery) ([]*domain.AuditEvent, string, error)
+}
+
+// SessionRepo is the interface for persisting login sessions. (port)
+type SessionRepo interface {
+	Create(ctx context.Context, s *domain.Session) error
+	Get(ctx context.Context, userID, sessionID uuid.UUID) (*domain.Session, error)
+	// Rotate stores the rotated session, with its expiry, only if its refresh token hash is still prevHash.
+	// Otherwise, the refresh token was already used by someone else and ErrRefreshTokenReused is returned.
+	Rotate(ctx context.Context, s *domain.Session, prevHash string) error
+	// UpdateAuthentication stores the auth time and methods of the session, or returns ErrSessionNotFound.
+	UpdateAuthentication(ctx context.Context, s *domain.Session) error
+	// List returns the sessions of the user, the most recently created first.
+	List(ctx context.Context, userID uuid.UUID) ([]*domain.Session, error)
+	Delete(ctx context.Context, userID, sessionID uuid.UUID) error
+	DeleteAll(ctx context.Context, userID uuid.UUID) error
+}
+
+// RevocationRepo stores revocations of access tokens until the tokens expire. (port)
+type RevocationRepo interface {
+	RevokeToken(ctx context.Context, userID uuid.UUID, tokenID string, expiresAt time.Time) error
+	// RevokeSession revokes every token issued for the session.
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID, expiresAt time.Time) error
+	// RevokeTokensIssuedUntil revokes every token of the user issued at or before issuedUntil.
+	// The revocation can be forgotten after expiresAt, when all of those tokens are expired.
+	RevokeTokensIssuedUntil(ctx context.Context, userID uuid.UUID, issuedUntil, expiresAt time.Time) error
+	// IsRevoked reports whether the token is revoked by its ID, its session or the time it was issued.
+	IsRevoked(ctx context.Context, claims *Claims) (bool, error)
+	// RevokedUntil returns the time every token of the user issued at or before is revoked,
+	// or zero if RevokeTokensIssuedUntil is not in effect for the user.
+	RevokedUntil(ctx context.Context, userID uuid.UUID) (time.Time, error)
+}
+
+// LoginAttemptRepo counts login attempts by key in fixed windows. (port)
+// Attempts are counted before they are verified, and uncounted if they succeed.
+type LoginAttemptRepo interface {
+	// Reserve atomically counts an attempt unless max attempts are already counted in the current window.
+	// A new window starts if the current one is over. It reports whether the attempt was counted,
+	// and returns the attempts in the window either way.
+	Reserve(ctx context.Context, key string, max int, window time.Duration) (*domain.LoginAttempts, bool, error)
+	// Release uncounts an attempt counted by Reserve. It does nothing if the window is already over.
+	Release(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+// EmailVerificationRepo stores the pending email verification of each user. (port)
+type EmailVerificationRepo interface {
+	// Save replaces the pending verification of the user, so that only the latest mail can be used.
+	Save(ctx context.Context, v *domain.EmailVerification) error
+	// Get returns ErrEmailVerificationNotFound if there is no pending verification or it is expired.
+	Get(ctx context.Context, userID uuid.UUID) (*domain.EmailVerification, error)
+	// CountAttempt atomically counts an attempt of a code for the verification, unless max attempts are already
+	// counted. Then, it returns ErrTooManyVerificationAttempts. If the verification was replaced or consumed,
+	// ErrEmailVerificationNotFound.
+	CountAttempt(ctx context.Context, v *domain.EmailVerification, max int) error
+	// Consume deletes the verification, only if it is still pending. Otherwise, ErrEmailVerificationNotFound.
+	Consume(ctx context.Context, v *domain.EmailVerification) error
+}
+
+// PasswordResetRepo stores the pending password reset of each user. (port)
+type PasswordResetRepo interface {
+	// Save replaces the pending reset of the user, so that only the latest mail can be used.
+	Save(ctx context.Context, r *domain.PasswordReset) error
+	// Get returns ErrPasswordResetNotFound if there is no pending reset or it is expired.
+	Get(ctx context.Context, userID uuid.UUID) (*domain.PasswordReset, error)
+	// Consume deletes the reset, only if it is still pending. Otherwise, ErrPasswordResetNotFound.
+	Consume(ctx context.Context, r *domain.PasswordReset) error
+}
+
+// MagicLinkRepo stores the pending magic link login of each user. (port)
+type MagicLinkRepo interface {
+	// Save replaces the pending link of the user, so that only the latest mail can be used.
+	Save(ctx context.Context, l *domain.MagicLink) error
+	// Get returns ErrMagicLinkNotFound if there is no pending link or it is expired.
+	Get(ctx context.Context, userID uuid.UUID) (*domain.MagicLink, error)
+	// Consume deletes the link, only if it is still pending. Otherwise, ErrMagicLinkNotFound.
+	Consume(ctx context.Context, l *domain.MagicLink) error
+}
+
+// MFARepo stores the second factor of each user. (port)
+type MFARepo interface {
+	// Get returns ErrMFANotFound if the user has not enrolled.
+	Get(ctx context.Context, userID uuid.UUID) (*domain.MFA, error)
+	// Save replaces the enrollment not enabled yet. It returns ErrMFAAlreadyEnabled if the user has enabled MFA.
+	Save(ctx context.Context, m *domain.MFA) error
+	// Enable enables the enrollment with its recovery codes. It returns ErrMFANotFound if it is not pending anymore.
+	Enable(ctx context.Context, m *domain.MFA) error
+	// UseTOTP records the time step of an accepted code.
+	// It returns ErrInvalidMFACode if a code of the same or a later step was accepted in the meantime.
+	UseTOTP(ctx context.Context, userID uuid.UUID, step int64) error
+	// UseRecoveryCode removes the recovery code. It returns ErrInvalidMFACode if it was used in the meantime.
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, hash string) error
+	Delete(ctx context.Context, userID uuid.UUID) error
+}
+
+// MFAChallengeRepo stores the login of each user waiting for the second factor. (port)
+type MFAChallengeRepo interface {
+	// Save replaces the pending challenge of the user, so that only the latest login can be completed.
+	Save(ctx context.Context, c *domain.MFAChallenge) error
+	// Get returns ErrMFAChallengeNotFound if there is no pending challenge or it is expired.
+	Get(ctx context.Context, userID uuid.UUID) (*domain.MFAChallenge, error)
+	// Consume deletes the challenge, only if it is still pending. Otherwise, ErrMFAChallengeNotFound.
+	Consume(ctx context.Context, c *domain.MFAChallenge) error
+}
+
+// PasskeyRepo stores passkeys under each user. (port)
+type PasskeyRepo interface {
+	// Create returns ErrPasskeyAlreadyExists if the credential is registered already.
+	Create(ctx context.Context, p *domain.Passkey) error
+	// Get returns ErrPasskeyNotFound if the user has no such passkey.
+	Get(ctx context.Context, userID uuid.UUID, id []byte) (*domain.Passkey, error)
+	List(ctx context.Context, userID uuid.UUID) ([]*domain.Passkey, error)
+	// UpdateUsage saves the sign count and the last use, only if the sign count is still prevSignCount.
+	// Otherwise, it returns ErrPasskeyCloned as the credential was used concurrently with the same count.
+	UpdateUsage(ctx context.Context, p *domain.Passkey, prevSignCount uint32) error
+	// Delete returns ErrPasskeyNotFound if the user has no such passkey.
+	Delete(ctx context.Context, userID uuid.UUID, id []byte) error
+}
+
+// WebAuthnCeremonyRepo stores pending WebAuthn ceremonies. (port)
+type WebAuthnCeremonyRepo interface {
+	Save(ctx context.Context, c *domain.WebAuthnCeremony) error
+	// Consume deletes the ceremony and returns it.
+	// It returns ErrWebAuthnCeremonyNotFound if there is no such ceremony or it is expired.
+	Consume(ctx context.Context, id uuid.UUID) (*domain.WebAuthnCeremony, error)
+}
+
+// IdentityRepo stores the external identities linked to users. (port)
+type IdentityRepo interface {
+	// Create returns ErrIdentityAlreadyLinked if the identity is linked to any user already.
+	Create(ctx context.Context, i *domain.Identity) error
+	// Get returns ErrIdentityNotFound if the identity is not linked to any user.
+	Get(ctx context.Context, provider, subject string) (*domain.Identity, error)
+	List(ctx context.Context, userID uuid.UUID) ([]*domain.Identity, error)
+	// Delete returns ErrIdentityNotFound if the user has no such identity.
+	Delete(ctx context.Context, userID uuid.UUID, provider, subject string) error
+}
+
+// OIDCAuthRequestRepo stores authorization requests pending the callback from providers. (port)
+type OIDCAuthRequestRepo interface {
+	Save(ctx context.Context, r *domain.OIDCAuthRequest) error
+	// Consume deletes the request and returns it.
+	// It returns ErrOIDCAuthRequestNotFound if there is no such request or it is expired.
+	Consume(ctx context.Context, stateHash string) (*domain.OIDCAuthRequest, error)
+}
+
+// OAuthClientRepo stores the registered OAuth clients. (port)
+type OAuthClientRepo interface {
+	Create(ctx context.Context, c *domain.OAuthClient) error
+	// Get returns ErrOAuthClientNotFound if there is no such client.
+	Get(ctx context.Context, id string) (*domain.OAuthClient, error)
+	// List returns every client, the most recently created first.
+	List(ctx context.Context) ([]*domain.OAuthClient, error)
+	// Delete returns ErrOAuthClientNotFound if there is no such client.
+	Delete(ctx context.Context, id string) error
+}
+
+// ConsentRepo stores the consents of users to OAuth clients. (port)
+type ConsentRepo interface {
+	// Save creates or replaces the consent of the user to the client.
+	Save(ctx context.Context, c *domain.Consent) error
+	// Get returns ErrConsentNotFound if the user has not consented to the client.
+	Get(ctx context.Context, userID uuid.UUID, clientID string) (*domain.Consent, error)
+	List(ctx context.Context, userID uuid.UUID) ([]*domain.Consent, error)
+	// Delete returns ErrConsentNotFound if the user has not consented to the client.
+	Delete(ctx context.Context, userID uuid.UUID, clientID string) error
+}
+
+// AuthorizationCodeRepo stores authorization codes until they are redeemed. (port)
+type AuthorizationCodeRepo interface {
+	Save(ctx context.Context, c *domain.AuthorizationCode) error
+	// Consume deletes the code and returns it.
+	// It returns ErrAuthorizationCodeNotFound if there is no such code or it is expired.
+	Consume(ctx context.Context, codeHash string) (*domain.AuthorizationCode, error)
+}
+
+// APIKeyRepo stores API keys under each user. (port)
+type APIKeyRepo interface {
+	Create(ctx context.Context, k *domain.APIKey) error
+	// Get returns ErrAPIKeyNotFound if the user has no such key or it is expired.
+	Get(ctx context.Context, userID, id uuid.UUID) (*domain.APIKey, error)
+	// List returns the keys of the user which are not expired, the most recently created first.
+	List(ctx context.Context, userID uuid.UUID) ([]*domain.APIKey, error)
+	// UpdateLastUsed saves the last use of the key.
+	UpdateLastUsed(ctx context.Context, k *domain.APIKey) error
+	// Delete returns ErrAPIKeyNotFound if the user has no such key.
+	Delete(ctx context.Context, userID, id uuid.UUID) error
+	// DeleteAll deletes every key of the user, including expired ones.
+	DeleteAll(ctx context.Context, userID uuid.UUID) error
+}
+
+// DPoPReplayRepo remembers the DPoP proofs used, so that a proof can't be replayed. (port)
+type DPoPReplayRepo interface {
+	// Use records the proof until it expires. It returns ErrDPoPProofReplayed if the proof has been used already.
+	Use(ctx context.Context, proofID string, expiresAt time.Time) error
 }
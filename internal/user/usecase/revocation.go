@@ -0,0 +1,82 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// endSession deletes the session, so its refresh token can't be used, and revokes its access tokens.
+func endSession(
+	ctx context.Context, sessionRepo SessionRepo, revocationRepo RevocationRepo, userID, sessionID uuid.UUID,
+) error {
+	if err := revocationRepo.RevokeSession(ctx, userID, sessionID, time.Now().Add(AccessTokenExpiresIn)); err != nil {
+		return err
+	}
+	return sessionRepo.Delete(ctx, userID, sessionID)
+}
+
+// revokeAll revokes every token and session of the user issued until now, and deletes the API keys of the user.
+// It returns the time until which tokens are revoked. Tokens issued for the user afterwards must be issued after it.
+func revokeAll(
+	ctx context.Context, sessionRepo SessionRepo, revocationRepo RevocationRepo, apiKeyRepo APIKeyRepo,
+	userID uuid.UUID,
+) (time.Time, error) {
+	// tokens are issued at whole seconds ("iat" is a NumericDate), so a token issued in the current second
+	// can't be told apart from those issued after now. The cutoff is rounded up, so that none of them survives.
+	issuedUntil := time.Now().Truncate(time.Second).Add(time.Second)
+	err := revocationRepo.RevokeTokensIssuedUntil(ctx, userID, issuedUntil, issuedUntil.Add(AccessTokenExpiresIn))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := sessionRepo.DeleteAll(ctx, userID); err != nil {
+		return time.Time{}, err
+	}
+	if err := apiKeyRepo.DeleteAll(ctx, userID); err != nil {
+		return time.Time{}, err
+	}
+	return issuedUntil, nil
+}
+
+// LogoutUC ends the session the access token was issued for.
+type LogoutUC interface {
+	Execute(ctx context.Context, p *Principal) error
+}
+
+type logoutUC struct {
+	revocationRepo RevocationRepo
+	sessionRepo    SessionRepo
+}
+
+func NewLogoutUC(sessionRepo SessionRepo, revocationRepo RevocationRepo) LogoutUC {
+	return &logoutUC{revocationRepo: revocationRepo, sessionRepo: sessionRepo}
+}
+
+func (l *logoutUC) Execute(ctx context.Context, p *Principal) error {
+	// tokens not bound to a session can only be revoked by themselves.
+	if p.SessionID == uuid.Nil {
+		return l.revocationRepo.RevokeToken(ctx, p.UserID, p.TokenID, p.TokenExpiresAt)
+	}
+	return endSession(ctx, l.sessionRepo, l.revocationRepo, p.UserID, p.SessionID)
+}
+
+// LogoutAllUC revokes every token and API key of the user, so the user is logged out from all devices.
+type LogoutAllUC interface {
+	Execute(ctx context.Context, p *Principal) error
+}
+
+type logoutAllUC struct {
+	revocationRepo RevocationRepo
+	sessionRepo    SessionRepo
+	apiKeyRepo     APIKeyRepo
+}
+
+func NewLogoutAllUC(sessionRepo SessionRepo, revocationRepo RevocationRepo, apiKeyRepo APIKeyRepo) LogoutAllUC {
+	return &logoutAllUC{revocationRepo: revocationRepo, sessionRepo: sessionRepo, apiKeyRepo: apiKeyRepo}
+}
+
+func (l *logoutAllUC) Execute(ctx context.Context, p *Principal) error {
+	_, err := revokeAll(ctx, l.sessionRepo, l.revocationRepo, l.apiKeyRepo, p.UserID)
+	return err
+}
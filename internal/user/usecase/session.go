@@ -0,0 +1,315 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+)
+
+const (
+	AccessTokenExpiresIn = time.Minute * 15
+	SessionExpiresIn     = time.Hour * 24 * 28 // 4 weeks
+)
+
+// TokenPair is a short-lived access token and the refresh token to renew it.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	// DPoPBound reports whether the tokens are bound to a DPoP key, which makes the token type DPoP.
+	DPoPBound bool
+}
+
+// sessionIssuer starts login sessions and issues access tokens bound to them.
+type sessionIssuer struct {
+	sessionRepo  SessionRepo
+	tokenManager TokenManager
+	// auditLog records sessions started as logins. It is nil for sessions started otherwise, e.g. by signups.
+	auditLog AuditLog
+	// issuedAfter is the time access tokens are issued after, if not zero. See startAfter.
+	issuedAfter time.Time
+}
+
+// start starts a session of the user, who has just authenticated by the methods.
+func (s *sessionIssuer) start(
+	ctx context.Context, u *domain.User, device *domain.Device, methods ...domain.AuthMethod,
+) (*TokenPair, error) {
+	return s.startForClient(ctx, u, device, "", nil, "", methods...)
+}
+
+// startAfter starts a session like start, but its access token is issued after issuedUntil returned by revokeAll,
+// so that the token is not revoked along with those issued in the same second.
+func (s *sessionIssuer) startAfter(
+	ctx context.Context, u *domain.User, device *domain.Device, issuedUntil time.Time, methods ...domain.AuthMethod,
+) (*TokenPair, error) {
+	issuer := *s
+	issuer.issuedAfter = issuedUntil
+	return issuer.start(ctx, u, device, methods...)
+}
+
+// startForClient starts a session of the OAuth client the user authorized for the scopes.
+// The session is bound to the DPoP key of the thumbprint, if any.
+func (s *sessionIssuer) startForClient(
+	ctx context.Context, u *domain.User, device *domain.Device, clientID string, scopes []domain.Scope,
+	thumbprint string, methods ...domain.AuthMethod,
+) (*TokenPair, error) {
+	session, refreshToken, err := domain.NewSession(u.ID, device, SessionExpiresIn)
+	if err != nil {
+		return nil, err
+	}
+	session.AuthMethods = methods
+	session.ClientID = clientID
+	session.Scopes = scopes
+	session.Thumbprint = thumbprint
+
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	if s.auditLog != nil {
+		recordAudit(ctx, s.auditLog, domain.AuditLoginSucceeded, u.ID, uuid.Nil, loginDetails(session))
+	}
+
+	accessToken, err := s.accessToken(session, u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{AccessToken: accessToken, RefreshToken: refreshToken, DPoPBound: thumbprint != ""}, nil
+}
+
+// loginDetails describes the login which started the session.
+func loginDetails(session *domain.Session) map[string]string {
+	details := map[string]string{
+		"session_id":   session.ID.String(),
+		"auth_methods": strings.Join(domain.FormatAuthMethods(session.AuthMethods), " "),
+	}
+	if session.Device != nil {
+		details["ip_address"] = session.Device.IPAddress
+		details["user_agent"] = session.Device.UserAgent
+	}
+	if session.ClientID != "" {
+		details["client_id"] = session.ClientID
+	}
+	return details
+}
+
+// accessToken issues an access token granted the scopes of the current roles of the user.
+// For client sessions, they are narrowed down to the scopes the user authorized the client for.
+// It is bound to the DPoP key of the session, if any.
+func (s *sessionIssuer) accessToken(session *domain.Session, u *domain.User) (string, error) {
+	var issuedAt time.Time
+	if !s.issuedAfter.IsZero() && !time.Now().After(s.issuedAfter) {
+		issuedAt = s.issuedAfter.Add(time.Second)
+	}
+	return s.tokenManager.Generate(&Claims{
+		UserID:      session.UserID,
+		SessionID:   session.ID,
+		ClientID:    session.ClientID,
+		Scopes:      session.GrantedScopes(u.Scopes()),
+		Thumbprint:  session.Thumbprint,
+		AuthTime:    session.AuthTime,
+		AuthMethods: session.AuthMethods,
+		IssuedAt:    issuedAt,
+		ExpiresAt:   time.Now().Add(AccessTokenExpiresIn),
+	})
+}
+
+type RefreshTokenReq struct {
+	RefreshToken string
+	// DPoP is the proof of the key the session is bound to, or is to be bound to. It is nil if not sent.
+	DPoP *DPoPProofReq
+}
+
+// RefreshTokenUC exchanges a refresh token for a new token pair.
+// The refresh token is rotated on every use. If a rotated token is presented again,
+// the whole session is revoked because either the client or an attacker holds a stolen token.
+type RefreshTokenUC interface {
+	Execute(ctx context.Context, req *RefreshTokenReq) (*TokenPair, error)
+}
+
+type refreshTokenUC struct {
+	userRepo    UserRepo
+	sessionRepo SessionRepo
+	replayRepo  DPoPReplayRepo
+	issuer      *sessionIssuer
+}
+
+func NewRefreshTokenUC(
+	userRepo UserRepo, sessionRepo SessionRepo, replayRepo DPoPReplayRepo, tokenManager TokenManager,
+) RefreshTokenUC {
+	return &refreshTokenUC{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		replayRepo:  replayRepo,
+		issuer:      &sessionIssuer{sessionRepo: sessionRepo, tokenManager: tokenManager},
+	}
+}
+
+func (r *refreshTokenUC) Execute(ctx context.Context, req *RefreshTokenReq) (*TokenPair, error) {
+	var thumbprint string
+	if req.DPoP != nil {
+		var err error
+		thumbprint, err = verifyDPoPProof(ctx, r.replayRepo, req.DPoP, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r.refresh(ctx, req.RefreshToken, "", thumbprint)
+}
+
+// refresh rotates the refresh token of a session of the client. Sessions of zenbu itself have no client.
+// A refresh token of a client is rejected for the others, as their sessions are granted other scopes.
+// thumbprint is of the DPoP key the refresh was proven with, if any.
+func (r *refreshTokenUC) refresh(ctx context.Context, refreshToken, clientID, thumbprint string) (*TokenPair, error) {
+	userID, sessionID, hash, err := domain.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := r.sessionRepo.Get(ctx, userID, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if session.IsExpired(time.Now()) {
+		return nil, errors.Join(ErrInvalidRefreshToken, r.sessionRepo.Delete(ctx, userID, sessionID))
+	}
+	if session.ClientID != clientID {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if session.IsRotatedRefreshToken(hash) {
+		return nil, r.revokeFamily(ctx, session)
+	}
+	if !session.IsCurrentRefreshToken(hash) {
+		return nil, ErrInvalidRefreshToken
+	}
+	// a session bound to a key is refreshed only with proofs of the key, so that a stolen refresh token is useless.
+	// An unbound session is bound by the first refresh with a proof, e.g. of a client which logged in without one.
+	if session.Thumbprint != "" && session.Thumbprint != thumbprint {
+		return nil, errors.Join(ErrInvalidRefreshToken, errors.New("refresh token is bound to another dpop key"))
+	}
+	session.Thumbprint = thumbprint
+
+	u, err := r.userRepo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsDisabled() {
+		return nil, ErrUserDisabled
+	}
+	// guests have no credentials to log in again by, so they are kept while they are used.
+	if u.IsGuest() {
+		session.Extend(SessionExpiresIn)
+		if u.ExtendGuest(GuestExpiresIn) {
+			if err := r.userRepo.ExtendGuest(ctx, u); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	newRefreshToken, err := session.Rotate()
+	if err != nil {
+		return nil, err
+	}
+	err = r.sessionRepo.Rotate(ctx, session, hash)
+	if errors.Is(err, ErrRefreshTokenReused) {
+		return nil, r.revokeFamily(ctx, session)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := r.issuer.accessToken(session, u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{AccessToken: accessToken, RefreshToken: newRefreshToken, DPoPBound: thumbprint != ""}, nil
+}
+
+func (r *refreshTokenUC) revokeFamily(ctx context.Context, session *domain.Session) error {
+	err := r.sessionRepo.Delete(ctx, session.UserID, session.ID)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return errors.Join(ErrRefreshTokenReused, err)
+	}
+	return ErrRefreshTokenReused
+}
+
+// sessionOf returns the session the access token of the principal was issued for.
+// Expired sessions are rejected, since the repo may return them until they are deleted by TTL.
+func sessionOf(ctx context.Context, sessionRepo SessionRepo, p *Principal) (*domain.Session, error) {
+	if p.SessionID == uuid.Nil {
+		return nil, ErrInvalidToken
+	}
+
+	session, err := sessionRepo.Get(ctx, p.UserID, p.SessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.IsExpired(time.Now()) {
+		return nil, ErrInvalidToken
+	}
+	return session, nil
+}
+
+type ListSessionsRes struct {
+	Sessions []*domain.Session
+	// CurrentSessionID is the session of the principal listing sessions.
+	CurrentSessionID uuid.UUID
+}
+
+// ListSessionsUC lists the devices where the user is logged in.
+type ListSessionsUC interface {
+	Execute(ctx context.Context, p *Principal) (*ListSessionsRes, error)
+}
+
+type listSessionsUC struct {
+	sessionRepo SessionRepo
+}
+
+func NewListSessionsUC(sessionRepo SessionRepo) ListSessionsUC {
+	return &listSessionsUC{sessionRepo: sessionRepo}
+}
+
+func (l *listSessionsUC) Execute(ctx context.Context, p *Principal) (*ListSessionsRes, error) {
+	sessions, err := l.sessionRepo.List(ctx, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListSessionsRes{Sessions: sessions, CurrentSessionID: p.SessionID}, nil
+}
+
+// RevokeSessionUC logs the user out from one of the devices.
+type RevokeSessionUC interface {
+	Execute(ctx context.Context, p *Principal, sessionID uuid.UUID) error
+}
+
+type revokeSessionUC struct {
+	sessionRepo    SessionRepo
+	revocationRepo RevocationRepo
+}
+
+func NewRevokeSessionUC(sessionRepo SessionRepo, revocationRepo RevocationRepo) RevokeSessionUC {
+	return &revokeSessionUC{sessionRepo: sessionRepo, revocationRepo: revocationRepo}
+}
+
+func (r *revokeSessionUC) Execute(ctx context.Context, p *Principal, sessionID uuid.UUID) error {
+	// sessions are looked up under the user partition, so a user can never revoke sessions of others.
+	if _, err := r.sessionRepo.Get(ctx, p.UserID, sessionID); err != nil {
+		return err
+	}
+
+	return endSession(ctx, r.sessionRepo, r.revocationRepo, p.UserID, sessionID)
+}
@@ -0,0 +1,50 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/buzzryan/zenbu/internal/user/domain"
+	"github.com/buzzryan/zenbu/internal/user/infra"
+	"github.com/buzzryan/zenbu/internal/user/usecase"
+)
+
+func TestExpiredSessionIsRejected(t *testing.T) {
+	ctx := context.Background()
+	users := newMemUserRepo()
+	sessions := newMemSessionRepo()
+	tokens := newTokenManager(t)
+	u := createUser(t, users, "alice", "correct horse battery")
+
+	newPrincipal := func(t *testing.T, expiresIn time.Duration) *usecase.Principal {
+		t.Helper()
+		session, _, err := domain.NewSession(u.ID, &domain.Device{Name: "test"}, expiresIn)
+		if err != nil {
+			t.Fatalf("failed to create session: %v", err)
+		}
+		if err := sessions.Create(ctx, session); err != nil {
+			t.Fatalf("failed to store session: %v", err)
+		}
+		return &usecase.Principal{UserID: u.ID, SessionID: session.ID}
+	}
+
+	authenticate := usecase.NewAuthenticateUC(users, sessions, tokens)
+	if _, err := authenticate.Execute(ctx, newPrincipal(t, time.Hour)); err != nil {
+		t.Fatalf("live session is rejected: %v", err)
+	}
+
+	// the session is still stored, as items expired by TTL are deleted lazily.
+	expired := newPrincipal(t, -time.Second)
+	if _, err := authenticate.Execute(ctx, expired); !errors.Is(err, usecase.ErrInvalidToken) {
+		t.Errorf("authenticate: got %v, want %v", err, usecase.ErrInvalidToken)
+	}
+
+	reauth := usecase.NewReauthenticateUC(users, sessions, infra.NewMemoryLoginAttemptRepo(), noMFARepo{}, tokens,
+		usecase.DefaultLockoutPolicy)
+	_, err := reauth.Execute(ctx, expired, &usecase.ReauthenticateReq{Password: "correct horse battery"})
+	if !errors.Is(err, usecase.ErrInvalidToken) {
+		t.Errorf("reauthenticate: got %v, want %v", err, usecase.ErrInvalidToken)
+	}
+}
@@ -5,20 +5,61 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/buzzryan/zenbu/internal/commonutil/jwkutil"
+	"github.com/buzzryan/zenbu/internal/user/domain"
 )
 
 // TokenManager is an interface for generating and parsing tokens.
 type TokenManager interface {
 	Generate(*Claims) (token string, err error)
 	Parse(token string) (*Claims, error)
+	// GenerateIDToken issues an OpenID Connect ID token, which tells an OAuth client who the user is.
+	GenerateIDToken(*IDTokenClaims) (token string, err error)
+	// JWKS returns the public keys verifying tokens, so that other services can verify tokens by themselves.
+	JWKS() (*jwkutil.Set, error)
 }
 
 type Claims struct {
-	UserID    uuid.UUID
+	// ID is the unique identifier of the token (jti). It is generated when empty.
+	ID     string
+	UserID uuid.UUID
+	// SessionID is the login session the token was issued for.
+	SessionID uuid.UUID
+	// ClientID is the OAuth client the token was issued to. It is empty for tokens of zenbu itself.
+	// Tokens issued to a client acting on its own have no UserID.
+	ClientID string
+	// Scopes are the permissions granted to the token.
+	Scopes []domain.Scope
+	// Thumbprint is of the DPoP key the token is bound to (cnf.jkt). It is empty for bearer tokens.
+	Thumbprint string
+	// AuthTime is when the user last authenticated in the session, and AuthMethods are how. (amr)
+	// Sensitive operations require the user to have authenticated recently.
+	AuthTime    time.Time
+	AuthMethods []domain.AuthMethod
+	// ActorID is the admin acting as the user by the token (act), or uuid.Nil if the user is oneself.
+	ActorID uuid.UUID
+	// IssuedAt is when the token is issued. If zero, TokenManager sets it to the time the token is generated.
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// IDTokenClaims are the claims of an ID token. (OpenID Connect Core 1.0 Section 2)
+type IDTokenClaims struct {
+	Issuer    string
+	Subject   uuid.UUID
+	Audience  string
+	Nonce     string
+	AuthTime  time.Time
 	ExpiresAt time.Time
+	// Email and EmailVerified are given only for the email scope, and Username only for the profile scope.
+	Email         string
+	EmailVerified bool
+	Username      string
 }
 
 var (
 	ErrTokenExpired = errors.New("token expired")
 	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenRevoked = errors.New("token revoked")
 )
@@ -4,27 +4,34 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"slices"
 	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/buzzryan/zenbu/internal/commonutil/jwkutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/logutil"
+	"github.com/buzzryan/zenbu/internal/commonutil/mailutil"
 	"github.com/buzzryan/zenbu/internal/commonutil/storageutil"
 	"github.com/buzzryan/zenbu/internal/user/domain"
 )
 
-const (
-	TokenExpiresIn = time.Hour * 24 * 28 // 4 weeks
-)
-
 type SignupReq struct {
 	Username string
 	Password string
+	// Email is optional. A verification mail is sent to it if given.
+	Email  string
+	Device *domain.Device
+	// Principal is of the user signing up. A guest is upgraded to a full account keeping its ID and data,
+	// while a new user is created for the others.
+	Principal *Principal
 }
 
 type SignupRes struct {
-	Token string
+	Token        string
+	RefreshToken string
 }
 
 type BasicSignupUC interface {
@@ -32,36 +39,69 @@ type BasicSignupUC interface {
 }
 
 type basicSignupUC struct {
-	userRepo     UserRepo
-	tokenManager TokenManager
+	userRepo UserRepo
+	issuer   *sessionIssuer
+	verifier *emailVerifier
 }
 
-func NewBasicSignupUC(userRepo UserRepo, manager TokenManager) BasicSignupUC {
-	return &basicSignupUC{userRepo: userRepo, tokenManager: manager}
+func NewBasicSignupUC(
+	userRepo UserRepo, sessionRepo SessionRepo, manager TokenManager,
+	verificationRepo EmailVerificationRepo, mailer mailutil.Mailer, appBaseURL string,
+) BasicSignupUC {
+	return &basicSignupUC{
+		userRepo: userRepo,
+		issuer:   &sessionIssuer{sessionRepo: sessionRepo, tokenManager: manager},
+		verifier: &emailVerifier{
+			userRepo: userRepo, verificationRepo: verificationRepo, mailer: mailer, appBaseURL: appBaseURL,
+		},
+	}
 }
 
 func (b *basicSignupUC) Execute(ctx context.Context, req *SignupReq) (*SignupRes, error) {
-	newUser := &domain.User{
-		ID:        uuid.New(),
-		Username:  req.Username,
-		Password:  domain.NewPassword(req.Password),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-	newUser, err := b.userRepo.Create(ctx, newUser)
+	password, err := domain.NewPassword(ctx, req.Password)
 	if err != nil {
 		return nil, err
 	}
 
-	token, err := b.tokenManager.Generate(&Claims{
-		UserID:    newUser.ID,
-		ExpiresAt: time.Now().Add(TokenExpiresIn),
-	})
+	newUser, err := guestOf(ctx, b.userRepo, req.Principal)
+	if err != nil {
+		return nil, err
+	}
+	if newUser != nil {
+		prevUsername := newUser.Username
+		newUser.Username = req.Username
+		newUser.Password = password
+		newUser.Email = domain.NormalizeEmail(req.Email)
+		newUser.Upgrade()
+		err = b.userRepo.UpgradeGuest(ctx, newUser, prevUsername)
+	} else {
+		newUser, err = b.userRepo.Create(ctx, &domain.User{
+			ID:        uuid.New(),
+			Username:  req.Username,
+			Password:  password,
+			Roles:     domain.DefaultRoles(),
+			Email:     domain.NormalizeEmail(req.Email),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		})
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &SignupRes{Token: token}, nil
+	// the user is already created, so failing to send the mail doesn't fail signup. It can be sent again.
+	if newUser.Email != "" {
+		if err := b.verifier.send(ctx, newUser); err != nil {
+			logutil.From(ctx).Warn("failed to send email verification", slog.Any("err", err))
+		}
+	}
+
+	tokens, err := b.issuer.start(ctx, newUser, req.Device, domain.AuthMethodPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignupRes{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
 }
 
 type AuthenticateRes struct {
@@ -71,29 +111,31 @@ type AuthenticateRes struct {
 }
 
 type AuthenticateUC interface {
-	Execute(ctx context.Context, token string) (*AuthenticateRes, error)
+	Execute(ctx context.Context, p *Principal) (*AuthenticateRes, error)
 }
 
 type authenticateUC struct {
-	userRepo UserRepo
-	manager  TokenManager
+	userRepo    UserRepo
+	sessionRepo SessionRepo
+	issuer      *sessionIssuer
 }
 
-func (a authenticateUC) Execute(ctx context.Context, token string) (*AuthenticateRes, error) {
-	claims, err := a.manager.Parse(token)
+func (a authenticateUC) Execute(ctx context.Context, p *Principal) (*AuthenticateRes, error) {
+	// a revoked session must not be able to extend its access token.
+	session, err := sessionOf(ctx, a.sessionRepo, p)
 	if err != nil {
 		return nil, err
 	}
 
-	u, err := a.userRepo.Get(ctx, claims.UserID)
+	u, err := a.userRepo.Get(ctx, p.UserID)
 	if err != nil {
 		return nil, err
 	}
+	if u.IsDisabled() {
+		return nil, ErrUserDisabled
+	}
 
-	refreshedToken, err := a.manager.Generate(&Claims{
-		UserID:    u.ID,
-		ExpiresAt: time.Now().Add(TokenExpiresIn),
-	})
+	refreshedToken, err := a.issuer.accessToken(session, u)
 	if err != nil {
 		return nil, err
 	}
@@ -101,78 +143,174 @@ func (a authenticateUC) Execute(ctx context.Context, token string) (*Authenticat
 	return &AuthenticateRes{User: u, RefreshedToken: refreshedToken}, nil
 }
 
-func NewAuthenticateUC(userRepo UserRepo, manager TokenManager) AuthenticateUC {
-	return &authenticateUC{userRepo: userRepo, manager: manager}
+func NewAuthenticateUC(userRepo UserRepo, sessionRepo SessionRepo, manager TokenManager) AuthenticateUC {
+	return &authenticateUC{
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		issuer:      &sessionIssuer{sessionRepo: sessionRepo, tokenManager: manager},
+	}
 }
 
 type BasicLoginRes struct {
-	Token string
+	Token        string
+	RefreshToken string
+	// MFAToken is set instead of the tokens if the user has enabled MFA.
+	// The login is completed by CompleteMFALoginUC with it and a code of the second factor.
+	MFAToken string
+}
+
+// BasicLoginReq identifies the user by either the username or the email address.
+type BasicLoginReq struct {
+	Username string
+	Email    string
+	Password string
+	Device   *domain.Device
 }
 
 type BasicLoginUC interface {
-	Execute(ctx context.Context, username, password string) (*BasicLoginRes, error)
+	Execute(ctx context.Context, req *BasicLoginReq) (*BasicLoginRes, error)
 }
 
 type basicLoginUC struct {
-	userRepo     UserRepo
-	tokenManager TokenManager
+	userRepo      UserRepo
+	mfaRepo       MFARepo
+	challengeRepo MFAChallengeRepo
+	issuer        *sessionIssuer
+	throttle      *loginThrottle
+	auditLog      AuditLog
 }
 
-func (b basicLoginUC) Execute(ctx context.Context, username, password string) (*BasicLoginRes, error) {
-	u, err := b.userRepo.GetByName(ctx, username)
+func (b basicLoginUC) Execute(ctx context.Context, req *BasicLoginReq) (*BasicLoginRes, error) {
+	var ip string
+	if req.Device != nil {
+		ip = req.Device.IPAddress
+	}
+
+	find := func() (*domain.User, error) { return b.userRepo.GetByName(ctx, req.Username) }
+	accountKey := usernameAttemptKey(req.Username)
+	if req.Username == "" {
+		email := domain.NormalizeEmail(req.Email)
+		find = func() (*domain.User, error) { return b.userRepo.GetByEmail(ctx, email) }
+		accountKey = emailAttemptKey(email)
+	}
+
+	if err := b.throttle.reserve(ctx, accountKey, ip); err != nil {
+		return nil, err
+	}
+
+	u, err := find()
+	if errors.Is(err, ErrUserNotFound) {
+		// unknown accounts must not be told from wrong passwords, neither by response time nor by lockout.
+		if err := domain.CompareDummyPassword(ctx, req.Password); err != nil {
+			return nil, err
+		}
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if !u.Password.Compare(password) {
+	ok, err := u.Password.Compare(ctx, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// failures of unknown accounts are not recorded, as there is no user to record them for.
+		recordAudit(ctx, b.auditLog, domain.AuditLoginFailed, u.ID, uuid.Nil,
+			map[string]string{"reason": "invalid_password", "ip_address": ip})
 		return nil, ErrInvalidPassword
 	}
+	if err := b.throttle.succeed(ctx, accountKey, ip); err != nil {
+		return nil, err
+	}
+	if u.Password.NeedsRehash() {
+		b.rehash(ctx, u, req.Password)
+	}
 
-	token, err := b.tokenManager.Generate(&Claims{
-		UserID:    u.ID,
-		ExpiresAt: time.Now().Add(TokenExpiresIn),
-	})
+	// the state of the account is revealed only to whom knows the password.
+	if u.IsDisabled() {
+		return nil, ErrUserDisabled
+	}
+	if u.PasswordResetRequired {
+		return nil, ErrPasswordResetRequired
+	}
+
+	mfaToken, err := challengeMFA(ctx, b.mfaRepo, b.challengeRepo, u)
+	if err != nil {
+		return nil, err
+	}
+	if mfaToken != "" {
+		return &BasicLoginRes{MFAToken: mfaToken}, nil
+	}
+
+	tokens, err := b.issuer.start(ctx, u, req.Device, domain.AuthMethodPassword)
 	if err != nil {
 		return nil, err
 	}
 
-	return &BasicLoginRes{Token: token}, nil
+	return &BasicLoginRes{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
 }
 
-func NewBasicLoginUC(userRepo UserRepo, manager TokenManager) BasicLoginUC {
-	return &basicLoginUC{userRepo: userRepo, tokenManager: manager}
+// rehash upgrades the password hash of the user to the current algorithm and parameters.
+// It is best-effort, as the old hash is still valid.
+func (b basicLoginUC) rehash(ctx context.Context, u *domain.User, plain string) {
+	password, err := domain.NewPassword(ctx, plain)
+	if err != nil {
+		logutil.From(ctx).Warn("failed to rehash password", slog.Any("err", err))
+		return
+	}
+
+	err = b.userRepo.UpdatePassword(ctx, u.ID, password, u.Password)
+	// if the password was changed in the meantime, the new one must be kept.
+	if err != nil && !errors.Is(err, ErrPasswordChanged) {
+		logutil.From(ctx).Warn("failed to rehash password", slog.Any("err", err))
+	}
+}
+
+func NewBasicLoginUC(
+	userRepo UserRepo, sessionRepo SessionRepo, loginAttemptRepo LoginAttemptRepo, mfaRepo MFARepo,
+	challengeRepo MFAChallengeRepo, manager TokenManager, auditLog AuditLog, lockoutPolicy LockoutPolicy,
+) BasicLoginUC {
+	return &basicLoginUC{
+		userRepo:      userRepo,
+		mfaRepo:       mfaRepo,
+		challengeRepo: challengeRepo,
+		issuer:        &sessionIssuer{sessionRepo: sessionRepo, tokenManager: manager, auditLog: auditLog},
+		throttle:      &loginThrottle{repo: loginAttemptRepo, policy: lockoutPolicy},
+		auditLog:      auditLog,
+	}
 }
 
 // CreateProfileImagUploadURLUC returns a signed URL for uploading a profile image.
 type CreateProfileImagUploadURLUC interface {
-	Execute(ctx context.Context, token string) (url string, err error)
+	Execute(ctx context.Context, p *Principal) (url string, err error)
 }
 
 type createProfileImageUploadURL struct {
-	userRepo     UserRepo
-	tokenManager TokenManager
-	storage      storageutil.Storage
+	userRepo UserRepo
+	storage  storageutil.Storage
+	auditLog AuditLog
 }
 
-func NewCreateProfileImagUploadURLUC(userRepo UserRepo, tokenManager TokenManager, storage storageutil.Storage) CreateProfileImagUploadURLUC {
-	return &createProfileImageUploadURL{userRepo: userRepo, tokenManager: tokenManager, storage: storage}
+func NewCreateProfileImagUploadURLUC(
+	userRepo UserRepo, storage storageutil.Storage, auditLog AuditLog,
+) CreateProfileImagUploadURLUC {
+	return &createProfileImageUploadURL{userRepo: userRepo, storage: storage, auditLog: auditLog}
 }
 
 func userProfileImageDir(userID uuid.UUID) string {
 	return "profiles/" + userID.String() + "/images"
 }
 
-func (c *createProfileImageUploadURL) Execute(ctx context.Context, token string) (string, error) {
-	claims, err := c.tokenManager.Parse(token)
+func (c *createProfileImageUploadURL) Execute(ctx context.Context, p *Principal) (string, error) {
+	path := userProfileImageDir(p.UserID) + "/" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	url, err := c.storage.CreateUploadURL(ctx, storageutil.Public, path)
 	if err != nil {
 		return "", err
 	}
 
-	url, err := c.storage.CreateUploadURL(ctx, storageutil.Public,
-		userProfileImageDir(claims.UserID)+"/"+strconv.FormatInt(time.Now().UnixNano(), 10))
-	if err != nil {
-		return "", err
-	}
+	recordAudit(ctx, c.auditLog, domain.AuditProfileImageUploadRequested, p.UserID, actorOf(p, p.UserID),
+		map[string]string{"path": path})
 
 	return url, nil
 }
@@ -208,21 +346,15 @@ func (g *getProfileImageURLUC) Execute(ctx context.Context, userID uuid.UUID) (s
 }
 
 type GetMeUC interface {
-	Execute(ctx context.Context, token string) (*domain.User, error)
+	Execute(ctx context.Context, p *Principal) (*domain.User, error)
 }
 
 type getMeUC struct {
-	userRepo     UserRepo
-	tokenManager TokenManager
+	userRepo UserRepo
 }
 
-func (g getMeUC) Execute(ctx context.Context, token string) (*domain.User, error) {
-	claims, err := g.tokenManager.Parse(token)
-	if err != nil {
-		return nil, err
-	}
-
-	u, err := g.userRepo.Get(ctx, claims.UserID)
+func (g getMeUC) Execute(ctx context.Context, p *Principal) (*domain.User, error) {
+	u, err := g.userRepo.Get(ctx, p.UserID)
 	if err != nil {
 		return nil, err
 	}
@@ -230,6 +362,23 @@ func (g getMeUC) Execute(ctx context.Context, token string) (*domain.User, error
 	return u, nil
 }
 
-func NewGetMeUC(userRepo UserRepo, tokenManager TokenManager) GetMeUC {
-	return &getMeUC{userRepo: userRepo, tokenManager: tokenManager}
+func NewGetMeUC(userRepo UserRepo) GetMeUC {
+	return &getMeUC{userRepo: userRepo}
+}
+
+// GetJWKSUC returns the JSON Web Key Set to verify tokens issued by zenbu.
+type GetJWKSUC interface {
+	Execute(ctx context.Context) (*jwkutil.Set, error)
+}
+
+type getJWKSUC struct {
+	tokenManager TokenManager
+}
+
+func NewGetJWKSUC(tokenManager TokenManager) GetJWKSUC {
+	return &getJWKSUC{tokenManager: tokenManager}
+}
+
+func (g *getJWKSUC) Execute(_ context.Context) (*jwkutil.Set, error) {
+	return g.tokenManager.JWKS()
 }